@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	"xiaozhi-esp32-server-golang/internal/app/server/recorder"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/vad"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 回放录制的设备会话：通过模拟连接把录制的上行信令和音频送入 ChatManager，
+// ASR/LLM/TTS 使用按录制内容生成的模拟提供者，最后对比录制和回放的下行信令
+func main() {
+	configFile := flag.String("c", "config/config.yaml", "配置文件路径")
+	recordingFile := flag.String("f", "", "录制文件路径")
+	speed := flag.Float64("speed", 1, "回放倍速")
+	tail := flag.Duration("tail", 5*time.Second, "上行数据回放完成后等待服务端处理的时间")
+	realProvider := flag.Bool("real", false, "使用配置文件中的真实ASR/LLM/TTS提供者，而不是模拟提供者")
+	logLevel := flag.String("log", "info", "日志级别")
+	flag.Parse()
+
+	if *recordingFile == "" {
+		fmt.Println("录制文件路径不能为空")
+		os.Exit(1)
+	}
+
+	log.UseStdout()
+	if level, err := logrus.ParseLevel(*logLevel); err == nil {
+		log.SetLevel(level)
+	}
+
+	recording, err := recorder.Load(*recordingFile)
+	if err != nil {
+		fmt.Printf("读取录制文件失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := initConfig(*configFile, recording, *realProvider); err != nil {
+		fmt.Printf("初始化配置失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	replayConn := recorder.NewReplayConn(recording, *speed)
+	chatManager, err := chat.NewChatManager(recording.Header.DeviceID, replayConn)
+	if err != nil {
+		fmt.Printf("创建ChatManager失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	managerDone := make(chan struct{})
+	go func() {
+		defer close(managerDone)
+		if err := chatManager.Start(); err != nil {
+			log.Errorf("ChatManager启动失败: %v", err)
+		}
+	}()
+	replayConn.Start()
+
+	select {
+	case <-replayConn.Finished():
+		// 给服务端留出处理最后一轮对话的时间
+		select {
+		case <-time.After(*tail):
+		case <-managerDone:
+		}
+	case <-managerDone:
+		log.Infof("会话在回放完成前结束")
+	}
+	chatManager.Close()
+
+	printDiff(recorder.CmdTrace(recording.Events), recorder.CmdTrace(replayConn.Outbound()))
+}
+
+// initConfig 加载配置文件，默认将 ASR/LLM/TTS 替换为按录制内容生成的模拟提供者
+func initConfig(configFile string, recording *recorder.Recording, realProvider bool) error {
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+
+	// 回放不读写线上的用户配置和对话记录，用户配置直接取自配置文件
+	viper.Set("config_provider.type", "redis")
+	viper.Set("memory.provider", "nomemo")
+	viper.Set("tts_cache.enable", false)
+
+	if !realProvider {
+		script := recorder.ExtractScript(recording)
+		log.Infof("从录制中提取到 %d 条识别结果, %d 条回复", len(script.AsrResults), len(script.LlmReplies))
+		viper.Set("asr.provider", constants.AsrTypeMock)
+		viper.Set("asr.mock", map[string]interface{}{"results": script.AsrResults})
+		viper.Set("llm.provider", constants.LlmTypeMock)
+		viper.Set("llm.mock", map[string]interface{}{"type": constants.LlmTypeMock, "replies": script.LlmReplies})
+		viper.Set("tts.provider", constants.TtsTypeMock)
+		viper.Set("tts.mock", map[string]interface{}{})
+	}
+
+	if err := vad.InitVAD(); err != nil {
+		return fmt.Errorf("初始化VAD失败: %v", err)
+	}
+	mcp.GetGlobalMCPManager()
+	return auth.Init()
+}
+
+// printDiff 逐行对比录制和回放的下行信令
+func printDiff(recorded []string, replayed []string) {
+	fmt.Printf("\n%-4s | %-50s | %s\n", "", "录制", "回放")
+	fmt.Println(strings.Repeat("-", 110))
+	mismatch := 0
+	for i := 0; i < len(recorded) || i < len(replayed); i++ {
+		var left, right string
+		if i < len(recorded) {
+			left = recorded[i]
+		}
+		if i < len(replayed) {
+			right = replayed[i]
+		}
+		mark := ""
+		if left != right {
+			mark = "!"
+			mismatch++
+		}
+		fmt.Printf("%-4s | %-50s | %s\n", mark, left, right)
+	}
+	fmt.Printf("\n录制 %d 条, 回放 %d 条, 不一致 %d 条\n", len(recorded), len(replayed), mismatch)
+}
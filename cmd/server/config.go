@@ -12,6 +12,9 @@ import (
 	"xiaozhi-esp32-server-golang/internal/app/server/auth"
 	redisdb "xiaozhi-esp32-server-golang/internal/db/redis"
 	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
+	"xiaozhi-esp32-server-golang/internal/domain/config/hotreload"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/tracing"
 	"xiaozhi-esp32-server-golang/internal/domain/vad"
 
 	log "xiaozhi-esp32-server-golang/logger"
@@ -27,6 +30,8 @@ var (
 	configUpdateTicker *time.Ticker
 	configUpdateStop   chan struct{}
 	configUpdateWg     sync.WaitGroup
+
+	configWatcher *hotreload.Watcher
 )
 
 func Init(configFile string) error {
@@ -61,6 +66,12 @@ func Init(configFile string) error {
 	//init redis
 	initRedis()
 
+	//init tracing
+	initTracing()
+
+	// 监听配置文件变化
+	startConfigWatcher(configFile)
+
 	// memory 模块采用懒加载，使用时自动初始化，无需显式初始化
 
 	//init auth
@@ -119,10 +130,99 @@ func StopPeriodicConfigUpdate() {
 	if configUpdateStop != nil {
 		close(configUpdateStop)
 		configUpdateWg.Wait()
+		configUpdateStop = nil
 		logrus.Info("周期性配置更新已停止")
 	}
 }
 
+// startConfigWatcher 启动配置文件热更新, 校验通过后生效并通知各模块:
+// VAD 调整资源池, 全局 MCP 只重连发生变化的服务器, 新会话使用新的 vad/asr/llm/tts 配置, 已有会话保持不变
+func startConfigWatcher(configFile string) {
+	if !viper.GetBool("server.hot_reload") {
+		log.Info("配置热更新已禁用")
+		return
+	}
+
+	configWatcher = hotreload.New(configFile, hotreload.WithOverlay(func(v *viper.Viper) error {
+		// 管理后台下发的系统配置优先级高于配置文件, 与启动时一致
+		configMap, err := fetchSystemConfig()
+		if err != nil || configMap == nil {
+			return err
+		}
+		return v.MergeConfigMap(configMap)
+	}))
+	configWatcher.AddValidator(validateConfig)
+
+	configWatcher.Subscribe(func(diff hotreload.Diff) {
+		logLevel, err := logrus.ParseLevel(viper.GetString("log.level"))
+		if err != nil {
+			log.Warnf("日志级别配置错误: %v", err)
+			return
+		}
+		logrus.SetLevel(logLevel)
+	}, "log.level")
+
+	configWatcher.Subscribe(func(diff hotreload.Diff) {
+		if err := vad.ReloadVAD(); err != nil {
+			log.Errorf("VAD 资源池热更新失败: %v", err)
+		}
+	}, "vad")
+
+	configWatcher.Subscribe(func(diff hotreload.Diff) {
+		if err := mcp.GetGlobalMCPManager().Reload(); err != nil {
+			log.Errorf("全局MCP热更新失败: %v", err)
+		}
+	}, "mcp.global")
+
+	configWatcher.Subscribe(func(diff hotreload.Diff) {
+		StopPeriodicConfigUpdate()
+		startPeriodicConfigUpdate()
+	}, "config_provider.update_interval", "config_provider.enable_periodic_update")
+
+	if err := configWatcher.Start(); err != nil {
+		log.Errorf("启动配置热更新失败: %v", err)
+		configWatcher = nil
+	}
+}
+
+// StopConfigWatcher 停止配置文件热更新
+func StopConfigWatcher() {
+	if configWatcher != nil {
+		configWatcher.Stop()
+	}
+}
+
+// validateConfig 校验热更新的配置, 不通过时继续使用旧配置
+func validateConfig(v *viper.Viper) error {
+	// 只校验切换后的 VAD 提供商, 未切换时沿用启动时的配置, 不影响其他配置项生效
+	if vadProvider := v.GetString("vad.provider"); vadProvider != viper.GetString("vad.provider") && !vad.IsSupportedProvider(vadProvider) {
+		return fmt.Errorf("不支持的 VAD 提供商: %q", vadProvider)
+	}
+
+	for _, section := range []string{"asr", "llm", "tts"} {
+		provider := v.GetString(section + ".provider")
+		if provider != "" && !v.IsSet(section+"."+provider) {
+			return fmt.Errorf("%s.provider 为 %s, 但缺少 %s.%s 配置", section, provider, section, provider)
+		}
+	}
+
+	var servers []mcp.MCPServerConfig
+	if err := v.UnmarshalKey("mcp.global.servers", &servers); err != nil {
+		return fmt.Errorf("解析 mcp.global.servers 失败: %v", err)
+	}
+	names := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if server.Name == "" {
+			return fmt.Errorf("mcp.global.servers 中存在未命名的服务器")
+		}
+		if names[server.Name] {
+			return fmt.Errorf("mcp.global.servers 中服务器名称重复: %s", server.Name)
+		}
+		names[server.Name] = true
+	}
+	return nil
+}
+
 func initConfig(configFile string) error {
 	viper.SetConfigFile(configFile)
 
@@ -136,6 +236,24 @@ func initConfig(configFile string) error {
 
 // updateConfigFromAPI 从接口获取配置并更新viper配置
 func updateConfigFromAPI() error {
+	configMap, err := fetchSystemConfig()
+	if err != nil {
+		return err
+	}
+	if configMap == nil {
+		return nil
+	}
+
+	// 使用viper.MergeConfigMap设置到viper
+	if err := viper.MergeConfigMap(configMap); err != nil {
+		return fmt.Errorf("合并配置到viper失败: %v", err)
+	}
+
+	return nil
+}
+
+// fetchSystemConfig 从接口获取系统配置, 未配置时返回nil
+func fetchSystemConfig() (map[string]interface{}, error) {
 	configProviderType := viper.GetString("config_provider.type")
 
 	//fmt.Printf("获取系统配置, config_provider.type: %s\n", configProviderType)
@@ -143,7 +261,7 @@ func updateConfigFromAPI() error {
 	// 从配置文件获取后端管理系统地址
 	configProvider, err := user_config.GetProvider(configProviderType)
 	if err != nil {
-		return fmt.Errorf("获取配置提供者失败: %v", err)
+		return nil, fmt.Errorf("获取配置提供者失败: %v", err)
 	}
 
 	// 创建上下文
@@ -153,25 +271,20 @@ func updateConfigFromAPI() error {
 	// 获取系统配置JSON字符串
 	configJSON, err := configProvider.GetSystemConfig(ctx)
 	if err != nil {
-		return fmt.Errorf("获取系统配置失败: %v", err)
+		return nil, fmt.Errorf("获取系统配置失败: %v", err)
 	}
 
 	if configJSON == "" {
-		return nil
+		return nil, nil
 	}
 
 	// 解析JSON为map
 	var configMap map[string]interface{}
 	if err := json.Unmarshal([]byte(configJSON), &configMap); err != nil {
-		return fmt.Errorf("解析配置JSON失败: %v", err)
-	}
-
-	// 使用viper.MergeConfigMap设置到viper
-	if err := viper.MergeConfigMap(configMap); err != nil {
-		return fmt.Errorf("合并配置到viper失败: %v", err)
+		return nil, fmt.Errorf("解析配置JSON失败: %v", err)
 	}
 
-	return nil
+	return configMap, nil
 }
 
 func initLog() error {
@@ -260,6 +373,16 @@ func initRedis() error {
 	return nil
 }
 
+func initTracing() error {
+	err := tracing.Init()
+	if err != nil {
+		// 链路追踪不影响主流程
+		log.Errorf("链路追踪初始化失败: %v", err)
+		return err
+	}
+	return nil
+}
+
 func initAuthManager() error {
 	return auth.Init()
 }
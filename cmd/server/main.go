@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -8,7 +9,9 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 	"xiaozhi-esp32-server-golang/internal/app/server"
+	"xiaozhi-esp32-server-golang/internal/domain/tracing"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/spf13/viper"
@@ -56,8 +59,30 @@ func main() {
 
 	log.Info("正在关闭服务器...")
 
-	// 停止周期性配置更新服务
+	// 等待进行中的对话结束并保存数据, 再次收到信号时立即退出
+	shutdownTimeout := time.Duration(viper.GetInt("server.shutdown_timeout")) * time.Second
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+	appCtx, appCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	go func() {
+		<-quit
+		log.Warn("再次收到退出信号, 不再等待进行中的对话")
+		appCancel()
+	}()
+	appInstance.Shutdown(appCtx)
+	appCancel()
+
+	// 停止配置热更新和周期性配置更新服务
+	StopConfigWatcher()
 	StopPeriodicConfigUpdate()
 
+	// 导出剩余的追踪数据
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := tracing.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("关闭链路追踪失败: %v", err)
+	}
+	cancel()
+
 	log.Info("服务器已关闭")
 }
@@ -7,8 +7,12 @@ const (
 )
 
 const (
-	AsrTypeFunAsr = "funasr"
-	AsrTypeDoubao = "doubao"
+	AsrTypeFunAsr     = "funasr"
+	AsrTypeDoubao     = "doubao"
+	AsrTypeSherpaOnnx = "sherpa_onnx"
+	AsrTypeOpenAI     = "openai"
+	AsrTypeFailover   = "failover" // 多个ASR后端按顺序故障转移
+	AsrTypeMock       = "mock"     // 按脚本返回识别结果，用于回放和测试
 )
 
 const (
@@ -16,6 +20,8 @@ const (
 	LlmTypeOllama  = "ollama"
 	LlmTypeEinoLLM = "eino_llm"
 	LlmTypeEino    = "eino"
+	LlmTypeMock    = "mock"   // 按脚本返回回复，用于回放和测试
+	LlmTypeRouter  = "router" // 按意图将请求分发到不同的模型
 )
 
 const (
@@ -26,4 +32,6 @@ const (
 	TtsTypeEdgeOffline = "edge_offline"
 	TtsTypeXiaozhi     = "xiaozhi"
 	TtsTypeOpenAI      = "openai"
+	TtsTypeFailover    = "failover" // 多个TTS后端按顺序故障转移
+	TtsTypeMock        = "mock"     // 输出静音音频帧，用于回放和测试
 )
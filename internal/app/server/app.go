@@ -4,15 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 	"xiaozhi-esp32-server-golang/internal/app/mqtt_server"
 	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	"xiaozhi-esp32-server-golang/internal/app/server/cluster"
 	"xiaozhi-esp32-server-golang/internal/app/server/mqtt_udp"
+	"xiaozhi-esp32-server-golang/internal/app/server/openai_api"
+	"xiaozhi-esp32-server-golang/internal/app/server/recorder"
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	"xiaozhi-esp32-server-golang/internal/app/server/webrtc"
 	"xiaozhi-esp32-server-golang/internal/app/server/websocket"
 	"xiaozhi-esp32-server-golang/internal/data/history"
 	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
 	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
+	"xiaozhi-esp32-server-golang/internal/domain/quota"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -25,6 +33,13 @@ import (
 type App struct {
 	wsServer       *websocket.WebSocketServer
 	mqttUdpAdapter *mqtt_udp.MqttUdpAdapter
+	// 集群节点, 未开启集群模式时为nil
+	cluster *cluster.Cluster
+
+	eventHandle   *EventHandle
+	historyWorker *HistoryWorker
+	// 退出中不再接受新连接
+	shuttingDown atomic.Bool
 
 	// ChatManager管理 - 使用concurrent map
 	chatManagers cmap.ConcurrentMap[string, *chat.ChatManager]
@@ -35,6 +50,13 @@ func NewApp() *App {
 	app := &App{
 		chatManagers: cmap.New[*chat.ChatManager](),
 	}
+	if viper.GetBool("cluster.enable") {
+		app.cluster, err = cluster.New(cluster.LoadConfig(), cluster.WithHandoff(app.handoffDevice))
+		if err != nil {
+			log.Errorf("创建集群节点失败: %+v", err)
+			return nil
+		}
+	}
 	app.wsServer = app.newWebSocketServer()
 	app.mqttUdpAdapter, err = app.newMqttUdpAdapter()
 	if err != nil {
@@ -45,6 +67,12 @@ func NewApp() *App {
 }
 
 func (a *App) Run() {
+	if a.cluster != nil {
+		if err := a.cluster.Start(); err != nil {
+			log.Fatalf("启动集群节点失败: %+v", err)
+		}
+		a.registerClusterHandler()
+	}
 	go a.wsServer.Start()
 	if viper.GetBool("mqtt_server.enable") {
 		go func() {
@@ -66,7 +94,67 @@ func (a *App) Run() {
 
 	a.initEventHandle()
 
-	select {} // 阻塞主线程
+	a.startReminderScheduler()
+
+	metrics.RegisterGaugeFunc("active_chat_managers", "当前活跃的ChatManager数量", func() float64 {
+		return float64(a.GetChatManagerCount())
+	})
+}
+
+// Shutdown 优雅退出, 用于滚动发布:
+// 停止接受新连接 -> 等待进行中的对话播放完成(最长到 ctx 结束), MQTT 设备发送 goodbye ->
+// 等待历史记录和长期记忆写入完成 -> 断开 MQTT 并注销集群节点
+func (a *App) Shutdown(ctx context.Context) {
+	a.shuttingDown.Store(true)
+	log.Infof("开始优雅退出, 当前 %d 个设备在线", a.GetChatManagerCount())
+
+	if a.mqttUdpAdapter != nil {
+		a.mqttUdpAdapter.StopAccept()
+	}
+	// 停止监听后还要等待进行中的HTTP请求(如 /v1/chat/completions), 与关闭设备会话并行
+	wsDone := make(chan struct{})
+	go func() {
+		defer close(wsDone)
+		if err := a.wsServer.Shutdown(ctx); err != nil {
+			log.Warnf("关闭 WebSocket 服务失败: %v", err)
+		}
+	}()
+
+	if a.cluster != nil {
+		// 标记节点下线, 其它节点接管本节点设备的后续连接
+		a.cluster.Drain(ctx)
+	}
+
+	var wg sync.WaitGroup
+	for deviceID, chatManager := range a.GetAllChatManagers() {
+		wg.Add(1)
+		go func(deviceID string, chatManager *chat.ChatManager) {
+			defer wg.Done()
+			chatManager.Shutdown(ctx)
+			log.Infof("设备 %s 的ChatManager已关闭", deviceID)
+		}(deviceID, chatManager)
+	}
+	wg.Wait()
+	<-wsDone
+
+	if a.eventHandle != nil {
+		if err := a.eventHandle.Flush(ctx); err != nil {
+			log.Warnf("记忆写入未全部完成: %v", err)
+		}
+	}
+	if a.historyWorker != nil {
+		if err := a.historyWorker.Flush(ctx); err != nil {
+			log.Warnf("等待聊天历史保存完成超时: %v", err)
+		}
+	}
+
+	if a.mqttUdpAdapter != nil {
+		a.mqttUdpAdapter.Stop()
+	}
+	if a.cluster != nil {
+		a.cluster.Stop()
+	}
+	log.Info("优雅退出完成")
 }
 
 func (app *App) initEventHandle() {
@@ -79,6 +167,7 @@ func (app *App) initEventHandle() {
 		log.Errorf("启动 EventHandle 失败: %v", err)
 		return
 	}
+	app.eventHandle = eventHandle
 
 	// 初始化聊天历史记录处理器（总是启用）
 	historyCfg := history.HistoryClientConfig{
@@ -87,7 +176,7 @@ func (app *App) initEventHandle() {
 		Timeout:   viper.GetDuration("manager.history_timeout"),
 		Enabled:   true, // 总是启用
 	}
-	NewHistoryWorker(historyCfg)
+	app.historyWorker = NewHistoryWorker(historyCfg)
 	log.Info("聊天历史记录处理器已初始化")
 }
 
@@ -114,6 +203,7 @@ func (app *App) newMqttUdpAdapter() (*mqtt_udp.MqttUdpAdapter, error) {
 		&mqttConfig,
 		mqtt_udp.WithUdpServer(udpServer),
 		mqtt_udp.WithOnNewConnection(app.OnNewConnection),
+		mqtt_udp.WithDeviceClaimer(app.claimDevice),
 	), nil
 }
 
@@ -133,7 +223,27 @@ func (app *App) newUdpServer() (*mqtt_udp.UdpServer, error) {
 
 func (app *App) newWebSocketServer() *websocket.WebSocketServer {
 	port := viper.GetInt("websocket.port")
-	return websocket.NewWebSocketServer(port, websocket.WithOnNewConnection(app.OnNewConnection))
+	opts := []websocket.WebSocketServerOption{websocket.WithOnNewConnection(app.OnNewConnection)}
+	if viper.GetBool("webrtc.enable") {
+		webrtcServer, err := webrtc.NewWebRTCServer(webrtc.WithOnNewConnection(app.OnNewConnection))
+		if err != nil {
+			log.Errorf("创建 WebRTC 服务失败: %v", err)
+		} else {
+			opts = append(opts, websocket.WithWebRTCServer(webrtcServer))
+		}
+	}
+	if viper.GetBool("openai_api.enable") {
+		chatCompletionsServer, err := openai_api.NewChatCompletionsServer()
+		if err != nil {
+			log.Errorf("创建 OpenAI 兼容接口失败: %v", err)
+		} else {
+			opts = append(opts, websocket.WithChatCompletionsServer(chatCompletionsServer))
+		}
+	}
+	if app.cluster != nil {
+		opts = append(opts, websocket.WithCluster(app.cluster))
+	}
+	return websocket.NewWebSocketServer(port, opts...)
 }
 
 func (app *App) startMqttServer() error {
@@ -144,6 +254,19 @@ func (app *App) startMqttServer() error {
 func (a *App) OnNewConnection(transport types.IConn) {
 	deviceID := transport.GetDeviceID()
 
+	if a.shuttingDown.Load() {
+		log.Warnf("服务正在退出, 拒绝设备 %s 的连接", deviceID)
+		transport.Close()
+		return
+	}
+	if a.cluster != nil && !a.takeDevice(deviceID) {
+		transport.Close()
+		return
+	}
+
+	// 按配置录制会话，用于离线回放排查问题
+	transport = recorder.Wrap(transport)
+
 	// 检查是否已存在该设备的ChatManager
 	if existingManager, exists := a.chatManagers.Get(deviceID); exists {
 		log.Infof("设备 %s 已存在ChatManager，先关闭旧的连接", deviceID)
@@ -173,6 +296,9 @@ func (a *App) OnNewConnection(transport types.IConn) {
 			if storedManager, exists := a.chatManagers.Get(deviceID); exists && storedManager == chatManager {
 				a.chatManagers.Remove(deviceID)
 				log.Infof("设备 %s 的ChatManager已从映射中移除", deviceID)
+				if a.cluster != nil {
+					a.cluster.ReleaseDevice(context.Background(), deviceID)
+				}
 				a.DeviceOffline(deviceID)
 			}
 		}()
@@ -268,6 +394,7 @@ func (a *App) registerHandler() {
 		return
 	}
 	provider.RegisterMessageEventHandler(context.Background(), config_types.EventHandleMessageInject, a.HandleInjectMsg)
+	provider.RegisterMessageEventHandler(context.Background(), config_types.EventHandleQuotaUsage, a.HandleQuotaUsage)
 }
 
 // 向客户端注入消息
@@ -298,6 +425,11 @@ func (a *App) HandleInjectMsg(ctx context.Context, eventType string, eventData m
 	// 获取指定设备的ChatManager
 	chatManager, exists := a.GetChatManager(msg.DeviceId)
 	if !exists {
+		// 集群模式下管理后台会把注入请求广播给所有节点, 由设备所在的节点处理
+		if owner := a.deviceOwner(ctx, msg.DeviceId); owner != "" {
+			log.Debugf("HandleInjectMsg: device %s is on node %s, skip", msg.DeviceId, owner)
+			return fmt.Sprintf("device is handled by node %s", owner), nil
+		}
 		log.Errorf("HandleInjectMsg: device %s not found or offline", msg.DeviceId)
 		return "", fmt.Errorf("device %s not found or offline", msg.DeviceId)
 	}
@@ -314,3 +446,27 @@ func (a *App) HandleInjectMsg(ctx context.Context, eventType string, eventData m
 
 	return "message injected successfully", nil
 }
+
+// HandleQuotaUsage 查询设备、智能体、用户当前的配额用量, 计数在 Redis 中, 任一节点都可以处理
+func (a *App) HandleQuotaUsage(ctx context.Context, eventType string, eventData map[string]interface{}) (string, error) {
+	bodyBytes, _ := json.Marshal(eventData)
+	var subject quota.Subject
+	if err := json.Unmarshal(bodyBytes, &subject); err != nil {
+		log.Errorf("HandleQuotaUsage error: %+v", err)
+		return "", fmt.Errorf("HandleQuotaUsage error")
+	}
+	if subject.DeviceID == "" && subject.AgentID == "" && subject.UserID == "" {
+		return "", fmt.Errorf("device_id, agent_id or user_id is required")
+	}
+
+	usages, err := quota.Get().Usage(ctx, subject)
+	if err != nil {
+		log.Errorf("HandleQuotaUsage: failed to get usage: %v", err)
+		return "", fmt.Errorf("failed to get quota usage: %v", err)
+	}
+	result, _ := json.Marshal(map[string]interface{}{
+		"enable": quota.LoadConfig().Enable,
+		"usages": usages,
+	})
+	return string(result), nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/cluster"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+type clusterInjectRequest struct {
+	DeviceID string `json:"device_id"`
+	Message  string `json:"message"`
+	SkipLlm  bool   `json:"skip_llm"`
+}
+
+type clusterDeviceRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+// registerClusterHandler 注册其它节点发来的调用
+func (a *App) registerClusterHandler() {
+	a.cluster.Handle(cluster.MethodInjectMessage, func(ctx context.Context, data json.RawMessage) (interface{}, error) {
+		var req clusterInjectRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		chatManager, exists := a.GetChatManager(req.DeviceID)
+		if !exists {
+			return nil, fmt.Errorf("device %s not found or offline", req.DeviceID)
+		}
+		return nil, chatManager.InjectMessage(req.Message, req.SkipLlm)
+	})
+
+	// 设备重连到了其它节点, 关闭本节点上残留的会话
+	a.cluster.Handle(cluster.MethodKickDevice, func(ctx context.Context, data json.RawMessage) (interface{}, error) {
+		var req clusterDeviceRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		if a.CloseChatManager(req.DeviceID) {
+			log.Infof("设备 %s 已连接到其它节点, 关闭本节点的会话", req.DeviceID)
+		}
+		a.cluster.ReleaseDevice(ctx, req.DeviceID)
+		return nil, nil
+	})
+
+	mcp.SetRemoteToolsProvider(a.cluster.RemoteMcpTools)
+}
+
+// claimDevice MQTT 设备在本节点没有会话时认领, 认领失败时由其它节点处理
+func (a *App) claimDevice(deviceID string) bool {
+	if a.cluster == nil {
+		return true
+	}
+	owner, err := a.cluster.ClaimDevice(context.Background(), deviceID)
+	if err != nil {
+		// 所有节点都会收到 MQTT 消息, 无法确认归属时不处理, 避免多个节点同时响应
+		log.Errorf("认领设备 %s 失败: %v", deviceID, err)
+		return false
+	}
+	return owner == a.cluster.NodeID()
+}
+
+// takeDevice 设备直接连接到本节点, 强制认领并通知之前的节点关闭残留会话
+func (a *App) takeDevice(deviceID string) bool {
+	if a.cluster.IsDraining() {
+		log.Warnf("节点 %s 正在下线, 拒绝设备 %s 的连接", a.cluster.NodeID(), deviceID)
+		return false
+	}
+	prevOwner, err := a.cluster.TakeDevice(context.Background(), deviceID)
+	if err != nil {
+		// 无法记录归属时其它节点可能同时持有该设备, 拒绝连接由设备重连
+		log.Errorf("认领设备 %s 失败, 拒绝连接: %v", deviceID, err)
+		return false
+	}
+	if prevOwner != "" && prevOwner != a.cluster.NodeID() {
+		go func() {
+			err := a.cluster.Call(context.Background(), prevOwner, cluster.MethodKickDevice, clusterDeviceRequest{DeviceID: deviceID}, nil)
+			if err != nil {
+				log.Warnf("通知节点 %s 关闭设备 %s 的会话失败: %v", prevOwner, deviceID, err)
+			}
+		}()
+	}
+	return true
+}
+
+// deviceOwner 设备所在的其它节点, 不在集群模式或设备不在其它节点上时返回空
+func (a *App) deviceOwner(ctx context.Context, deviceID string) string {
+	if a.cluster == nil {
+		return ""
+	}
+	owner, err := a.cluster.DeviceOwner(ctx, deviceID)
+	if err != nil {
+		log.Errorf("获取设备 %s 所在节点失败: %v", deviceID, err)
+		return ""
+	}
+	if owner == a.cluster.NodeID() {
+		return ""
+	}
+	return owner
+}
+
+// handoffDevice 节点下线时交出设备, 等进行中的对话结束后关闭会话
+func (a *App) handoffDevice(ctx context.Context, deviceID string) {
+	chatManager, exists := a.GetChatManager(deviceID)
+	if !exists {
+		a.cluster.ReleaseDevice(ctx, deviceID)
+		return
+	}
+	log.Infof("节点下线, 交出设备 %s", deviceID)
+	go chatManager.Shutdown(ctx)
+}
+
+// InjectMessage 向设备注入消息, 集群模式下设备不在本节点时转发到设备所在的节点
+func (a *App) InjectMessage(ctx context.Context, deviceID string, message string, skipLlm bool) error {
+	if chatManager, exists := a.GetChatManager(deviceID); exists {
+		return chatManager.InjectMessage(message, skipLlm)
+	}
+	owner := a.deviceOwner(ctx, deviceID)
+	if owner == "" {
+		return fmt.Errorf("device %s not found or offline", deviceID)
+	}
+	log.Debugf("设备 %s 在节点 %s 上, 转发注入消息", deviceID, owner)
+	return a.cluster.Call(ctx, owner, cluster.MethodInjectMessage, clusterInjectRequest{
+		DeviceID: deviceID,
+		Message:  message,
+		SkipLlm:  skipLlm,
+	}, nil)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/viper"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	"xiaozhi-esp32-server-golang/internal/domain/reminder"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 每次领取的到期提醒数
+const reminderBatchSize = 100
+
+// startReminderScheduler 定时检查到期的提醒并播报, 多个节点同时检查, 每条提醒只会被一个节点领取
+func (a *App) startReminderScheduler() {
+	manager := reminder.Get()
+	if !manager.Available() {
+		log.Warnf("Redis 不可用, 定时提醒未启动")
+		return
+	}
+	eventbus.Get().Subscribe(eventbus.TopicSessionStart, func(clientState *ClientState) {
+		if clientState == nil {
+			return
+		}
+		go a.deliverPendingReminders(clientState.DeviceID)
+	})
+
+	interval := time.Duration(viper.GetInt("reminder.poll_interval")) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			// 退出中不再领取, 由其它节点播报
+			if a.shuttingDown.Load() {
+				return
+			}
+			a.checkDueReminders(manager)
+		}
+	}()
+	log.Infof("定时提醒已启动, 检查间隔: %s", interval)
+}
+
+func (a *App) checkDueReminders(manager *reminder.Manager) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	due, err := manager.TakeDue(ctx, reminderBatchSize)
+	if err != nil {
+		log.Errorf("读取到期提醒失败: %v", err)
+		return
+	}
+	for _, r := range due {
+		a.deliverReminder(ctx, manager, r)
+	}
+}
+
+// deliverReminder 通过注入消息让设备播报提醒, 设备不在线时保存到下次连接时播报, MQTT 设备同时发送 alert 唤醒
+// 服务停机期间到期、恢复后才领取的提醒已经过时, 不再播报; 重复提醒领取时已更新为下一次
+func (a *App) deliverReminder(ctx context.Context, manager *reminder.Manager, r reminder.Reminder) {
+	if manager.Late(r) {
+		log.Warnf("设备 %s 的提醒 %s 已过期, 到期时间 %s, 不再播报: %s", r.DeviceID, r.ID, r.NextAt.Format("2006-01-02 15:04:05"), r.Message)
+		return
+	}
+	err := a.InjectMessage(ctx, r.DeviceID, r.Message, true)
+	if err == nil {
+		log.Infof("设备 %s 播报提醒 %s: %s", r.DeviceID, r.ID, r.Message)
+		return
+	}
+	log.Infof("设备 %s 不在线, 提醒 %s 将在下次连接时播报: %v", r.DeviceID, r.ID, err)
+	if err := manager.AddPending(ctx, r); err != nil {
+		log.Errorf("保存设备 %s 的离线提醒失败: %v", r.DeviceID, err)
+	}
+	if a.mqttUdpAdapter != nil && a.mqttUdpAdapter.WakeDevice(r.DeviceID, r.Message) {
+		log.Infof("已向设备 %s 发送提醒 alert", r.DeviceID)
+	}
+}
+
+// deliverPendingReminders 设备 hello 完成后播报离线期间到期的提醒
+func (a *App) deliverPendingReminders(deviceID string) {
+	// 等待设备打开音频通道
+	delay := time.Duration(viper.GetInt("reminder.pending_delay_ms")) * time.Millisecond
+	if delay <= 0 {
+		delay = 1500 * time.Millisecond
+	}
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	manager := reminder.Get()
+	pending, err := manager.TakePending(ctx, deviceID)
+	if err != nil {
+		log.Errorf("读取设备 %s 的离线提醒失败: %v", deviceID, err)
+		return
+	}
+	for i, r := range pending {
+		if err := a.InjectMessage(ctx, deviceID, r.Message, true); err != nil {
+			log.Warnf("设备 %s 播报离线提醒失败, 下次连接时重试: %v", deviceID, err)
+			for _, rest := range pending[i:] {
+				manager.AddPending(ctx, rest)
+			}
+			return
+		}
+		log.Infof("设备 %s 播报离线提醒 %s: %s", deviceID, r.ID, r.Message)
+	}
+}
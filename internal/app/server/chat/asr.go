@@ -3,9 +3,11 @@ package chat
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	"xiaozhi-esp32-server-golang/internal/domain/audio"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/spf13/viper"
@@ -17,6 +19,9 @@ type ASRManager struct {
 	clientState     *ClientState
 	serverTransport *ServerTransport
 	session         *ChatSession // 用于访问 speakerManager
+
+	// VAD音频处理协程, 会话关闭后 Wait 等待其退出
+	wg sync.WaitGroup
 }
 
 func NewASRManager(clientState *ClientState, serverTransport *ServerTransport, opts ...ASRManagerOption) *ASRManager {
@@ -34,7 +39,9 @@ func NewASRManager(clientState *ClientState, serverTransport *ServerTransport, o
 // ProcessVadAudio 启动VAD音频处理
 func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 	state := a.clientState
+	a.wg.Add(1)
 	go func() {
+		defer a.wg.Done()
 		hasTriggeredCancel := true // 标志位，记录是否已触发过取消操作（当 voiceDuration > 120 时）
 		audioFormat := state.InputAudioFormat
 		audioProcesser, err := audio.GetAudioProcesser(audioFormat.SampleRate, audioFormat.Channels, audioFormat.FrameDuration)
@@ -49,6 +56,9 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 			vadNeedGetCount = 60 / audioFormat.FrameDuration
 		}
 
+		bargeIn := newBargeInDetector()
+		defer bargeIn.release()
+
 		for {
 			pcmFrame := make([]float32, frameSize)
 
@@ -71,6 +81,17 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 
 				if state.GetClientVoiceStop() { //已停止 说话 则不接收音频数据
 					//log.Infof("客户端停止说话, 跳过音频数据")
+					// TTS播放期间继续检测用户是否插话
+					if bargeIn.enable && state.IsTtsPlaying() && state.ListenMode != "manual" && a.session != nil {
+						n, err := audioProcesser.DecoderFloat32(opusFrame, pcmFrame)
+						if err != nil {
+							log.Errorf("解码失败: %v", err)
+							continue
+						}
+						if bargeIn.detect(state, pcmFrame[:n], audioFormat.FrameDuration) {
+							a.session.OnBargeIn(bargeIn.takeSpeech())
+						}
+					}
 					continue
 				}
 
@@ -117,6 +138,9 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 							//首次检测到语音时，最多只保留200ms的前静音数据
 							allData := state.AsrAudioBuffer.GetAndClearAllData()
 							pcmData = allData
+							if a.session != nil {
+								a.session.turnTrace.startVad(state.DeviceConfig.Vad.Provider)
+							}
 						}
 					}
 					//log.Debugf("isVad, pcmData len: %d, vadPcmData len: %d, haveVoice: %v", len(pcmData), len(vadPcmData), haveVoice)
@@ -210,6 +234,9 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 					if state.IsSilence(idleDuration) { //从有声音到 静默的判断
 						// 在 OnVoiceSilence 之前重置标志位，以便下次可以再次触发
 						hasTriggeredCancel = false
+						if a.session != nil {
+							a.session.turnTrace.endVad()
+						}
 						state.OnVoiceSilence()
 						state.VoiceStatus.Reset()
 						continue
@@ -252,6 +279,7 @@ func (a *ASRManager) RestartAsrRecognition(ctx context.Context) error {
 	asrResultChannel, err := state.AsrProvider.StreamingRecognize(state.Asr.Ctx, state.Asr.AsrAudioChannel)
 	if err != nil {
 		log.Errorf("重启ASR流式识别失败: %v", err)
+		metrics.IncProviderError(metrics.ComponentAsr, state.DeviceConfig.Asr.Provider)
 		return fmt.Errorf("重启ASR流式识别失败: %v", err)
 	}
 
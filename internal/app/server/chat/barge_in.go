@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"math"
+	"time"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+// bargeInListenGuard 插话打断后的这段时间内忽略设备发来的 listen start, 单位: ms
+const bargeInListenGuard = 2000
+
+// bargeInDetector 在TTS播放期间继续检测设备上行音频，用户持续说话时触发打断
+// 设备没有回声消除或回声消除未收敛时，播放的声音会被麦克风采到，
+// 通过能量阈值、持续时长和TTS开始后的回声保护时间来避免误打断
+type bargeInDetector struct {
+	enable           bool
+	minEnergy        float64 // 帧能量(RMS)阈值, pcm 取值范围 -1~1
+	minVoiceDuration int64   // 持续检测到语音超过该时长才打断, 单位: ms
+	echoGuard        int64   // TTS开始后的回声保护时间, 期间不检测, 单位: ms
+	useVad           bool    // 能量达标后是否再用VAD确认
+
+	// 插话检测单独使用的VAD实例, 不影响会话拾音时的VAD状态
+	vad Vad
+
+	ttsStartTime  int64     // 当前检测对应的TTS开始时间, 变化时重置检测状态
+	voiceDuration int64     // 已持续检测到语音的时长
+	speech        []float32 // 检测期间的语音, 打断后补给新一轮ASR, 避免丢失句首
+}
+
+// newBargeInDetector 从 chat.barge_in 读取配置
+func newBargeInDetector() *bargeInDetector {
+	d := &bargeInDetector{
+		enable:           viper.GetBool("chat.barge_in.enable"),
+		minEnergy:        viper.GetFloat64("chat.barge_in.min_energy"),
+		minVoiceDuration: viper.GetInt64("chat.barge_in.min_voice_duration"),
+		echoGuard:        viper.GetInt64("chat.barge_in.echo_guard_duration"),
+		useVad:           true,
+	}
+	if viper.IsSet("chat.barge_in.use_vad") {
+		d.useVad = viper.GetBool("chat.barge_in.use_vad")
+	}
+	if d.minEnergy <= 0 {
+		d.minEnergy = 0.02
+	}
+	if d.minVoiceDuration <= 0 {
+		d.minVoiceDuration = 300
+	}
+	if d.echoGuard < 0 {
+		d.echoGuard = 0
+	}
+	return d
+}
+
+func (d *bargeInDetector) reset() {
+	d.voiceDuration = 0
+	d.speech = nil
+}
+
+// detect 检测一帧pcm数据，返回是否应该打断
+func (d *bargeInDetector) detect(state *ClientState, pcmData []float32, frameDuration int) bool {
+	ttsStartTime := state.GetTtsStartTime()
+	if d.ttsStartTime != ttsStartTime {
+		d.ttsStartTime = ttsStartTime
+		d.reset()
+		// 新一轮TTS开始时重置VAD状态, 同一轮内连续检测
+		if d.vad.VadProvider != nil {
+			d.vad.ResetVad()
+		}
+	}
+	if time.Now().UnixMilli()-ttsStartTime < d.echoGuard {
+		return false
+	}
+
+	haveVoice := pcmEnergy(pcmData) >= d.minEnergy
+	if haveVoice && d.useVad {
+		if d.vad.VadProvider == nil {
+			if err := d.vad.Init(state.DeviceConfig.Vad.Provider, state.DeviceConfig.Vad.Config); err != nil {
+				log.Errorf("插话检测初始化vad失败: %v", err)
+				return false
+			}
+		}
+		var err error
+		haveVoice, err = d.vad.IsVADExt(pcmData, state.InputAudioFormat.SampleRate, len(pcmData))
+		if err != nil {
+			log.Errorf("插话检测vad失败: %v", err)
+			return false
+		}
+	}
+
+	if !haveVoice {
+		d.reset()
+		return false
+	}
+	d.voiceDuration += int64(frameDuration)
+	d.speech = append(d.speech, pcmData...)
+	return d.voiceDuration >= d.minVoiceDuration
+}
+
+// release 释放插话检测使用的VAD实例
+func (d *bargeInDetector) release() {
+	d.vad.Reset()
+}
+
+// takeSpeech 取出检测期间的语音并重置检测状态
+func (d *bargeInDetector) takeSpeech() ([]float32, int64) {
+	speech, duration := d.speech, d.voiceDuration
+	d.reset()
+	return speech, duration
+}
+
+// isRecentBargeIn 是否刚刚发生过插话打断
+func (s *ChatSession) isRecentBargeIn() bool {
+	return time.Now().UnixMilli()-s.lastBargeInTime.Load() < bargeInListenGuard
+}
+
+// pcmEnergy 计算pcm数据的均方根能量
+func pcmEnergy(pcmData []float32) float64 {
+	if len(pcmData) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, sample := range pcmData {
+		sum += float64(sample) * float64(sample)
+	}
+	return math.Sqrt(sum / float64(len(pcmData)))
+}
+
+// OnBargeIn TTS播放期间检测到用户插话: 停止播放并取消本轮LLM/TTS,
+// 保存已经播放的部分回复, 然后开始新一轮拾音
+func (s *ChatSession) OnBargeIn(speech []float32, voiceDuration int64) {
+	state := s.clientState
+	spokenText := s.ttsManager.GetSpokenText()
+	log.Infof("设备 %s 检测到用户插话, 打断TTS播放, 已播放: %s", state.DeviceID, spokenText)
+	metrics.IncBargeIn()
+	s.lastBargeInTime.Store(time.Now().UnixMilli())
+
+	state.AfterAsrSessionCtx.Cancel()
+	s.StopSpeaking(true)
+	s.llmManager.SaveInterruptedReply(state.Ctx, spokenText)
+
+	state.SetStatus(ClientStatusListening)
+	if err := s.OnListenStart(); err != nil {
+		log.Errorf("插话后开始新一轮拾音失败: %v", err)
+		return
+	}
+
+	// 插话检测期间的语音已经确认是用户说话, 直接送入新一轮ASR
+	state.SetClientHaveVoice(true)
+	state.SetClientHaveVoiceLastTime(time.Now().UnixMilli())
+	state.Vad.AddVoiceDuration(voiceDuration)
+	if len(speech) > 0 {
+		state.Asr.AddAudioData(speech)
+	}
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+)
+
+func tonePcm(amplitude float64, samples int) []float32 {
+	pcm := make([]float32, samples)
+	for i := range pcm {
+		pcm[i] = float32(amplitude * math.Sin(2*math.Pi*440*float64(i)/16000))
+	}
+	return pcm
+}
+
+// fakeVad 按 voice 返回检测结果，记录调用和重置次数
+type fakeVad struct {
+	voice  bool
+	calls  int
+	resets int
+}
+
+func (v *fakeVad) IsVAD(pcmData []float32) (bool, error) {
+	return v.IsVADExt(pcmData, 16000, len(pcmData))
+}
+
+func (v *fakeVad) IsVADExt(pcmData []float32, sampleRate int, frameSize int) (bool, error) {
+	v.calls++
+	return v.voice, nil
+}
+
+func (v *fakeVad) Reset() error {
+	v.resets++
+	return nil
+}
+
+func (v *fakeVad) Close() error {
+	return nil
+}
+
+func TestBargeInDetector(t *testing.T) {
+	d := &bargeInDetector{
+		enable:           true,
+		minEnergy:        0.02,
+		minVoiceDuration: 180,
+		echoGuard:        50,
+	}
+	state := &ClientState{}
+	state.SetTtsPlaying(true)
+
+	loud := tonePcm(0.5, 960)
+	quiet := tonePcm(0.001, 960)
+
+	// 回声保护时间内不检测
+	if d.detect(state, loud, 60) || d.voiceDuration != 0 {
+		t.Fatalf("回声保护时间内不应检测")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if d.detect(state, loud, 60) || d.detect(state, loud, 60) {
+		t.Fatalf("语音时长不足时不应打断")
+	}
+	// 中间出现静音时重新计时
+	if d.detect(state, quiet, 60) || d.voiceDuration != 0 {
+		t.Fatalf("静音时应重置语音时长")
+	}
+	for i := 0; i < 2; i++ {
+		if d.detect(state, loud, 60) {
+			t.Fatalf("第 %d 帧不应打断", i)
+		}
+	}
+	if !d.detect(state, loud, 60) {
+		t.Fatalf("持续语音达到阈值时应打断")
+	}
+	speech, duration := d.takeSpeech()
+	if len(speech) != 3*960 || duration != 180 {
+		t.Errorf("打断时的语音错误: %d, %d", len(speech), duration)
+	}
+
+	// 新一轮TTS开始时重置状态
+	d.detect(state, loud, 60)
+	time.Sleep(2 * time.Millisecond)
+	state.SetTtsPlaying(true)
+	d.detect(state, loud, 60)
+	if d.voiceDuration != 0 {
+		t.Errorf("新一轮TTS开始时应重置检测状态")
+	}
+}
+
+// TestBargeInDetectorVad 能量达标后由插话检测自己的VAD确认，不使用也不重置会话的VAD
+func TestBargeInDetectorVad(t *testing.T) {
+	detectorVad := &fakeVad{}
+	sessionVad := &fakeVad{voice: true}
+	d := &bargeInDetector{
+		enable:           true,
+		minEnergy:        0.02,
+		minVoiceDuration: 120,
+		useVad:           true,
+	}
+	d.vad.VadProvider = detectorVad
+	state := &ClientState{}
+	state.Vad.VadProvider = sessionVad
+	state.SetTtsPlaying(true)
+
+	loud := tonePcm(0.5, 960)
+	quiet := tonePcm(0.001, 960)
+
+	// 能量达标但VAD认为不是人声(如音乐、回声)时不计时
+	for i := 0; i < 3; i++ {
+		if d.detect(state, loud, 60) || d.voiceDuration != 0 {
+			t.Fatalf("VAD未检测到语音时不应计时")
+		}
+	}
+	// 能量不足时不调用VAD
+	d.detect(state, quiet, 60)
+	if detectorVad.calls != 3 {
+		t.Fatalf("能量不足时不应调用VAD, 调用次数: %d", detectorVad.calls)
+	}
+
+	detectorVad.voice = true
+	if d.detect(state, loud, 60) {
+		t.Fatalf("语音时长不足时不应打断")
+	}
+	if !d.detect(state, loud, 60) {
+		t.Fatalf("VAD确认的语音达到阈值时应打断")
+	}
+	// 同一轮TTS内不逐帧重置VAD, 只在新一轮开始时重置一次
+	if detectorVad.resets != 1 {
+		t.Errorf("VAD重置次数错误: %d", detectorVad.resets)
+	}
+	if sessionVad.calls != 0 || sessionVad.resets != 0 {
+		t.Errorf("插话检测不应使用会话的VAD: %+v", sessionVad)
+	}
+}
@@ -23,10 +23,23 @@ type ChatManager struct {
 	session     *ChatSession
 	ctx         context.Context
 	cancel      context.CancelFunc
+
+	sessionOpts []ChatSessionOption
+
+	// 节点下线交出设备和退出时都会调用 Shutdown, 只执行一次
+	shutdownOnce sync.Once
+	shutdownErr  error
 }
 
 type ChatManagerOption func(*ChatManager)
 
+// WithSessionOptions 设置创建 ChatSession 时的选项
+func WithSessionOptions(opts ...ChatSessionOption) ChatManagerOption {
+	return func(cm *ChatManager) {
+		cm.sessionOpts = append(cm.sessionOpts, opts...)
+	}
+}
+
 func NewChatManager(deviceID string, transport types_conn.IConn, options ...ChatManagerOption) (*ChatManager, error) {
 
 	cm := &ChatManager{
@@ -59,6 +72,7 @@ func NewChatManager(deviceID string, transport types_conn.IConn, options ...Chat
 	cm.session = NewChatSession(
 		clientState,
 		serverTransport,
+		cm.sessionOpts...,
 	)
 
 	return cm, nil
@@ -159,6 +173,26 @@ func (c *ChatManager) Close() error {
 	return nil
 }
 
+// Shutdown 优雅关闭: 不再接受新的对话, 等待进行中的对话播放完成(最长到 ctx 结束)后关闭会话,
+// 关闭时 MQTT 设备会收到 goodbye, 下次唤醒时重新 hello(集群模式下由其它节点认领)
+// 重复调用时等待第一次调用完成
+func (c *ChatManager) Shutdown(ctx context.Context) error {
+	c.shutdownOnce.Do(func() {
+		if c.session != nil && !c.session.Drain(ctx) {
+			log.Warnf("设备 %s 的对话未在限定时间内结束, 强制关闭", c.DeviceID)
+		}
+		c.shutdownErr = c.Close()
+	})
+	return c.shutdownErr
+}
+
+// Wait 等待会话的后台协程退出, 在 Close 或 Shutdown 之后调用
+func (c *ChatManager) Wait() {
+	if c.session != nil {
+		c.session.Wait()
+	}
+}
+
 func (c *ChatManager) OnClose(deviceId string) {
 	log.Infof("设备 %s 断开连接", deviceId)
 	c.cancel()
@@ -0,0 +1,56 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm/window"
+	"xiaozhi-esp32-server-golang/internal/domain/memory/llm_memory"
+	"xiaozhi-esp32-server-golang/internal/domain/quota"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// summaryTimeout 总结较早对话的超时时间
+const summaryTimeout = 30 * time.Second
+
+// summarizeAsync 在后台将较早的对话合并到滚动摘要中, 不阻塞本轮对话, 同一时间只进行一次总结
+// 本轮请求已经按预算丢弃了这些消息, 摘要在之后的请求中生效
+func (l *LLMManager) summarizeAsync(cfg window.Config, fold []*schema.Message) {
+	clientState := l.clientState
+	if clientState.LLMProvider == nil || len(fold) == 0 {
+		return
+	}
+	if !l.summarizing.CompareAndSwap(false, true) {
+		return
+	}
+
+	previous := clientState.GetSummary()
+	go func() {
+		defer l.summarizing.Store(false)
+
+		ctx, cancel := context.WithTimeout(clientState.Ctx, summaryTimeout)
+		defer cancel()
+
+		startTs := time.Now()
+		summary, usage, err := window.Summarize(ctx, clientState.LLMProvider, clientState.SessionID, previous, fold, cfg.SummaryMaxTokens)
+		if usage != nil {
+			quota.Get().Add(context.Background(), quotaSubject(clientState), quota.MetricLLMTokens, int64(usage.TotalTokens))
+		}
+		if err != nil {
+			log.Warnf("总结较早的对话失败, sessionID: %s, error: %v", clientState.SessionID, err)
+			return
+		}
+		if !clientState.ApplySummary(summary, fold[len(fold)-1]) {
+			log.Debugf("对话历史已变化, 放弃本次摘要, sessionID: %s", clientState.SessionID)
+			return
+		}
+		// 与对话历史一起保存, 重新连接后继续使用
+		if err := llm_memory.Get().SetDialogueSummary(context.Background(), clientState.DeviceID, summary); err != nil {
+			log.Warnf("保存对话摘要失败, sessionID: %s, error: %v", clientState.SessionID, err)
+		}
+		log.Infof("已将 %d 条较早的消息总结为摘要, 耗时: %dms, sessionID: %s, 摘要: %s",
+			len(fold), time.Since(startTs).Milliseconds(), clientState.SessionID, summary)
+	}()
+}
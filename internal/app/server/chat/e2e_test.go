@@ -0,0 +1,169 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	"xiaozhi-esp32-server-golang/internal/app/server/memconn"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	ttsmock "xiaozhi-esp32-server-golang/internal/domain/tts/mock"
+)
+
+type e2eVolumeParams struct {
+	Volume int `json:"volume" description:"音量 0-100"`
+}
+
+// useMockConfig 加载模拟 ASR/LLM/TTS 的测试配置, overrides 覆盖其中的配置项, 测试结束后恢复原来的全局配置
+func useMockConfig(t *testing.T, overrides map[string]interface{}) {
+	t.Helper()
+	previous := viper.AllSettings()
+	t.Cleanup(func() {
+		viper.Reset()
+		viper.MergeConfigMap(previous)
+	})
+
+	viper.Reset()
+	viper.SetConfigFile("testdata/mock_config.yaml")
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("读取测试配置失败: %v", err)
+	}
+	for key, value := range overrides {
+		viper.Set(key, value)
+	}
+
+	if err := auth.Init(); err != nil {
+		t.Fatalf("初始化auth失败: %v", err)
+	}
+	mcp.GetGlobalMCPManager()
+}
+
+// startTestChatManager 创建并启动 ChatManager, 测试结束时关闭并等待所有后台协程退出
+func startTestChatManager(t *testing.T, deviceID string, conn *memconn.MemConn) *ChatManager {
+	t.Helper()
+	chatManager, err := NewChatManager(deviceID, conn)
+	if err != nil {
+		t.Fatalf("创建ChatManager失败: %v", err)
+	}
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		chatManager.Start()
+	}()
+	t.Cleanup(func() {
+		chatManager.Close()
+		<-started
+		chatManager.Wait()
+	})
+	return chatManager
+}
+
+// TestChatEndToEnd 使用模拟的 ASR/LLM/TTS 和内存连接跑通一轮完整对话:
+// hello -> listen start -> 音频 -> listen stop -> stt -> 工具调用 -> tts
+func TestChatEndToEnd(t *testing.T) {
+	const deviceID = "e2e:00:00:00:00:01"
+
+	useMockConfig(t, nil)
+
+	toolArgs := make(chan string, 1)
+	err := mcp.GetLocalMCPManager().RegisterToolFunc("e2e_set_volume", "调整音量", e2eVolumeParams{}, func(ctx context.Context, argumentsInJSON string) (string, error) {
+		toolArgs <- argumentsInJSON
+		return "音量已设置为50", nil
+	})
+	if err != nil {
+		t.Fatalf("注册工具失败: %v", err)
+	}
+	defer mcp.GetLocalMCPManager().UnregisterTool("e2e_set_volume")
+
+	conn := memconn.New(deviceID)
+	startTestChatManager(t, deviceID, conn)
+
+	send := func(v map[string]interface{}) {
+		if err := conn.DeviceSendJSON(v); err != nil {
+			t.Fatalf("发送信令失败: %v", err)
+		}
+	}
+	recv := func() map[string]interface{} {
+		msg, err := conn.DeviceRecvCmd(10 * time.Second)
+		if err != nil {
+			t.Fatalf("接收信令失败: %v", err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(msg, &m); err != nil {
+			t.Fatalf("解析信令失败: %s, %v", msg, err)
+		}
+		return m
+	}
+
+	send(map[string]interface{}{
+		"type":      "hello",
+		"device_id": deviceID,
+		"transport": "websocket",
+		"audio_params": map[string]interface{}{
+			"format":         "opus",
+			"sample_rate":    16000,
+			"channels":       1,
+			"frame_duration": 60,
+		},
+	})
+	if hello := recv(); hello["type"] != "hello" {
+		t.Fatalf("期望 hello 响应, 实际: %v", hello)
+	}
+
+	// 用模拟TTS生成的音调帧作为上行音频
+	frames, err := ttsmock.NewMockTTSProvider(map[string]interface{}{"char_duration_ms": 60}).TextToSpeech(context.Background(), "一二三四五", 16000, 1, 60)
+	if err != nil {
+		t.Fatalf("生成音频帧失败: %v", err)
+	}
+	send(map[string]interface{}{"type": "listen", "state": "start", "mode": "manual"})
+	for _, frame := range frames {
+		if err := conn.DeviceSendAudio(frame); err != nil {
+			t.Fatalf("发送音频失败: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	send(map[string]interface{}{"type": "listen", "state": "stop"})
+
+	var trace []string
+	for {
+		msg := recv()
+		line, _ := msg["type"].(string)
+		if state, _ := msg["state"].(string); state != "" {
+			line += ":" + state
+		}
+		if text, _ := msg["text"].(string); text != "" {
+			line += " " + text
+		}
+		trace = append(trace, line)
+		if line == "tts:stop" {
+			break
+		}
+	}
+
+	expected := []string{"stt 帮我把音量调到五十", "tts:start", "tts:sentence_start 音量已经调到五十了。", "tts:sentence_end 音量已经调到五十了。", "tts:stop"}
+	if len(trace) != len(expected) {
+		t.Fatalf("下行信令错误: %v", trace)
+	}
+	for i := range expected {
+		if trace[i] != expected[i] {
+			t.Errorf("第 %d 条下行信令错误: %s, 期望: %s", i, trace[i], expected[i])
+		}
+	}
+
+	select {
+	case args := <-toolArgs:
+		if args != `{"volume":50}` {
+			t.Errorf("工具参数错误: %s", args)
+		}
+	default:
+		t.Errorf("工具未被调用")
+	}
+
+	if audio, err := conn.DeviceRecvAudio(time.Second); err != nil || len(audio) == 0 {
+		t.Errorf("未收到TTS音频: %v", err)
+	}
+}
@@ -8,17 +8,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/window"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
 	"xiaozhi-esp32-server-golang/internal/domain/play_music"
 	"xiaozhi-esp32-server-golang/internal/domain/speaker"
+	"xiaozhi-esp32-server-golang/internal/domain/tracing"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -28,8 +32,6 @@ import (
 )
 
 const (
-	MaxMessageCount = 10
-
 	McpReadResourcePageSize       = 100 * 1024
 	McpReadResourceStreamDoneFlag = "[DONE]"
 )
@@ -70,6 +72,8 @@ type LLMManager struct {
 	// key: role (user/assistant), value: MessageID
 	lastMessageID   map[string]string
 	lastMessageIDMu sync.RWMutex // 保护 lastMessageID 的并发访问
+
+	summarizing atomic.Bool // 是否正在总结较早的对话
 }
 
 func NewLLMManager(clientState *ClientState, serverTransport *ServerTransport, ttsManager *TTSManager) *LLMManager {
@@ -170,6 +174,7 @@ func (l *LLMManager) HandleLLMResponseChannelAsync(ctx context.Context, userMess
 			if nest, ok := val.(int); !ok || nest <= 1 {
 				// 首次调用或没有nest值，清空TTS音频缓存
 				l.ttsManager.ClearAudioHistory()
+				l.ttsManager.ResetSpokenText()
 				log.Debugf("onStartFunc 首次调用，已清空TTS音频缓存")
 			}
 			l.serverTransport.SendTtsStart()
@@ -261,6 +266,7 @@ func (l *LLMManager) HandleLLMResponseChannelSync(ctx context.Context, userMessa
 		if nest <= 1 {
 			// 首次调用或没有nest值，清空TTS音频缓存
 			l.ttsManager.ClearAudioHistory()
+			l.ttsManager.ResetSpokenText()
 			log.Debugf("HandleLLMResponseChannelSync 首次调用，已清空TTS音频缓存")
 		}
 		l.serverTransport.SendTtsStart()
@@ -391,7 +397,7 @@ func (l *LLMManager) handleLLMResponse(ctx context.Context, userMessage *schema.
 						}
 						strFullText := fullText.String()
 						if strFullText != "" || len(toolCalls) > 0 {
-							if err := l.AddLlmMessage(ctx, schema.AssistantMessage(strFullText, toolCalls)); err != nil {
+							if err := l.AddLlmMessage(ctx, withResponseMeta(schema.AssistantMessage(strFullText, toolCalls), llmResponse)); err != nil {
 								log.Errorf("保存助手消息失败: %v", err)
 							}
 						}
@@ -400,7 +406,7 @@ func (l *LLMManager) handleLLMResponse(ctx context.Context, userMessage *schema.
 						lctx := context.WithValue(ctx, "nest", 2)
 						// 将 fullText 传递到新的 context（toolCalls 直接作为参数传递）
 						lctx = context.WithValue(lctx, fullTextKey, fullText)
-						invokeToolSuccess, err := l.handleToolCallResponse(lctx, userMessage, schema.AssistantMessage(fullText.String(), toolCalls), toolCalls)
+						invokeToolSuccess, err := l.handleToolCallResponse(lctx, userMessage, withResponseMeta(schema.AssistantMessage(fullText.String(), toolCalls), llmResponse), toolCalls)
 						if err != nil {
 							log.Errorf("处理工具调用响应失败: %v", err)
 							return true, fmt.Errorf("处理工具调用响应失败: %v", err)
@@ -464,7 +470,7 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 
 	for _, toolCall := range tools {
 		toolName := toolCall.Function.Name
-		tool, ok := mcp.GetToolByName(state.DeviceID, toolName)
+		tool, ok := mcp.GetToolByName(state.DeviceID, state.AgentID, toolName)
 		if !ok || tool == nil {
 			log.Errorf("未找到工具: %s", toolName)
 			addMessageFunc(toolCall, fmt.Sprintf("未找到工具: %s", toolName))
@@ -472,7 +478,9 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 		}
 		log.Infof("进行工具调用请求: %s, 参数: %+v", toolName, toolCall.Function.Arguments)
 		startTs := time.Now().UnixMilli()
-		fcResult, err := tool.InvokableRun(toolCtx, toolCall.Function.Arguments)
+		spanCtx, span := tracing.StartSpan(toolCtx, "mcp.tool", tracing.AttrTool.String(toolName))
+		fcResult, err := tool.InvokableRun(spanCtx, toolCall.Function.Arguments)
+		tracing.EndSpan(span, err)
 		if err != nil {
 			log.Errorf("工具调用失败: %v", err)
 			addMessageFunc(toolCall, fmt.Sprintf("工具 %s 调用失败: %v", toolName, err))
@@ -762,8 +770,13 @@ func (l *LLMManager) DoLLmRequest(ctx context.Context, userMessage *schema.Messa
 
 	l.einoTools = einoTools
 
+	// 工具调用后的再次请求也需要检查 token 配额
+	if !l.checkLLMQuota(ctx) {
+		return nil
+	}
+
 	//组装历史消息和当前用户的消息
-	requestMessages := l.GetMessages(ctx, userMessage, MaxMessageCount, speakerResult)
+	requestMessages := l.GetMessages(ctx, userMessage, speakerResult)
 	clientState.SetStatus(ClientStatusLLMStart)
 	responseSentences, err := llm.HandleLLMWithContextAndTools(
 		ctx,
@@ -776,6 +789,7 @@ func (l *LLMManager) DoLLmRequest(ctx context.Context, userMessage *schema.Messa
 		log.Errorf("发送带工具的 LLM 请求失败, seesionID: %s, error: %v", l.clientState.SessionID, err)
 		return fmt.Errorf("发送带工具的 LLM 请求失败: %v", err)
 	}
+	responseSentences = l.countLLMTokens(ctx, requestMessages, responseSentences)
 
 	log.Debugf("DoLLmRequest goroutine开始 - SessionID: %s, context状态: %v", l.clientState.SessionID, ctx.Err())
 
@@ -817,6 +831,8 @@ func (l *LLMManager) AddMessage(ctx context.Context, msg *schema.Message) error
 	// 同步添加到内存中
 	l.clientState.AddMessage(msg)
 
+	metadata := l.messageMetadata(msg)
+
 	// Tool 角色消息：直接保存，不涉及两阶段保存（无音频）
 	if msg.Role == schema.Tool {
 		eventbus.Get().Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
@@ -828,6 +844,7 @@ func (l *LLMManager) AddMessage(ctx context.Context, msg *schema.Message) error
 			SampleRate:  0,
 			Channels:    0,
 			Timestamp:   time.Now(),
+			Metadata:    metadata,
 			IsUpdate:    false, // 一次性保存
 		})
 		return nil
@@ -851,20 +868,77 @@ func (l *LLMManager) AddMessage(ctx context.Context, msg *schema.Message) error
 		SampleRate:  0,
 		Channels:    0,
 		Timestamp:   time.Now(),
+		Metadata:    metadata,
 		IsUpdate:    false, // 新增消息
 	})
 
 	return nil
 }
 
+// withResponseMeta 将本轮 LLM 请求的 token 用量和路由结果记录到助手消息上, 保存聊天历史时写入 metadata
+func withResponseMeta(msg *schema.Message, llmResponse llm_common.LLMResponseStruct) *schema.Message {
+	if llmResponse.Usage != nil {
+		msg.ResponseMeta = &schema.ResponseMeta{Usage: llmResponse.Usage}
+	}
+	if llmResponse.Route != nil {
+		msg.Extra = map[string]any{llm_common.ExtraKeyRoute: llmResponse.Route}
+	}
+	return msg
+}
+
+// messageMetadata 聊天历史的附加信息, 目前包含助手消息的 token 用量和路由结果
+func (l *LLMManager) messageMetadata(msg *schema.Message) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		usage := msg.ResponseMeta.Usage
+		metadata["usage"] = map[string]interface{}{
+			"prompt_tokens":     usage.PromptTokens,
+			"completion_tokens": usage.CompletionTokens,
+			"total_tokens":      usage.TotalTokens,
+		}
+	}
+	if route, ok := msg.Extra[llm_common.ExtraKeyRoute].(*llm_common.RouteDecision); ok {
+		metadata["route"] = route
+		if route.Model != "" {
+			metadata["model"] = route.Model
+		}
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	if _, ok := metadata["model"]; !ok && l.clientState.LLMProvider != nil {
+		if modelName, ok := l.clientState.LLMProvider.GetModelInfo()["model_name"].(string); ok {
+			metadata["model"] = modelName
+		}
+	}
+	return metadata
+}
+
+// SaveInterruptedReply 回复被插话打断时，将已经播放的部分作为助手消息保存
+// 只有本轮的助手回复还没有保存（最后一条是用户消息或工具结果）时才保存
+func (l *LLMManager) SaveInterruptedReply(ctx context.Context, spokenText string) {
+	spokenText = strings.TrimSpace(spokenText)
+	if spokenText == "" {
+		return
+	}
+	lastMsg := l.clientState.GetLastMessage()
+	if lastMsg == nil || (lastMsg.Role != schema.User && lastMsg.Role != schema.Tool) {
+		log.Debugf("本轮回复已保存或没有对应的用户消息，跳过保存截断回复")
+		return
+	}
+	if err := l.AddLlmMessage(ctx, schema.AssistantMessage(spokenText, nil)); err != nil {
+		log.Errorf("保存截断回复失败: %v", err)
+	}
+}
+
 // AddLlmMessage 保持向后兼容，委托给 AddMessage
 func (l *LLMManager) AddLlmMessage(ctx context.Context, msg *schema.Message) error {
 	return l.AddMessage(ctx, msg)
 }
 
-func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Message, count int, speakerResult *speaker.IdentifyResult) []*schema.Message {
-	//从dialogue中获取
-	messageList := l.clientState.GetMessages(count)
+func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Message, speakerResult *speaker.IdentifyResult) []*schema.Message {
+	//从dialogue中获取, 由 window.Build 按 token 预算和条数截取
+	messageList := l.clientState.GetMessages(math.MaxInt)
 
 	// 构建 system prompt
 	systemPrompt := l.clientState.SystemPrompt
@@ -900,14 +974,14 @@ func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Messag
 		}
 	}
 
-	retMessage := make([]*schema.Message, 0)
-	retMessage = append(retMessage, &schema.Message{
-		Role:    schema.System,
-		Content: systemPrompt,
-	})
-	retMessage = append(retMessage, messageList...)
-	if userMessage != nil {
-		retMessage = append(retMessage, userMessage)
+	// 按 token 预算选取历史消息, 超出预算的较早对话在后台总结为摘要
+	cfg := window.LoadConfig(l.clientState.DeviceConfig.Context)
+	result := window.Build(cfg, systemPrompt, l.clientState.GetSummary(), messageList, userMessage)
+	if result.Dropped > 0 {
+		log.Debugf("上下文超出预算, 丢弃 %d 条较早的消息, 预估 token: %d, sessionID: %s", result.Dropped, result.Tokens, l.clientState.SessionID)
+	}
+	if len(result.Fold) > 0 {
+		l.summarizeAsync(cfg, result.Fold)
 	}
-	return retMessage
+	return result.Messages
 }
@@ -3,17 +3,18 @@ package chat
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	mcp_manager "xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/reminder"
 	log "xiaozhi-esp32-server-golang/logger"
-
 	//"github.com/scroot/music-sd/pkg/netease"
 	//"github.com/scroot/music-sd/pkg/qq"
-	"github.com/spf13/viper"
 )
 
 type LocalMcpTool struct {
@@ -48,6 +49,48 @@ func InitChatLocalMCPTools() {
 			Params:      struct{}{},
 			Handle:      clearConversationHistoryHandler,
 		},
+		"remember_fact": {
+			Name:        "remember_fact",
+			Description: "当用户明确要求记住某件事时使用，例如“记住我女儿的生日是5月3日”，将这件事保存到长期记忆中，以后可以通过 recall_memory 查询",
+			Params:      RememberFactParams{},
+			Handle:      rememberFactHandler,
+		},
+		"recall_memory": {
+			Name:        "recall_memory",
+			Description: "当用户询问之前让你记住的事情或过去聊过的内容，而当前对话中没有相关信息时使用，从长期记忆中检索相关内容",
+			Params:      RecallMemoryParams{},
+			Handle:      recallMemoryHandler,
+		},
+		"forget_memory": {
+			Name:        "forget_memory",
+			Description: "当用户明确要求忘记某件事或清空全部记忆时使用，指定 query 时只删除相关记忆，不指定时清空全部长期记忆",
+			Params:      ForgetMemoryParams{},
+			Handle:      forgetMemoryHandler,
+		},
+		"search_knowledge": {
+			Name:        "search_knowledge",
+			Description: "当用户询问产品使用方法、功能说明、故障处理等问题时使用，从智能体的知识库(如产品说明书)中检索相关内容，请根据检索到的内容回答，不要编造",
+			Params:      SearchKnowledgeParams{},
+			Handle:      searchKnowledgeHandler,
+		},
+		"set_reminder": {
+			Name:        "set_reminder",
+			Description: "当用户要求在某个时间提醒他做某事、设置闹钟或定时提醒时使用，例如“每天晚上8点半提醒孩子睡觉”“10分钟后提醒我关火”，到时间后设备会主动播报 message，设备不在线时在下次连接时播报",
+			Params:      SetReminderParams{},
+			Handle:      setReminderHandler,
+		},
+		"list_reminders": {
+			Name:        "list_reminders",
+			Description: "当用户询问设置了哪些提醒或闹钟时使用，返回当前设备的全部提醒及编号",
+			Params:      struct{}{},
+			Handle:      listRemindersHandler,
+		},
+		"cancel_reminder": {
+			Name:        "cancel_reminder",
+			Description: "当用户要求取消或删除某个提醒、闹钟时使用，需要提醒编号，不知道编号时先调用 list_reminders 查询",
+			Params:      CancelReminderParams{},
+			Handle:      cancelReminderHandler,
+		},
 		/*"play_music": {
 			Name:        "play_music",
 			Description: "当用户想听歌、无聊时、想放空大脑时使用，用于播放指定名称的音乐，当用户想随便听一首音乐时请推荐出具体的歌曲名称，当有多个音乐播放工具时优先使用此工具，**此工具调用耗时较长，需要先返回友好的过渡性提示语**",
@@ -56,11 +99,8 @@ func InitChatLocalMCPTools() {
 		},*/
 	}
 
+	// 全部注册，是否启用在获取工具时按智能体配置和全局开关判断，智能体可以开启全局关闭的工具
 	for toolName, localTool := range localTools {
-		// 只有当配置明确设为false时才跳过，配置不存在或为true时都启用
-		if viper.IsSet("local_mcp."+toolName) && !viper.GetBool("local_mcp."+toolName) {
-			continue
-		}
 		err := manager.RegisterToolFunc(
 			localTool.Name,
 			localTool.Description,
@@ -270,6 +310,259 @@ func clearConversationHistoryHandler(ctx context.Context, argumentsInJSON string
 	return "", fmt.Errorf("从context中未找到chat_session_operator")
 }
 
+type RememberFactParams struct {
+	Fact string `json:"fact" description:"需要记住的事情，用第一人称的完整陈述句，例如：我女儿的生日是5月3日" required:"true"`
+}
+
+type RecallMemoryParams struct {
+	Query string `json:"query" description:"要查询的内容，例如：女儿的生日" required:"true"`
+}
+
+type ForgetMemoryParams struct {
+	Query string `json:"query,omitempty" description:"要忘记的内容的关键词，例如：女儿的生日；清空全部记忆时不填"`
+}
+
+type SearchKnowledgeParams struct {
+	Query string `json:"query" description:"要检索的问题，例如：怎么连接WiFi" required:"true"`
+}
+
+type SetReminderParams struct {
+	Message      string `json:"message" description:"到时间后设备播报的话，直接对用户说，例如：小朋友，八点半了，该刷牙睡觉啦" required:"true"`
+	Time         string `json:"time,omitempty" description:"提醒时间，格式为 HH:MM(如 20:30，取最近的一次) 或 YYYY-MM-DD HH:MM，与 delay_minutes 二选一"`
+	DelayMinutes int    `json:"delay_minutes,omitempty" description:"多少分钟后提醒，例如 10 分钟后提醒时填 10，与 time 二选一"`
+	Repeat       string `json:"repeat,omitempty" description:"重复方式：不填只提醒一次；daily 每天；weekdays 工作日；weekends 周末；weekly 每周；也可以填 5 段 cron 表达式(分 时 日 月 周)，如 0 7 1 * * 表示每月1号7点"`
+}
+
+type CancelReminderParams struct {
+	ID string `json:"id" description:"要取消的提醒编号，通过 list_reminders 获取" required:"true"`
+}
+
+// getChatSessionOperator 从context中获取ChatSessionOperator
+func getChatSessionOperator(ctx context.Context) (ChatSessionOperator, error) {
+	chatSessionOperatorValue := ctx.Value("chat_session_operator")
+	if chatSessionOperatorValue == nil {
+		return nil, fmt.Errorf("从context中未找到chat_session_operator")
+	}
+	chatSessionOperator, ok := chatSessionOperatorValue.(ChatSessionOperator)
+	if !ok {
+		return nil, fmt.Errorf("从context中获取的chat_session_operator不是ChatSessionOperator类型")
+	}
+	return chatSessionOperator, nil
+}
+
+// memoryErrorResponse 记忆工具执行失败的响应
+func memoryErrorResponse(toolName string, err error) (string, error) {
+	if errors.Is(err, errMemoryDisabled) {
+		return NewErrorResponse(toolName, "当前智能体未开启长期记忆", "MEMORY_DISABLED", "请告诉用户需要先在智能体配置中开启长期记忆").ToJSON()
+	}
+	return NewErrorResponse(toolName, err.Error(), "MEMORY_ERROR", "请稍后重试").ToJSON()
+}
+
+// rememberFactHandler 记住事情的处理函数
+func rememberFactHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	var params RememberFactParams
+	if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil || strings.TrimSpace(params.Fact) == "" {
+		return NewErrorResponse("remember_fact", "参数解析失败", "PARSE_ERROR", "请在 fact 中填写需要记住的事情").ToJSON()
+	}
+	log.Infof("执行记住事情工具: %s", params.Fact)
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		log.Warn(err)
+		return "", err
+	}
+	if err := chatSessionOperator.LocalMcpRememberFact(ctx, strings.TrimSpace(params.Fact)); err != nil {
+		log.Errorf("保存长期记忆失败: %v", err)
+		return memoryErrorResponse("remember_fact", err)
+	}
+	return NewContentResponse("remember_fact", map[string]string{"fact": params.Fact}, "已记住").ToJSON()
+}
+
+// recallMemoryHandler 检索记忆的处理函数
+func recallMemoryHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	var params RecallMemoryParams
+	if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil || strings.TrimSpace(params.Query) == "" {
+		return NewErrorResponse("recall_memory", "参数解析失败", "PARSE_ERROR", "请在 query 中填写要查询的内容").ToJSON()
+	}
+	log.Infof("执行检索记忆工具: %s", params.Query)
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		log.Warn(err)
+		return "", err
+	}
+	result, err := chatSessionOperator.LocalMcpRecallMemory(ctx, strings.TrimSpace(params.Query))
+	if err != nil {
+		log.Errorf("检索长期记忆失败: %v", err)
+		return memoryErrorResponse("recall_memory", err)
+	}
+	if result == "" {
+		return NewContentResponse("recall_memory", "", "没有找到相关的记忆，请如实告诉用户不记得").ToJSON()
+	}
+	return NewContentResponse("recall_memory", result, "找到以下相关记忆").ToJSON()
+}
+
+// forgetMemoryHandler 删除记忆的处理函数
+func forgetMemoryHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	var params ForgetMemoryParams
+	if argumentsInJSON != "" {
+		if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil {
+			return NewErrorResponse("forget_memory", "参数解析失败", "PARSE_ERROR", "请检查参数格式是否正确").ToJSON()
+		}
+	}
+	query := strings.TrimSpace(params.Query)
+	log.Infof("执行删除记忆工具, query: %s", query)
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		log.Warn(err)
+		return "", err
+	}
+	removed, err := chatSessionOperator.LocalMcpForgetMemory(ctx, query)
+	if err != nil {
+		log.Errorf("删除长期记忆失败: %v", err)
+		return memoryErrorResponse("forget_memory", err)
+	}
+	if query == "" {
+		return NewActionResponse("forget_memory", "reset_memory", "已清空全部长期记忆", "completed", false).ToJSON()
+	}
+	if removed == 0 {
+		return NewContentResponse("forget_memory", map[string]int{"removed": 0}, "没有找到相关的记忆").ToJSON()
+	}
+	return NewActionResponse("forget_memory", "forget_memory", fmt.Sprintf("已删除 %d 条相关记忆", removed), "completed", false).ToJSON()
+}
+
+// searchKnowledgeHandler 检索知识库的处理函数
+func searchKnowledgeHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	var params SearchKnowledgeParams
+	if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil || strings.TrimSpace(params.Query) == "" {
+		return NewErrorResponse("search_knowledge", "参数解析失败", "PARSE_ERROR", "请在 query 中填写要检索的问题").ToJSON()
+	}
+	log.Infof("执行检索知识库工具: %s", params.Query)
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		log.Warn(err)
+		return "", err
+	}
+	result, err := chatSessionOperator.LocalMcpSearchKnowledge(ctx, strings.TrimSpace(params.Query))
+	if err != nil {
+		log.Errorf("检索知识库失败: %v", err)
+		return NewErrorResponse("search_knowledge", err.Error(), "KNOWLEDGE_ERROR", "请稍后重试").ToJSON()
+	}
+	if result == "" {
+		return NewContentResponse("search_knowledge", "", "知识库中没有找到相关内容，请如实告诉用户").ToJSON()
+	}
+	return NewContentResponse("search_knowledge", result, "从知识库中找到以下相关内容").ToJSON()
+}
+
+// reminderErrorResponse 提醒工具执行失败的响应
+func reminderErrorResponse(toolName string, err error) (string, error) {
+	if errors.Is(err, reminder.ErrUnavailable) {
+		return NewErrorResponse(toolName, "服务器未开启定时提醒", "REMINDER_UNAVAILABLE", "请告诉用户暂时无法设置提醒").ToJSON()
+	}
+	return NewErrorResponse(toolName, err.Error(), "REMINDER_ERROR", "请根据错误信息调整后重试").ToJSON()
+}
+
+// reminderData 提醒返回给 LLM 的内容
+func reminderData(r reminder.Reminder) map[string]string {
+	data := map[string]string{
+		"id":      r.ID,
+		"message": r.Message,
+		"next_at": formatChineseDateTime(r.NextAt),
+	}
+	if r.Cron != "" {
+		data["cron"] = r.Cron
+	}
+	return data
+}
+
+// setReminderHandler 设置定时提醒的处理函数
+func setReminderHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	var params SetReminderParams
+	if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil || strings.TrimSpace(params.Message) == "" {
+		return NewErrorResponse("set_reminder", "参数解析失败", "PARSE_ERROR", "请在 message 中填写到时间后要播报的话").ToJSON()
+	}
+	log.Infof("执行设置提醒工具: %+v", params)
+
+	var at time.Time
+	if params.DelayMinutes > 0 {
+		at = time.Now().Add(time.Duration(params.DelayMinutes) * time.Minute)
+	} else if strings.TrimSpace(params.Time) != "" {
+		var err error
+		if at, err = reminder.ParseTime(params.Time, time.Now()); err != nil {
+			return NewErrorResponse("set_reminder", err.Error(), "PARSE_ERROR", "time 的格式为 HH:MM 或 YYYY-MM-DD HH:MM").ToJSON()
+		}
+	} else if _, err := reminder.ParseCron(params.Repeat); err != nil {
+		// 只有 cron 表达式时可以不填时间
+		return NewErrorResponse("set_reminder", "缺少提醒时间", "PARSE_ERROR", "请填写 time 或 delay_minutes").ToJSON()
+	}
+	cron, err := reminder.RepeatToCron(params.Repeat, at)
+	if err != nil {
+		return NewErrorResponse("set_reminder", err.Error(), "PARSE_ERROR", "repeat 可以填 daily、weekdays、weekends、weekly 或 5 段 cron 表达式").ToJSON()
+	}
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		log.Warn(err)
+		return "", err
+	}
+	r := &reminder.Reminder{Message: strings.TrimSpace(params.Message), Cron: cron, NextAt: at}
+	if err := chatSessionOperator.LocalMcpSetReminder(ctx, r); err != nil {
+		log.Errorf("设置提醒失败: %v", err)
+		return reminderErrorResponse("set_reminder", err)
+	}
+	return NewContentResponse("set_reminder", reminderData(*r), fmt.Sprintf("提醒已设置，下次提醒时间：%s", formatChineseDateTime(r.NextAt))).ToJSON()
+}
+
+// listRemindersHandler 查询定时提醒的处理函数
+func listRemindersHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	log.Info("执行查询提醒工具")
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		log.Warn(err)
+		return "", err
+	}
+	reminders, err := chatSessionOperator.LocalMcpListReminders(ctx)
+	if err != nil {
+		log.Errorf("查询提醒失败: %v", err)
+		return reminderErrorResponse("list_reminders", err)
+	}
+	if len(reminders) == 0 {
+		return NewContentResponse("list_reminders", []map[string]string{}, "当前没有设置提醒").ToJSON()
+	}
+	data := make([]map[string]string, 0, len(reminders))
+	for _, r := range reminders {
+		data = append(data, reminderData(r))
+	}
+	return NewContentResponse("list_reminders", data, fmt.Sprintf("当前时间：%s，共 %d 个提醒", formatChineseDateTime(time.Now()), len(reminders))).ToJSON()
+}
+
+// cancelReminderHandler 取消定时提醒的处理函数
+func cancelReminderHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	var params CancelReminderParams
+	if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil || strings.TrimSpace(params.ID) == "" {
+		return NewErrorResponse("cancel_reminder", "参数解析失败", "PARSE_ERROR", "请在 id 中填写提醒编号").ToJSON()
+	}
+	log.Infof("执行取消提醒工具: %s", params.ID)
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		log.Warn(err)
+		return "", err
+	}
+	cancelled, err := chatSessionOperator.LocalMcpCancelReminder(ctx, strings.TrimSpace(params.ID))
+	if err != nil {
+		log.Errorf("取消提醒失败: %v", err)
+		return reminderErrorResponse("cancel_reminder", err)
+	}
+	if !cancelled {
+		return NewErrorResponse("cancel_reminder", "没有找到该提醒", "REMINDER_NOT_FOUND", "请先调用 list_reminders 确认提醒编号").ToJSON()
+	}
+	return NewActionResponse("cancel_reminder", "cancel_reminder", "提醒已取消", "completed", false).ToJSON()
+}
+
 // getWeekNumber 获取周数
 func getWeekNumber(t time.Time) int {
 	_, week := t.ISOWeek()
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudwego/eino/schema"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/quota"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// quotaSubject 当前会话的配额归属
+func quotaSubject(clientState *ClientState) quota.Subject {
+	return quota.Subject{
+		DeviceID: clientState.DeviceID,
+		AgentID:  clientState.AgentID,
+		UserID:   clientState.DeviceConfig.UserId,
+	}
+}
+
+type quotaExemptKey struct{}
+
+// withoutQuota 标记不计入 TTS 字数配额, 用于超出配额的提示本身
+func withoutQuota(ctx context.Context) context.Context {
+	return context.WithValue(ctx, quotaExemptKey{}, true)
+}
+
+// countsTowardQuota 是否计入 TTS 字数配额
+func countsTowardQuota(ctx context.Context) bool {
+	exempt, _ := ctx.Value(quotaExemptKey{}).(bool)
+	return !exempt
+}
+
+// checkTurnQuota 开始一轮对话前检查配额, 超出时播报提示并返回 false
+func (s *ChatSession) checkTurnQuota(ctx context.Context) bool {
+	err := quota.Get().CheckTurn(ctx, quotaSubject(s.clientState))
+	if err == nil {
+		return true
+	}
+	log.Warnf("设备 %s 超出配额, 不再请求 LLM: %v", s.clientState.DeviceID, err)
+	if errors.Is(err, quota.ErrExceeded) {
+		s.speakQuotaExceeded()
+	}
+	return false
+}
+
+// speakQuotaExceeded 播报超出配额的提示
+func (s *ChatSession) speakQuotaExceeded() {
+	s.serverTransport.SendTtsStart()
+	defer s.serverTransport.SendTtsStop()
+
+	sessionCtx := s.clientState.SessionCtx.Get(s.clientState.Ctx)
+	s.ttsManager.handleTts(withoutQuota(s.clientState.AfterAsrSessionCtx.Get(sessionCtx)), llm_common.LLMResponseStruct{
+		Text: quota.Get().FallbackMessage(),
+	})
+}
+
+// checkLLMQuota 工具调用后的再次请求前检查 token 配额, 超出时在当前这一轮回复中播报提示并返回 false
+func (l *LLMManager) checkLLMQuota(ctx context.Context) bool {
+	err := quota.Get().CheckLLM(ctx, quotaSubject(l.clientState))
+	if err == nil {
+		return true
+	}
+	log.Warnf("设备 %s 超出 LLM 配额, seesionID: %s, error: %v", l.clientState.DeviceID, l.clientState.SessionID, err)
+	if errors.Is(err, quota.ErrExceeded) {
+		if err := l.ttsManager.handleTextResponse(withoutQuota(ctx), llm_common.LLMResponseStruct{
+			Text: quota.Get().FallbackMessage(),
+		}, true); err != nil {
+			log.Errorf("播报超出配额提示失败: %v", err)
+		}
+	}
+	return false
+}
+
+// countLLMTokens 透传 LLM 响应并在结束后累加 token 用量
+// 优先使用模型返回的用量, 模型未返回时输入按请求消息估算, 输出按回复文本估算
+func (l *LLMManager) countLLMTokens(ctx context.Context, requestMessages []*schema.Message, in chan llm_common.LLMResponseStruct) chan llm_common.LLMResponseStruct {
+	subject := quotaSubject(l.clientState)
+	var estimated int64
+	for _, msg := range requestMessages {
+		estimated += quota.EstimateTokens(msg.Content)
+	}
+
+	out := make(chan llm_common.LLMResponseStruct, cap(in))
+	go func() {
+		var usage *schema.TokenUsage
+		var route *llm_common.RouteDecision
+		defer close(out)
+		defer func() {
+			tokens := estimated
+			if usage != nil {
+				tokens = int64(usage.TotalTokens)
+			}
+			// 路由模型的意图分类也消耗 token
+			if route != nil {
+				tokens += route.ClassifierTokens
+			}
+			// 会话结束时 ctx 已取消, 使用新的 ctx 保证计数
+			quota.Get().Add(context.Background(), subject, quota.MetricLLMTokens, tokens)
+		}()
+		for resp := range in {
+			if resp.Usage != nil {
+				usage = resp.Usage
+			}
+			if resp.Route != nil {
+				route = resp.Route
+			}
+			estimated += quota.EstimateTokens(resp.Text)
+			for _, toolCall := range resp.ToolCalls {
+				estimated += quota.EstimateTokens(toolCall.Function.Name + toolCall.Function.Arguments)
+			}
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+				// 下游已退出, 继续读完上游避免其阻塞
+				for range in {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -46,6 +46,7 @@ func (s *ServerTransport) SendTtsStart() error {
 		return err
 	}
 	s.clientState.SetTtsStart(true)
+	s.clientState.SetTtsPlaying(true)
 	return nil
 }
 
@@ -63,6 +64,7 @@ func (s *ServerTransport) SendTtsStop() error {
 	if err != nil {
 		return err
 	}
+	s.clientState.SetTtsPlaying(false)
 	return nil
 }
 
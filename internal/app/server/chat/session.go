@@ -10,11 +10,13 @@ import (
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
 
 	"xiaozhi-esp32-server-golang/internal/app/server/auth"
 	types_conn "xiaozhi-esp32-server-golang/internal/app/server/types"
@@ -29,8 +31,11 @@ import (
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
 	"xiaozhi-esp32-server-golang/internal/domain/memory"
 	"xiaozhi-esp32-server-golang/internal/domain/memory/llm_memory"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
 	"xiaozhi-esp32-server-golang/internal/domain/speaker"
+	"xiaozhi-esp32-server-golang/internal/domain/tracing"
 	"xiaozhi-esp32-server-golang/internal/domain/tts"
+	tts_cache "xiaozhi-esp32-server-golang/internal/domain/tts/cache"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -39,6 +44,7 @@ type AsrResponseChannelItem struct {
 	ctx           context.Context
 	text          string
 	speakerResult *speaker.IdentifyResult
+	traceCtx      context.Context // 本轮对话的链路追踪上下文，可为空
 }
 
 type ChatSession struct {
@@ -58,10 +64,33 @@ type ChatSession struct {
 	speakerResultMu      sync.RWMutex
 	pendingSpeakerResult *speaker.IdentifyResult
 	speakerResultReady   chan struct{} // 仅用于通知就绪，不传数据
+
+	// 当前收音中的一轮对话的链路追踪
+	turnTrace turnTrace
+
+	// 最近一次插话打断的时间(ms)
+	lastBargeInTime atomic.Int64
+
+	// 服务退出时置为true, 不再接受新的对话, 进行中的一轮正常结束
+	draining atomic.Bool
+	// 正在处理的对话轮数
+	activeTurns atomic.Int32
+
+	ttsOpts []TTSManagerOption
+
+	// Start 启动的后台协程, Close 后通过 Wait 等待退出
+	wg sync.WaitGroup
 }
 
 type ChatSessionOption func(*ChatSession)
 
+// WithTTSManagerOptions 设置会话的 TTSManager 选项
+func WithTTSManagerOptions(opts ...TTSManagerOption) ChatSessionOption {
+	return func(s *ChatSession) {
+		s.ttsOpts = append(s.ttsOpts, opts...)
+	}
+}
+
 func NewChatSession(clientState *ClientState, serverTransport *ServerTransport, opts ...ChatSessionOption) *ChatSession {
 	s := &ChatSession{
 		clientState:        clientState,
@@ -75,7 +104,7 @@ func NewChatSession(clientState *ClientState, serverTransport *ServerTransport,
 
 	s.asrManager = NewASRManager(clientState, serverTransport)
 	s.asrManager.session = s // 设置 session 引用
-	s.ttsManager = NewTTSManager(clientState, serverTransport)
+	s.ttsManager = NewTTSManager(clientState, serverTransport, s.ttsOpts...)
 	s.llmManager = NewLLMManager(clientState, serverTransport, s.ttsManager)
 
 	// 如果启用声纹识别，创建声纹管理器
@@ -188,22 +217,39 @@ func (s *ChatSession) Start(pctx context.Context) error {
 	}
 
 	// 异步加载历史消息，不阻塞会话启动
-	go func() {
+	s.goLoop(func() {
 		err := s.initHistoryMessages()
 		if err != nil {
 			log.Errorf("初始化对话历史失败: %v", err)
 		}
-	}()
+	})
 
-	go s.CmdMessageLoop(s.ctx)   //处理信令消息
-	go s.AudioMessageLoop(s.ctx) //处理音频数据
-	go s.processChatText(s.ctx)  //处理 asr后 的对话消息
-	go s.llmManager.Start(s.ctx) //处理 llm后 的一系列返回消息
-	go s.ttsManager.Start(s.ctx) //处理 tts的 消息队列
+	s.goLoop(func() { s.CmdMessageLoop(s.ctx) })   //处理信令消息
+	s.goLoop(func() { s.AudioMessageLoop(s.ctx) }) //处理音频数据
+	s.goLoop(func() { s.processChatText(s.ctx) })  //处理 asr后 的对话消息
+	s.goLoop(func() { s.llmManager.Start(s.ctx) }) //处理 llm后 的一系列返回消息
+	s.goLoop(func() { s.ttsManager.Start(s.ctx) }) //处理 tts的 消息队列
 
 	return nil
 }
 
+// goLoop 启动会话的后台协程
+func (s *ChatSession) goLoop(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// Wait 等待会话的后台协程和VAD处理协程退出, 在 Close 之后调用
+func (s *ChatSession) Wait() {
+	s.wg.Wait()
+	if s.asrManager != nil {
+		s.asrManager.wg.Wait()
+	}
+}
+
 // 初始化历史对话记录到内存中
 func (s *ChatSession) initHistoryMessages() error {
 	var historyMessages []*schema.Message
@@ -232,6 +278,14 @@ func (s *ChatSession) initHistoryMessages() error {
 			return err
 		}
 		log.Infof("从 Redis 加载了 %d 条历史消息", len(historyMessages))
+
+		// 较早对话的摘要与历史消息一起恢复
+		summary, err := llm_memory.Get().GetDialogueSummary(s.ctx, s.clientState.DeviceID)
+		if err != nil {
+			log.Warnf("从 Redis 加载对话摘要失败: %v", err)
+		} else if summary != "" {
+			s.clientState.SetSummary(summary)
+		}
 	} else if useManager {
 		// 从 Manager 加载
 		historyMessages, err = s.loadFromManager()
@@ -328,7 +382,7 @@ func (c *ChatSession) InitAsrLlmTts() error {
 	if err != nil {
 		return fmt.Errorf("创建 TTS 提供者失败: %v", err)
 	}
-	c.clientState.TTSProvider = ttsProvider
+	c.clientState.TTSProvider = tts_cache.Wrap(ttsProvider, ttsConfig.Provider, ttsConfig.Config)
 
 	if err := c.clientState.InitLlm(); err != nil {
 		return fmt.Errorf("初始化LLM失败: %v", err)
@@ -462,12 +516,20 @@ func (c *ChatSession) HandleAudioMessage(data []byte) bool {
 
 // handleHelloMessage 处理 hello 消息
 func (s *ChatSession) HandleHelloMessage(msg *ClientMessage) error {
+	var err error
 	if msg.Transport == types_conn.TransportTypeWebsocket {
-		return s.HandleWebsocketHelloMessage(msg)
+		err = s.HandleWebsocketHelloMessage(msg)
 	} else if msg.Transport == types_conn.TransportTypeMqttUdp {
-		return s.HandleMqttHelloMessage(msg)
+		err = s.HandleMqttHelloMessage(msg)
+	} else if msg.Transport == types_conn.TransportTypeWebRTC {
+		err = s.HandleWebRTCHelloMessage(msg)
+	} else {
+		return fmt.Errorf("不支持的传输类型: %s", msg.Transport)
 	}
-	return fmt.Errorf("不支持的传输类型: %s", msg.Transport)
+	if err == nil {
+		eventbus.Get().Publish(eventbus.TopicSessionStart, s.clientState)
+	}
+	return err
 }
 
 func (s *ChatSession) HandleMqttHelloMessage(msg *ClientMessage) error {
@@ -540,6 +602,16 @@ func (s *ChatSession) HandleWebsocketHelloMessage(msg *ClientMessage) error {
 	return s.serverTransport.SendHello("websocket", &s.clientState.OutputAudioFormat, nil)
 }
 
+// HandleWebRTCHelloMessage 音频走 WebRTC 音轨, 上行帧长由客户端在 audio_params 中声明(浏览器通常为20ms)
+func (s *ChatSession) HandleWebRTCHelloMessage(msg *ClientMessage) error {
+	err := s.HandleCommonHelloMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.serverTransport.SendHello(types_conn.TransportTypeWebRTC, &s.clientState.OutputAudioFormat, nil)
+}
+
 // handleListenMessage 处理监听消息
 func (s *ChatSession) HandleListenMessage(msg *ClientMessage) error {
 	// 根据状态处理
@@ -748,6 +820,12 @@ func (s *ChatSession) HandleListenStart(msg *ClientMessage) error {
 		s.clientState.ListenMode = msg.Mode
 		log.Infof("设备 %s 拾音模式: %s", msg.DeviceID, msg.Mode)
 	}
+	// 插话打断后服务端已经开始了新一轮拾音, 设备收到 tts stop 后发来的 listen start 不再重新开始, 避免丢掉已识别的句首
+	if s.isRecentBargeIn() && s.clientState.GetStatus() == ClientStatusListening {
+		log.Debugf("设备 %s 刚刚插话打断, 已在拾音中, 忽略 listen start", msg.DeviceID)
+		return nil
+	}
+
 	//if s.clientState.ListenMode == "manual" {
 	s.StopSpeaking(false)
 	//}
@@ -788,9 +866,11 @@ func (s *ChatSession) OnListenStart() error {
 	}
 
 	// 启动asr流式识别，复用 restartAsrRecognition 函数
+	s.startTurnTrace()
 	err := s.asrManager.RestartAsrRecognition(ctx)
 	if err != nil {
 		log.Errorf("asr流式识别失败: %v", err)
+		s.turnTrace.end("ASR启动失败")
 		s.Close()
 		return err
 	}
@@ -813,6 +893,7 @@ func (s *ChatSession) OnListenStart() error {
 			select {
 			case <-ctx.Done():
 				log.Debugf("asr ctx done")
+				s.turnTrace.end("会话结束")
 				return
 			default:
 			}
@@ -820,18 +901,26 @@ func (s *ChatSession) OnListenStart() error {
 			text, isRetry, err := s.clientState.RetireAsrResult(ctx)
 			if err != nil {
 				log.Errorf("处理asr结果失败: %v", err)
+				metrics.IncProviderError(metrics.ComponentAsr, s.clientState.DeviceConfig.Asr.Provider)
+				s.turnTrace.end("ASR识别失败")
 				s.Close()
 				return
 			}
 			if !isRetry {
 				log.Debugf("asrResult is not retry, return")
+				s.turnTrace.end("ASR结束")
 				return
 			}
 
 			//统计asr耗时
 			log.Debugf("处理asr结果: %s, 耗时: %d ms", text, s.clientState.GetAsrDuration())
+			if text != "" && s.clientState.Statistic.AsrStartTs > 0 {
+				metrics.ObserveAsrLatency(s.clientState.DeviceConfig.Asr.Provider, time.Duration(s.clientState.GetAsrDuration())*time.Millisecond)
+			}
 
 			if text != "" {
+				traceCtx := s.turnTrace.take(text)
+
 				// 创建用户消息
 				userMsg := &schema.Message{
 					Role:    schema.User,
@@ -911,7 +1000,7 @@ func (s *ChatSession) OnListenStart() error {
 					log.Debugf("获取声纹识别结果: %+v", speakerResult)
 				}
 
-				err = s.AddAsrResultToQueue(text, speakerResult)
+				err = s.addAsrResultToQueue(text, speakerResult, traceCtx)
 				if err != nil {
 					log.Errorf("开始对话失败: %v", err)
 					s.Close()
@@ -919,6 +1008,7 @@ func (s *ChatSession) OnListenStart() error {
 				}
 
 				if s.clientState.IsRealTime() {
+					s.startTurnTrace()
 					if restartErr := s.asrManager.RestartAsrRecognition(ctx); restartErr != nil {
 						log.Errorf("重启ASR识别失败: %v", restartErr)
 						s.Close()
@@ -932,6 +1022,7 @@ func (s *ChatSession) OnListenStart() error {
 				select {
 				case <-ctx.Done():
 					log.Debugf("asr ctx done")
+					s.turnTrace.end("会话结束")
 					return
 				default:
 				}
@@ -941,6 +1032,7 @@ func (s *ChatSession) OnListenStart() error {
 					diffTs := time.Now().Unix() - startIdleTime
 					if startIdleTime > 0 && diffTs <= maxIdleTime {
 						log.Warnf("ASR识别结果为空，尝试重启ASR识别, diff ts: %s", diffTs)
+						s.startTurnTrace()
 						if restartErr := s.asrManager.RestartAsrRecognition(ctx); restartErr != nil {
 							log.Errorf("重启ASR识别失败: %v", restartErr)
 							s.Close()
@@ -949,20 +1041,36 @@ func (s *ChatSession) OnListenStart() error {
 						continue
 					} else {
 						log.Warnf("ASR识别结果为空，已达到最大空闲时间: %d", maxIdleTime)
+						s.turnTrace.end("空闲超时")
 						s.Close()
 						return
 					}
 				}
 			}
+			s.turnTrace.end("ASR识别结果为空")
 			return
 		}
 	}()
 	return nil
 }
 
+// startTurnTrace 开始新一轮对话的链路追踪
+func (s *ChatSession) startTurnTrace() {
+	s.turnTrace.start(s.clientState.SessionID, s.clientState.DeviceID, s.clientState.DeviceConfig.Asr.Provider)
+}
+
 // startChat 开始对话
 func (s *ChatSession) AddAsrResultToQueue(text string, speakerResult *speaker.IdentifyResult) error {
+	return s.addAsrResultToQueue(text, speakerResult, nil)
+}
+
+func (s *ChatSession) addAsrResultToQueue(text string, speakerResult *speaker.IdentifyResult, traceCtx context.Context) error {
 	log.Debugf("AddAsrResultToQueue text: %s", text)
+	if s.draining.Load() {
+		log.Infof("服务正在退出, 丢弃设备 %s 的新对话: %s", s.clientState.DeviceID, text)
+		tracing.EndSpan(trace.SpanFromContext(traceCtx), nil)
+		return nil
+	}
 	if speakerResult != nil && speakerResult.Identified {
 		log.Debugf("AddAsrResultToQueue speaker: %s (confidence: %.2f)", speakerResult.SpeakerName, speakerResult.Confidence)
 	}
@@ -971,10 +1079,12 @@ func (s *ChatSession) AddAsrResultToQueue(text string, speakerResult *speaker.Id
 		ctx:           s.clientState.AfterAsrSessionCtx.Get(sessionCtx),
 		text:          text,
 		speakerResult: speakerResult,
+		traceCtx:      traceCtx,
 	}
 	err := s.chatTextQueue.Push(item)
 	if err != nil {
 		log.Warnf("chatTextQueue 已满或已关闭, 丢弃消息")
+		tracing.EndSpan(trace.SpanFromContext(traceCtx), err)
 	}
 	return nil
 }
@@ -992,7 +1102,14 @@ func (s *ChatSession) processChatText(ctx context.Context) {
 			continue
 		}
 
-		err = s.actionDoChat(item.ctx, item.text, item.speakerResult)
+		if item.traceCtx == nil {
+			// 非语音输入（唤醒词文本、注入消息等）单独作为一轮
+			item.traceCtx, _ = tracing.StartTurn(context.Background(), s.clientState.SessionID, s.clientState.DeviceID)
+		}
+		s.activeTurns.Add(1)
+		err = s.actionDoChat(tracing.WithSpan(item.ctx, item.traceCtx), item.text, item.speakerResult)
+		s.activeTurns.Add(-1)
+		tracing.EndSpan(trace.SpanFromContext(item.traceCtx), err)
 		if err != nil {
 			log.Errorf("处理对话失败: %v", err)
 			continue
@@ -1004,6 +1121,37 @@ func (s *ChatSession) ClearChatTextQueue() {
 	s.chatTextQueue.Clear()
 }
 
+// Drain 不再接受新的对话, 等待进行中的对话和TTS播放结束, ctx 结束时返回 false
+func (s *ChatSession) Drain(ctx context.Context) bool {
+	s.draining.Store(true)
+
+	var sessionDone <-chan struct{}
+	if s.ctx != nil {
+		sessionDone = s.ctx.Done()
+	}
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	// 对话结束到异步TTS开始之间有间隙, 连续两次空闲才认为结束
+	idleCount := 0
+	for {
+		if s.activeTurns.Load() == 0 && s.chatTextQueue.Len() == 0 && !s.clientState.IsTtsPlaying() {
+			idleCount++
+		} else {
+			idleCount = 0
+		}
+		if idleCount >= 2 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-sessionDone:
+			return true
+		case <-ticker.C:
+		}
+	}
+}
+
 func (s *ChatSession) Close() {
 	deviceID := ""
 	if s.clientState != nil {
@@ -1058,6 +1206,11 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 
 	sessionID := clientState.SessionID
 
+	// 检查对话轮数、token 和 TTS 字数配额
+	if !s.checkTurnQuota(ctx) {
+		return nil
+	}
+
 	// 声纹识别后动态切换TTS（未识别到时恢复默认TTS）
 	if err := s.switchTTSForSpeaker(speakerResult); err != nil {
 		log.Warnf("切换TTS失败: %v", err)
@@ -1076,6 +1229,10 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 		log.Errorf("获取设备 %s 的工具失败: %v", clientState.DeviceID, err)
 		mcpTools = make(map[string]tool.InvokableTool)
 	}
+	// 智能体没有知识库时不提供检索工具
+	if !clientState.DeviceConfig.Knowledge {
+		delete(mcpTools, "search_knowledge")
+	}
 
 	// 将MCP工具转换为接口格式以便传递给转换函数
 	mcpToolsInterface := make(map[string]interface{})
@@ -1197,7 +1354,7 @@ func (s *ChatSession) switchTTSForSpeaker(speakerResult *speaker.IdentifyResult)
 	}
 
 	// 8. 保存到声纹TTS Provider（优先使用）
-	s.clientState.SpeakerTTSProvider = newTTSProvider
+	s.clientState.SpeakerTTSProvider = tts_cache.Wrap(newTTSProvider, targetTTSConfig.Provider, ttsConfig)
 
 	log.Infof("✅ 为说话人 %s 切换TTS成功 - Provider: %s, ConfigID: %s, Voice: %v",
 		speakerResult.SpeakerName,
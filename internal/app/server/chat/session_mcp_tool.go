@@ -3,6 +3,7 @@ package chat
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -11,7 +12,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+
+	userconfig "xiaozhi-esp32-server-golang/internal/domain/config"
+	"xiaozhi-esp32-server-golang/internal/domain/memory"
 	llm_memory "xiaozhi-esp32-server-golang/internal/domain/memory/llm_memory"
+	"xiaozhi-esp32-server-golang/internal/domain/reminder"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -76,6 +83,90 @@ func (c *ChatManager) LocalMcpClearHistory() error {
 	return nil
 }
 
+// errMemoryDisabled 未配置长期记忆
+var errMemoryDisabled = errors.New("未开启长期记忆")
+
+// memoryProvider 返回会话的长期记忆提供者, 未开启长期记忆时返回 errMemoryDisabled
+func (c *ChatManager) memoryProvider() (memory.MemoryProvider, error) {
+	provider := c.clientState.MemoryProvider
+	memoryType := memory.MemoryType(c.clientState.DeviceConfig.Memory.Provider)
+	if provider == nil || memoryType == "" || memoryType == memory.MemoryTypeNone {
+		return nil, errMemoryDisabled
+	}
+	return provider, nil
+}
+
+// 记住用户要求记住的事情
+func (c *ChatManager) LocalMcpRememberFact(ctx context.Context, fact string) error {
+	provider, err := c.memoryProvider()
+	if err != nil {
+		return err
+	}
+	if recaller, ok := provider.(memory.MemoryRecaller); ok {
+		return recaller.Remember(ctx, c.clientState.GetDeviceIDOrAgentID(), fact)
+	}
+	return provider.AddMessage(ctx, c.clientState.GetDeviceIDOrAgentID(), schema.Message{Role: schema.User, Content: fact})
+}
+
+// 检索长期记忆
+func (c *ChatManager) LocalMcpRecallMemory(ctx context.Context, query string) (string, error) {
+	provider, err := c.memoryProvider()
+	if err != nil {
+		return "", err
+	}
+	// 每轮对话前的检索可能被关闭, 工具调用是用户主动要求的, 优先使用不受开关限制的检索
+	if recaller, ok := provider.(memory.MemoryRecaller); ok {
+		return recaller.Recall(ctx, c.clientState.GetDeviceIDOrAgentID(), query, 5)
+	}
+	return provider.Search(ctx, c.clientState.GetDeviceIDOrAgentID(), query, 5, 0)
+}
+
+// 删除长期记忆
+func (c *ChatManager) LocalMcpForgetMemory(ctx context.Context, query string) (int, error) {
+	provider, err := c.memoryProvider()
+	if err != nil {
+		return 0, err
+	}
+	memoryID := c.clientState.GetDeviceIDOrAgentID()
+	if query == "" {
+		return 0, provider.ResetMemory(ctx, memoryID)
+	}
+	forgetter, ok := provider.(memory.MemoryForgetter)
+	if !ok {
+		return 0, fmt.Errorf("当前记忆类型 %s 不支持按内容删除", c.clientState.DeviceConfig.Memory.Provider)
+	}
+	return forgetter.Forget(ctx, memoryID, query)
+}
+
+// 检索智能体知识库
+func (c *ChatManager) LocalMcpSearchKnowledge(ctx context.Context, query string) (string, error) {
+	if !c.clientState.DeviceConfig.Knowledge {
+		return "", nil
+	}
+	configProvider, err := userconfig.GetProvider(viper.GetString("config_provider.type"))
+	if err != nil {
+		return "", err
+	}
+	return configProvider.SearchKnowledge(ctx, c.DeviceID, c.clientState.AgentID, query, 0)
+}
+
+// 设置定时提醒, 到时间后由设备播报
+func (c *ChatManager) LocalMcpSetReminder(ctx context.Context, r *reminder.Reminder) error {
+	r.DeviceID = c.DeviceID
+	r.AgentID = c.clientState.AgentID
+	return reminder.Get().Add(ctx, r)
+}
+
+// 查询当前设备的定时提醒
+func (c *ChatManager) LocalMcpListReminders(ctx context.Context) ([]reminder.Reminder, error) {
+	return reminder.Get().List(ctx, c.DeviceID)
+}
+
+// 取消当前设备的定时提醒
+func (c *ChatManager) LocalMcpCancelReminder(ctx context.Context, id string) (bool, error) {
+	return reminder.Get().Cancel(ctx, c.DeviceID, id)
+}
+
 type PlayMusicParams struct {
 	Name string `json:"name,omitempty" description:"音乐的名称"`
 	//Welcome string `json:"welcome" description:"搜索音乐会耗时过长，用于安抚用户的提示语" required:"true"`
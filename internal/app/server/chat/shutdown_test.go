@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/app/server/memconn"
+)
+
+// TestChatManagerShutdown 退出时等待正在播放的回复结束再关闭连接
+func TestChatManagerShutdown(t *testing.T) {
+	const deviceID = "e2e:00:00:00:00:02"
+	const reply = "好的，这是一段需要播放一会儿的回复。"
+
+	useMockConfig(t, map[string]interface{}{
+		"llm.provider": constants.LlmTypeMock,
+		"llm.mock": map[string]interface{}{
+			"type":    constants.LlmTypeMock,
+			"replies": []interface{}{reply},
+		},
+		"tts.provider": constants.TtsTypeMock,
+		"tts.mock":     map[string]interface{}{"char_duration_ms": 40},
+	})
+
+	conn := memconn.New(deviceID)
+	chatManager := startTestChatManager(t, deviceID, conn)
+
+	recv := func() map[string]interface{} {
+		msg, err := conn.DeviceRecvCmd(10 * time.Second)
+		if err != nil {
+			t.Fatalf("接收信令失败: %v", err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(msg, &m); err != nil {
+			t.Fatalf("解析信令失败: %s, %v", msg, err)
+		}
+		return m
+	}
+
+	conn.DeviceSendJSON(map[string]interface{}{
+		"type":      "hello",
+		"device_id": deviceID,
+		"transport": "websocket",
+		"audio_params": map[string]interface{}{
+			"format":         "opus",
+			"sample_rate":    16000,
+			"channels":       1,
+			"frame_duration": 60,
+		},
+	})
+	if hello := recv(); hello["type"] != "hello" {
+		t.Fatalf("期望 hello 响应, 实际: %v", hello)
+	}
+
+	if err := chatManager.InjectMessage("讲个故事", false); err != nil {
+		t.Fatalf("注入消息失败: %v", err)
+	}
+	for {
+		msg := recv()
+		if msg["type"] == "tts" && msg["state"] == "start" {
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	shutdownDone := make(chan struct{})
+	go func() {
+		chatManager.Shutdown(ctx)
+		close(shutdownDone)
+	}()
+
+	var sentenceEnd bool
+	for {
+		msg := recv()
+		if msg["type"] == "tts" && msg["state"] == "sentence_end" {
+			sentenceEnd = true
+		}
+		if msg["type"] == "tts" && msg["state"] == "stop" {
+			break
+		}
+	}
+	if !sentenceEnd {
+		t.Errorf("回复未播放完成就被中断")
+	}
+
+	// 退出中注入的新消息不会再开始一轮对话
+	chatManager.InjectMessage("再讲一个", false)
+
+	newTurn := func(msg []byte) {
+		var m map[string]interface{}
+		if json.Unmarshal(msg, &m) != nil {
+			return
+		}
+		if m["type"] == "stt" || (m["type"] == "tts" && m["state"] == "start") {
+			t.Errorf("退出中不应开始新一轮对话: %s", msg)
+		}
+	}
+	timeout := time.After(5 * time.Second)
+wait:
+	for {
+		select {
+		case msg := <-conn.DeviceCmdChan():
+			newTurn(msg)
+		case <-shutdownDone:
+			break wait
+		case <-timeout:
+			t.Fatalf("Shutdown 未在回复结束后返回")
+		}
+	}
+	for {
+		select {
+		case msg := <-conn.DeviceCmdChan():
+			newTurn(msg)
+			continue
+		default:
+		}
+		break
+	}
+	select {
+	case <-conn.Done():
+	default:
+		t.Errorf("Shutdown 后连接应已关闭")
+	}
+}
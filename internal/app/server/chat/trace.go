@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"xiaozhi-esp32-server-golang/internal/domain/tracing"
+)
+
+// turnTrace 记录当前正在收音的一轮对话的span
+// 拿到ASR结果后，整轮的上下文随 AsrResponseChannelItem 交给后续的LLM、TTS处理，当前记录清空，等待下一轮
+type turnTrace struct {
+	mu      sync.Mutex
+	ctx     context.Context // 包含整轮对话根span的上下文
+	span    trace.Span
+	vadSpan trace.Span
+	asrSpan trace.Span
+}
+
+// start 开始新的一轮，上一轮尚未拿到ASR结果时直接结束
+func (t *turnTrace) start(sessionID string, deviceID string, asrProvider string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.endLocked("未获取到识别结果")
+
+	t.ctx, t.span = tracing.StartTurn(context.Background(), sessionID, deviceID)
+	_, t.asrSpan = tracing.StartSpan(t.ctx, "asr", tracing.AttrProvider.String(asrProvider))
+}
+
+// startVad 检测到语音开始
+func (t *turnTrace) startVad(vadProvider string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ctx == nil || t.vadSpan != nil {
+		return
+	}
+	_, t.vadSpan = tracing.StartSpan(t.ctx, "vad", tracing.AttrProvider.String(vadProvider))
+}
+
+// endVad 检测到语音结束
+func (t *turnTrace) endVad() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.vadSpan != nil {
+		t.vadSpan.End()
+		t.vadSpan = nil
+	}
+}
+
+// take 拿到ASR结果后取出本轮的上下文，由调用方在对话结束时结束根span
+func (t *turnTrace) take(text string) context.Context {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ctx := t.ctx
+	if ctx == nil {
+		return nil
+	}
+	if t.vadSpan != nil {
+		t.vadSpan.End()
+	}
+	if t.asrSpan != nil {
+		t.asrSpan.SetAttributes(tracing.TextAttrs(tracing.AttrText, text)...)
+		t.asrSpan.End()
+	}
+	t.span.SetAttributes(tracing.TextAttrs("xiaozhi.asr_text", text)...)
+	t.ctx, t.span, t.vadSpan, t.asrSpan = nil, nil, nil, nil
+	return ctx
+}
+
+// end 未拿到ASR结果时结束本轮
+func (t *turnTrace) end(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.endLocked(reason)
+}
+
+func (t *turnTrace) endLocked(reason string) {
+	if t.ctx == nil {
+		return
+	}
+	if t.vadSpan != nil {
+		t.vadSpan.End()
+	}
+	if t.asrSpan != nil {
+		t.asrSpan.End()
+	}
+	t.span.SetAttributes(attribute.String("xiaozhi.end_reason", reason))
+	t.span.End()
+	t.ctx, t.span, t.vadSpan, t.asrSpan = nil, nil, nil, nil
+}
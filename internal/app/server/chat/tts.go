@@ -3,12 +3,19 @@ package chat
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
+	"xiaozhi-esp32-server-golang/internal/domain/quota"
+	"xiaozhi-esp32-server-golang/internal/domain/tracing"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type TTSQueueItem struct {
@@ -32,6 +39,27 @@ type TTSManager struct {
 	// 聊天历史音频缓存：持续累积多段TTS音频（Opus帧数组）
 	audioHistoryBuffer [][]byte
 	audioMutex         sync.Mutex
+
+	// 本轮已开始播放的句子，被插话打断时作为截断后的回复保存
+	spokenText  strings.Builder
+	spokenMutex sync.Mutex
+
+	textOnly bool // 只下发句子文本, 不合成音频
+	noPacing bool // 音频生成后立即下发, 不按播放速度流控
+}
+
+// WithTextOnly 只下发 sentence_start/sentence_end, 不调用TTS, 用于纯文本对话接口
+func WithTextOnly() TTSManagerOption {
+	return func(t *TTSManager) {
+		t.textOnly = true
+	}
+}
+
+// WithoutAudioPacing 音频帧生成后立即下发, 对端不是实时播放的设备时使用
+func WithoutAudioPacing() TTSManagerOption {
+	return func(t *TTSManager) {
+		t.noPacing = true
+	}
 }
 
 // NewTTSManager 只接受WithClientState
@@ -109,23 +137,47 @@ func (t *TTSManager) handleTextResponse(ctx context.Context, llmResponse llm_com
 }
 
 // 同步 TTS 处理
-func (t *TTSManager) handleTts(ctx context.Context, llmResponse llm_common.LLMResponseStruct) error {
+func (t *TTSManager) handleTts(ctx context.Context, llmResponse llm_common.LLMResponseStruct) (err error) {
 	log.Debugf("handleTts start, text: %s", llmResponse.Text)
 	if llmResponse.Text == "" {
 		return nil
 	}
 
+	ctx, span := tracing.StartSpan(ctx, "tts.sentence", tracing.AttrProvider.String(t.clientState.DeviceConfig.Tts.Provider))
+	span.SetAttributes(tracing.TextAttrs(tracing.AttrText, llmResponse.Text)...)
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	if t.textOnly {
+		t.spokenMutex.Lock()
+		t.spokenText.WriteString(llmResponse.Text)
+		t.spokenMutex.Unlock()
+		if err := t.serverTransport.SendSentenceStart(llmResponse.Text); err != nil {
+			return fmt.Errorf("发送 TTS 文本失败: %s, %v", llmResponse.Text, err)
+		}
+		return t.serverTransport.SendSentenceEnd(llmResponse.Text)
+	}
+
 	// 使用带上下文的TTS处理
+	t.clientState.SetStartTtsTs()
 	outputChan, err := t.clientState.GetTtsProvider().TextToSpeechStream(ctx, llmResponse.Text, t.clientState.OutputAudioFormat.SampleRate, t.clientState.OutputAudioFormat.Channels, t.clientState.OutputAudioFormat.FrameDuration)
 	if err != nil {
 		log.Errorf("生成 TTS 音频失败: %v", err)
+		metrics.IncProviderError(metrics.ComponentTts, t.clientState.DeviceConfig.Tts.Provider)
 		return fmt.Errorf("生成 TTS 音频失败: %v", err)
 	}
+	if countsTowardQuota(ctx) {
+		quota.Get().Add(ctx, quotaSubject(t.clientState), quota.MetricTTSChars, int64(utf8.RuneCountInString(llmResponse.Text)))
+	}
 
 	if err := t.serverTransport.SendSentenceStart(llmResponse.Text); err != nil {
 		log.Errorf("发送 TTS 文本失败: %s, %v", llmResponse.Text, err)
 		return fmt.Errorf("发送 TTS 文本失败: %s, %v", llmResponse.Text, err)
 	}
+	t.spokenMutex.Lock()
+	t.spokenText.WriteString(llmResponse.Text)
+	t.spokenMutex.Unlock()
 
 	// 发送音频帧
 	if err := t.SendTTSAudio(ctx, outputChan, llmResponse.IsStart); err != nil {
@@ -174,7 +226,7 @@ func (t *TTSManager) SendTTSAudio(ctx context.Context, audioChan chan []byte, is
 		now := time.Now()
 
 		// 如果下一帧时间还没到，需要等待
-		if now.Before(nextFrameTime) {
+		if !t.noPacing && now.Before(nextFrameTime) {
 			sleepDuration := nextFrameTime.Sub(now)
 			//log.Debugf("SendTTSAudio 流控等待: %v", sleepDuration)
 			time.Sleep(sleepDuration)
@@ -191,7 +243,7 @@ func (t *TTSManager) SendTTSAudio(ctx context.Context, audioChan chan []byte, is
 				// 为确保终端播放完成：等待已发送帧的总时长与从开始发送以来的实际耗时之间的差值
 				elapsed := time.Since(startTime)
 				totalDuration := time.Duration(totalFrames) * frameDuration
-				if totalDuration > elapsed {
+				if !t.noPacing && totalDuration > elapsed {
 					waitDuration := totalDuration - elapsed
 					log.Debugf("SendTTSAudio 等待客户端播放剩余缓冲: %v (totalFrames=%d, frameDuration=%v)", waitDuration, totalFrames, frameDuration)
 					time.Sleep(waitDuration)
@@ -218,9 +270,23 @@ func (t *TTSManager) SendTTSAudio(ctx context.Context, audioChan chan []byte, is
 				log.Debugf("SendTTSAudio 已发送 %d 帧", totalFrames)
 			}
 
+			if totalFrames == 1 {
+				trace.SpanFromContext(ctx).AddEvent("first_frame")
+			}
+
+			// TTS首帧耗时，由 handleTts 记录开始时间，每句只统计一次
+			if totalFrames == 1 {
+				if duration, ok := t.clientState.TakeTtsDuration(); ok {
+					metrics.ObserveTtsFirstFrame(t.clientState.DeviceConfig.Tts.Provider, time.Duration(duration)*time.Millisecond)
+				}
+			}
+
 			// 统计信息记录（仅在开始时记录一次）
 			if isStart && isStatistic && totalFrames == 1 {
 				log.Debugf("从接收音频结束 asr->llm->tts首帧 整体 耗时: %d ms", t.clientState.GetAsrLlmTtsDuration())
+				if t.clientState.Statistic.AsrStartTs > 0 {
+					metrics.ObserveTurnLatency(time.Duration(t.clientState.GetAsrLlmTtsDuration()) * time.Millisecond)
+				}
 				isStatistic = false
 			}
 		}
@@ -242,3 +308,17 @@ func (t *TTSManager) GetAndClearAudioHistory() [][]byte {
 	t.audioHistoryBuffer = nil
 	return data
 }
+
+// ResetSpokenText 清空本轮已播放的文本
+func (t *TTSManager) ResetSpokenText() {
+	t.spokenMutex.Lock()
+	defer t.spokenMutex.Unlock()
+	t.spokenText.Reset()
+}
+
+// GetSpokenText 获取本轮已开始播放的文本
+func (t *TTSManager) GetSpokenText() string {
+	t.spokenMutex.Lock()
+	defer t.spokenMutex.Unlock()
+	return t.spokenText.String()
+}
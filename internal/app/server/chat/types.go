@@ -1,6 +1,10 @@
 package chat
 
-import "context"
+import (
+	"context"
+
+	"xiaozhi-esp32-server-golang/internal/domain/reminder"
+)
 
 // ChatSessionOperator 定义 local mcp tool 需要的 ChatSession 操作接口
 // 这个接口用于解耦 LLMManager 和 ChatSession，避免循环依赖
@@ -14,6 +18,27 @@ type ChatSessionOperator interface {
 	// LocalMcpPlayMusic 播放音乐
 	LocalMcpPlayMusic(ctx context.Context, params *PlayMusicParams) error
 
+	// LocalMcpRememberFact 将用户要求记住的事情保存到长期记忆
+	LocalMcpRememberFact(ctx context.Context, fact string) error
+
+	// LocalMcpRecallMemory 从长期记忆中检索与 query 相关的内容
+	LocalMcpRecallMemory(ctx context.Context, query string) (string, error)
+
+	// LocalMcpForgetMemory 删除与 query 相关的长期记忆, query 为空时清空全部长期记忆, 返回删除的条数
+	LocalMcpForgetMemory(ctx context.Context, query string) (int, error)
+
+	// LocalMcpSearchKnowledge 检索智能体知识库
+	LocalMcpSearchKnowledge(ctx context.Context, query string) (string, error)
+
+	// LocalMcpSetReminder 为当前设备设置定时提醒, 成功后 r 中填充 ID 和下次提醒时间
+	LocalMcpSetReminder(ctx context.Context, r *reminder.Reminder) error
+
+	// LocalMcpListReminders 当前设备的全部提醒
+	LocalMcpListReminders(ctx context.Context) ([]reminder.Reminder, error)
+
+	// LocalMcpCancelReminder 取消当前设备的提醒, 提醒不存在时返回 false
+	LocalMcpCancelReminder(ctx context.Context, id string) (bool, error)
+
 	// 未来可以根据需要添加其他操作
 	// GetDeviceID() string
 	// IsActive() bool
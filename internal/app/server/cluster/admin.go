@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// NodeStatus 节点状态
+type NodeStatus struct {
+	NodeID    string   `json:"node_id"`
+	Draining  bool     `json:"draining"`
+	Devices   []string `json:"devices"`
+	McpAgents []string `json:"mcp_agents"`
+	Remaining int      `json:"remaining,omitempty"`
+}
+
+// Status 本节点状态
+func (c *Cluster) Status() NodeStatus {
+	status := NodeStatus{
+		NodeID:    c.config.NodeID,
+		Draining:  c.IsDraining(),
+		Devices:   c.OwnedDevices(),
+		McpAgents: []string{},
+	}
+	if status.Devices == nil {
+		status.Devices = []string{}
+	}
+	c.mcpAgents.Range(func(key, _ interface{}) bool {
+		status.McpAgents = append(status.McpAgents, key.(string))
+		return true
+	})
+	return status
+}
+
+// AdminEnabled 是否开放节点管理接口, 未配置 admin_token 时不开放
+func (c *Cluster) AdminEnabled() bool {
+	return c.config.AdminToken != ""
+}
+
+// HandleAdmin 节点管理接口, 需要 Authorization: Bearer <admin_token>
+//
+//	GET  /admin/cluster        查看本节点状态
+//	POST /admin/cluster/drain  下线本节点, 交出所有设备后返回, 之后可以安全地停止进程
+func (c *Cluster) HandleAdmin(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !c.AdminEnabled() || subtle.ConstantTimeCompare([]byte(token), []byte(c.config.AdminToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && strings.TrimSuffix(r.URL.Path, "/") == "/admin/cluster":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Status())
+	case r.Method == http.MethodPost && strings.TrimSuffix(r.URL.Path, "/") == "/admin/cluster/drain":
+		// 不跟随请求的 context, 调用方断开时也要完成迁移, 否则设备会被提前释放
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.DrainTimeout)
+		defer cancel()
+		remaining := c.Drain(ctx)
+		status := c.Status()
+		status.Remaining = remaining
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
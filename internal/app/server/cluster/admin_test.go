@@ -0,0 +1,83 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestAdminCluster(t *testing.T, token string) *Cluster {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	c := newCluster(Config{
+		NodeID:       "node-a",
+		OwnershipTTL: 30 * time.Second,
+		DrainTimeout: 5 * time.Second,
+		AdminToken:   token,
+	}, "xiaozhi")
+	c.client = client
+	return c
+}
+
+func TestHandleAdminAuth(t *testing.T) {
+	cases := []struct {
+		token  string
+		header string
+		want   int
+	}{
+		// 未配置令牌时不开放
+		{"", "", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tc := range cases {
+		c := newTestAdminCluster(t, tc.token)
+		req := httptest.NewRequest(http.MethodGet, "/admin/cluster", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		w := httptest.NewRecorder()
+		c.HandleAdmin(w, req)
+		if w.Code != tc.want {
+			t.Errorf("token=%q header=%q: 状态码 %d, 期望 %d", tc.token, tc.header, w.Code, tc.want)
+		}
+	}
+}
+
+// TestHandleAdminDrainDetached 调用方断开后仍然等待设备迁移完成, 不提前释放设备
+func TestHandleAdminDrainDetached(t *testing.T) {
+	c := newTestAdminCluster(t, "secret")
+	c.ownedDevices.Store("dev-1", struct{}{})
+	c.onDrain = func(ctx context.Context, deviceID string) {
+		go func() {
+			time.Sleep(700 * time.Millisecond)
+			c.ownedDevices.Delete(deviceID)
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/admin/cluster/drain", nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	c.HandleAdmin(w, req)
+
+	var status NodeStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if status.Remaining != 0 || len(status.Devices) != 0 || !status.Draining {
+		t.Errorf("下线结果错误: %+v", status)
+	}
+}
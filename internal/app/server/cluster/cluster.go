@@ -0,0 +1,377 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+
+	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	nodeStateActive   = "active"
+	nodeStateDraining = "draining"
+)
+
+// Config 集群配置, 对应 cluster
+type Config struct {
+	NodeID       string
+	OwnershipTTL time.Duration // 设备归属和节点存活记录的过期时间, 每 1/3 周期续期
+	RpcTimeout   time.Duration // 跨节点调用超时
+	DrainTimeout time.Duration // 节点下线时等待设备迁移的最长时间
+	AdminToken   string
+}
+
+// LoadConfig 从 cluster 配置读取, node_id 为空时使用 hostname
+func LoadConfig() Config {
+	cfg := Config{
+		NodeID:       viper.GetString("cluster.node_id"),
+		OwnershipTTL: time.Duration(viper.GetInt("cluster.ownership_ttl")) * time.Second,
+		RpcTimeout:   time.Duration(viper.GetInt("cluster.rpc_timeout")) * time.Second,
+		DrainTimeout: time.Duration(viper.GetInt("cluster.drain_timeout")) * time.Second,
+		AdminToken:   viper.GetString("cluster.admin_token"),
+	}
+	if cfg.NodeID == "" {
+		cfg.NodeID, _ = os.Hostname()
+	}
+	if cfg.OwnershipTTL <= 0 {
+		cfg.OwnershipTTL = 30 * time.Second
+	}
+	if cfg.RpcTimeout <= 0 {
+		cfg.RpcTimeout = 10 * time.Second
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 60 * time.Second
+	}
+	return cfg
+}
+
+// Cluster 多实例部署时的节点协调
+//
+// 设备归属: {prefix}:cluster:device:{device_id} -> 节点ID, 由持有设备会话的节点定期续期,
+// MQTT 消息所有节点都会收到, 只有认领成功的节点处理; 节点挂掉后记录过期, 设备重新 hello 时由其它节点认领
+// 节点存活: {prefix}:cluster:node:{node_id} -> active/draining
+// ws endpoint MCP: {prefix}:cluster:mcp:{agent_id} 哈希, 字段为节点ID, 值为最后续期时间
+// 跨节点调用: 每个节点订阅 {prefix}:cluster:rpc:{node_id}, 请求和响应都通过该频道发送
+type Cluster struct {
+	config Config
+	client *redis.Client
+	prefix string
+
+	publish func(ctx context.Context, channel string, payload []byte) (int64, error)
+
+	// 本节点持有的设备和有 ws endpoint MCP 连接的智能体
+	ownedDevices sync.Map
+	mcpAgents    sync.Map
+
+	handlers   map[string]Handler
+	handlersMu sync.RWMutex
+	pending    sync.Map
+	seq        atomic.Uint64
+
+	draining atomic.Bool
+	onDrain  func(ctx context.Context, deviceID string)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// ClusterOption 用于配置 Cluster 的可选参数
+type ClusterOption func(*Cluster)
+
+// WithHandoff 节点下线时对本节点的每个设备调用, 由调用方在 ctx 结束前关闭设备会话让设备重连到其它节点
+func WithHandoff(onDrain func(ctx context.Context, deviceID string)) ClusterOption {
+	return func(c *Cluster) {
+		c.onDrain = onDrain
+	}
+}
+
+// New 创建集群节点, 需要先初始化 Redis
+func New(config Config, opts ...ClusterOption) (*Cluster, error) {
+	client := i_redis.GetClient()
+	if client == nil {
+		return nil, errors.New("集群模式需要Redis, Redis客户端未初始化")
+	}
+	if config.NodeID == "" {
+		return nil, errors.New("集群节点ID不能为空")
+	}
+	c := newCluster(config, viper.GetString("redis.key_prefix"), opts...)
+	c.client = client
+	c.publish = func(ctx context.Context, channel string, payload []byte) (int64, error) {
+		return client.Publish(ctx, channel, payload).Result()
+	}
+	return c, nil
+}
+
+func newCluster(config Config, prefix string, opts ...ClusterOption) *Cluster {
+	c := &Cluster{
+		config:   config,
+		prefix:   prefix,
+		handlers: make(map[string]Handler),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.registerMcpHandlers()
+	return c
+}
+
+// NodeID 本节点ID
+func (c *Cluster) NodeID() string {
+	return c.config.NodeID
+}
+
+// IsDraining 节点是否正在下线, 下线中不再接受新设备
+func (c *Cluster) IsDraining() bool {
+	return c.draining.Load()
+}
+
+// Start 注册节点并订阅跨节点调用
+func (c *Cluster) Start() error {
+	if err := c.heartbeat(c.ctx); err != nil {
+		return fmt.Errorf("注册集群节点失败: %v", err)
+	}
+	pubsub := c.client.Subscribe(c.ctx, c.rpcChannel(c.config.NodeID))
+	if _, err := pubsub.Receive(c.ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("订阅集群频道失败: %v", err)
+	}
+	go c.serve(pubsub)
+	go c.keepalive()
+	log.Infof("集群节点 %s 已启动", c.config.NodeID)
+	return nil
+}
+
+// Stop 释放本节点持有的设备并注销节点
+func (c *Cluster) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.ownedDevices.Range(func(key, _ interface{}) bool {
+		c.ReleaseDevice(ctx, key.(string))
+		return true
+	})
+	c.mcpAgents.Range(func(key, _ interface{}) bool {
+		c.client.HDel(ctx, c.mcpKey(key.(string)), c.config.NodeID)
+		return true
+	})
+	c.client.Del(ctx, c.nodeKey(c.config.NodeID))
+	c.cancel()
+	log.Infof("集群节点 %s 已注销", c.config.NodeID)
+}
+
+func (c *Cluster) key(parts ...string) string {
+	key := "cluster"
+	for _, part := range parts {
+		key += ":" + part
+	}
+	return i_redis.GetKeyWithPrefix(c.prefix, key)
+}
+
+func (c *Cluster) nodeKey(nodeID string) string {
+	return c.key("node", nodeID)
+}
+
+func (c *Cluster) deviceKey(deviceID string) string {
+	return c.key("device", deviceID)
+}
+
+func (c *Cluster) mcpKey(agentID string) string {
+	return c.key("mcp", agentID)
+}
+
+func (c *Cluster) rpcChannel(nodeID string) string {
+	return c.key("rpc", nodeID)
+}
+
+// 归属节点存活且未下线时保留, 否则由当前节点认领
+var claimScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	if redis.call('GET', ARGV[3] .. owner) == 'active' then
+		return owner
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return ARGV[1]
+`)
+
+// 强制认领, 返回之前的归属节点
+var takeScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+if owner then
+	return owner
+end
+return ''
+`)
+
+// 只处理归属于当前节点的记录, ARGV[2] 为空时删除, 否则续期
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == '' then
+	return redis.call('DEL', KEYS[1])
+end
+return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+`)
+
+// ClaimDevice 认领设备, 返回设备当前的归属节点, 等于 NodeID() 表示认领成功
+// 下线中的节点不认领新设备
+func (c *Cluster) ClaimDevice(ctx context.Context, deviceID string) (string, error) {
+	if c.IsDraining() {
+		return c.DeviceOwner(ctx, deviceID)
+	}
+	owner, err := claimScript.Run(ctx, c.client,
+		[]string{c.deviceKey(deviceID)},
+		c.config.NodeID, c.config.OwnershipTTL.Milliseconds(), c.nodeKey(""),
+	).Text()
+	if err != nil {
+		return "", err
+	}
+	if owner == c.config.NodeID {
+		c.ownedDevices.Store(deviceID, struct{}{})
+	}
+	return owner, nil
+}
+
+// TakeDevice 设备直连到本节点(websocket/webrtc)时强制认领, 返回之前的归属节点
+func (c *Cluster) TakeDevice(ctx context.Context, deviceID string) (string, error) {
+	prevOwner, err := takeScript.Run(ctx, c.client,
+		[]string{c.deviceKey(deviceID)},
+		c.config.NodeID, c.config.OwnershipTTL.Milliseconds(),
+	).Text()
+	if err != nil {
+		return "", err
+	}
+	c.ownedDevices.Store(deviceID, struct{}{})
+	return prevOwner, nil
+}
+
+// ReleaseDevice 设备会话结束时释放归属, 已被其它节点认领时不处理
+func (c *Cluster) ReleaseDevice(ctx context.Context, deviceID string) {
+	c.ownedDevices.Delete(deviceID)
+	if err := releaseScript.Run(ctx, c.client, []string{c.deviceKey(deviceID)}, c.config.NodeID, "").Err(); err != nil {
+		log.Warnf("释放设备 %s 归属失败: %v", deviceID, err)
+	}
+}
+
+// DeviceOwner 设备当前的归属节点, 没有节点持有时返回空
+func (c *Cluster) DeviceOwner(ctx context.Context, deviceID string) (string, error) {
+	owner, err := c.client.Get(ctx, c.deviceKey(deviceID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return owner, err
+}
+
+// OwnedDevices 本节点持有的设备
+func (c *Cluster) OwnedDevices() []string {
+	var devices []string
+	c.ownedDevices.Range(func(key, _ interface{}) bool {
+		devices = append(devices, key.(string))
+		return true
+	})
+	return devices
+}
+
+func (c *Cluster) keepalive() {
+	ticker := time.NewTicker(c.config.OwnershipTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(c.ctx, c.config.OwnershipTTL/3)
+			if err := c.heartbeat(ctx); err != nil {
+				log.Errorf("集群节点 %s 续期失败: %v", c.config.NodeID, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// heartbeat 续期节点存活、设备归属和 ws endpoint MCP 记录
+func (c *Cluster) heartbeat(ctx context.Context) error {
+	state := nodeStateActive
+	if c.IsDraining() {
+		state = nodeStateDraining
+	}
+	ttl := c.config.OwnershipTTL
+	if err := c.client.Set(ctx, c.nodeKey(c.config.NodeID), state, ttl).Err(); err != nil {
+		return err
+	}
+
+	pipe := c.client.Pipeline()
+	var devices []string
+	c.ownedDevices.Range(func(key, _ interface{}) bool {
+		deviceID := key.(string)
+		devices = append(devices, deviceID)
+		// pipeline 中无法在 NOSCRIPT 时回退, 直接发送脚本
+		releaseScript.Eval(ctx, pipe, []string{c.deviceKey(deviceID)}, c.config.NodeID, ttl.Milliseconds())
+		return true
+	})
+	c.syncMcpAgents(ctx, pipe)
+	cmds, err := pipe.Exec(ctx)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	for i, deviceID := range devices {
+		// 归属已被其它节点抢走, 设备已经重连到其它节点
+		if n, _ := cmds[i].(*redis.Cmd).Int(); n == 0 {
+			log.Warnf("设备 %s 已不再归属于节点 %s", deviceID, c.config.NodeID)
+			c.ownedDevices.Delete(deviceID)
+		}
+	}
+	return nil
+}
+
+// Drain 节点下线: 不再认领新设备, 交出本节点的所有设备, 等待设备会话结束(ReleaseDevice)或超时
+// 返回超时后仍未迁移的设备数, 这些设备的归属会被直接释放
+func (c *Cluster) Drain(ctx context.Context) int {
+	if !c.draining.CompareAndSwap(false, true) {
+		log.Warnf("集群节点 %s 已在下线中", c.config.NodeID)
+	}
+	if err := c.heartbeat(ctx); err != nil {
+		log.Errorf("集群节点 %s 标记下线失败: %v", c.config.NodeID, err)
+	}
+
+	devices := c.OwnedDevices()
+	log.Infof("集群节点 %s 开始下线, 需要迁移 %d 个设备", c.config.NodeID, len(devices))
+	if c.onDrain != nil {
+		for _, deviceID := range devices {
+			c.onDrain(ctx, deviceID)
+		}
+	}
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		remaining := c.OwnedDevices()
+		if len(remaining) == 0 {
+			log.Infof("集群节点 %s 设备迁移完成", c.config.NodeID)
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			log.Warnf("集群节点 %s 下线超时, 仍有 %d 个设备: %v", c.config.NodeID, len(remaining), remaining)
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			for _, deviceID := range remaining {
+				c.ReleaseDevice(releaseCtx, deviceID)
+			}
+			cancel()
+			return len(remaining)
+		case <-ticker.C:
+		}
+	}
+}
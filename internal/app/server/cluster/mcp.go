@@ -0,0 +1,172 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/redis/go-redis/v9"
+
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+type mcpToolsRequest struct {
+	AgentID string `json:"agent_id"`
+}
+
+type mcpCallRequest struct {
+	AgentID   string `json:"agent_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// remoteToolInfo 工具描述, 参数以 OpenAPI V3 schema 传输
+type remoteToolInfo struct {
+	Name   string          `json:"name"`
+	Desc   string          `json:"desc"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// remoteTool 其它节点上的 ws endpoint MCP 工具, 调用时转发到该节点
+type remoteTool struct {
+	cluster *Cluster
+	nodeID  string
+	agentID string
+	info    *schema.ToolInfo
+}
+
+func (t *remoteTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return t.info, nil
+}
+
+func (t *remoteTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	var result string
+	err := t.cluster.Call(ctx, t.nodeID, MethodMcpCallTool, mcpCallRequest{
+		AgentID:   t.agentID,
+		Name:      t.info.Name,
+		Arguments: argumentsInJSON,
+	}, &result)
+	if err != nil {
+		return "", fmt.Errorf("调用节点 %s 上的工具 %s 失败: %v", t.nodeID, t.info.Name, err)
+	}
+	return result, nil
+}
+
+func (c *Cluster) registerMcpHandlers() {
+	c.Handle(MethodMcpListTools, func(ctx context.Context, data json.RawMessage) (interface{}, error) {
+		var req mcpToolsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		tools, err := mcp.GetWsEndpointMcpTools(req.AgentID)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]remoteToolInfo, 0, len(tools))
+		for name, invokableTool := range tools {
+			info, err := invokableTool.Info(ctx)
+			if err != nil {
+				log.Warnf("获取工具 %s 信息失败: %v", name, err)
+				continue
+			}
+			remoteInfo := remoteToolInfo{Name: info.Name, Desc: info.Desc}
+			if info.ParamsOneOf != nil {
+				params, err := info.ParamsOneOf.ToOpenAPIV3()
+				if err != nil {
+					log.Warnf("转换工具 %s 参数失败: %v", name, err)
+					continue
+				}
+				if remoteInfo.Params, err = json.Marshal(params); err != nil {
+					continue
+				}
+			}
+			infos = append(infos, remoteInfo)
+		}
+		return infos, nil
+	})
+
+	c.Handle(MethodMcpCallTool, func(ctx context.Context, data json.RawMessage) (interface{}, error) {
+		var req mcpCallRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		tools, err := mcp.GetWsEndpointMcpTools(req.AgentID)
+		if err != nil {
+			return nil, err
+		}
+		invokableTool, ok := tools[req.Name]
+		if !ok {
+			return nil, fmt.Errorf("节点 %s 上没有智能体 %s 的工具 %s", c.config.NodeID, req.AgentID, req.Name)
+		}
+		return invokableTool.InvokableRun(ctx, req.Arguments)
+	})
+}
+
+// syncMcpAgents 在心跳中登记本节点上有 ws endpoint MCP 连接的智能体, 注销已断开的
+func (c *Cluster) syncMcpAgents(ctx context.Context, pipe redis.Pipeliner) {
+	current := make(map[string]bool)
+	now := time.Now().UnixMilli()
+	for _, agentID := range mcp.GetWsEndpointAgentIds() {
+		current[agentID] = true
+		pipe.HSet(ctx, c.mcpKey(agentID), c.config.NodeID, now)
+		pipe.PExpire(ctx, c.mcpKey(agentID), c.config.OwnershipTTL)
+		c.mcpAgents.Store(agentID, struct{}{})
+	}
+	c.mcpAgents.Range(func(key, _ interface{}) bool {
+		agentID := key.(string)
+		if !current[agentID] {
+			pipe.HDel(ctx, c.mcpKey(agentID), c.config.NodeID)
+			c.mcpAgents.Delete(agentID)
+		}
+		return true
+	})
+}
+
+// RemoteMcpTools 智能体连接在其它节点上的 ws endpoint MCP 工具
+func (c *Cluster) RemoteMcpTools(agentID string) map[string]tool.InvokableTool {
+	tools := make(map[string]tool.InvokableTool)
+	if agentID == "" {
+		return tools
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, c.config.RpcTimeout)
+	defer cancel()
+
+	entries, err := c.client.HGetAll(ctx, c.mcpKey(agentID)).Result()
+	if err != nil {
+		log.Errorf("获取智能体 %s 的MCP节点失败: %v", agentID, err)
+		return tools
+	}
+	expireBefore := time.Now().Add(-c.config.OwnershipTTL).UnixMilli()
+	for nodeID, lastSeen := range entries {
+		if nodeID == c.config.NodeID {
+			continue
+		}
+		if ts, _ := strconv.ParseInt(lastSeen, 10, 64); ts < expireBefore {
+			continue
+		}
+		var infos []remoteToolInfo
+		if err := c.Call(ctx, nodeID, MethodMcpListTools, mcpToolsRequest{AgentID: agentID}, &infos); err != nil {
+			log.Warnf("获取节点 %s 上智能体 %s 的MCP工具失败: %v", nodeID, agentID, err)
+			continue
+		}
+		for _, info := range infos {
+			toolInfo := &schema.ToolInfo{Name: info.Name, Desc: info.Desc}
+			if len(info.Params) > 0 {
+				params := &openapi3.Schema{}
+				if err := json.Unmarshal(info.Params, params); err != nil {
+					log.Warnf("解析工具 %s 参数失败: %v", info.Name, err)
+					continue
+				}
+				toolInfo.ParamsOneOf = schema.NewParamsOneOfByOpenAPIV3(params)
+			}
+			tools[info.Name] = &remoteTool{cluster: c, nodeID: nodeID, agentID: agentID, info: toolInfo}
+		}
+	}
+	return tools
+}
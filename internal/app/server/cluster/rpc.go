@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 内置的跨节点调用方法
+const (
+	MethodInjectMessage = "device.inject"
+	MethodKickDevice    = "device.kick"
+	MethodMcpListTools  = "mcp.list_tools"
+	MethodMcpCallTool   = "mcp.call_tool"
+)
+
+// ErrNodeUnavailable 目标节点没有订阅频道, 通常是节点已经下线
+var ErrNodeUnavailable = errors.New("集群节点不可用")
+
+// Handler 处理其它节点发来的调用, 返回值会序列化为 JSON 作为响应
+type Handler func(ctx context.Context, data json.RawMessage) (interface{}, error)
+
+// envelope 频道中传输的请求和响应
+type envelope struct {
+	ID     string          `json:"id"`
+	From   string          `json:"from"`
+	Method string          `json:"method,omitempty"`
+	Reply  bool            `json:"reply,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Handle 注册调用处理函数, 同名方法会被覆盖
+func (c *Cluster) Handle(method string, handler Handler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	c.handlers[method] = handler
+}
+
+// Call 调用指定节点的方法并等待响应, resp 为 nil 时忽略响应内容
+func (c *Cluster) Call(ctx context.Context, nodeID string, method string, req interface{}, resp interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+	msg := envelope{
+		ID:     fmt.Sprintf("%s-%d", c.config.NodeID, c.seq.Add(1)),
+		From:   c.config.NodeID,
+		Method: method,
+		Data:   data,
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+
+	replyChan := make(chan *envelope, 1)
+	c.pending.Store(msg.ID, replyChan)
+	defer c.pending.Delete(msg.ID)
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.RpcTimeout)
+	defer cancel()
+
+	receivers, err := c.publish(ctx, c.rpcChannel(nodeID), payload)
+	if err != nil {
+		return fmt.Errorf("发送请求到节点 %s 失败: %v", nodeID, err)
+	}
+	if receivers == 0 {
+		return fmt.Errorf("%w: %s", ErrNodeUnavailable, nodeID)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("调用节点 %s 的 %s 超时: %v", nodeID, method, ctx.Err())
+	case reply := <-replyChan:
+		if reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+		if resp == nil || len(reply.Data) == 0 {
+			return nil
+		}
+		return json.Unmarshal(reply.Data, resp)
+	}
+}
+
+func (c *Cluster) serve(pubsub *redis.PubSub) {
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			c.onMessage([]byte(msg.Payload))
+		}
+	}
+}
+
+// onMessage 响应交给等待中的 Call, 请求在新的 goroutine 中处理, 避免阻塞频道
+func (c *Cluster) onMessage(payload []byte) {
+	var msg envelope
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Errorf("解析集群消息失败: %v", err)
+		return
+	}
+	if msg.Reply {
+		if replyChan, ok := c.pending.Load(msg.ID); ok {
+			replyChan.(chan *envelope) <- &msg
+		}
+		return
+	}
+	go c.handleRequest(&msg)
+}
+
+func (c *Cluster) handleRequest(msg *envelope) {
+	reply := envelope{ID: msg.ID, From: c.config.NodeID, Reply: true}
+
+	c.handlersMu.RLock()
+	handler, ok := c.handlers[msg.Method]
+	c.handlersMu.RUnlock()
+	if !ok {
+		reply.Error = fmt.Sprintf("节点 %s 不支持的方法: %s", c.config.NodeID, msg.Method)
+	} else {
+		ctx, cancel := context.WithTimeout(c.ctx, c.config.RpcTimeout)
+		result, err := handler(ctx, msg.Data)
+		cancel()
+		if err != nil {
+			reply.Error = err.Error()
+		} else if result != nil {
+			if reply.Data, err = json.Marshal(result); err != nil {
+				reply.Error = fmt.Sprintf("序列化响应失败: %v", err)
+			}
+		}
+	}
+
+	payload, _ := json.Marshal(reply)
+	ctx, cancel := context.WithTimeout(c.ctx, c.config.RpcTimeout)
+	defer cancel()
+	if _, err := c.publish(ctx, c.rpcChannel(msg.From), payload); err != nil {
+		log.Errorf("响应节点 %s 的 %s 调用失败: %v", msg.From, msg.Method, err)
+	}
+}
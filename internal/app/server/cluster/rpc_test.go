@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestNodes 创建通过内存频道互通的节点, 不依赖 Redis
+func newTestNodes(nodeIDs ...string) map[string]*Cluster {
+	nodes := make(map[string]*Cluster)
+	for _, nodeID := range nodeIDs {
+		nodes[nodeID] = newCluster(Config{NodeID: nodeID, RpcTimeout: time.Second}, "xiaozhi")
+	}
+	for _, node := range nodes {
+		node.publish = func(ctx context.Context, channel string, payload []byte) (int64, error) {
+			for _, target := range nodes {
+				if target.rpcChannel(target.NodeID()) == channel {
+					target.onMessage(payload)
+					return 1, nil
+				}
+			}
+			return 0, nil
+		}
+	}
+	return nodes
+}
+
+func TestCall(t *testing.T) {
+	nodes := newTestNodes("node-a", "node-b")
+	type injectReq struct {
+		DeviceID string `json:"device_id"`
+	}
+	nodes["node-b"].Handle(MethodInjectMessage, func(ctx context.Context, data json.RawMessage) (interface{}, error) {
+		var req injectReq
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		if req.DeviceID != "dev-1" {
+			return nil, errors.New("device not found")
+		}
+		return "ok:" + req.DeviceID, nil
+	})
+
+	var result string
+	if err := nodes["node-a"].Call(context.Background(), "node-b", MethodInjectMessage, injectReq{DeviceID: "dev-1"}, &result); err != nil {
+		t.Fatalf("调用失败: %v", err)
+	}
+	if result != "ok:dev-1" {
+		t.Errorf("响应错误: %s", result)
+	}
+
+	err := nodes["node-a"].Call(context.Background(), "node-b", MethodInjectMessage, injectReq{DeviceID: "dev-2"}, &result)
+	if err == nil || err.Error() != "device not found" {
+		t.Errorf("应返回对端的错误: %v", err)
+	}
+
+	err = nodes["node-a"].Call(context.Background(), "node-b", "unknown", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "不支持的方法") {
+		t.Errorf("未注册的方法应返回错误: %v", err)
+	}
+
+	err = nodes["node-a"].Call(context.Background(), "node-c", MethodKickDevice, nil, nil)
+	if !errors.Is(err, ErrNodeUnavailable) {
+		t.Errorf("节点不存在时应返回 ErrNodeUnavailable: %v", err)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	nodes := newTestNodes("node-a", "node-b")
+	nodes["node-b"].Handle(MethodKickDevice, func(ctx context.Context, data json.RawMessage) (interface{}, error) {
+		time.Sleep(2 * time.Second)
+		return nil, nil
+	})
+
+	start := time.Now()
+	err := nodes["node-a"].Call(context.Background(), "node-b", MethodKickDevice, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Errorf("应返回超时错误: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("超时时间错误: %v", elapsed)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	c := newCluster(Config{NodeID: "node-a"}, "xiaozhi")
+	if key := c.deviceKey("aa:bb"); key != "xiaozhi:cluster:device:aa:bb" {
+		t.Errorf("设备归属key错误: %s", key)
+	}
+	if key := c.rpcChannel("node-a"); key != "xiaozhi:cluster:rpc:node-a" {
+		t.Errorf("频道名错误: %s", key)
+	}
+	// claimScript 通过拼接前缀获取节点存活key
+	if c.nodeKey("")+"node-a" != c.nodeKey("node-a") {
+		t.Errorf("节点key前缀错误: %s", c.nodeKey(""))
+	}
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
+	"time"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
 	"xiaozhi-esp32-server-golang/internal/domain/memory/llm_memory"
@@ -10,9 +13,15 @@ import (
 	"github.com/panjf2000/ants/v2"
 )
 
+// addMessageTimeout 单条消息写入记忆的超时
+const addMessageTimeout = 30 * time.Second
+
 type EventHandle struct {
 	addMessagePool *ants.Pool
 	sessionEndPool *ants.Pool
+
+	// 上次 Flush 之后写入失败的任务数
+	failed atomic.Int64
 }
 
 func NewEventHandle() (*EventHandle, error) {
@@ -52,20 +61,28 @@ func (s *EventHandle) HandleAddMessage() {
 			// 只处理第一阶段：保存到 Redis 记忆体（仅文本）
 			// 第二阶段（IsUpdate=true）不需要更新 Redis，因为 Redis 记忆体不需要音频
 			if !eventCopy.IsUpdate {
+				// 排队期间会话可能已经关闭(如服务退出时), 不使用 clientState.Ctx
+				ctx, cancel := context.WithTimeout(context.Background(), addMessageTimeout)
+				defer cancel()
+
 				// 添加到 Redis 消息列表（用于 LLM 上下文）
-				llm_memory.Get().AddMessage(
-					clientState.Ctx,
+				if err := llm_memory.Get().AddMessage(
+					ctx,
 					clientState.DeviceID,
 					clientState.AgentID,
-					eventCopy.Msg)
+					eventCopy.Msg); err != nil {
+					s.failed.Add(1)
+					log.Errorf("add message to llm memory failed: %v", err)
+				}
 
 				// 将消息加到长期记忆体（memobase/mem0）
 				if clientState.MemoryProvider != nil {
 					err := clientState.MemoryProvider.AddMessage(
-						clientState.Ctx,
+						ctx,
 						clientState.GetDeviceIDOrAgentID(),
 						eventCopy.Msg)
 					if err != nil {
+						s.failed.Add(1)
 						log.Errorf("add message to memory provider failed: %v", err)
 					}
 				}
@@ -93,11 +110,15 @@ func (s *EventHandle) HandleSessionEnd() error {
 		clientStateCopy := clientState
 		err := s.sessionEndPool.Submit(func() {
 			// 将消息加到长期记忆体中
+			// 会话结束时 clientState.Ctx 已经取消, 使用独立的超时
 			if clientStateCopy.MemoryProvider != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
 				err := clientStateCopy.MemoryProvider.Flush(
-					clientStateCopy.Ctx,
+					ctx,
 					clientStateCopy.GetDeviceIDOrAgentID())
 				if err != nil {
+					s.failed.Add(1)
 					log.Errorf("flush message to memory provider failed: %v", err)
 				}
 			}
@@ -108,3 +129,37 @@ func (s *EventHandle) HandleSessionEnd() error {
 	})
 	return nil
 }
+
+// Flush 等待已提交的记忆写入和会话结束的 Flush 执行完成, ctx 结束或有任务写入失败时返回错误
+func (s *EventHandle) Flush(ctx context.Context) error {
+	if err := waitPoolIdle(ctx, s.addMessagePool, s.sessionEndPool); err != nil {
+		return err
+	}
+	if failed := s.failed.Swap(0); failed > 0 {
+		return fmt.Errorf("%d 个记忆写入任务失败", failed)
+	}
+	return nil
+}
+
+// waitPoolIdle 等待协程池中没有运行和排队的任务
+func waitPoolIdle(ctx context.Context, pools ...*ants.Pool) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		idle := true
+		for _, pool := range pools {
+			if pool.Running() > 0 || pool.Waiting() > 0 {
+				idle = false
+				break
+			}
+		}
+		if idle {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
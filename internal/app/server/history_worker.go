@@ -41,10 +41,16 @@ func (w *HistoryWorker) subscribeEvents() {
 	bus.Subscribe(eventbus.TopicAddMessage, w.handleAddMessage)
 }
 
+// Flush 等待已提交的历史记录保存完成, ctx 结束时返回错误
+func (w *HistoryWorker) Flush(ctx context.Context) error {
+	return waitPoolIdle(ctx, w.pool)
+}
+
 // handleAddMessage 统一处理消息添加事件
 func (w *HistoryWorker) handleAddMessage(event *eventbus.AddMessageEvent) {
 	w.pool.Submit(func() {
-		ctx, cancel := context.WithTimeout(event.ClientState.Ctx, 5*time.Second)
+		// 不使用 ClientState.Ctx, 会话关闭后最后一轮对话的记录仍需保存
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
 		// 判断是新增还是更新
@@ -125,6 +131,9 @@ func (w *HistoryWorker) saveMessageText(ctx context.Context, event *eventbus.Add
 	metadata := map[string]interface{}{
 		"timestamp": event.Timestamp.Format(time.RFC3339),
 	}
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
 	// Tool 角色需要将 ToolCallID 存储到 Metadata 中
 	if event.Msg.Role == schema.Tool && event.Msg.ToolCallID != "" {
 		metadata["tool_call_id"] = event.Msg.ToolCallID
@@ -0,0 +1,212 @@
+package memconn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+)
+
+var (
+	ErrClosed  = errors.New("connection is closed")
+	ErrTimeout = errors.New("timeout")
+)
+
+// MemConn 内存中的 types.IConn 实现，服务端和模拟设备通过 channel 直接交换信令和音频
+// 用于在 go test 中跑通完整的 hello -> listen -> stt -> tts 流程，不需要真实的网络连接
+//
+// IConn 方法供服务端(ChatManager)使用，Device* 方法供模拟设备使用
+type MemConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	deviceID      string
+	transportType string
+	data          map[string]interface{}
+
+	toServerCmd   chan []byte
+	toServerAudio chan []byte
+	toDeviceCmd   chan []byte
+	toDeviceAudio chan []byte
+
+	onCloseCbList []func(deviceId string)
+	closed        bool
+	sync.Mutex
+}
+
+// New 创建内存连接，传输类型为 websocket
+func New(deviceID string) *MemConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MemConn{
+		ctx:           ctx,
+		cancel:        cancel,
+		deviceID:      deviceID,
+		transportType: types.TransportTypeWebsocket,
+		data:          make(map[string]interface{}),
+		toServerCmd:   make(chan []byte, 100),
+		toServerAudio: make(chan []byte, 100),
+		toDeviceCmd:   make(chan []byte, 1000),
+		toDeviceAudio: make(chan []byte, 1000),
+	}
+}
+
+// SetTransportType 设置 GetTransportType 的返回值，模拟 mqtt_udp 时需要同时通过 SetData 设置 aes_key/full_nonce
+func (c *MemConn) SetTransportType(transportType string) {
+	c.Lock()
+	defer c.Unlock()
+	c.transportType = transportType
+}
+
+// SetData 设置 GetData 返回的私有数据
+func (c *MemConn) SetData(key string, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.data[key] = value
+}
+
+// Done 连接关闭后返回
+func (c *MemConn) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// ---------- 服务端侧，实现 types.IConn ----------
+
+func (c *MemConn) SendCmd(msg []byte) error {
+	return c.send(c.toDeviceCmd, msg)
+}
+
+func (c *MemConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.toServerCmd, time.Duration(timeout)*time.Second)
+}
+
+func (c *MemConn) SendAudio(audio []byte) error {
+	return c.send(c.toDeviceAudio, audio)
+}
+
+func (c *MemConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.toServerAudio, time.Duration(timeout)*time.Second)
+}
+
+func (c *MemConn) GetDeviceID() string {
+	return c.deviceID
+}
+
+func (c *MemConn) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.cancel()
+	return nil
+}
+
+func (c *MemConn) OnClose(cb func(deviceId string)) {
+	c.Lock()
+	defer c.Unlock()
+	c.onCloseCbList = append(c.onCloseCbList, cb)
+}
+
+func (c *MemConn) CloseAudioChannel() error {
+	return nil
+}
+
+func (c *MemConn) GetTransportType() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.transportType
+}
+
+func (c *MemConn) GetData(key string) (interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+	if value, ok := c.data[key]; ok {
+		return value, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// ---------- 设备侧 ----------
+
+// DeviceSendCmd 设备发送信令
+func (c *MemConn) DeviceSendCmd(msg []byte) error {
+	return c.send(c.toServerCmd, msg)
+}
+
+// DeviceSendJSON 设备发送 json 信令
+func (c *MemConn) DeviceSendJSON(v interface{}) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.DeviceSendCmd(msg)
+}
+
+// DeviceSendAudio 设备发送一帧Opus音频
+func (c *MemConn) DeviceSendAudio(audio []byte) error {
+	return c.send(c.toServerAudio, audio)
+}
+
+// DeviceRecvCmd 设备接收服务端下发的信令，timeout<=0 时一直等待
+func (c *MemConn) DeviceRecvCmd(timeout time.Duration) ([]byte, error) {
+	return c.recv(context.Background(), c.toDeviceCmd, timeout)
+}
+
+// DeviceRecvAudio 设备接收服务端下发的音频帧，timeout<=0 时一直等待
+func (c *MemConn) DeviceRecvAudio(timeout time.Duration) ([]byte, error) {
+	return c.recv(context.Background(), c.toDeviceAudio, timeout)
+}
+
+// DeviceCmdChan 设备侧接收信令的通道, 需要同时等待信令和音频时使用
+func (c *MemConn) DeviceCmdChan() <-chan []byte {
+	return c.toDeviceCmd
+}
+
+// DeviceAudioChan 设备侧接收音频帧的通道
+func (c *MemConn) DeviceAudioChan() <-chan []byte {
+	return c.toDeviceAudio
+}
+
+// Disconnect 模拟设备断开连接，关闭连接并通知注册方
+func (c *MemConn) Disconnect() {
+	c.Close()
+	c.Lock()
+	cbList := append([]func(deviceId string){}, c.onCloseCbList...)
+	c.Unlock()
+	for _, cb := range cbList {
+		cb(c.deviceID)
+	}
+}
+
+func (c *MemConn) send(ch chan []byte, data []byte) error {
+	data = append([]byte(nil), data...)
+	select {
+	case <-c.ctx.Done():
+		return ErrClosed
+	case ch <- data:
+		return nil
+	}
+}
+
+func (c *MemConn) recv(ctx context.Context, ch chan []byte, timeout time.Duration) ([]byte, error) {
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case data := <-ch:
+		return data, nil
+	case <-c.ctx.Done():
+		return nil, ErrClosed
+	case <-timeoutChan:
+		return nil, ErrTimeout
+	}
+}
@@ -0,0 +1,362 @@
+package mqtt_udp
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio"
+	. "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+// 单帧最长 120ms
+const maxOpusFrameMs = 120
+
+// JitterBufferConfig 抖动缓冲配置, 对应 udp.jitter_buffer
+type JitterBufferConfig struct {
+	Enable           bool
+	Delay            time.Duration // 缺包时等待乱序包的最长时间
+	MaxConcealFrames int           // 连续丢包不超过该帧数时补帧, 0 表示不补帧
+	Fec              bool          // 补帧时优先使用下一个包中的FEC数据
+	SampleRate       int
+	Channels         int
+	FrameDuration    int // 上行帧长, 单位: ms, 用于计算抖动
+}
+
+// loadJitterBufferConfig 从 udp.jitter_buffer 读取配置
+func loadJitterBufferConfig() JitterBufferConfig {
+	cfg := JitterBufferConfig{
+		Enable:           viper.GetBool("udp.jitter_buffer.enable"),
+		Delay:            time.Duration(viper.GetInt("udp.jitter_buffer.delay")) * time.Millisecond,
+		MaxConcealFrames: viper.GetInt("udp.jitter_buffer.max_conceal_frames"),
+		Fec:              viper.GetBool("udp.jitter_buffer.fec"),
+		SampleRate:       viper.GetInt("udp.jitter_buffer.sample_rate"),
+		Channels:         viper.GetInt("udp.jitter_buffer.channels"),
+		FrameDuration:    viper.GetInt("udp.jitter_buffer.frame_duration"),
+	}
+	if cfg.Delay <= 0 {
+		cfg.Delay = 120 * time.Millisecond
+	}
+	if cfg.MaxConcealFrames < 0 {
+		cfg.MaxConcealFrames = 0
+	}
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = 16000
+	}
+	if cfg.Channels <= 0 {
+		cfg.Channels = 1
+	}
+	if cfg.FrameDuration <= 0 {
+		cfg.FrameDuration = 60
+	}
+	return cfg
+}
+
+// JitterStats 单个设备上行音频的收包统计
+type JitterStats struct {
+	Received  uint64  // 收到的有效包数, 不含重复和迟到的包
+	Duplicate uint64  // 重复或重放的包
+	Late      uint64  // 等待超时被跳过后才到达的包
+	Reordered uint64  // 乱序到达的包
+	Lost      uint64  // 丢失的包
+	Concealed uint64  // 通过 PLC/FEC 补上的帧
+	Resync    uint64  // 设备重新打开音频通道, 序列号重新开始的次数
+	Jitter    float64 // 到达间隔抖动(RFC3550), 单位: ms
+}
+
+// LossRatio 丢包率
+func (s JitterStats) LossRatio() float64 {
+	total := s.Received + s.Lost
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Lost) / float64(total)
+}
+
+type jitterPacket struct {
+	data    []byte
+	arrival time.Time
+}
+
+// JitterBuffer 按序列号对上行音频重排序, 丢弃重复和重放的包, 对少量丢包用Opus PLC/FEC补帧
+// 按序到达的包立即输出, 只有出现缺包时才会等待, 最长等待 Delay 后跳过缺失的包
+type JitterBuffer struct {
+	cfg    JitterBufferConfig
+	output func(data []byte)
+
+	mu          sync.Mutex
+	started     bool
+	nextSeq     uint32 // 下一个待输出的序列号
+	highestSeq  uint32
+	released    uint64 // 已输出序列号的位图, 第i位表示 nextSeq-1-i 已输出
+	pending     map[uint32]*jitterPacket
+	lastTransit float64
+	hasTransit  bool
+	timer       *time.Timer
+	closed      bool
+	stats       JitterStats
+
+	concealer *audio.AudioProcesser
+	frameSize int // 每帧每声道的采样数, 由最近一次解码得到
+	pcm       []int16
+	encodeBuf []byte
+}
+
+// NewJitterBuffer 创建抖动缓冲, output 按序列号顺序接收音频帧
+func NewJitterBuffer(cfg JitterBufferConfig, output func(data []byte)) *JitterBuffer {
+	return &JitterBuffer{
+		cfg:     cfg,
+		output:  output,
+		pending: make(map[uint32]*jitterPacket),
+	}
+}
+
+// Push 放入一个已解密的音频包
+func (b *JitterBuffer) Push(seq uint32, data []byte) {
+	b.push(seq, data, time.Now())
+}
+
+func (b *JitterBuffer) push(seq uint32, data []byte, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	// 开始后不接受已经输出过的序列号, 设备重新打开音频通道时由 Reset 重新开始
+	diff := int32(seq - b.nextSeq)
+	if !b.started {
+		b.started = true
+		b.nextSeq = seq
+		b.highestSeq = seq
+		b.released = 0
+		b.hasTransit = false
+		diff = 0
+	}
+
+	if diff < 0 {
+		// 已经输出过的是重复或重放的包, 否则是等待超时后才到达的包
+		if back := uint32(-diff) - 1; back < 64 && b.released&(1<<back) != 0 {
+			b.stats.Duplicate++
+		} else {
+			b.stats.Late++
+		}
+		return
+	}
+	if _, ok := b.pending[seq]; ok {
+		b.stats.Duplicate++
+		return
+	}
+
+	b.stats.Received++
+	if int32(seq-b.highestSeq) < 0 {
+		b.stats.Reordered++
+	} else {
+		b.highestSeq = seq
+	}
+	b.updateJitter(seq, now)
+
+	b.pending[seq] = &jitterPacket{data: data, arrival: now}
+	b.drain()
+	b.skipExpired(now)
+	b.scheduleFlush(now)
+}
+
+// updateJitter 按 RFC3550 计算到达间隔抖动, 发送时间用 序列号*帧长 估算
+func (b *JitterBuffer) updateJitter(seq uint32, now time.Time) {
+	transit := float64(now.UnixNano())/1e6 - float64(seq)*float64(b.cfg.FrameDuration)
+	if b.hasTransit {
+		d := math.Abs(transit - b.lastTransit)
+		b.stats.Jitter += (d - b.stats.Jitter) / 16
+	}
+	b.lastTransit = transit
+	b.hasTransit = true
+}
+
+// drain 输出从 nextSeq 开始连续的包
+func (b *JitterBuffer) drain() {
+	for {
+		packet, ok := b.pending[b.nextSeq]
+		if !ok {
+			return
+		}
+		delete(b.pending, b.nextSeq)
+		b.emit(packet.data)
+		b.nextSeq++
+		b.released = b.released<<1 | 1
+	}
+}
+
+// skipExpired 最早的缓存包等待超过 Delay 时跳过前面缺失的包
+func (b *JitterBuffer) skipExpired(now time.Time) {
+	for len(b.pending) > 0 {
+		oldestSeq, oldest := b.oldestPending()
+		if now.Sub(oldest.arrival) < b.cfg.Delay {
+			return
+		}
+		b.skipTo(oldestSeq, oldest.data)
+		b.drain()
+	}
+}
+
+// flushPending 不再等待, 按顺序输出所有缓存的包
+func (b *JitterBuffer) flushPending() {
+	for len(b.pending) > 0 {
+		oldestSeq, oldest := b.oldestPending()
+		b.skipTo(oldestSeq, oldest.data)
+		b.drain()
+	}
+}
+
+func (b *JitterBuffer) oldestPending() (uint32, *jitterPacket) {
+	var oldestSeq uint32
+	var oldest *jitterPacket
+	for seq, packet := range b.pending {
+		if oldest == nil || int32(seq-oldestSeq) < 0 {
+			oldestSeq, oldest = seq, packet
+		}
+	}
+	return oldestSeq, oldest
+}
+
+// skipTo 跳过 nextSeq 到 seq 之间缺失的包, 缺失不多时补帧, next 为缺口之后的第一个包
+func (b *JitterBuffer) skipTo(seq uint32, next []byte) {
+	lost := int(seq - b.nextSeq)
+	if lost <= 0 {
+		return
+	}
+	b.stats.Lost += uint64(lost)
+	if lost <= b.cfg.MaxConcealFrames {
+		for i := 0; i < lost; i++ {
+			var fecData []byte
+			if b.cfg.Fec && i == lost-1 {
+				fecData = next
+			}
+			frame := b.conceal(fecData)
+			if frame == nil {
+				break
+			}
+			b.stats.Concealed++
+			b.output(frame)
+		}
+	}
+	b.nextSeq = seq
+	b.released <<= uint(lost)
+}
+
+// emit 输出一帧, 需要补帧时同时解码以保持解码器状态连续
+func (b *JitterBuffer) emit(data []byte) {
+	if b.cfg.MaxConcealFrames > 0 {
+		b.observe(data)
+	}
+	b.output(data)
+}
+
+func (b *JitterBuffer) initConcealer() bool {
+	if b.concealer != nil {
+		return true
+	}
+	concealer, err := audio.GetAudioProcesser(b.cfg.SampleRate, b.cfg.Channels, b.cfg.FrameDuration)
+	if err != nil {
+		Errorf("jitter buffer 创建编解码器失败: %v", err)
+		b.cfg.MaxConcealFrames = 0
+		return false
+	}
+	b.concealer = concealer
+	b.pcm = make([]int16, b.cfg.SampleRate*maxOpusFrameMs/1000*b.cfg.Channels)
+	b.encodeBuf = make([]byte, 1500)
+	return true
+}
+
+func (b *JitterBuffer) observe(data []byte) {
+	if !b.initConcealer() {
+		return
+	}
+	n, err := b.concealer.Decoder(data, b.pcm)
+	if err != nil {
+		Debugf("jitter buffer 解码失败: %v", err)
+		return
+	}
+	b.frameSize = n
+}
+
+// conceal 生成一帧补偿数据并重新编码为Opus, 没有解码过任何帧时返回nil
+func (b *JitterBuffer) conceal(fecData []byte) []byte {
+	if b.frameSize == 0 || !b.initConcealer() {
+		return nil
+	}
+	pcm := b.pcm[:b.frameSize*b.cfg.Channels]
+	var err error
+	if fecData != nil {
+		err = b.concealer.DecoderFEC(fecData, pcm)
+	} else {
+		err = b.concealer.DecoderPLC(pcm)
+	}
+	if err != nil {
+		Debugf("jitter buffer 补帧失败: %v", err)
+		return nil
+	}
+	n, err := b.concealer.Encoder(pcm, b.encodeBuf)
+	if err != nil {
+		Debugf("jitter buffer 补帧编码失败: %v", err)
+		return nil
+	}
+	return append([]byte(nil), b.encodeBuf[:n]...)
+}
+
+// scheduleFlush 有包在等待缺失的包时, 到期后即使没有新包到达也要输出
+func (b *JitterBuffer) scheduleFlush(now time.Time) {
+	if len(b.pending) == 0 {
+		return
+	}
+	_, oldest := b.oldestPending()
+	wait := b.cfg.Delay - now.Sub(oldest.arrival)
+	if b.timer == nil {
+		b.timer = time.AfterFunc(wait, b.onTimer)
+	} else {
+		b.timer.Reset(wait)
+	}
+}
+
+func (b *JitterBuffer) onTimer() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	now := time.Now()
+	b.skipExpired(now)
+	b.scheduleFlush(now)
+}
+
+// Reset 设备重新打开音频通道时调用, 输出缓存的包后从下一个收到的序列号重新开始
+func (b *JitterBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || !b.started {
+		return
+	}
+	b.flushPending()
+	b.started = false
+	b.stats.Resync++
+}
+
+// Stats 返回收包统计
+func (b *JitterBuffer) Stats() JitterStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// Close 停止等待, 丢弃缓存的包
+func (b *JitterBuffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.pending = make(map[uint32]*jitterPacket)
+}
@@ -0,0 +1,147 @@
+package mqtt_udp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio"
+)
+
+func newTestJitterBuffer(maxConcealFrames int) (*JitterBuffer, *[][]byte) {
+	var out [][]byte
+	cfg := JitterBufferConfig{
+		Enable:           true,
+		Delay:            100 * time.Millisecond,
+		MaxConcealFrames: maxConcealFrames,
+		Fec:              true,
+		SampleRate:       16000,
+		Channels:         1,
+		FrameDuration:    60,
+	}
+	b := NewJitterBuffer(cfg, func(data []byte) {
+		out = append(out, data)
+	})
+	return b, &out
+}
+
+func TestJitterBufferReorderAndDuplicate(t *testing.T) {
+	b, out := newTestJitterBuffer(0)
+	defer b.Close()
+	now := time.Now()
+
+	for i, seq := range []uint32{1, 3, 2, 2, 4, 1} {
+		b.push(seq, []byte{byte(seq)}, now.Add(time.Duration(i)*10*time.Millisecond))
+	}
+
+	if len(*out) != 4 {
+		t.Fatalf("输出帧数错误: %v", *out)
+	}
+	for i, data := range *out {
+		if data[0] != byte(i+1) {
+			t.Errorf("第 %d 帧顺序错误: %d", i, data[0])
+		}
+	}
+	stats := b.Stats()
+	if stats.Received != 4 || stats.Duplicate != 2 || stats.Reordered != 1 || stats.Lost != 0 {
+		t.Errorf("统计错误: %+v", stats)
+	}
+}
+
+func TestJitterBufferLossAndLate(t *testing.T) {
+	b, out := newTestJitterBuffer(0)
+	defer b.Close()
+	now := time.Now()
+
+	b.push(1, []byte{1}, now)
+	b.push(3, []byte{3}, now.Add(10*time.Millisecond))
+	if len(*out) != 1 {
+		t.Fatalf("缺包时不应输出后面的帧: %v", *out)
+	}
+	// 超过等待时间后跳过缺失的2
+	b.push(4, []byte{4}, now.Add(200*time.Millisecond))
+	if len(*out) != 3 || (*out)[1][0] != 3 || (*out)[2][0] != 4 {
+		t.Fatalf("输出错误: %v", *out)
+	}
+	// 被跳过之后才到达的包丢弃
+	b.push(2, []byte{2}, now.Add(210*time.Millisecond))
+	if len(*out) != 3 {
+		t.Fatalf("迟到的包不应输出: %v", *out)
+	}
+	stats := b.Stats()
+	if stats.Lost != 1 || stats.Late != 1 || stats.LossRatio() != 0.25 {
+		t.Errorf("统计错误: %+v", stats)
+	}
+
+	// 长时间空闲后回退的序列号仍然视为重放, 不能重新开始
+	b.push(1, []byte{1}, now.Add(3*time.Second))
+	if len(*out) != 3 || b.Stats().Resync != 0 {
+		t.Fatalf("回退的序列号不应输出: %v, %+v", *out, b.Stats())
+	}
+
+	// 通道重新打开, 序列号从1开始
+	b.Reset()
+	b.push(1, []byte{1}, now.Add(4*time.Second))
+	if len(*out) != 4 || b.Stats().Resync != 1 {
+		t.Errorf("序列号重新开始后应正常输出: %v, %+v", *out, b.Stats())
+	}
+}
+
+func TestJitterBufferFlushTimer(t *testing.T) {
+	b, out := newTestJitterBuffer(0)
+	defer b.Close()
+
+	b.Push(1, []byte{1})
+	b.Push(3, []byte{3})
+	time.Sleep(300 * time.Millisecond)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(*out) != 2 || (*out)[1][0] != 3 {
+		t.Errorf("等待超时后应输出缓存的帧: %v", *out)
+	}
+}
+
+func TestJitterBufferConceal(t *testing.T) {
+	b, out := newTestJitterBuffer(3)
+	defer b.Close()
+
+	processer, err := audio.GetAudioProcesser(16000, 1, 60)
+	if err != nil {
+		t.Fatalf("创建编码器失败: %v", err)
+	}
+	frames := make([][]byte, 6)
+	pcm := make([]int16, 960)
+	for i := range frames {
+		for j := range pcm {
+			pcm[j] = int16(8000 * math.Sin(2*math.Pi*440*float64(i*960+j)/16000))
+		}
+		buf := make([]byte, 1500)
+		n, err := processer.Encoder(pcm, buf)
+		if err != nil {
+			t.Fatalf("编码失败: %v", err)
+		}
+		frames[i] = buf[:n]
+	}
+
+	now := time.Now()
+	// 丢失 3、4 两帧
+	for i, seq := range []uint32{1, 2, 5, 6} {
+		b.push(seq, frames[seq-1], now.Add(time.Duration(i)*60*time.Millisecond))
+	}
+	b.push(7, frames[5], now.Add(time.Second))
+
+	stats := b.Stats()
+	if stats.Lost != 2 || stats.Concealed != 2 {
+		t.Fatalf("补帧统计错误: %+v", stats)
+	}
+	if len(*out) != 7 {
+		t.Fatalf("补帧后输出帧数错误: %d", len(*out))
+	}
+	decoder, _ := audio.GetAudioProcesser(16000, 1, 60)
+	for i, frame := range *out {
+		if n, err := decoder.Decoder(frame, make([]int16, 1920)); err != nil || n != 960 {
+			t.Errorf("第 %d 帧解码错误: %d, %v", i, n, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package mqtt_udp
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
+)
+
+var (
+	udpPacketsDesc   = metrics.NewDesc("udp_audio_packets", "设备上行UDP音频包统计", "device_id", "type")
+	udpLossRatioDesc = metrics.NewDesc("udp_audio_loss_ratio", "设备上行UDP音频丢包率", "device_id")
+	udpJitterDesc    = metrics.NewDesc("udp_audio_jitter_ms", "设备上行UDP音频到达间隔抖动, 单位: ms", "device_id")
+
+	registerUdpCollectorOnce sync.Once
+)
+
+// udpCollector 在采集时读取每个UDP会话的收包统计
+type udpCollector struct {
+	server *UdpServer
+}
+
+func (c *udpCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- udpPacketsDesc
+	ch <- udpLossRatioDesc
+	ch <- udpJitterDesc
+}
+
+func (c *udpCollector) Collect(ch chan<- prometheus.Metric) {
+	// 同一设备重连时旧会话可能还未清理, 标签重复会导致整次采集失败
+	seen := make(map[string]bool)
+	c.server.nonce2Session.Range(func(key, value interface{}) bool {
+		session := value.(*UdpSession)
+		stats, ok := session.GetJitterStats()
+		if !ok || seen[session.DeviceId] {
+			return true
+		}
+		seen[session.DeviceId] = true
+		for packetType, count := range map[string]uint64{
+			"received":  stats.Received,
+			"lost":      stats.Lost,
+			"concealed": stats.Concealed,
+			"reordered": stats.Reordered,
+			"duplicate": stats.Duplicate,
+			"late":      stats.Late,
+		} {
+			ch <- prometheus.MustNewConstMetric(udpPacketsDesc, prometheus.CounterValue, float64(count), session.DeviceId, packetType)
+		}
+		ch <- prometheus.MustNewConstMetric(udpLossRatioDesc, prometheus.GaugeValue, stats.LossRatio(), session.DeviceId)
+		ch <- prometheus.MustNewConstMetric(udpJitterDesc, prometheus.GaugeValue, stats.Jitter, session.DeviceId)
+		return true
+	})
+}
+
+// registerMetricsCollector 注册UDP收包统计采集器，多次调用只注册一次
+func (s *UdpServer) registerMetricsCollector() {
+	registerUdpCollectorOnce.Do(func() {
+		metrics.RegisterCollector(&udpCollector{server: s})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -12,6 +13,7 @@ import (
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
 	"xiaozhi-esp32-server-golang/internal/data/client"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
+	types_msg "xiaozhi-esp32-server-golang/internal/data/msg"
 	. "xiaozhi-esp32-server-golang/logger"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -33,6 +35,12 @@ type MqttUdpAdapter struct {
 	deviceId2Conn   *sync.Map
 	msgChan         chan mqtt.Message
 	onNewConnection types.OnNewConnection
+	// 集群模式下所有节点都会收到设备消息, 只有认领成功的节点创建会话, 为nil时总是处理
+	deviceClaimer func(deviceId string) bool
+	// 设备的下发主题, 会话结束后保留, 用于唤醒设备
+	deviceId2Topic *sync.Map
+	// 服务退出中, 不再为新设备创建会话
+	stopping atomic.Bool
 	sync.RWMutex
 }
 
@@ -52,12 +60,20 @@ func WithOnNewConnection(onNewConnection types.OnNewConnection) MqttUdpAdapterOp
 	}
 }
 
+// WithDeviceClaimer 设置设备认领函数, 返回false时忽略该设备的消息
+func WithDeviceClaimer(deviceClaimer func(deviceId string) bool) MqttUdpAdapterOption {
+	return func(s *MqttUdpAdapter) {
+		s.deviceClaimer = deviceClaimer
+	}
+}
+
 // NewMqttUdpAdapter 创建新的MQTT-UDP适配器，config为必传，其它参数用Option
 func NewMqttUdpAdapter(config *MqttConfig, opts ...MqttUdpAdapterOption) *MqttUdpAdapter {
 	s := &MqttUdpAdapter{
-		mqttConfig:    config,
-		deviceId2Conn: &sync.Map{},
-		msgChan:       make(chan mqtt.Message, 10000),
+		mqttConfig:     config,
+		deviceId2Conn:  &sync.Map{},
+		deviceId2Topic: &sync.Map{},
+		msgChan:        make(chan mqtt.Message, 10000),
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -122,6 +138,20 @@ func (s *MqttUdpAdapter) Start() error {
 	return nil
 }
 
+// StopAccept 不再为新设备创建会话, 已有会话的消息继续处理, 以便向设备发送 goodbye
+func (s *MqttUdpAdapter) StopAccept() {
+	s.stopping.Store(true)
+}
+
+// Stop 断开 MQTT 连接, 在所有设备会话关闭后调用
+func (s *MqttUdpAdapter) Stop() {
+	s.stopping.Store(true)
+	if s.client != nil && s.client.IsConnected() {
+		s.client.Disconnect(1000)
+	}
+	Info("MqttUdpAdapter已停止")
+}
+
 func (s *MqttUdpAdapter) checkClientActive() error {
 	go func() {
 		ticker := time.NewTicker(30 * time.Second)
@@ -165,6 +195,28 @@ func (s *MqttUdpAdapter) handleMessage(client mqtt.Client, msg mqtt.Message) {
 	}
 }
 
+// WakeDevice 向没有会话的设备发送 alert 消息, 设备显示 message 并播放提示音
+// 只能唤醒本节点曾经处理过的设备, 返回是否已发送
+func (s *MqttUdpAdapter) WakeDevice(deviceId string, message string) bool {
+	value, ok := s.deviceId2Topic.Load(deviceId)
+	if !ok || s.client == nil || !s.client.IsConnected() {
+		return false
+	}
+	payload, _ := json.Marshal(map[string]string{
+		"type":    types_msg.ServerMessageTypeAlert,
+		"status":  "提醒",
+		"message": message,
+		"emotion": "bell",
+	})
+	token := s.client.Publish(value.(string), 0, false, payload)
+	token.Wait()
+	if token.Error() != nil {
+		Errorf("唤醒设备 %s 失败: %v", deviceId, token.Error())
+		return false
+	}
+	return true
+}
+
 // 断开连接，超时或goodbye主动断开
 func (s *MqttUdpAdapter) handleDisconnect(deviceId string) {
 	Debugf("handleDisconnect, deviceId: %s", deviceId)
@@ -197,6 +249,15 @@ func (s *MqttUdpAdapter) processMessage() {
 
 			deviceSession := s.getDeviceSession(deviceId)
 			if deviceSession == nil {
+				if s.stopping.Load() {
+					Debugf("服务正在退出, 忽略设备 %s 的消息", deviceId)
+					continue
+				}
+				if s.deviceClaimer != nil && !s.deviceClaimer(deviceId) {
+					Debugf("设备 %s 由其它节点处理, 忽略消息", deviceId)
+					continue
+				}
+
 				// 从UDP服务端获取会话信息
 				udpSession := s.udpServer.CreateSession(deviceId, "")
 				if udpSession == nil {
@@ -205,6 +266,7 @@ func (s *MqttUdpAdapter) processMessage() {
 				}
 
 				publicTopic := fmt.Sprintf("%s%s", client.ServerPubTopicPrefix, topicMacAddr)
+				s.deviceId2Topic.Store(deviceId, publicTopic)
 
 				deviceSession = NewMqttUdpConn(deviceId, publicTopic, s.client, s.udpServer, udpSession)
 
@@ -218,6 +280,9 @@ func (s *MqttUdpAdapter) processMessage() {
 				deviceSession.OnClose(s.handleDisconnect)
 
 				s.onNewConnection(deviceSession)
+			} else if clientMsg.Type == types_msg.MessageTypeHello {
+				// 设备重新打开音频通道, 上行序列号重新开始
+				deviceSession.UdpSession.ResetJitterBuffer()
 			}
 
 			err := deviceSession.PushMsgToRecvCmd(msg.Payload())
@@ -8,6 +8,8 @@ import (
 	"net"
 	"sync"
 	"time"
+
+	. "xiaozhi-esp32-server-golang/logger"
 )
 
 const (
@@ -34,6 +36,8 @@ type UdpSession struct {
 	SendChannel chan []byte //接收的音频数据
 	Status      string
 	Lock        sync.Mutex
+
+	jitterBuffer *JitterBuffer //上行音频重排序和去重, 未启用时为nil
 }
 
 // decrypt 解密数据
@@ -45,10 +49,7 @@ func (s *UdpSession) Decrypt(data []byte) ([]byte, error) {
 	// 提取序列号
 	seqNum := binary.BigEndian.Uint32(data[12:16])
 
-	// 检查序列号
-	/*if seqNum < s.RemoteSeq {
-		return nil, fmt.Errorf("序列号过期: got %d, expected >= %d", seqNum, s.RemoteSeq)
-	}*/
+	// 过期和重复的序列号由 jitterBuffer 处理
 	s.RemoteSeq = seqNum
 
 	// 解密数据
@@ -106,6 +107,30 @@ func (s *UdpSession) RecvData(data []byte) (bool, error) {
 	}
 }
 
+// PushAudio 收到一个上行音频包, 启用抖动缓冲时先按序列号重排序
+func (s *UdpSession) PushAudio(seq uint32, data []byte) (bool, error) {
+	if s.jitterBuffer == nil {
+		return s.RecvData(data)
+	}
+	s.jitterBuffer.Push(seq, data)
+	return true, nil
+}
+
+// ResetJitterBuffer 设备重新打开音频通道时重置抖动缓冲, 允许序列号重新开始
+func (s *UdpSession) ResetJitterBuffer() {
+	if s.jitterBuffer != nil {
+		s.jitterBuffer.Reset()
+	}
+}
+
+// GetJitterStats 上行音频的收包统计, 未启用抖动缓冲时返回false
+func (s *UdpSession) GetJitterStats() (JitterStats, bool) {
+	if s.jitterBuffer == nil {
+		return JitterStats{}, false
+	}
+	return s.jitterBuffer.Stats(), true
+}
+
 // SendAudioData 发送音频数据
 func (s *UdpSession) SendAudioData(data []byte) (bool, error) {
 	s.Lock.Lock()
@@ -122,6 +147,12 @@ func (s *UdpSession) SendAudioData(data []byte) (bool, error) {
 }
 
 func (s *UdpSession) Destroy() {
+	if s.jitterBuffer != nil {
+		s.jitterBuffer.Close()
+		stats := s.jitterBuffer.Stats()
+		Infof("udp会话关闭, deviceId: %s, 收包: %d, 丢包: %d(%.2f%%), 补帧: %d, 乱序: %d, 重复: %d, 迟到: %d, 抖动: %.1fms",
+			s.DeviceId, stats.Received, stats.Lost, stats.LossRatio()*100, stats.Concealed, stats.Reordered, stats.Duplicate, stats.Late, stats.Jitter)
+	}
 	s.Lock.Lock()
 	defer s.Lock.Unlock()
 	s.Status = UdpSessionStatusClosed
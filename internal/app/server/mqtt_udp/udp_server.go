@@ -63,6 +63,8 @@ func (s *UdpServer) Start() error {
 	// 启动会话清理
 	//go s.cleanupSessions()
 
+	s.registerMetricsCollector()
+
 	// 启动数据包处理
 	go s.handlePackets()
 
@@ -136,7 +138,7 @@ func (s *UdpServer) processPacket(addr *net.UDPAddr, data []byte) {
 		return
 	}
 	Debugf("收到音频数据, addr: %s, 大小: %d 字节", addr, len(decrypted))
-	ok, err := udpSession.RecvData(decrypted)
+	ok, err := udpSession.PushAudio(binary.BigEndian.Uint32(data[12:16]), decrypted)
 	if err != nil {
 		Errorf("addr: %s 接收数据失败: %v", addr, err)
 		return
@@ -221,6 +223,13 @@ func (s *UdpServer) CreateSession(deviceId, clientId string) *UdpSession {
 		Status:      UdpSessionStatusActive,
 		Lock:        sync.Mutex{},
 	}
+	if jitterConfig := loadJitterBufferConfig(); jitterConfig.Enable {
+		session.jitterBuffer = NewJitterBuffer(jitterConfig, func(data []byte) {
+			if _, err := session.RecvData(data); err != nil {
+				Warnf("deviceId: %s 接收数据失败: %v", deviceId, err)
+			}
+		})
+	}
 	//通过channel发送音频数据, 当channel关闭的时候停止
 	go func() {
 		for data := range session.SendChannel {
@@ -0,0 +1,517 @@
+package openai_api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	"xiaozhi-esp32-server-golang/internal/app/server/memconn"
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	types_audio "xiaozhi-esp32-server-golang/internal/data/audio"
+	. "xiaozhi-esp32-server-golang/internal/data/msg"
+	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const helloTimeout = 10 * time.Second
+
+var errSessionClosed = errors.New("会话已关闭")
+
+// 所有设备或智能体
+const allowAll = "*"
+
+// APIKey 一个 API Key 及其允许访问的设备和智能体, 对应 openai_api.api_keys
+type APIKey struct {
+	Key     string   `mapstructure:"key"`
+	Devices []string `mapstructure:"devices"` // 允许访问的设备ID, "*" 表示所有设备
+	Agents  []string `mapstructure:"agents"`  // 允许访问的智能体ID, 可以访问智能体下的所有设备
+}
+
+// ChatCompletionsServer 提供 OpenAI 兼容的 /v1/chat/completions 接口
+// 每个设备对应一个常驻的文本会话: 用内存连接模拟设备跑完整的 ChatManager 流程,
+// 系统提示词、记忆、MCP工具和对话历史与真实设备一致
+type ChatCompletionsServer struct {
+	apiKeys     map[string]APIKey
+	timeout     time.Duration
+	idleTimeout time.Duration
+
+	sessions sync.Map // deviceID|mode => *textSession
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// textSession 一个设备的文本会话, 同一时间只处理一个请求
+type textSession struct {
+	conn       *memconn.MemConn
+	manager    *chat.ChatManager
+	audio      types_audio.AudioFormat
+	lastActive time.Time
+	closed     atomic.Bool // 已被清理, 不能再处理请求
+	sync.Mutex
+}
+
+// NewChatCompletionsServer 根据 openai_api 配置创建, 至少需要配置一个 API Key
+func NewChatCompletionsServer() (*ChatCompletionsServer, error) {
+	s := &ChatCompletionsServer{
+		apiKeys:     make(map[string]APIKey),
+		timeout:     time.Duration(viper.GetInt("openai_api.timeout")) * time.Second,
+		idleTimeout: time.Duration(viper.GetInt("openai_api.session_idle_timeout")) * time.Second,
+		stop:        make(chan struct{}),
+	}
+	var apiKeys []APIKey
+	if err := viper.UnmarshalKey("openai_api.api_keys", &apiKeys); err != nil {
+		return nil, fmt.Errorf("解析 openai_api.api_keys 失败: %v", err)
+	}
+	for _, apiKey := range apiKeys {
+		if apiKey.Key == "" {
+			continue
+		}
+		s.apiKeys[apiKey.Key] = apiKey
+	}
+	if len(s.apiKeys) == 0 {
+		return nil, fmt.Errorf("openai_api.api_keys 为空, 至少需要配置一个 API Key")
+	}
+	if s.timeout <= 0 {
+		s.timeout = 120 * time.Second
+	}
+	if s.idleTimeout <= 0 {
+		s.idleTimeout = 10 * time.Minute
+	}
+	go s.cleanupSessions()
+	return s, nil
+}
+
+// Close 停止清理空闲会话并关闭所有文本会话
+func (s *ChatCompletionsServer) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.sessions.Range(func(key, value interface{}) bool {
+			s.sessions.Delete(key)
+			value.(*textSession).close()
+			return true
+		})
+	})
+}
+
+// HandleChatCompletions 处理 POST /v1/chat/completions
+func (s *ChatCompletionsServer) HandleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	apiKey, ok := s.checkAuth(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "无效的 API Key")
+		return
+	}
+
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("解析请求失败: %v", err))
+		return
+	}
+	deviceID := r.Header.Get("Device-Id")
+	if deviceID == "" {
+		deviceID = req.DeviceID
+	}
+	if deviceID == "" {
+		deviceID = req.User
+	}
+	if deviceID == "" {
+		writeError(w, http.StatusBadRequest, "缺少 Device-Id 请求头或 device_id 参数")
+		return
+	}
+	text := req.lastUserText()
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "缺少 user 消息")
+		return
+	}
+	if allowed, err := s.allowDevice(r.Context(), apiKey, deviceID); err != nil {
+		log.Errorf("获取设备 %s 的智能体失败: %v", deviceID, err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !allowed {
+		writeError(w, http.StatusForbidden, "API Key 无权访问该设备")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	// 会话可能在获取之后、开始处理之前被清理, 此时换一个新会话
+	for retry := true; ; retry = false {
+		session, err := s.getSession(deviceID, req.withAudio())
+		if err != nil {
+			log.Errorf("创建文本会话失败, 设备ID: %s, 错误: %v", deviceID, err)
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writer := newResponseWriter(w, &req, session.audio)
+		err = session.chat(ctx, text, writer)
+		if retry && errors.Is(err, errSessionClosed) && !writer.started && writer.content.Len() == 0 && ctx.Err() == nil {
+			continue
+		}
+		writer.finish(err)
+		return
+	}
+}
+
+// checkAuth 校验 Authorization: Bearer <key>, 返回对应的 API Key 配置
+func (s *ChatCompletionsServer) checkAuth(r *http.Request) (APIKey, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	apiKey, ok := s.apiKeys[token]
+	return apiKey, ok
+}
+
+// allowDevice API Key 是否可以访问设备, 设备不在 devices 中时按设备所属的智能体判断
+func (s *ChatCompletionsServer) allowDevice(ctx context.Context, apiKey APIKey, deviceID string) (bool, error) {
+	for _, device := range apiKey.Devices {
+		if device == allowAll || device == deviceID {
+			return true, nil
+		}
+	}
+	if len(apiKey.Agents) == 0 {
+		return false, nil
+	}
+	configProvider, err := user_config.GetProvider(viper.GetString("config_provider.type"))
+	if err != nil {
+		return false, err
+	}
+	deviceConfig, err := configProvider.GetUserConfig(ctx, deviceID)
+	if err != nil {
+		return false, err
+	}
+	for _, agent := range apiKey.Agents {
+		if agent == allowAll || (agent == deviceConfig.AgentId && agent != "") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getSession 获取或创建设备的文本会话, 是否合成音频不同的请求使用不同的会话
+func (s *ChatCompletionsServer) getSession(deviceID string, withAudio bool) (*textSession, error) {
+	key := deviceID + "|text"
+	if withAudio {
+		key = deviceID + "|audio"
+	}
+	if val, ok := s.sessions.Load(key); ok {
+		session := val.(*textSession)
+		select {
+		case <-session.conn.Done():
+			s.sessions.CompareAndDelete(key, session)
+		default:
+			if !session.closed.Load() {
+				return session, nil
+			}
+			s.sessions.CompareAndDelete(key, session)
+		}
+	}
+
+	session, err := newTextSession(deviceID, withAudio)
+	if err != nil {
+		return nil, err
+	}
+	if actual, loaded := s.sessions.LoadOrStore(key, session); loaded {
+		// 并发请求已经创建了会话
+		session.close()
+		return actual.(*textSession), nil
+	}
+	return session, nil
+}
+
+// cleanupSessions 关闭长时间没有请求的会话, Close 后退出
+func (s *ChatCompletionsServer) cleanupSessions() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		s.sessions.Range(func(key, value interface{}) bool {
+			session := value.(*textSession)
+			if !session.TryLock() {
+				return true
+			}
+			if time.Since(session.lastActive) > s.idleTimeout {
+				s.sessions.CompareAndDelete(key, session)
+				session.close()
+				log.Infof("清理空闲的文本会话: %s", key)
+			}
+			session.Unlock()
+			return true
+		})
+	}
+}
+
+func newTextSession(deviceID string, withAudio bool) (*textSession, error) {
+	ttsOpts := []chat.TTSManagerOption{chat.WithoutAudioPacing()}
+	if !withAudio {
+		ttsOpts = append(ttsOpts, chat.WithTextOnly())
+	}
+
+	conn := memconn.New(deviceID)
+	manager, err := chat.NewChatManager(deviceID, conn, chat.WithSessionOptions(chat.WithTTSManagerOptions(ttsOpts...)))
+	if err != nil {
+		return nil, err
+	}
+	go manager.Start()
+
+	session := &textSession{conn: conn, manager: manager, lastActive: time.Now()}
+	if err := conn.DeviceSendJSON(map[string]interface{}{
+		"type":      MessageTypeHello,
+		"device_id": deviceID,
+		"transport": types.TransportTypeWebsocket,
+		"audio_params": types_audio.AudioFormat{
+			Format:        "opus",
+			SampleRate:    16000,
+			Channels:      1,
+			FrameDuration: 60,
+		},
+	}); err != nil {
+		session.close()
+		return nil, err
+	}
+
+	timer := time.NewTimer(helloTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case data := <-conn.DeviceCmdChan():
+			var msg ServerMessage
+			if err := json.Unmarshal(data, &msg); err != nil || msg.Type != ServerMessageTypeHello {
+				continue
+			}
+			if msg.AudioFormat != nil {
+				session.audio = *msg.AudioFormat
+			}
+			return session, nil
+		case <-conn.Done():
+			session.close()
+			return nil, errSessionClosed
+		case <-timer.C:
+			session.close()
+			return nil, fmt.Errorf("等待 hello 响应超时")
+		}
+	}
+}
+
+func (t *textSession) close() {
+	t.closed.Store(true)
+	t.manager.Close()
+	t.conn.Disconnect()
+}
+
+// drain 丢弃上一轮残留的信令和音频
+func (t *textSession) drain() {
+	for {
+		select {
+		case <-t.conn.DeviceCmdChan():
+		case <-t.conn.DeviceAudioChan():
+		default:
+			return
+		}
+	}
+}
+
+// chat 发送一轮用户输入, 把下发的句子和音频交给 writer, 收到 tts stop 时结束
+func (t *textSession) chat(ctx context.Context, text string, writer *responseWriter) error {
+	t.Lock()
+	defer t.Unlock()
+	// 等锁期间被清理
+	if t.closed.Load() {
+		return errSessionClosed
+	}
+	t.lastActive = time.Now()
+	defer func() {
+		t.lastActive = time.Now()
+	}()
+
+	t.drain()
+	if err := t.manager.InjectMessage(text, false); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// 客户端断开或超时, 打断本轮回复
+			t.conn.DeviceSendJSON(map[string]interface{}{"type": MessageTypeAbort})
+			return ctx.Err()
+		case <-t.conn.Done():
+			return errSessionClosed
+		case frame := <-t.conn.DeviceAudioChan():
+			writer.writeAudio(frame)
+		case data := <-t.conn.DeviceCmdChan():
+			var msg ServerMessage
+			if err := json.Unmarshal(data, &msg); err != nil || msg.Type != ServerMessageTypeTts {
+				continue
+			}
+			switch msg.State {
+			case MessageStateSentenceStart:
+				writer.writeText(msg.Text)
+			case MessageStateStop:
+				// 音频在 tts stop 之前下发, 此时已全部在通道中
+				for {
+					select {
+					case frame := <-t.conn.DeviceAudioChan():
+						writer.writeAudio(frame)
+					default:
+						return nil
+					}
+				}
+			}
+		}
+	}
+}
+
+// responseWriter 按请求是否流式输出 OpenAI 格式的响应
+type responseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	req     *ChatCompletionRequest
+	audio   types_audio.AudioFormat
+
+	id        string
+	created   int64
+	started   bool
+	content   strings.Builder
+	frames    []string
+	withAudio bool
+}
+
+func newResponseWriter(w http.ResponseWriter, req *ChatCompletionRequest, audio types_audio.AudioFormat) *responseWriter {
+	flusher, _ := w.(http.Flusher)
+	return &responseWriter{
+		w:         w,
+		flusher:   flusher,
+		req:       req,
+		audio:     audio,
+		id:        "chatcmpl-" + uuid.New().String(),
+		created:   time.Now().Unix(),
+		withAudio: req.withAudio(),
+	}
+}
+
+func (rw *responseWriter) audioChunk() *AudioChunk {
+	return &AudioChunk{
+		ID:            rw.id,
+		Format:        "opus",
+		SampleRate:    rw.audio.SampleRate,
+		Channels:      rw.audio.Channels,
+		FrameDuration: rw.audio.FrameDuration,
+	}
+}
+
+func (rw *responseWriter) writeText(text string) {
+	rw.content.WriteString(text)
+	if rw.req.Stream {
+		rw.writeChunk(&ChatCompletionMessage{Content: text}, nil)
+	}
+}
+
+func (rw *responseWriter) writeAudio(frame []byte) {
+	if !rw.withAudio {
+		return
+	}
+	data := base64.StdEncoding.EncodeToString(frame)
+	if !rw.req.Stream {
+		rw.frames = append(rw.frames, data)
+		return
+	}
+	audio := rw.audioChunk()
+	audio.Data = data
+	rw.writeChunk(&ChatCompletionMessage{Audio: audio}, nil)
+}
+
+func (rw *responseWriter) writeChunk(delta *ChatCompletionMessage, finishReason *string) {
+	if !rw.started {
+		rw.started = true
+		rw.w.Header().Set("Content-Type", "text/event-stream")
+		rw.w.Header().Set("Cache-Control", "no-cache")
+		rw.w.Header().Set("Connection", "keep-alive")
+		delta.Role = "assistant"
+	}
+	data, err := json.Marshal(ChatCompletionResponse{
+		ID:      rw.id,
+		Object:  "chat.completion.chunk",
+		Created: rw.created,
+		Model:   rw.req.Model,
+		Choices: []ChatCompletionChoice{{Delta: delta, FinishReason: finishReason}},
+	})
+	if err != nil {
+		log.Errorf("序列化响应失败: %v", err)
+		return
+	}
+	fmt.Fprintf(rw.w, "data: %s\n\n", data)
+	if rw.flusher != nil {
+		rw.flusher.Flush()
+	}
+}
+
+// finish 结束响应, 流式响应已经开始输出时错误只能记录日志
+func (rw *responseWriter) finish(err error) {
+	if err != nil {
+		log.Warnf("文本对话未正常结束: %v", err)
+	}
+	if err != nil && !rw.started && rw.content.Len() == 0 {
+		status := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		writeError(rw.w, status, err.Error())
+		return
+	}
+
+	finishReason := "stop"
+	if err != nil {
+		finishReason = "length"
+	}
+	if rw.req.Stream {
+		rw.writeChunk(&ChatCompletionMessage{}, &finishReason)
+		fmt.Fprint(rw.w, "data: [DONE]\n\n")
+		if rw.flusher != nil {
+			rw.flusher.Flush()
+		}
+		return
+	}
+
+	message := &ChatCompletionMessage{Role: "assistant", Content: rw.content.String()}
+	if rw.withAudio {
+		message.Audio = rw.audioChunk()
+		message.Audio.Frames = rw.frames
+		message.Audio.Transcript = message.Content
+	}
+	rw.w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw.w).Encode(ChatCompletionResponse{
+		ID:      rw.id,
+		Object:  "chat.completion",
+		Created: rw.created,
+		Model:   rw.req.Model,
+		Choices: []ChatCompletionChoice{{Message: message, FinishReason: &finishReason}},
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: errorBody{Message: message, Type: errType}})
+}
@@ -0,0 +1,136 @@
+package openai_api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+)
+
+func TestChatCompletions(t *testing.T) {
+	viper.Set("config_provider.type", "redis")
+	viper.Set("memory.provider", "nomemo")
+	viper.Set("tts_cache.enable", false)
+	viper.Set("asr.provider", constants.AsrTypeMock)
+	viper.Set("llm.provider", constants.LlmTypeMock)
+	viper.Set("llm.mock", map[string]interface{}{
+		"type":  constants.LlmTypeMock,
+		"reply": "你好，我是小智。有什么可以帮你？",
+		"loop":  true,
+	})
+	viper.Set("tts.provider", constants.TtsTypeMock)
+	viper.Set("tts.mock", map[string]interface{}{"char_duration_ms": 20})
+	viper.Set("openai_api.api_keys", []map[string]interface{}{
+		{"key": "sk-test", "devices": []string{"openai:00:00:00:00:01"}},
+	})
+
+	if err := auth.Init(); err != nil {
+		t.Fatalf("初始化auth失败: %v", err)
+	}
+	mcp.GetGlobalMCPManager()
+
+	chatServer, err := NewChatCompletionsServer()
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	defer chatServer.Close()
+	server := httptest.NewServer(http.HandlerFunc(chatServer.HandleChatCompletions))
+	defer server.Close()
+
+	postDevice := func(deviceID string, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer sk-test")
+		req.Header.Set("Device-Id", deviceID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		return resp
+	}
+	post := func(body string) *http.Response {
+		return postDevice("openai:00:00:00:00:01", body)
+	}
+
+	// 非流式
+	resp := post(`{"model":"xiaozhi","messages":[{"role":"user","content":"你好"}]}`)
+	var completion ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	resp.Body.Close()
+	if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "你好，我是小智。有什么可以帮你？" {
+		t.Fatalf("非流式响应错误: %+v", completion)
+	}
+
+	// 流式, 同时返回音频, 与纯文本请求使用不同的会话
+	resp = post(`{"model":"xiaozhi","stream":true,"modalities":["text","audio"],"messages":[{"role":"user","content":[{"type":"text","text":"今天天气怎么样"}]}]}`)
+	defer resp.Body.Close()
+	var content strings.Builder
+	var audioFrames int
+	var done bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "data: ")
+		if line == "" {
+			continue
+		}
+		if line == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk ChatCompletionResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("解析chunk失败: %s, %v", line, err)
+		}
+		delta := chunk.Choices[0].Delta
+		content.WriteString(delta.Content)
+		if delta.Audio != nil && delta.Audio.Data != "" {
+			audioFrames++
+		}
+	}
+	if !done || content.String() != "你好，我是小智。有什么可以帮你？" {
+		t.Errorf("流式响应错误: %q, done: %v", content.String(), done)
+	}
+	if audioFrames == 0 {
+		t.Errorf("未收到音频")
+	}
+
+	// 会话在请求之间被清理时使用新会话, 不返回错误
+	val, _ := chatServer.sessions.Load("openai:00:00:00:00:01|text")
+	val.(*textSession).close()
+	resp = post(`{"model":"xiaozhi","messages":[{"role":"user","content":"你好"}]}`)
+	completion = ChatCompletionResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("会话关闭后的请求失败: %d, %v", resp.StatusCode, err)
+	}
+	resp.Body.Close()
+
+	// API Key 无权访问的设备
+	resp = postDevice("openai:00:00:00:00:02", `{"model":"xiaozhi","messages":[{"role":"user","content":"你好"}]}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("不应允许访问其它设备: %d", resp.StatusCode)
+	}
+
+	// 错误的 API Key
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer wrong")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("API Key 校验错误: %v", err)
+	}
+}
+
+func TestChatCompletionsRequireAPIKey(t *testing.T) {
+	viper.Set("openai_api.api_keys", []string{})
+	if _, err := NewChatCompletionsServer(); err == nil {
+		t.Errorf("没有配置 API Key 时应创建失败")
+	}
+}
@@ -0,0 +1,111 @@
+package openai_api
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ChatCompletionRequest OpenAI /v1/chat/completions 请求, 只解析用到的字段
+// 对话历史由服务端按设备维护, messages 中只取最后一条 user 消息
+type ChatCompletionRequest struct {
+	Model      string        `json:"model"`
+	Messages   []ChatMessage `json:"messages"`
+	Stream     bool          `json:"stream"`
+	Modalities []string      `json:"modalities,omitempty"` // 包含 audio 时同时返回TTS音频
+	User       string        `json:"user,omitempty"`
+	// 扩展字段: 使用哪个设备的配置(智能体、提示词、记忆、工具), 也可以通过 Device-Id 请求头指定
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// ChatMessage content 可以是字符串, 也可以是 [{"type": "text", "text": "..."}]
+type ChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type contentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Text 提取消息中的文本
+func (m ChatMessage) Text() string {
+	var text string
+	if err := json.Unmarshal(m.Content, &text); err == nil {
+		return text
+	}
+	var parts []contentPart
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.Type == "text" {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
+
+// lastUserText 最后一条 user 消息的文本
+func (r *ChatCompletionRequest) lastUserText() string {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == "user" {
+			return strings.TrimSpace(r.Messages[i].Text())
+		}
+	}
+	return ""
+}
+
+func (r *ChatCompletionRequest) withAudio() bool {
+	for _, modality := range r.Modalities {
+		if modality == "audio" {
+			return true
+		}
+	}
+	return false
+}
+
+// AudioChunk TTS音频, 流式返回时每个chunk一帧, 非流式返回时 frames 为全部帧
+// 每帧是独立的Opus数据包(无容器), 按 sample_rate/channels/frame_duration 解码
+type AudioChunk struct {
+	ID            string   `json:"id"`
+	Data          string   `json:"data,omitempty"`
+	Frames        []string `json:"frames,omitempty"`
+	Transcript    string   `json:"transcript,omitempty"`
+	Format        string   `json:"format"`
+	SampleRate    int      `json:"sample_rate"`
+	Channels      int      `json:"channels"`
+	FrameDuration int      `json:"frame_duration"`
+}
+
+type ChatCompletionMessage struct {
+	Role    string      `json:"role,omitempty"`
+	Content string      `json:"content,omitempty"`
+	Audio   *AudioChunk `json:"audio,omitempty"`
+}
+
+type ChatCompletionChoice struct {
+	Index        int                    `json:"index"`
+	Message      *ChatCompletionMessage `json:"message,omitempty"`
+	Delta        *ChatCompletionMessage `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+// ChatCompletionResponse 非流式响应(object 为 chat.completion)和流式chunk(object 为 chat.completion.chunk)共用
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
@@ -0,0 +1,281 @@
+package recorder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const formatVersion = 1
+
+// 数据方向
+const (
+	DirIn  = "in"  // 设备 -> 服务端
+	DirOut = "out" // 服务端 -> 设备
+)
+
+// 事件类型
+const (
+	KindCmd   = "cmd"   // 文本信令
+	KindAudio = "audio" // Opus音频帧
+	KindClose = "close" // 连接关闭
+)
+
+// Header 录制文件的第一行
+type Header struct {
+	Version   int       `json:"version"`
+	DeviceID  string    `json:"device_id"`
+	Transport string    `json:"transport"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// Event 录制文件中的一条记录，每行一条
+type Event struct {
+	Ts   int64  `json:"ts"` // 相对录制开始的毫秒数
+	Dir  string `json:"dir,omitempty"`
+	Kind string `json:"kind"`
+	Text string `json:"text,omitempty"` // 信令内容
+	Data []byte `json:"data,omitempty"` // 音频数据
+}
+
+// Recording 读取后的完整录制
+type Recording struct {
+	Header Header
+	Events []Event
+}
+
+// Wrap 根据 recorder 配置决定是否录制该连接，需要录制时返回包装后的连接
+func Wrap(conn types.IConn) types.IConn {
+	if !viper.GetBool("recorder.enable") {
+		return conn
+	}
+	deviceID := conn.GetDeviceID()
+	if devices := viper.GetStringSlice("recorder.devices"); len(devices) > 0 {
+		matched := false
+		for _, d := range devices {
+			if d == deviceID {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return conn
+		}
+	}
+
+	dir := viper.GetString("recorder.dir")
+	if dir == "" {
+		dir = "recordings"
+	}
+	recordingConn, err := NewRecordingConn(conn, dir)
+	if err != nil {
+		log.Errorf("设备 %s 开启会话录制失败: %v", deviceID, err)
+		return conn
+	}
+	return recordingConn
+}
+
+// RecordingConn 包装 types.IConn，记录所有收发的信令和音频
+type RecordingConn struct {
+	types.IConn
+
+	path      string
+	startTime time.Time
+	file      *os.File
+	writer    *bufio.Writer
+	eventChan chan Event
+	done      chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewRecordingConn 创建录制连接，录制文件为 dir/{deviceID}_{时间}.jsonl
+func NewRecordingConn(conn types.IConn, dir string) (*RecordingConn, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建录制目录失败: %v", err)
+	}
+	startTime := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.jsonl", sanitizeFileName(conn.GetDeviceID()), startTime.Format("20060102_150405.000")))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("创建录制文件失败: %v", err)
+	}
+
+	c := &RecordingConn{
+		IConn:     conn,
+		path:      path,
+		startTime: startTime,
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		eventChan: make(chan Event, 1024),
+		done:      make(chan struct{}),
+	}
+	header, _ := json.Marshal(Header{
+		Version:   formatVersion,
+		DeviceID:  conn.GetDeviceID(),
+		Transport: conn.GetTransportType(),
+		StartTime: startTime,
+	})
+	c.writer.Write(header)
+	c.writer.WriteByte('\n')
+
+	// 底层连接断开时也要落盘
+	conn.OnClose(func(deviceId string) {
+		c.finish()
+	})
+
+	go c.writeLoop()
+	log.Infof("设备 %s 开始会话录制: %s", conn.GetDeviceID(), path)
+	return c, nil
+}
+
+// Path 录制文件路径
+func (c *RecordingConn) Path() string {
+	return c.path
+}
+
+func (c *RecordingConn) SendCmd(msg []byte) error {
+	c.record(DirOut, KindCmd, msg)
+	return c.IConn.SendCmd(msg)
+}
+
+func (c *RecordingConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	msg, err := c.IConn.RecvCmd(ctx, timeout)
+	if err == nil {
+		c.record(DirIn, KindCmd, msg)
+	}
+	return msg, err
+}
+
+func (c *RecordingConn) SendAudio(audio []byte) error {
+	c.record(DirOut, KindAudio, audio)
+	return c.IConn.SendAudio(audio)
+}
+
+func (c *RecordingConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	audio, err := c.IConn.RecvAudio(ctx, timeout)
+	if err == nil {
+		c.record(DirIn, KindAudio, audio)
+	}
+	return audio, err
+}
+
+func (c *RecordingConn) Close() error {
+	err := c.IConn.Close()
+	c.finish()
+	return err
+}
+
+func (c *RecordingConn) record(dir string, kind string, data []byte) {
+	event := Event{
+		Ts:   time.Since(c.startTime).Milliseconds(),
+		Dir:  dir,
+		Kind: kind,
+	}
+	if kind == KindCmd {
+		event.Text = string(data)
+	} else {
+		event.Data = append([]byte(nil), data...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	// 录制不能阻塞音频收发，写不过来时丢弃
+	select {
+	case c.eventChan <- event:
+	default:
+		log.Warnf("设备 %s 录制队列已满, 丢弃 %s %s", c.GetDeviceID(), dir, kind)
+	}
+}
+
+// finish 写入关闭事件并结束录制，可重复调用
+func (c *RecordingConn) finish() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.eventChan <- Event{Ts: time.Since(c.startTime).Milliseconds(), Kind: KindClose}
+	close(c.eventChan)
+	c.mu.Unlock()
+
+	<-c.done
+	log.Infof("设备 %s 会话录制结束: %s", c.GetDeviceID(), c.path)
+}
+
+func (c *RecordingConn) writeLoop() {
+	defer close(c.done)
+	encoder := json.NewEncoder(c.writer)
+	for event := range c.eventChan {
+		if err := encoder.Encode(event); err != nil {
+			log.Errorf("写入录制文件失败: %v", err)
+		}
+	}
+	if err := c.writer.Flush(); err != nil {
+		log.Errorf("写入录制文件失败: %v", err)
+	}
+	c.file.Close()
+}
+
+// Load 读取录制文件
+func Load(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	recording := &Recording{}
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("录制文件为空: %s", path)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &recording.Header); err != nil {
+		return nil, fmt.Errorf("解析录制文件头失败: %v", err)
+	}
+	if recording.Header.Version != formatVersion {
+		return nil, fmt.Errorf("不支持的录制文件版本: %d", recording.Header.Version)
+	}
+
+	line := 1
+	for scanner.Scan() {
+		line++
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("解析录制文件第 %d 行失败: %v", line, err)
+		}
+		recording.Events = append(recording.Events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return recording, nil
+}
+
+func sanitizeFileName(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			runes[i] = '_'
+		}
+	}
+	return string(runes)
+}
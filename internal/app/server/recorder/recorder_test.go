@@ -0,0 +1,109 @@
+package recorder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordingConnRoundTrip(t *testing.T) {
+	source := &Recording{
+		Header: Header{Version: formatVersion, DeviceID: "aa:bb:cc:dd:ee:ff", Transport: "websocket"},
+		Events: []Event{
+			{Ts: 0, Dir: DirIn, Kind: KindCmd, Text: `{"type":"hello"}`},
+			{Ts: 10, Dir: DirIn, Kind: KindAudio, Data: []byte{1, 2, 3}},
+		},
+	}
+	replayConn := NewReplayConn(source, 10)
+	dir := t.TempDir()
+	conn, err := NewRecordingConn(replayConn, dir)
+	if err != nil {
+		t.Fatalf("创建录制连接失败: %v", err)
+	}
+	replayConn.Start()
+
+	ctx := context.Background()
+	if msg, err := conn.RecvCmd(ctx, 1); err != nil || string(msg) != `{"type":"hello"}` {
+		t.Fatalf("RecvCmd 错误: %s, %v", msg, err)
+	}
+	if _, err := conn.RecvAudio(ctx, 1); err != nil {
+		t.Fatalf("RecvAudio 错误: %v", err)
+	}
+	conn.SendCmd([]byte(`{"type":"stt","text":"你好"}`))
+	conn.SendCmd([]byte(`{"type":"tts","state":"start"}`))
+	conn.SendCmd([]byte(`{"type":"tts","state":"sentence_start","text":"你好呀。"}`))
+	conn.SendAudio([]byte{4, 5})
+	conn.SendAudio([]byte{6, 7})
+	conn.SendCmd([]byte(`{"type":"tts","state":"sentence_start","text":"有什么可以帮你？"}`))
+	conn.SendCmd([]byte(`{"type":"tts","state":"stop"}`))
+	conn.Close()
+	// 重复关闭不应阻塞或panic
+	conn.Close()
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("应生成1个录制文件, 实际: %d", len(files))
+	}
+	recording, err := Load(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("读取录制文件失败: %v", err)
+	}
+	if recording.Header.DeviceID != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("设备ID错误: %s", recording.Header.DeviceID)
+	}
+	// 2条上行 + 7条下行 + 关闭
+	if len(recording.Events) != 10 || recording.Events[9].Kind != KindClose {
+		t.Fatalf("事件数量错误: %+v", recording.Events)
+	}
+	if audio := recording.Events[1].Data; len(audio) != 3 || audio[2] != 3 {
+		t.Errorf("音频数据错误: %v", audio)
+	}
+
+	script := ExtractScript(recording)
+	if len(script.AsrResults) != 1 || script.AsrResults[0] != "你好" {
+		t.Errorf("识别结果错误: %v", script.AsrResults)
+	}
+	if len(script.LlmReplies) != 1 || script.LlmReplies[0] != "你好呀。有什么可以帮你？" {
+		t.Errorf("回复错误: %v", script.LlmReplies)
+	}
+
+	trace := CmdTrace(recording.Events)
+	expected := []string{"stt 你好", "tts:start", "tts:sentence_start 你好呀。", "audio", "tts:sentence_start 有什么可以帮你？", "tts:stop"}
+	if len(trace) != len(expected) {
+		t.Fatalf("信令摘要错误: %v", trace)
+	}
+	for i := range expected {
+		if trace[i] != expected[i] {
+			t.Errorf("第 %d 条信令摘要错误: %s, 期望: %s", i, trace[i], expected[i])
+		}
+	}
+}
+
+func TestReplayConnTiming(t *testing.T) {
+	recording := &Recording{
+		Header: Header{Version: formatVersion, DeviceID: "test"},
+		Events: []Event{
+			{Ts: 0, Dir: DirIn, Kind: KindCmd, Text: "a"},
+			{Ts: 5, Dir: DirOut, Kind: KindCmd, Text: "ignored"},
+			{Ts: 200, Dir: DirIn, Kind: KindCmd, Text: "b"},
+		},
+	}
+	conn := NewReplayConn(recording, 2)
+	start := time.Now()
+	conn.Start()
+
+	ctx := context.Background()
+	for _, want := range []string{"a", "b"} {
+		msg, err := conn.RecvCmd(ctx, 1)
+		if err != nil || string(msg) != want {
+			t.Fatalf("RecvCmd 错误: %s, %v, 期望: %s", msg, err, want)
+		}
+	}
+	// 2倍速下第二条应在约100ms后送达
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("回放节奏错误, 耗时: %v", elapsed)
+	}
+	<-conn.Finished()
+}
@@ -0,0 +1,286 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// ReplayConn 实现 types.IConn，按录制时的节奏把设备上行的信令和音频重新送入服务端，
+// 并记录服务端下发的全部数据，用于和录制结果对比
+type ReplayConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	recording *Recording
+	speed     float64
+
+	recvCmdChan   chan []byte
+	recvAudioChan chan []byte
+	finished      chan struct{}
+
+	onCloseCbList []func(deviceId string)
+
+	startTime time.Time
+	outbound  []Event
+	closed    bool
+	sync.Mutex
+}
+
+// NewReplayConn 创建回放连接，speed 为回放倍速，<=0 时按 1 倍速
+func NewReplayConn(recording *Recording, speed float64) *ReplayConn {
+	if speed <= 0 {
+		speed = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ReplayConn{
+		ctx:           ctx,
+		cancel:        cancel,
+		recording:     recording,
+		speed:         speed,
+		recvCmdChan:   make(chan []byte, 100),
+		recvAudioChan: make(chan []byte, 100),
+		finished:      make(chan struct{}),
+	}
+}
+
+// Start 开始回放上行数据
+func (c *ReplayConn) Start() {
+	c.Lock()
+	c.startTime = time.Now()
+	c.Unlock()
+
+	go func() {
+		defer close(c.finished)
+		for _, event := range c.recording.Events {
+			if event.Dir != DirIn {
+				continue
+			}
+			wait := time.Duration(float64(event.Ts)/c.speed)*time.Millisecond - time.Since(c.startTime)
+			if wait > 0 {
+				select {
+				case <-c.ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+
+			ch := c.recvAudioChan
+			data := event.Data
+			if event.Kind == KindCmd {
+				ch = c.recvCmdChan
+				data = []byte(event.Text)
+			}
+			select {
+			case <-c.ctx.Done():
+				return
+			case ch <- data:
+			}
+		}
+		log.Infof("回放上行数据完成, 共 %d 条事件", len(c.recording.Events))
+	}()
+}
+
+// Finished 上行数据全部送出后关闭
+func (c *ReplayConn) Finished() <-chan struct{} {
+	return c.finished
+}
+
+// Outbound 回放过程中服务端下发的数据
+func (c *ReplayConn) Outbound() []Event {
+	c.Lock()
+	defer c.Unlock()
+	return append([]Event(nil), c.outbound...)
+}
+
+func (c *ReplayConn) addOutbound(kind string, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return errors.New("connection is closed")
+	}
+	event := Event{
+		Ts:   time.Since(c.startTime).Milliseconds(),
+		Dir:  DirOut,
+		Kind: kind,
+	}
+	if kind == KindCmd {
+		event.Text = string(data)
+	} else {
+		event.Data = append([]byte(nil), data...)
+	}
+	c.outbound = append(c.outbound, event)
+	return nil
+}
+
+func (c *ReplayConn) SendCmd(msg []byte) error {
+	log.Debugf("replay send cmd: %s", string(msg))
+	return c.addOutbound(KindCmd, msg)
+}
+
+func (c *ReplayConn) SendAudio(audio []byte) error {
+	return c.addOutbound(KindAudio, audio)
+}
+
+func (c *ReplayConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.recvCmdChan, timeout)
+}
+
+func (c *ReplayConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.recvAudioChan, timeout)
+}
+
+func (c *ReplayConn) recv(ctx context.Context, ch chan []byte, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.ctx.Done():
+		return nil, errors.New("connection is closed")
+	case data := <-ch:
+		return data, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (c *ReplayConn) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.cancel()
+	return nil
+}
+
+// Disconnect 模拟设备断开，通知注册方
+func (c *ReplayConn) Disconnect() {
+	c.Lock()
+	cbList := append([]func(deviceId string){}, c.onCloseCbList...)
+	c.Unlock()
+	for _, cb := range cbList {
+		cb(c.GetDeviceID())
+	}
+}
+
+func (c *ReplayConn) OnClose(cb func(deviceId string)) {
+	c.Lock()
+	defer c.Unlock()
+	c.onCloseCbList = append(c.onCloseCbList, cb)
+}
+
+func (c *ReplayConn) GetDeviceID() string {
+	return c.recording.Header.DeviceID
+}
+
+func (c *ReplayConn) GetTransportType() string {
+	if c.recording.Header.Transport != "" {
+		return c.recording.Header.Transport
+	}
+	return types.TransportTypeWebsocket
+}
+
+func (c *ReplayConn) GetData(key string) (interface{}, error) {
+	// mqtt_udp 的 hello 需要加密参数，回放时音频不经过UDP，返回空值即可
+	if c.GetTransportType() == types.TransportTypeMqttUdp && (key == "aes_key" || key == "full_nonce") {
+		return "", nil
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (c *ReplayConn) CloseAudioChannel() error {
+	return nil
+}
+
+// cmdMessage 对比时关心的信令字段
+type cmdMessage struct {
+	Type  string `json:"type"`
+	State string `json:"state"`
+	Text  string `json:"text"`
+}
+
+// Script 从录制的下行信令中提取出的识别结果和回复，用于驱动模拟的ASR和LLM
+type Script struct {
+	AsrResults []string
+	LlmReplies []string
+}
+
+// ExtractScript 按 stt 消息划分对话轮次，每轮 tts sentence_start 的文本拼成一条LLM回复
+func ExtractScript(recording *Recording) Script {
+	var script Script
+	var reply strings.Builder
+	inTurn := false
+	flush := func() {
+		if inTurn {
+			script.LlmReplies = append(script.LlmReplies, reply.String())
+		}
+		reply.Reset()
+	}
+	for _, event := range recording.Events {
+		if event.Dir != DirOut || event.Kind != KindCmd {
+			continue
+		}
+		var msg cmdMessage
+		if err := json.Unmarshal([]byte(event.Text), &msg); err != nil {
+			continue
+		}
+		switch {
+		case msg.Type == "stt":
+			flush()
+			script.AsrResults = append(script.AsrResults, msg.Text)
+			inTurn = true
+		case msg.Type == "tts" && msg.State == "sentence_start" && inTurn:
+			reply.WriteString(msg.Text)
+		}
+	}
+	flush()
+	return script
+}
+
+// CmdTrace 将事件中的下行信令转换为便于对比的摘要，如 "tts:sentence_start 你好"
+// 连续的音频帧合并为一条 "audio"，回放使用模拟TTS，帧数与录制时不同，不参与对比
+func CmdTrace(events []Event) []string {
+	var trace []string
+	haveAudio := false
+	flushAudio := func() {
+		if haveAudio {
+			trace = append(trace, "audio")
+			haveAudio = false
+		}
+	}
+	for _, event := range events {
+		if event.Dir != DirOut {
+			continue
+		}
+		if event.Kind == KindAudio {
+			haveAudio = true
+			continue
+		}
+		if event.Kind != KindCmd {
+			continue
+		}
+		flushAudio()
+		var msg cmdMessage
+		if err := json.Unmarshal([]byte(event.Text), &msg); err != nil {
+			trace = append(trace, event.Text)
+			continue
+		}
+		line := msg.Type
+		if msg.State != "" {
+			line += ":" + msg.State
+		}
+		if msg.Text != "" && msg.Type != "hello" {
+			line += " " + msg.Text
+		}
+		trace = append(trace, line)
+	}
+	flushAudio()
+	return trace
+}
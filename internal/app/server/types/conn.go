@@ -8,6 +8,7 @@ import "context"
 const (
 	TransportTypeWebsocket = "websocket"
 	TransportTypeMqttUdp   = "udp"
+	TransportTypeWebRTC    = "webrtc"
 )
 
 type IConn interface {
@@ -0,0 +1,31 @@
+package webrtc
+
+import "time"
+
+// opusFrameDurations Opus TOC 字节中 config(高5位) 对应的单帧时长, 单位: 0.1ms
+// 0-11 SILK: 10/20/40/60ms, 12-15 Hybrid: 10/20ms, 16-31 CELT: 2.5/5/10/20ms
+var opusFrameDurations = [32]int{
+	100, 200, 400, 600, 100, 200, 400, 600, 100, 200, 400, 600,
+	100, 200, 100, 200,
+	25, 50, 100, 200, 25, 50, 100, 200, 25, 50, 100, 200, 25, 50, 100, 200,
+}
+
+// opusPacketDuration 根据 TOC 字节计算一个 Opus 数据包的时长(RFC6716 3.1), 无法解析时返回0
+func opusPacketDuration(packet []byte) time.Duration {
+	if len(packet) == 0 {
+		return 0
+	}
+	toc := packet[0]
+	frameDuration := time.Duration(opusFrameDurations[toc>>3]) * 100 * time.Microsecond
+	frameCount := 1
+	switch toc & 0x03 {
+	case 1, 2:
+		frameCount = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0
+		}
+		frameCount = int(packet[1] & 0x3f)
+	}
+	return frameDuration * time.Duration(frameCount)
+}
@@ -0,0 +1,34 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio"
+)
+
+func TestOpusPacketDuration(t *testing.T) {
+	for _, frameDuration := range []int{20, 40, 60} {
+		processer, err := audio.GetAudioProcesser(16000, 1, frameDuration)
+		if err != nil {
+			t.Fatalf("创建编码器失败: %v", err)
+		}
+		pcm := make([]int16, 16000*frameDuration/1000)
+		buf := make([]byte, 1500)
+		n, err := processer.Encoder(pcm, buf)
+		if err != nil {
+			t.Fatalf("编码失败: %v", err)
+		}
+		if d := opusPacketDuration(buf[:n]); d != time.Duration(frameDuration)*time.Millisecond {
+			t.Errorf("帧长 %dms 解析错误: %v", frameDuration, d)
+		}
+	}
+
+	if d := opusPacketDuration(nil); d != 0 {
+		t.Errorf("空数据包应返回0: %v", d)
+	}
+	// code 3, CELT 20ms, 3帧
+	if d := opusPacketDuration([]byte{31<<3 | 3, 3}); d != 60*time.Millisecond {
+		t.Errorf("code 3 数据包解析错误: %v", d)
+	}
+}
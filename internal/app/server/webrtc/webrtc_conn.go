@@ -0,0 +1,250 @@
+package webrtc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	pion "github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// WebRTCConn 实现 types.IConn 接口，适配 WebRTC 连接
+// 上下行音频走 Opus 音轨(SRTP), 信令走名为 xiaozhi 的数据通道, 消息格式与 websocket 一致
+type WebRTCConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	onCloseCbList []func(deviceId string)
+
+	pc         *pion.PeerConnection
+	localTrack *pion.TrackLocalStaticSample
+	dc         *pion.DataChannel
+	deviceID   string
+
+	recvCmdChan   chan []byte
+	recvAudioChan chan []byte
+
+	closed bool
+	sync.RWMutex
+}
+
+// newWebRTCConn 创建连接并注册音轨和数据通道的回调, onReady 在数据通道打开后调用一次
+func newWebRTCConn(pc *pion.PeerConnection, localTrack *pion.TrackLocalStaticSample, deviceID string, onReady func(conn *WebRTCConn)) *WebRTCConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	instance := &WebRTCConn{
+		ctx:           ctx,
+		cancel:        cancel,
+		pc:            pc,
+		localTrack:    localTrack,
+		deviceID:      deviceID,
+		recvCmdChan:   make(chan []byte, 100),
+		recvAudioChan: make(chan []byte, 100),
+	}
+
+	pc.OnTrack(func(track *pion.TrackRemote, receiver *pion.RTPReceiver) {
+		if track.Kind() != pion.RTPCodecTypeAudio {
+			return
+		}
+		log.Infof("WebRTC 收到音轨, 设备ID: %s, codec: %s", deviceID, track.Codec().MimeType)
+		go instance.readTrack(track)
+	})
+
+	pc.OnDataChannel(func(dc *pion.DataChannel) {
+		if dc.Label() != dataChannelLabel {
+			log.Warnf("WebRTC 忽略未知数据通道: %s, 设备ID: %s", dc.Label(), deviceID)
+			return
+		}
+		dc.OnOpen(func() {
+			instance.Lock()
+			instance.dc = dc
+			instance.Unlock()
+			onReady(instance)
+		})
+		dc.OnMessage(func(msg pion.DataChannelMessage) {
+			if !msg.IsString {
+				return
+			}
+			instance.RLock()
+			defer instance.RUnlock()
+			if instance.closed {
+				return
+			}
+			select {
+			case instance.recvCmdChan <- msg.Data:
+			default:
+				log.Errorf("recv cmd channel is full")
+			}
+		})
+		dc.OnClose(func() {
+			instance.notifyClose()
+		})
+	})
+
+	pc.OnConnectionStateChange(func(state pion.PeerConnectionState) {
+		log.Debugf("WebRTC 连接状态变化, 设备ID: %s, 状态: %s", deviceID, state)
+		if state == pion.PeerConnectionStateFailed || state == pion.PeerConnectionStateClosed {
+			instance.notifyClose()
+		}
+	})
+
+	return instance
+}
+
+// readTrack 读取上行音轨, RTP 负载即一帧 Opus 数据
+func (c *WebRTCConn) readTrack(track *pion.TrackRemote) {
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Errorf("WebRTC 读取音轨失败, 设备ID: %s, 错误: %v", c.deviceID, err)
+			}
+			return
+		}
+		if len(packet.Payload) == 0 {
+			continue
+		}
+		c.RLock()
+		if c.closed {
+			c.RUnlock()
+			return
+		}
+		select {
+		case c.recvAudioChan <- packet.Payload:
+		default:
+			log.Errorf("recv audio channel is full")
+		}
+		c.RUnlock()
+	}
+}
+
+// notifyClose 对端断开时通知注册方, 只通知一次
+func (c *WebRTCConn) notifyClose() {
+	select {
+	case <-c.ctx.Done():
+		return
+	default:
+	}
+	c.cancel()
+	c.RLock()
+	cbList := append([]func(deviceId string){}, c.onCloseCbList...)
+	c.RUnlock()
+	for _, cb := range cbList {
+		cb(c.deviceID) //通知注册方退出
+	}
+}
+
+func (c *WebRTCConn) SendCmd(msg []byte) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.closed {
+		return errors.New("connection is closed")
+	}
+	if c.dc == nil {
+		return errors.New("data channel is not open")
+	}
+
+	log.Debugf("send cmd: %s", string(msg))
+	if err := c.dc.SendText(string(msg)); err != nil {
+		log.Errorf("send cmd error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SendAudio 发送一帧 Opus 音频, 按帧长推进 RTP 时间戳
+func (c *WebRTCConn) SendAudio(audio []byte) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.closed {
+		return errors.New("connection is closed")
+	}
+
+	duration := opusPacketDuration(audio)
+	if duration == 0 {
+		return errors.New("invalid opus packet")
+	}
+	if err := c.localTrack.WriteSample(media.Sample{Data: audio, Duration: duration}); err != nil {
+		log.Errorf("send audio error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (c *WebRTCConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		log.Debugf("recv cmd context done")
+		return nil, ctx.Err()
+	case msg, ok := <-c.recvCmdChan:
+		if !ok {
+			return nil, errors.New("connection is closed")
+		}
+		return msg, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (c *WebRTCConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		log.Debugf("recv audio context done")
+		return nil, ctx.Err()
+	case audio, ok := <-c.recvAudioChan:
+		if !ok {
+			return nil, errors.New("connection is closed")
+		}
+		return audio, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (c *WebRTCConn) Close() error {
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return nil // Already closed
+	}
+	c.closed = true
+	c.cancel()
+	close(c.recvCmdChan)
+	close(c.recvAudioChan)
+	c.Unlock()
+
+	// 关闭过程中会触发数据通道和连接状态回调, 不能持有锁
+	if err := c.pc.Close(); err != nil {
+		log.Warnf("关闭 PeerConnection 失败, 设备ID: %s, 错误: %v", c.deviceID, err)
+	}
+	return nil
+}
+
+func (c *WebRTCConn) OnClose(cb func(deviceId string)) {
+	c.Lock()
+	defer c.Unlock()
+	c.onCloseCbList = append(c.onCloseCbList, cb)
+}
+
+func (c *WebRTCConn) GetDeviceID() string {
+	return c.deviceID
+}
+
+func (c *WebRTCConn) GetTransportType() string {
+	return types.TransportTypeWebRTC
+}
+
+func (c *WebRTCConn) GetData(key string) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *WebRTCConn) CloseAudioChannel() error {
+	return nil
+}
@@ -0,0 +1,293 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	pion "github.com/pion/webrtc/v4"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	// 客户端创建的信令数据通道名称
+	dataChannelLabel = "xiaozhi"
+	// 等待ICE候选收集完成的最长时间
+	iceGatheringTimeout = 5 * time.Second
+	// 返回 answer 后数据通道一直没有打开则关闭连接
+	connectTimeout = 30 * time.Second
+)
+
+// ICEServer STUN/TURN 服务器配置, 对应 webrtc.ice_servers
+type ICEServer struct {
+	URLs       []string `mapstructure:"urls" json:"urls"`
+	Username   string   `mapstructure:"username" json:"username,omitempty"`
+	Credential string   `mapstructure:"credential" json:"credential,omitempty"`
+}
+
+// SessionDescription 信令接口的请求和响应
+type SessionDescription struct {
+	Type       string      `json:"type"`
+	SDP        string      `json:"sdp"`
+	ICEServers []ICEServer `json:"ice_servers,omitempty"`
+}
+
+// WebRTCServer 处理 WebRTC 信令, 为每个 offer 创建 PeerConnection 并适配为 IConn
+// 信令接口挂在 WebSocketServer 的 HTTP 端口上, 采用非 trickle 方式: 收集完候选后一次性返回 answer
+type WebRTCServer struct {
+	api        *pion.API
+	iceServers []ICEServer
+
+	onNewConnection types.OnNewConnection
+}
+
+// WebRTCServerOption 用于配置 WebRTCServer 的可选参数
+type WebRTCServerOption func(*WebRTCServer)
+
+func WithOnNewConnection(onNewConnection types.OnNewConnection) WebRTCServerOption {
+	return func(s *WebRTCServer) {
+		s.onNewConnection = onNewConnection
+	}
+}
+
+// NewWebRTCServer 根据 webrtc 配置创建服务
+func NewWebRTCServer(opts ...WebRTCServerOption) (*WebRTCServer, error) {
+	mediaEngine := &pion.MediaEngine{}
+	if err := mediaEngine.RegisterCodec(pion.RTPCodecParameters{
+		RTPCodecCapability: opusCodecCapability(),
+		PayloadType:        111,
+	}, pion.RTPCodecTypeAudio); err != nil {
+		return nil, fmt.Errorf("注册Opus编解码器失败: %v", err)
+	}
+
+	// NACK、RTCP报告、TWCC等默认拦截器
+	interceptorRegistry := &interceptor.Registry{}
+	if err := pion.RegisterDefaultInterceptors(mediaEngine, interceptorRegistry); err != nil {
+		return nil, fmt.Errorf("注册拦截器失败: %v", err)
+	}
+
+	settingEngine := pion.SettingEngine{}
+	portMin, portMax := viper.GetInt("webrtc.port_min"), viper.GetInt("webrtc.port_max")
+	if portMin > 0 && portMax >= portMin {
+		if err := settingEngine.SetEphemeralUDPPortRange(uint16(portMin), uint16(portMax)); err != nil {
+			return nil, fmt.Errorf("设置UDP端口范围失败: %v", err)
+		}
+	}
+	if ips := viper.GetStringSlice("webrtc.public_ips"); len(ips) > 0 {
+		// 服务端在NAT后面时, 用公网地址替换host候选
+		settingEngine.SetNAT1To1IPs(ips, pion.ICECandidateTypeHost)
+	}
+
+	s := &WebRTCServer{
+		api: pion.NewAPI(
+			pion.WithMediaEngine(mediaEngine),
+			pion.WithInterceptorRegistry(interceptorRegistry),
+			pion.WithSettingEngine(settingEngine),
+		),
+	}
+	if err := viper.UnmarshalKey("webrtc.ice_servers", &s.iceServers); err != nil {
+		return nil, fmt.Errorf("解析 webrtc.ice_servers 失败: %v", err)
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+func opusCodecCapability() pion.RTPCodecCapability {
+	return pion.RTPCodecCapability{
+		MimeType:    pion.MimeTypeOpus,
+		ClockRate:   48000,
+		Channels:    2,
+		SDPFmtpLine: "minptime=10;useinbandfec=1",
+	}
+}
+
+func (s *WebRTCServer) peerConnectionConfig() pion.Configuration {
+	config := pion.Configuration{}
+	for _, server := range s.iceServers {
+		config.ICEServers = append(config.ICEServers, pion.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+	return config
+}
+
+// HandleOffer 处理客户端的 offer
+//
+//	POST /xiaozhi/webrtc/v1/offer  Header: Device-Id, Client-Id, Authorization
+//	请求: {"type": "offer", "sdp": "..."}
+//	响应: {"type": "answer", "sdp": "...", "ice_servers": [...]}
+//
+// 浏览器无法设置请求头时可以用 device_id、client_id、token 参数代替,
+// 开启 auth.enable 时先校验令牌和设备激活状态, 通过后才创建 PeerConnection 或返回 ICE 服务器(可能包含TURN凭证)
+// 客户端需要在 offer 中带上一个 sendrecv 的音频轨和名为 xiaozhi 的数据通道,
+// 数据通道打开后发送 transport 为 webrtc 的 hello 消息, 之后的信令与 websocket 一致
+func (s *WebRTCServer) HandleOffer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := requestParam(r, "Device-Id", "device_id")
+	if deviceID == "" {
+		log.Warn("缺少 Device-Id 请求头")
+		http.Error(w, "缺少 Device-Id 请求头", http.StatusBadRequest)
+		return
+	}
+	if status, err := s.authorize(r, deviceID); err != nil {
+		log.Warnf("WebRTC 请求认证失败, 设备ID: %s, 错误: %v", deviceID, err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		// 客户端创建 PeerConnection 前获取 ICE 服务器
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SessionDescription{ICEServers: s.iceServers})
+		return
+	}
+
+	var offer SessionDescription
+	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil || offer.SDP == "" {
+		http.Error(w, "无效的 offer", http.StatusBadRequest)
+		return
+	}
+
+	answer, err := s.accept(deviceID, offer.SDP)
+	if err != nil {
+		log.Errorf("WebRTC 建立连接失败, 设备ID: %s, 错误: %v", deviceID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionDescription{
+		Type:       answer.Type.String(),
+		SDP:        answer.SDP,
+		ICEServers: s.iceServers,
+	})
+}
+
+// requestParam 优先读取请求头, 没有时读取同名的查询参数
+func requestParam(r *http.Request, header string, query string) string {
+	if value := r.Header.Get(header); value != "" {
+		return value
+	}
+	return r.URL.Query().Get(query)
+}
+
+// authorize 开启 auth.enable 时校验令牌和设备激活状态, 与 websocket 连接和 hello 的校验一致
+func (s *WebRTCServer) authorize(r *http.Request, deviceID string) (int, error) {
+	if !viper.GetBool("auth.enable") {
+		return http.StatusOK, nil
+	}
+
+	token := requestParam(r, "Authorization", "token")
+	if token == "" {
+		return http.StatusUnauthorized, fmt.Errorf("缺少 Authorization 请求头")
+	}
+	if authManager := auth.A(); authManager == nil || !authManager.ValidateToken(token) {
+		return http.StatusUnauthorized, fmt.Errorf("无效的令牌")
+	}
+
+	clientID := requestParam(r, "Client-Id", "client_id")
+	if clientID == "" {
+		return http.StatusBadRequest, fmt.Errorf("缺少 Client-Id 请求头")
+	}
+	configProvider, err := user_config.GetProvider(viper.GetString("config_provider.type"))
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("获取配置提供者失败: %v", err)
+	}
+	isActivated, err := configProvider.IsDeviceActivated(r.Context(), deviceID, clientID)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("获取激活状态失败: %v", err)
+	}
+	if !isActivated {
+		return http.StatusForbidden, fmt.Errorf("设备未激活")
+	}
+	return http.StatusOK, nil
+}
+
+// accept 创建 PeerConnection 并返回 answer, 数据通道打开后通知 onNewConnection
+func (s *WebRTCServer) accept(deviceID string, sdp string) (*pion.SessionDescription, error) {
+	pc, err := s.api.NewPeerConnection(s.peerConnectionConfig())
+	if err != nil {
+		return nil, fmt.Errorf("创建 PeerConnection 失败: %v", err)
+	}
+
+	localTrack, err := pion.NewTrackLocalStaticSample(opusCodecCapability(), "audio", "xiaozhi")
+	if err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("创建音轨失败: %v", err)
+	}
+
+	var readyOnce sync.Once
+	ready := make(chan struct{})
+	newWebRTCConn(pc, localTrack, deviceID, func(conn *WebRTCConn) {
+		readyOnce.Do(func() {
+			close(ready)
+			log.Infof("WebRTC 数据通道已打开, 设备ID: %s", deviceID)
+			if s.onNewConnection != nil {
+				s.onNewConnection(conn)
+			}
+		})
+	})
+	go func() {
+		select {
+		case <-ready:
+		case <-time.After(connectTimeout):
+			log.Warnf("WebRTC 数据通道未打开, 关闭连接, 设备ID: %s", deviceID)
+			pc.Close()
+		}
+	}()
+
+	if err := pc.SetRemoteDescription(pion.SessionDescription{Type: pion.SDPTypeOffer, SDP: sdp}); err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("设置 offer 失败: %v", err)
+	}
+
+	// 复用 offer 中的音频 transceiver 发送下行音频
+	rtpSender, err := pc.AddTrack(localTrack)
+	if err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("添加音轨失败: %v", err)
+	}
+	go func() {
+		// 读取 RTCP, 否则拥塞控制等拦截器无法工作
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := rtpSender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("创建 answer 失败: %v", err)
+	}
+	gatherComplete := pion.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("设置 answer 失败: %v", err)
+	}
+	select {
+	case <-gatherComplete:
+	case <-time.After(iceGatheringTimeout):
+		log.Warnf("WebRTC 收集ICE候选超时, 设备ID: %s", deviceID)
+	}
+
+	return pc.LocalDescription(), nil
+}
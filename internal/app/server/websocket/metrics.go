@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/domain/asr"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/funasr"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
+	"xiaozhi-esp32-server-golang/internal/domain/vad"
+)
+
+var (
+	vadPoolDesc         = metrics.NewDesc("vad_pool_resources", "VAD资源池中的实例数", "provider", "state")
+	asrBackendStateDesc = metrics.NewDesc("asr_backend_circuit_state", "ASR故障转移后端的熔断状态(0正常 1半开 2熔断)", "backend", "provider")
+	asrBackendErrorDesc = metrics.NewDesc("asr_backend_error_rate", "ASR故障转移后端最近请求的错误率", "backend", "provider")
+	funasrPoolDesc      = metrics.NewDesc("funasr_pool_connections", "FunASR连接池中的连接数", "state")
+	mcpConnectedDesc    = metrics.NewDesc("mcp_server_connected", "全局MCP服务器连接状态(1已连接 0未连接)", "server")
+
+	registerCollectorOnce sync.Once
+)
+
+// serverCollector 在采集时读取VAD资源池、ASR后端健康状况、FunASR连接池和MCP连接状态
+type serverCollector struct {
+	globalMCPManager *mcp.GlobalMCPManager
+}
+
+func (c *serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- vadPoolDesc
+	ch <- asrBackendStateDesc
+	ch <- asrBackendErrorDesc
+	ch <- funasrPoolDesc
+	ch <- mcpConnectedDesc
+}
+
+func (c *serverCollector) Collect(ch chan<- prometheus.Metric) {
+	vadProvider := viper.GetString("vad.provider")
+	if stats := vad.GetPoolStats(vadProvider); stats != nil {
+		for _, state := range []string{"in_use_resources", "available_resources", "max_size"} {
+			if value, ok := stats[state].(int); ok {
+				ch <- prometheus.MustNewConstMetric(vadPoolDesc, prometheus.GaugeValue, float64(value), vadProvider, state)
+			}
+		}
+	}
+
+	for _, stats := range asr.GetAsrBackendStats() {
+		state := 0.0
+		switch stats.State {
+		case asr.CircuitStateHalfOpen:
+			state = 1
+		case asr.CircuitStateOpen:
+			state = 2
+		}
+		ch <- prometheus.MustNewConstMetric(asrBackendStateDesc, prometheus.GaugeValue, state, stats.Name, stats.Provider)
+		ch <- prometheus.MustNewConstMetric(asrBackendErrorDesc, prometheus.GaugeValue, stats.ErrorRate, stats.Name, stats.Provider)
+	}
+
+	inUse, total := funasr.GetPoolStats()
+	ch <- prometheus.MustNewConstMetric(funasrPoolDesc, prometheus.GaugeValue, float64(inUse), "in_use")
+	ch <- prometheus.MustNewConstMetric(funasrPoolDesc, prometheus.GaugeValue, float64(total), "total")
+
+	if c.globalMCPManager != nil {
+		for server, connected := range c.globalMCPManager.GetServerStatus() {
+			value := 0.0
+			if connected {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(mcpConnectedDesc, prometheus.GaugeValue, value, server)
+		}
+	}
+}
+
+// registerMetricsCollector 注册服务端状态采集器，多次调用只注册一次
+func (s *WebSocketServer) registerMetricsCollector() {
+	registerCollectorOnce.Do(func() {
+		metrics.RegisterCollector(&serverCollector{globalMCPManager: s.globalMCPManager})
+	})
+}
@@ -1,16 +1,23 @@
 package websocket
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
 
 	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	"xiaozhi-esp32-server-golang/internal/app/server/cluster"
+	"xiaozhi-esp32-server-golang/internal/app/server/openai_api"
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	"xiaozhi-esp32-server-golang/internal/app/server/webrtc"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -26,6 +33,16 @@ type WebSocketServer struct {
 	port int
 	// MCP管理器
 	globalMCPManager *mcp.GlobalMCPManager
+	// WebRTC 信令, 为nil时不提供
+	webrtcServer *webrtc.WebRTCServer
+	// OpenAI 兼容的文本对话接口, 为nil时不提供
+	chatCompletionsServer *openai_api.ChatCompletionsServer
+	// 集群节点, 为nil时不提供 /admin/cluster 管理接口
+	cluster *cluster.Cluster
+	// Start 后创建, Shutdown 时停止监听, 由 httpMu 保护
+	httpMu     sync.Mutex
+	httpServer *http.Server
+	shutdown   bool
 
 	onNewConnection types.OnNewConnection
 }
@@ -48,6 +65,27 @@ func WithMCPManager(mcpManager *mcp.GlobalMCPManager) WebSocketServerOption {
 	}
 }
 
+// WithWebRTCServer 在同一端口上提供 WebRTC 信令接口
+func WithWebRTCServer(webrtcServer *webrtc.WebRTCServer) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.webrtcServer = webrtcServer
+	}
+}
+
+// WithChatCompletionsServer 在同一端口上提供 /v1/chat/completions
+func WithChatCompletionsServer(chatCompletionsServer *openai_api.ChatCompletionsServer) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.chatCompletionsServer = chatCompletionsServer
+	}
+}
+
+// WithCluster 在同一端口上提供集群节点管理接口
+func WithCluster(c *cluster.Cluster) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.cluster = c
+	}
+}
+
 func WithOnNewConnection(onNewConnection types.OnNewConnection) WebSocketServerOption {
 	return func(s *WebSocketServer) {
 		s.onNewConnection = onNewConnection
@@ -97,18 +135,79 @@ func (s *WebSocketServer) Start() error {
 
 	http.HandleFunc("/admin/inject_msg", s.handleInjectMsg)
 
+	if s.webrtcServer != nil {
+		http.HandleFunc("/xiaozhi/webrtc/v1/offer", s.webrtcServer.HandleOffer)
+	}
+	if s.chatCompletionsServer != nil {
+		http.HandleFunc("/v1/chat/completions", s.chatCompletionsServer.HandleChatCompletions)
+	}
+	if s.cluster != nil {
+		if s.cluster.AdminEnabled() {
+			http.HandleFunc("/admin/cluster", s.cluster.HandleAdmin)
+			http.HandleFunc("/admin/cluster/", s.cluster.HandleAdmin)
+		} else {
+			log.Errorf("未配置 cluster.admin_token, 不开放 /admin/cluster 节点管理接口")
+		}
+	}
+
+	if viper.GetBool("metrics.enable") {
+		s.registerMetricsCollector()
+		http.Handle("/metrics", metrics.Handler())
+	}
+
 	listenAddr := fmt.Sprintf("0.0.0.0:%d", s.port)
 	log.Infof("WebSocket 服务器启动在 ws://%s/xiaozhi/v1/", listenAddr)
 	log.Infof("MCP WebSocket 端点: ws://%s/mcp?token=xxx", listenAddr)
 	log.Infof("MCP API 端点: http://%s/xiaozhi/api/mcp/tools/{deviceId}", listenAddr)
+	if s.webrtcServer != nil {
+		log.Infof("WebRTC 信令端点: http://%s/xiaozhi/webrtc/v1/offer", listenAddr)
+	}
+	if s.chatCompletionsServer != nil {
+		log.Infof("文本对话端点: http://%s/v1/chat/completions", listenAddr)
+	}
+	if s.cluster != nil {
+		log.Infof("集群管理端点: http://%s/admin/cluster", listenAddr)
+	}
+	if viper.GetBool("metrics.enable") {
+		log.Infof("Prometheus 指标端点: http://%s/metrics", listenAddr)
+	}
 
-	if err := http.ListenAndServe(listenAddr, nil); err != nil {
+	s.httpMu.Lock()
+	if s.shutdown {
+		// Start 还没来得及监听服务就已经关闭
+		s.httpMu.Unlock()
+		return nil
+	}
+	httpServer := &http.Server{Addr: listenAddr}
+	s.httpServer = httpServer
+	s.httpMu.Unlock()
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Log().Fatalf("WebSocket 服务器启动失败: %v", err)
 		return err
 	}
 	return nil
 }
 
+// Shutdown 停止监听, 不再接受新连接, 等待进行中的HTTP请求结束
+// 已升级的 websocket 连接不受影响, 由 ChatManager 各自关闭
+func (s *WebSocketServer) Shutdown(ctx context.Context) error {
+	s.httpMu.Lock()
+	s.shutdown = true
+	httpServer := s.httpServer
+	s.httpMu.Unlock()
+
+	var err error
+	if httpServer != nil {
+		err = httpServer.Shutdown(ctx)
+	}
+	// 进行中的请求结束后再关闭文本会话
+	if s.chatCompletionsServer != nil {
+		s.chatCompletionsServer.Close()
+	}
+	return err
+}
+
 // handleGetDeviceTools 获取设备的工具列表
 func (s *WebSocketServer) handleGetDeviceTools(w http.ResponseWriter, r *http.Request, deviceID string) {
 
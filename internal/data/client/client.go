@@ -8,8 +8,10 @@ import (
 	"time"
 
 	"sync"
+	"sync/atomic"
 
 	"xiaozhi-esp32-server-golang/internal/domain/asr"
+	asr_types "xiaozhi-esp32-server-golang/internal/domain/asr/types"
 	utypes "xiaozhi-esp32-server-golang/internal/domain/config/types"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
@@ -29,6 +31,8 @@ import (
 type Dialogue struct {
 	mu       sync.RWMutex // 保护 Messages 的读写锁
 	Messages []*schema.Message
+	// Summary 已经从 Messages 中移除的较早对话的滚动摘要
+	Summary string
 }
 
 const (
@@ -101,6 +105,11 @@ type ClientState struct {
 	IsTtsStart        bool //是否tts开始
 	IsWelcomeSpeaking bool //是否已经欢迎语
 
+	segmentVad *segmentVoiceDetector //ASR 按静音分段使用的VAD, 与会话的VAD相互独立
+
+	ttsPlaying   atomic.Bool  //tts是否正在播放, 由 tts start/stop 维护, 用于插话检测
+	ttsStartTime atomic.Int64 //本轮tts开始播放的时间(ms), 用于插话检测的回声保护
+
 	// 声纹识别相关
 	SpeakerProvider speaker.SpeakerProvider // 声纹识别提供者（在 session 中初始化）
 
@@ -252,6 +261,35 @@ func AlignToolMessages(messages []*schema.Message) []*schema.Message {
 	return alignedMessages
 }
 
+// GetSummary 获取较早对话的摘要
+func (c *ClientState) GetSummary() string {
+	c.Dialogue.mu.RLock()
+	defer c.Dialogue.mu.RUnlock()
+	return c.Dialogue.Summary
+}
+
+// SetSummary 设置较早对话的摘要, 用于加载历史时恢复
+func (c *ClientState) SetSummary(summary string) {
+	c.Dialogue.mu.Lock()
+	defer c.Dialogue.mu.Unlock()
+	c.Dialogue.Summary = summary
+}
+
+// ApplySummary 更新摘要并从历史中移除已经合并到摘要中的消息(从最早一条到 last)
+// 总结期间历史可能被重新加载, 找不到 last 时不做修改并返回 false
+func (c *ClientState) ApplySummary(summary string, last *schema.Message) bool {
+	c.Dialogue.mu.Lock()
+	defer c.Dialogue.mu.Unlock()
+	for i, msg := range c.Dialogue.Messages {
+		if msg == last {
+			c.Dialogue.Messages = AlignToolMessages(c.Dialogue.Messages[i+1:])
+			c.Dialogue.Summary = summary
+			return true
+		}
+	}
+	return false
+}
+
 func (c *ClientState) InitMessages(messages []*schema.Message) error {
 	c.Dialogue.mu.Lock()
 	defer c.Dialogue.mu.Unlock()
@@ -259,6 +297,16 @@ func (c *ClientState) InitMessages(messages []*schema.Message) error {
 	return nil
 }
 
+// GetLastMessage 获取最后一条历史消息, 没有时返回nil
+func (c *ClientState) GetLastMessage() *schema.Message {
+	c.Dialogue.mu.RLock()
+	defer c.Dialogue.mu.RUnlock()
+	if len(c.Dialogue.Messages) == 0 {
+		return nil
+	}
+	return c.Dialogue.Messages[len(c.Dialogue.Messages)-1]
+}
+
 //历史消息相关的方法结束
 
 func (c *ClientState) SetTtsStart(isStart bool) {
@@ -269,6 +317,24 @@ func (c *ClientState) GetTtsStart() bool {
 	return c.IsTtsStart
 }
 
+// SetTtsPlaying 设置TTS是否正在播放, 开始播放时记录开始时间
+func (c *ClientState) SetTtsPlaying(playing bool) {
+	if playing {
+		c.ttsStartTime.Store(time.Now().UnixMilli())
+	}
+	c.ttsPlaying.Store(playing)
+}
+
+// IsTtsPlaying TTS是否正在播放
+func (c *ClientState) IsTtsPlaying() bool {
+	return c.ttsPlaying.Load()
+}
+
+// GetTtsStartTime 获取本轮TTS开始播放的时间(ms)
+func (c *ClientState) GetTtsStartTime() int64 {
+	return c.ttsStartTime.Load()
+}
+
 func (c *ClientState) GetMaxIdleDuration() int64 {
 	maxIdleDuration := viper.GetInt64("chat.max_idle_duration")
 	if maxIdleDuration == 0 {
@@ -363,8 +429,19 @@ func (s *ClientState) InitAsr() error {
 
 	log.Infof("初始化asr, asrConfig: %+v", asrConfig)
 
+	// 复制配置后注入分段用的VAD, 需要按静音分段的ASR提供者使用它, 与会话的VAD相互独立
+	providerConfig := make(map[string]interface{}, len(asrConfig.Config)+1)
+	for k, v := range asrConfig.Config {
+		providerConfig[k] = v
+	}
+	if s.segmentVad != nil {
+		s.segmentVad.Release()
+	}
+	s.segmentVad = newSegmentVoiceDetector(s.DeviceConfig.Vad.Provider, s.DeviceConfig.Vad.Config)
+	providerConfig[asr_types.ConfigKeyVoiceDetector] = s.segmentVad
+
 	//初始化asr
-	asrProvider, err := asr.NewAsrProvider(asrConfig.Provider, asrConfig.Config)
+	asrProvider, err := asr.NewAsrProvider(asrConfig.Provider, providerConfig)
 	if err != nil {
 		log.Errorf("创建asr提供者失败: %v", err)
 		return fmt.Errorf("创建asr提供者失败: %v", err)
@@ -377,12 +454,7 @@ func (s *ClientState) InitAsr() error {
 		AsrAudioChannel: make(chan []float32, 100),
 		AsrEnd:          make(chan bool, 1),
 		AsrResult:       bytes.Buffer{},
-	}
-
-	if rawAutoEnd, ok := asrConfig.Config["auto_end"]; ok {
-		if autoEnd, ok := rawAutoEnd.(bool); ok {
-			s.Asr.AutoEnd = autoEnd
-		}
+		AutoEnd:         asr.IsAutoEnd(asrConfig.Provider, asrConfig.Config),
 	}
 	return nil
 }
@@ -390,6 +462,9 @@ func (s *ClientState) InitAsr() error {
 func (c *ClientState) Destroy() {
 	c.Asr.Stop()
 	c.Vad.Reset()
+	if c.segmentVad != nil {
+		c.segmentVad.Release()
+	}
 
 	c.VoiceStatus.Reset()
 	c.AsrAudioBuffer.ClearAsrAudioData()
@@ -400,6 +475,7 @@ func (c *ClientState) Destroy() {
 	c.Statistic.Reset()
 	c.SetStatus(ClientStatusInit)
 	c.SetTtsStart(false)
+	c.SetTtsPlaying(false)
 }
 
 func (c *ClientState) SetAsrPcmFrameSize(sampleRate int, channels int, perFrameDuration int) {
@@ -1,17 +1,20 @@
 package client
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type Statistic struct {
 	AsrStartTs int64 //asr开始时间
 	LlmStartTs int64 //llm开始时间
-	TtsStartTs int64 //tts开始时间
+	TtsStartTs int64 //tts开始时间, TTS发送协程与处理协程并发读写, 需通过原子操作访问
 }
 
 func (s *Statistic) Reset() {
 	s.AsrStartTs = 0
 	s.LlmStartTs = 0
-	s.TtsStartTs = 0
+	atomic.StoreInt64(&s.TtsStartTs, 0)
 }
 
 func (state *ClientState) SetStartAsrTs() {
@@ -35,9 +38,18 @@ func (state *ClientState) GetLlmDuration() int64 {
 }
 
 func (state *ClientState) SetStartTtsTs() {
-	state.Statistic.TtsStartTs = time.Now().UnixMilli()
+	atomic.StoreInt64(&state.Statistic.TtsStartTs, time.Now().UnixMilli())
 }
 
 func (state *ClientState) GetTtsDuration() int64 {
-	return time.Now().UnixMilli() - state.Statistic.TtsStartTs
+	return time.Now().UnixMilli() - atomic.LoadInt64(&state.Statistic.TtsStartTs)
+}
+
+// TakeTtsDuration 返回TTS开始至今的耗时并清除开始时间, 未记录开始时间时返回 false, 保证每句只统计一次
+func (state *ClientState) TakeTtsDuration() (int64, bool) {
+	startTs := atomic.SwapInt64(&state.Statistic.TtsStartTs, 0)
+	if startTs <= 0 {
+		return 0, false
+	}
+	return time.Now().UnixMilli() - startTs, true
 }
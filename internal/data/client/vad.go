@@ -91,3 +91,42 @@ func (v *Vad) Reset() error {
 	v.ResetVoiceDuration()
 	return nil
 }
+
+// segmentVoiceDetector ASR 按静音分段时使用的 VAD, 从资源池获取独立的实例,
+// 不与监听时的会话 VAD 共用, 避免两个协程交替 Reset/检测破坏有状态 VAD(如 silero)的状态
+// 第一次检测时获取实例, 一次识别结束后由 ASR 调用 Release 归还
+type segmentVoiceDetector struct {
+	lock     sync.Mutex
+	provider string
+	config   map[string]interface{}
+	vad      vad_inter.VAD
+}
+
+func newSegmentVoiceDetector(provider string, config map[string]interface{}) *segmentVoiceDetector {
+	return &segmentVoiceDetector{provider: provider, config: config}
+}
+
+// IsVADExt 重置状态后检测一段音频, 与监听时的检测方式一致
+func (d *segmentVoiceDetector) IsVADExt(pcmData []float32, sampleRate int, frameSize int) (bool, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.vad == nil {
+		vadProvider, err := vad.AcquireVAD(d.provider, d.config)
+		if err != nil {
+			return false, fmt.Errorf("获取分段 VAD 实例失败: %v", err)
+		}
+		d.vad = vadProvider
+	}
+	d.vad.Reset()
+	return d.vad.IsVADExt(pcmData, sampleRate, frameSize)
+}
+
+// Release 归还 VAD 实例, 之后再检测时重新获取
+func (d *segmentVoiceDetector) Release() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.vad != nil {
+		vad.ReleaseVAD(d.vad)
+		d.vad = nil
+	}
+}
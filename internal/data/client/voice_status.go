@@ -1,6 +1,11 @@
 package client
 
+import "sync"
+
+// VoiceStatus 语音状态, 信令和音频处理协程同时读写, 通过方法访问
 type VoiceStatus struct {
+	mu sync.Mutex
+
 	HaveVoice            bool  //上次是否有说话
 	HaveVoiceLastTime    int64 //最后说话时间
 	VoiceStop            bool  //是否停止说话
@@ -8,35 +13,51 @@ type VoiceStatus struct {
 }
 
 func (v *VoiceStatus) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	v.HaveVoice = false
 	v.HaveVoiceLastTime = 0
 	v.VoiceStop = false
 }
 
 func (v *VoiceStatus) IsSilence(diffMilli int64) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	return diffMilli > v.SilenceThresholdTime
 }
 
 func (v *VoiceStatus) GetClientHaveVoice() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	return v.HaveVoice
 }
 
 func (v *VoiceStatus) SetClientHaveVoice(haveVoice bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	v.HaveVoice = haveVoice
 }
 
 func (v *VoiceStatus) GetClientHaveVoiceLastTime() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	return v.HaveVoiceLastTime
 }
 
 func (v *VoiceStatus) SetClientHaveVoiceLastTime(lastTime int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	v.HaveVoiceLastTime = lastTime
 }
 
 func (v *VoiceStatus) GetClientVoiceStop() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	return v.VoiceStop
 }
 
 func (v *VoiceStatus) SetClientVoiceStop(voiceStop bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	v.VoiceStop = voiceStop
 }
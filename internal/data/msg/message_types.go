@@ -34,6 +34,7 @@ const (
 	ServerMessageTypeLlm     = "llm"     // 大语言模型
 	ServerMessageTypeText    = "text"    // 文本消息
 	ServerMessageTypeGoodBye = "goodbye" // 再见消息
+	ServerMessageTypeAlert   = "alert"   // 提醒消息, 设备显示内容并播放提示音
 )
 
 // 消息状态常量
@@ -6,6 +6,9 @@ import (
 
 	"xiaozhi-esp32-server-golang/constants"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/doubao"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/mock"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/openai"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/sherpa_onnx"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -23,7 +26,7 @@ type AsrProvider interface {
 }
 
 // NewAsrProvider 创建一个新的ASR实例
-// asrType: ASR引擎类型，目前支持 "funasr"
+// asrType: ASR引擎类型，目前支持 "funasr"、"doubao"、"sherpa_onnx"、"openai"、"failover"、"mock"
 // config: ASR引擎配置，为 map[string]interface{} 类型
 func NewAsrProvider(asrType string, config map[string]interface{}) (AsrProvider, error) {
 	switch asrType {
@@ -38,7 +41,43 @@ func NewAsrProvider(asrType string, config map[string]interface{}) (AsrProvider,
 			log.Info("豆包ASR适配器创建成功")
 		}
 		return provider, err
+	case constants.AsrTypeSherpaOnnx:
+		log.Info("使用 本地sherpa-onnx ASR 提供者")
+		return sherpa_onnx.NewSherpaOnnxAdapter(config)
+	case constants.AsrTypeOpenAI:
+		log.Info("使用 OpenAI兼容 ASR 提供者")
+		return openai.NewOpenAIASRProvider(config)
+	case constants.AsrTypeFailover:
+		log.Info("使用 故障转移 ASR 提供者")
+		return NewFailoverAsrProvider(config)
+	case constants.AsrTypeMock:
+		log.Info("使用 模拟ASR 提供者")
+		return mock.NewMockAsrProvider(config)
 	default:
-		return nil, fmt.Errorf("不支持的ASR引擎类型: %s，目前仅支持 'funasr'", asrType)
+		return nil, fmt.Errorf("不支持的ASR引擎类型: %s，目前支持 'funasr'、'doubao'、'sherpa_onnx'、'openai'、'failover'、'mock'", asrType)
 	}
 }
+
+// IsAutoEnd 是否由ASR自动判断说话结束，不再使用VAD
+// failover 未配置顶层 auto_end 时，只有所有后端都开启 auto_end 才自动结束，否则切换到未开启的后端后本轮识别无法结束
+func IsAutoEnd(asrType string, config map[string]interface{}) bool {
+	if autoEnd, ok := config["auto_end"].(bool); ok {
+		return autoEnd
+	}
+	if asrType != constants.AsrTypeFailover {
+		return false
+	}
+	providers, ok := config["providers"].([]interface{})
+	if !ok || len(providers) == 0 {
+		return false
+	}
+	for _, rawProvider := range providers {
+		item, _ := rawProvider.(map[string]interface{})
+		backendConfig, _ := item["config"].(map[string]interface{})
+		backendType, _ := item["provider"].(string)
+		if !IsAutoEnd(backendType, backendConfig) {
+			return false
+		}
+	}
+	return true
+}
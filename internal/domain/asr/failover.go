@@ -0,0 +1,380 @@
+package asr
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// asrBackend 故障转移链中的一个ASR后端，提供者在首次使用时才创建
+type asrBackend struct {
+	name   string
+	config config_types.AsrConfig
+	health *backendHealth
+	// 会话注入的VAD, 不参与 backendKey 计算
+	voiceDetector types.VoiceDetector
+
+	mu       sync.Mutex
+	provider AsrProvider
+}
+
+func (b *asrBackend) getProvider() (AsrProvider, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.provider != nil {
+		return b.provider, nil
+	}
+	config := b.config.Config
+	if b.voiceDetector != nil {
+		config = make(map[string]interface{}, len(b.config.Config)+1)
+		for k, v := range b.config.Config {
+			config[k] = v
+		}
+		config[types.ConfigKeyVoiceDetector] = b.voiceDetector
+	}
+	provider, err := NewAsrProvider(b.config.Provider, config)
+	if err != nil {
+		return nil, err
+	}
+	b.provider = provider
+	return provider, nil
+}
+
+// FailoverAsrProvider 按顺序包装多个ASR后端
+// 记录每个后端的错误率和耗时，失败较多的后端会被熔断跳过，识别中途出错时透明切换到下一个后端
+type FailoverAsrProvider struct {
+	backends     []*asrBackend
+	finalTimeout time.Duration // 输入结束后等待最终结果的超时时间，超时视为失败
+}
+
+// NewFailoverAsrProvider 创建故障转移ASR提供者
+// config 示例:
+//
+//	providers:            # 按优先级排列，每项与 AsrConfig 结构一致
+//	  - provider: funasr
+//	    config: {...}
+//	  - provider: doubao
+//	    config: {...}
+//	failure_threshold: 3  # 连续失败多少次后熔断
+//	open_duration: 30     # 熔断时长(秒)
+func NewFailoverAsrProvider(config map[string]interface{}) (*FailoverAsrProvider, error) {
+	healthConfig := DefaultHealthConfig
+	if failureThreshold, ok := config["failure_threshold"].(int); ok && failureThreshold > 0 {
+		healthConfig.FailureThreshold = failureThreshold
+	} else if failureThresholdFloat, ok := config["failure_threshold"].(float64); ok && failureThresholdFloat > 0 {
+		healthConfig.FailureThreshold = int(failureThresholdFloat)
+	}
+	if errorRateWindow, ok := config["error_rate_window"].(int); ok && errorRateWindow > 0 {
+		healthConfig.ErrorRateWindow = errorRateWindow
+	} else if errorRateWindowFloat, ok := config["error_rate_window"].(float64); ok && errorRateWindowFloat > 0 {
+		healthConfig.ErrorRateWindow = int(errorRateWindowFloat)
+	}
+	if maxErrorRate, ok := config["max_error_rate"].(float64); ok && maxErrorRate > 0 {
+		healthConfig.MaxErrorRate = maxErrorRate
+	}
+	if minRequests, ok := config["min_requests"].(int); ok && minRequests > 0 {
+		healthConfig.MinRequests = minRequests
+	} else if minRequestsFloat, ok := config["min_requests"].(float64); ok && minRequestsFloat > 0 {
+		healthConfig.MinRequests = int(minRequestsFloat)
+	}
+	if openDuration, ok := config["open_duration"].(int); ok && openDuration > 0 {
+		healthConfig.OpenDuration = time.Duration(openDuration) * time.Second
+	} else if openDurationFloat, ok := config["open_duration"].(float64); ok && openDurationFloat > 0 {
+		healthConfig.OpenDuration = time.Duration(openDurationFloat * float64(time.Second))
+	}
+
+	finalTimeout := 5 * time.Second
+	if timeoutMs, ok := config["final_timeout_ms"].(int); ok && timeoutMs > 0 {
+		finalTimeout = time.Duration(timeoutMs) * time.Millisecond
+	} else if timeoutMsFloat, ok := config["final_timeout_ms"].(float64); ok && timeoutMsFloat > 0 {
+		finalTimeout = time.Duration(timeoutMsFloat) * time.Millisecond
+	}
+
+	rawProviders, ok := config["providers"].([]interface{})
+	if !ok || len(rawProviders) == 0 {
+		return nil, fmt.Errorf("failover ASR 缺少 providers 配置")
+	}
+
+	voiceDetector, _ := config[types.ConfigKeyVoiceDetector].(types.VoiceDetector)
+	f := &FailoverAsrProvider{finalTimeout: finalTimeout}
+	for i, rawProvider := range rawProviders {
+		item, ok := rawProvider.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failover ASR 第 %d 个 provider 配置格式错误", i)
+		}
+		backendConfig := config_types.AsrConfig{Config: map[string]interface{}{}}
+		backendConfig.Provider, _ = item["provider"].(string)
+		if backendConfig.Provider == "" || backendConfig.Provider == constants.AsrTypeFailover {
+			return nil, fmt.Errorf("failover ASR 第 %d 个 provider 类型无效: %q", i, backendConfig.Provider)
+		}
+		if c, ok := item["config"].(map[string]interface{}); ok {
+			backendConfig.Config = c
+		}
+		name, _ := item["name"].(string)
+		if name == "" {
+			name = fmt.Sprintf("%s#%d", backendConfig.Provider, i)
+		}
+
+		f.backends = append(f.backends, &asrBackend{
+			name:          name,
+			config:        backendConfig,
+			health:        getBackendHealth(backendKey(backendConfig), name, backendConfig.Provider, healthConfig),
+			voiceDetector: voiceDetector,
+		})
+	}
+	return f, nil
+}
+
+// backendKey 相同类型和配置的后端共享健康状态
+func backendKey(config config_types.AsrConfig) string {
+	data, _ := json.Marshal(config)
+	hash := md5.Sum(data)
+	return config.Provider + ":" + hex.EncodeToString(hash[:])
+}
+
+// nextBackend 从 start 开始按顺序选出下一个未熔断的后端
+// 所有后端都已熔断时，选择最早解除熔断的后端兜底，避免直接失败
+func (f *FailoverAsrProvider) nextBackend(start int) (int, *asrBackend) {
+	for i := start; i < len(f.backends); i++ {
+		if f.backends[i].health.Allow() {
+			return i, f.backends[i]
+		}
+		log.Debugf("ASR后端 %s 已熔断，跳过", f.backends[i].name)
+	}
+	if start != 0 {
+		return -1, nil
+	}
+
+	index := 0
+	for i, b := range f.backends {
+		if b.health.OpenUntil().Before(f.backends[index].health.OpenUntil()) {
+			index = i
+		}
+	}
+	log.Warnf("所有ASR后端均已熔断，尝试使用 %s", f.backends[index].name)
+	return index, f.backends[index]
+}
+
+// Process 按顺序尝试各个后端，返回第一个成功的识别结果
+func (f *FailoverAsrProvider) Process(pcmData []float32) (string, error) {
+	var lastErr error
+	for index, backend := f.nextBackend(0); backend != nil; index, backend = f.nextBackend(index + 1) {
+		provider, err := backend.getProvider()
+		if err != nil {
+			backend.health.RecordFailure()
+			lastErr = fmt.Errorf("创建ASR后端 %s 失败: %v", backend.name, err)
+			log.Warnf("%v", lastErr)
+			continue
+		}
+		startTs := time.Now()
+		text, err := provider.Process(pcmData)
+		if err != nil {
+			backend.health.RecordFailure()
+			lastErr = fmt.Errorf("ASR后端 %s 识别失败: %v", backend.name, err)
+			log.Warnf("%v", lastErr)
+			continue
+		}
+		backend.health.RecordSuccess(time.Since(startTs))
+		return text, nil
+	}
+	return "", lastErr
+}
+
+// asrAttempt 一次向某个后端发起的流式识别
+type asrAttempt struct {
+	index     int
+	backend   *asrBackend
+	cancel    context.CancelFunc
+	audio     chan []float32
+	results   chan types.StreamingResult
+	startTime time.Time
+}
+
+// startAttempt 从 start 开始选择可用后端启动流式识别，并回放已收到的音频
+func (f *FailoverAsrProvider) startAttempt(ctx context.Context, start int, history [][]float32, inputClosed bool) (*asrAttempt, error) {
+	var lastErr error
+	for index, backend := f.nextBackend(start); backend != nil; index, backend = f.nextBackend(index + 1) {
+		provider, err := backend.getProvider()
+		if err != nil {
+			backend.health.RecordFailure()
+			lastErr = fmt.Errorf("创建ASR后端 %s 失败: %v", backend.name, err)
+			log.Warnf("%v", lastErr)
+			continue
+		}
+
+		// 缓冲区足够容纳回放的历史音频，回放时不会阻塞
+		audioChan := make(chan []float32, len(history)+100)
+		for _, chunk := range history {
+			audioChan <- chunk
+		}
+		if inputClosed {
+			close(audioChan)
+		}
+
+		attemptCtx, cancel := context.WithCancel(ctx)
+		results, err := provider.StreamingRecognize(attemptCtx, audioChan)
+		if err != nil {
+			cancel()
+			backend.health.RecordFailure()
+			lastErr = fmt.Errorf("ASR后端 %s 启动流式识别失败: %v", backend.name, err)
+			log.Warnf("%v", lastErr)
+			continue
+		}
+		log.Debugf("ASR后端 %s 开始流式识别, 回放音频块数: %d", backend.name, len(history))
+		return &asrAttempt{
+			index:     index,
+			backend:   backend,
+			cancel:    cancel,
+			audio:     audioChan,
+			results:   results,
+			startTime: time.Now(),
+		}, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("没有可用的ASR后端")
+	}
+	return nil, lastErr
+}
+
+// StreamingRecognize 流式识别
+// 当前后端出错、结果通道提前关闭或超时未返回最终结果时，切换到下一个后端并回放本轮全部音频
+// 由于切换后会重新识别，各后端的中间结果先在内部累积，收到最终结果后一次性输出
+func (f *FailoverAsrProvider) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	attempt, err := f.startAttempt(ctx, 0, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resultChan := make(chan types.StreamingResult, 10)
+	go f.runStreaming(ctx, audioStream, attempt, resultChan)
+	return resultChan, nil
+}
+
+func (f *FailoverAsrProvider) runStreaming(ctx context.Context, audioStream <-chan []float32, attempt *asrAttempt, resultChan chan types.StreamingResult) {
+	var history [][]float32
+	var text strings.Builder
+	var finalTimer *time.Timer
+	var finalTimeout <-chan time.Time
+	inputClosed := false
+
+	defer func() {
+		if attempt != nil {
+			attempt.cancel()
+		}
+		if finalTimer != nil {
+			finalTimer.Stop()
+		}
+		close(resultChan)
+	}()
+
+	// failover 将当前后端记为失败并切换到下一个后端，没有可用后端时返回 false
+	failover := func(reason error) bool {
+		// 调用方取消(打断、中止、会话结束)导致的结束不是后端故障，不计失败也不切换
+		if ctx.Err() != nil {
+			attempt.backend.health.Release()
+			attempt.cancel()
+			attempt = nil
+			return false
+		}
+		log.Warnf("ASR后端 %s 识别失败: %v, 尝试切换后端", attempt.backend.name, reason)
+		attempt.backend.health.RecordFailure()
+		attempt.cancel()
+		text.Reset()
+
+		next, err := f.startAttempt(ctx, attempt.index+1, history, inputClosed)
+		if err != nil {
+			attempt = nil
+			select {
+			case <-ctx.Done():
+			case resultChan <- types.StreamingResult{IsFinal: true, Error: fmt.Errorf("%v, 最后错误: %v", err, reason)}:
+			}
+			return false
+		}
+		attempt = next
+		if inputClosed {
+			finalTimer.Reset(f.finalTimeout)
+		}
+		return true
+	}
+
+	// handleResult 处理后端返回的结果，返回 false 表示本轮识别结束
+	handleResult := func(result types.StreamingResult, ok bool) bool {
+		if !ok {
+			return failover(errors.New("结果通道提前关闭"))
+		}
+		if result.Error != nil {
+			return failover(result.Error)
+		}
+		text.WriteString(result.Text)
+		if !result.IsFinal {
+			return true
+		}
+
+		attempt.backend.health.RecordSuccess(time.Since(attempt.startTime))
+		select {
+		case <-ctx.Done():
+		case resultChan <- types.StreamingResult{Text: text.String(), IsFinal: true}:
+		}
+		attempt.cancel()
+		attempt = nil
+		return false
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			attempt.backend.health.Release()
+			return
+		case pcmChunk, ok := <-audioStream:
+			if !ok {
+				inputClosed = true
+				audioStream = nil
+				close(attempt.audio)
+				finalTimer = time.NewTimer(f.finalTimeout)
+				finalTimeout = finalTimer.C
+				continue
+			}
+			history = append(history, pcmChunk)
+
+			// 发送音频时同时处理结果，避免后端停止读取音频时阻塞
+		sendLoop:
+			for {
+				select {
+				case <-ctx.Done():
+					attempt.backend.health.Release()
+					return
+				case attempt.audio <- pcmChunk:
+					break sendLoop
+				case result, ok := <-attempt.results:
+					current := attempt
+					if !handleResult(result, ok) {
+						return
+					}
+					if attempt != current {
+						// 已切换后端，当前音频块已包含在回放的历史音频中
+						break sendLoop
+					}
+				}
+			}
+		case result, ok := <-attempt.results:
+			if !handleResult(result, ok) {
+				return
+			}
+		case <-finalTimeout:
+			if !failover(fmt.Errorf("输入结束后 %v 内未返回最终结果", f.finalTimeout)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+)
+
+// fakeAsrProvider 测试用的流式ASR
+// failAfter > 0 时收到第 failAfter 个音频块后返回错误，否则输入结束后返回 text
+// 被取消时与真实后端一样关闭结果通道
+type fakeAsrProvider struct {
+	text      string
+	failAfter int
+	// onChunk 不为空时，收到音频块后调用并关闭结果通道
+	onChunk func()
+	started int
+}
+
+func (p *fakeAsrProvider) Process(pcmData []float32) (string, error) {
+	return p.text, nil
+}
+
+func (p *fakeAsrProvider) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	p.started++
+	results := make(chan types.StreamingResult, 1)
+	go func() {
+		defer close(results)
+		chunks := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-audioStream:
+				if !ok {
+					results <- types.StreamingResult{Text: p.text, IsFinal: true}
+					return
+				}
+				if p.onChunk != nil {
+					p.onChunk()
+					return
+				}
+				chunks++
+				if p.failAfter > 0 && chunks >= p.failAfter {
+					results <- types.StreamingResult{Error: errors.New("后端断开")}
+					return
+				}
+			}
+		}
+	}()
+	return results, nil
+}
+
+func newTestFailover(providers ...*fakeAsrProvider) *FailoverAsrProvider {
+	f := &FailoverAsrProvider{finalTimeout: time.Second}
+	for _, p := range providers {
+		f.backends = append(f.backends, &asrBackend{
+			name:     "fake",
+			health:   &backendHealth{config: DefaultHealthConfig, state: CircuitStateClosed},
+			provider: p,
+		})
+	}
+	return f
+}
+
+func waitClosed(t *testing.T, results chan types.StreamingResult) []types.StreamingResult {
+	t.Helper()
+	var got []types.StreamingResult
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				return got
+			}
+			got = append(got, result)
+		case <-timeout:
+			t.Fatalf("等待结果通道关闭超时")
+		}
+	}
+}
+
+// abortedCtx 模拟调用方已经取消、但 runStreaming 还没有从 Done 中观察到取消的时刻
+type abortedCtx struct {
+	context.Context
+	mu  sync.Mutex
+	err error
+}
+
+func (c *abortedCtx) abort() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = context.Canceled
+}
+
+func (c *abortedCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// TestFailoverCancelIsNotFailure 调用方取消后后端关闭结果通道，不计后端失败，也不切换后端
+func TestFailoverCancelIsNotFailure(t *testing.T) {
+	ctx := &abortedCtx{Context: context.Background()}
+	primary := &fakeAsrProvider{onChunk: ctx.abort}
+	standby := &fakeAsrProvider{}
+	f := newTestFailover(primary, standby)
+
+	audio := make(chan []float32, 1)
+	results, err := f.StreamingRecognize(ctx, audio)
+	if err != nil {
+		t.Fatalf("启动流式识别失败: %v", err)
+	}
+	audio <- []float32{0}
+	if got := waitClosed(t, results); len(got) != 0 {
+		t.Fatalf("取消后不应返回结果: %+v", got)
+	}
+
+	stats := f.backends[0].health.Stats()
+	if stats.Failures != 0 || stats.State != CircuitStateClosed {
+		t.Fatalf("取消不应记为失败: %+v", stats)
+	}
+	if standby.started != 0 {
+		t.Fatalf("取消后不应切换到备用后端")
+	}
+}
+
+// TestFailoverCancel 调用方取消后结束识别，结果通道关闭
+func TestFailoverCancel(t *testing.T) {
+	f := newTestFailover(&fakeAsrProvider{}, &fakeAsrProvider{})
+	ctx, cancel := context.WithCancel(context.Background())
+	audio := make(chan []float32, 1)
+	results, err := f.StreamingRecognize(ctx, audio)
+	if err != nil {
+		t.Fatalf("启动流式识别失败: %v", err)
+	}
+	audio <- []float32{0}
+	cancel()
+	waitClosed(t, results)
+	if stats := f.backends[0].health.Stats(); stats.Failures != 0 {
+		t.Fatalf("取消不应记为失败: %+v", stats)
+	}
+}
+
+// TestFailoverSwitchOnError 后端出错时记为失败，切换后端并回放音频
+func TestFailoverSwitchOnError(t *testing.T) {
+	primary := &fakeAsrProvider{failAfter: 2}
+	standby := &fakeAsrProvider{text: "你好"}
+	f := newTestFailover(primary, standby)
+
+	audio := make(chan []float32, 3)
+	results, err := f.StreamingRecognize(context.Background(), audio)
+	if err != nil {
+		t.Fatalf("启动流式识别失败: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		audio <- []float32{float32(i)}
+	}
+	close(audio)
+
+	got := waitClosed(t, results)
+	if len(got) != 1 || !got[0].IsFinal || got[0].Error != nil || got[0].Text != "你好" {
+		t.Fatalf("应返回备用后端的最终结果: %+v", got)
+	}
+	if stats := f.backends[0].health.Stats(); stats.Failures != 1 {
+		t.Errorf("主后端应记录一次失败: %+v", stats)
+	}
+	if stats := f.backends[1].health.Stats(); stats.Requests != 1 || stats.Failures != 0 {
+		t.Errorf("备用后端应记录一次成功: %+v", stats)
+	}
+}
+
+// TestHealthOpenAfterFailures 连续失败达到阈值后熔断，熔断到期只放行一次试探请求
+func TestHealthOpenAfterFailures(t *testing.T) {
+	config := DefaultHealthConfig
+	config.FailureThreshold = 2
+	config.OpenDuration = 10 * time.Millisecond
+	h := &backendHealth{config: config, state: CircuitStateClosed}
+	h.RecordFailure()
+	if !h.Allow() {
+		t.Fatalf("未达到阈值时不应熔断")
+	}
+	h.RecordFailure()
+	if h.Allow() {
+		t.Fatalf("达到阈值后应熔断")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !h.Allow() {
+		t.Fatalf("熔断到期后应允许试探请求")
+	}
+	if h.Allow() {
+		t.Fatalf("半开状态只允许一个试探请求")
+	}
+	// 试探请求被取消，释放名额但不改变状态
+	h.Release()
+	if !h.Allow() {
+		t.Fatalf("释放后应允许新的试探请求")
+	}
+	h.RecordSuccess(time.Millisecond)
+	if h.Stats().State != CircuitStateClosed {
+		t.Fatalf("试探成功后应恢复")
+	}
+}
+
+func TestIsAutoEnd(t *testing.T) {
+	backend := func(autoEnd interface{}) interface{} {
+		config := map[string]interface{}{}
+		if autoEnd != nil {
+			config["auto_end"] = autoEnd
+		}
+		return map[string]interface{}{"provider": constants.AsrTypeFunAsr, "config": config}
+	}
+	cases := []struct {
+		asrType string
+		config  map[string]interface{}
+		want    bool
+	}{
+		{constants.AsrTypeFunAsr, map[string]interface{}{"auto_end": true}, true},
+		{constants.AsrTypeFunAsr, map[string]interface{}{}, false},
+		{constants.AsrTypeFailover, map[string]interface{}{"providers": []interface{}{backend(true), backend(true)}}, true},
+		{constants.AsrTypeFailover, map[string]interface{}{"providers": []interface{}{backend(true), backend(nil)}}, false},
+		{constants.AsrTypeFailover, map[string]interface{}{"providers": []interface{}{backend(false)}, "auto_end": true}, true},
+		{constants.AsrTypeFailover, map[string]interface{}{}, false},
+	}
+	for i, c := range cases {
+		if got := IsAutoEnd(c.asrType, c.config); got != c.want {
+			t.Errorf("第 %d 组 IsAutoEnd = %v, 期望 %v", i, got, c.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "xiaozhi-esp32-server-golang/logger"
@@ -50,6 +51,17 @@ type FunasrConnection struct {
 	writeMu  sync.Mutex // 添加写入锁
 }
 
+// 所有Funasr实例连接池中的连接数，供监控采集
+var (
+	poolConnections      atomic.Int64
+	poolInUseConnections atomic.Int64
+)
+
+// GetPoolStats 返回所有FunASR连接池中正在使用的连接数和连接总数
+func GetPoolStats() (inUse int64, total int64) {
+	return poolInUseConnections.Load(), poolConnections.Load()
+}
+
 // Funasr 实现ASR接口
 type Funasr struct {
 	config    FunasrConfig
@@ -111,9 +123,13 @@ func (f *Funasr) createConnection() (*websocket.Conn, error) {
 func (f *Funasr) removeConnection(conn *websocket.Conn) {
 	f.poolMutex.Lock()
 	defer f.poolMutex.Unlock()
-	if _, ok := f.pool[conn]; ok {
+	if connInfo, ok := f.pool[conn]; ok {
 		conn.Close()
 		delete(f.pool, conn)
+		poolConnections.Add(-1)
+		if connInfo.inUse {
+			poolInUseConnections.Add(-1)
+		}
 		log.Debugf("移除无效FunASR连接，当前连接数: %d", len(f.pool))
 	}
 }
@@ -134,6 +150,7 @@ func (f *Funasr) getConnection() (*websocket.Conn, error) {
 			}
 			connInfo.inUse = true
 			connInfo.lastUsed = time.Now()
+			poolInUseConnections.Add(1)
 			return conn, nil
 		}
 	}
@@ -148,6 +165,8 @@ func (f *Funasr) getConnection() (*websocket.Conn, error) {
 			inUse:    true,
 			lastUsed: time.Now(),
 		}
+		poolConnections.Add(1)
+		poolInUseConnections.Add(1)
 		log.Debugf("创建新的FunASR连接，当前连接数: %d", len(f.pool))
 		return conn, nil
 	}
@@ -161,6 +180,9 @@ func (f *Funasr) releaseConnection(conn *websocket.Conn) {
 	defer f.poolMutex.Unlock()
 
 	if connInfo, ok := f.pool[conn]; ok {
+		if connInfo.inUse {
+			poolInUseConnections.Add(-1)
+		}
 		connInfo.inUse = false
 		connInfo.lastUsed = time.Now()
 	}
@@ -180,6 +202,7 @@ func (f *Funasr) cleanupConnections() {
 				conn.Close()
 				// 从池中移除
 				delete(f.pool, conn)
+				poolConnections.Add(-1)
 				log.Debugf("关闭空闲连接，当前连接数: %d", len(f.pool))
 			}
 		}
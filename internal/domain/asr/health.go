@@ -0,0 +1,219 @@
+package asr
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	CircuitStateClosed   = "closed"    // 正常
+	CircuitStateOpen     = "open"      // 熔断中，跳过该后端
+	CircuitStateHalfOpen = "half_open" // 熔断到期，允许一次试探请求
+)
+
+// HealthConfig 后端健康检查及熔断配置
+type HealthConfig struct {
+	FailureThreshold int           // 连续失败多少次后熔断
+	ErrorRateWindow  int           // 统计错误率的最近请求数
+	MaxErrorRate     float64       // 窗口内错误率超过该值后熔断
+	MinRequests      int           // 窗口内至少多少次请求才按错误率熔断
+	OpenDuration     time.Duration // 熔断持续时间，到期后进入半开状态
+}
+
+// DefaultHealthConfig 默认熔断配置
+var DefaultHealthConfig = HealthConfig{
+	FailureThreshold: 3,
+	ErrorRateWindow:  20,
+	MaxErrorRate:     0.5,
+	MinRequests:      5,
+	OpenDuration:     30 * time.Second,
+}
+
+// AsrBackendStats 单个ASR后端的健康统计
+type AsrBackendStats struct {
+	Name                string  `json:"name"`
+	Provider            string  `json:"provider"`
+	State               string  `json:"state"`
+	Requests            int64   `json:"requests"`
+	Failures            int64   `json:"failures"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	ErrorRate           float64 `json:"error_rate"`
+	AvgLatencyMs        float64 `json:"avg_latency_ms"`
+}
+
+// backendHealth 记录某个ASR后端的请求结果，并据此熔断
+// 同一配置的后端在所有会话间共享健康状态
+type backendHealth struct {
+	mu     sync.Mutex
+	config HealthConfig
+
+	name     string
+	provider string
+
+	state               string
+	openUntil           time.Time
+	halfOpenInFlight    bool
+	requests            int64
+	failures            int64
+	consecutiveFailures int
+	recentResults       []bool // 最近请求是否失败，环形缓冲
+	recentIndex         int
+	avgLatencyMs        float64
+}
+
+var (
+	healthRegistryMu sync.Mutex
+	healthRegistry   = make(map[string]*backendHealth)
+)
+
+// getBackendHealth 获取(或创建)指定后端的健康记录
+func getBackendHealth(key, name, provider string, config HealthConfig) *backendHealth {
+	healthRegistryMu.Lock()
+	defer healthRegistryMu.Unlock()
+	if h, ok := healthRegistry[key]; ok {
+		h.mu.Lock()
+		h.config = config
+		h.mu.Unlock()
+		return h
+	}
+	h := &backendHealth{
+		config:   config,
+		name:     name,
+		provider: provider,
+		state:    CircuitStateClosed,
+	}
+	healthRegistry[key] = h
+	return h
+}
+
+// GetAsrBackendStats 获取所有ASR后端的健康统计
+func GetAsrBackendStats() []AsrBackendStats {
+	healthRegistryMu.Lock()
+	defer healthRegistryMu.Unlock()
+	stats := make([]AsrBackendStats, 0, len(healthRegistry))
+	for _, h := range healthRegistry {
+		stats = append(stats, h.Stats())
+	}
+	return stats
+}
+
+// Allow 判断当前是否允许向该后端发送请求
+func (h *backendHealth) Allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch h.state {
+	case CircuitStateOpen:
+		if time.Now().Before(h.openUntil) {
+			return false
+		}
+		h.state = CircuitStateHalfOpen
+		h.halfOpenInFlight = true
+		return true
+	case CircuitStateHalfOpen:
+		// 半开状态只允许一个试探请求
+		if h.halfOpenInFlight {
+			return false
+		}
+		h.halfOpenInFlight = true
+		return true
+	}
+	return true
+}
+
+// OpenUntil 返回熔断结束时间
+func (h *backendHealth) OpenUntil() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.openUntil
+}
+
+// RecordSuccess 记录一次成功请求及其耗时
+func (h *backendHealth) RecordSuccess(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.record(false)
+	h.consecutiveFailures = 0
+	h.halfOpenInFlight = false
+	h.state = CircuitStateClosed
+
+	latencyMs := float64(latency.Milliseconds())
+	if h.avgLatencyMs == 0 {
+		h.avgLatencyMs = latencyMs
+	} else {
+		h.avgLatencyMs = h.avgLatencyMs*0.8 + latencyMs*0.2
+	}
+}
+
+// RecordFailure 记录一次失败请求，必要时熔断
+func (h *backendHealth) RecordFailure() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.record(true)
+	h.failures++
+	h.consecutiveFailures++
+	h.halfOpenInFlight = false
+
+	if h.state == CircuitStateHalfOpen ||
+		h.consecutiveFailures >= h.config.FailureThreshold ||
+		(h.sampleCount() >= h.config.MinRequests && h.errorRate() >= h.config.MaxErrorRate) {
+		h.state = CircuitStateOpen
+		h.openUntil = time.Now().Add(h.config.OpenDuration)
+	}
+}
+
+// Release 请求被调用方取消、没有结果时释放半开试探名额
+func (h *backendHealth) Release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.halfOpenInFlight = false
+}
+
+// Stats 返回当前健康统计
+func (h *backendHealth) Stats() AsrBackendStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state := h.state
+	if state == CircuitStateOpen && !time.Now().Before(h.openUntil) {
+		state = CircuitStateHalfOpen
+	}
+	return AsrBackendStats{
+		Name:                h.name,
+		Provider:            h.provider,
+		State:               state,
+		Requests:            h.requests,
+		Failures:            h.failures,
+		ConsecutiveFailures: h.consecutiveFailures,
+		ErrorRate:           h.errorRate(),
+		AvgLatencyMs:        h.avgLatencyMs,
+	}
+}
+
+func (h *backendHealth) record(failed bool) {
+	h.requests++
+	if h.config.ErrorRateWindow <= 0 {
+		return
+	}
+	if len(h.recentResults) < h.config.ErrorRateWindow {
+		h.recentResults = append(h.recentResults, failed)
+		return
+	}
+	h.recentResults[h.recentIndex] = failed
+	h.recentIndex = (h.recentIndex + 1) % len(h.recentResults)
+}
+
+func (h *backendHealth) sampleCount() int {
+	return len(h.recentResults)
+}
+
+func (h *backendHealth) errorRate() float64 {
+	if len(h.recentResults) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, f := range h.recentResults {
+		if f {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(h.recentResults))
+}
@@ -0,0 +1,124 @@
+package mock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// MockAsrProvider 不做真实识别，按顺序返回配置中的识别结果
+// 用于会话回放和端到端测试，不依赖任何外部服务
+type MockAsrProvider struct {
+	mu      sync.Mutex
+	results []string
+	index   int
+	loop    bool          // 结果用完后是否从头开始
+	delay   time.Duration // 音频输入结束后返回结果前的延迟，模拟识别耗时
+}
+
+// NewMockAsrProvider 创建模拟ASR
+// config: results 识别结果列表（或 text 单条结果）, loop 是否循环, delay_ms 返回结果前的延迟
+func NewMockAsrProvider(config map[string]interface{}) (*MockAsrProvider, error) {
+	p := &MockAsrProvider{
+		results: stringList(config["results"]),
+	}
+	if text, ok := config["text"].(string); ok && text != "" {
+		p.results = append(p.results, text)
+	}
+	if loop, ok := config["loop"].(bool); ok {
+		p.loop = loop
+	}
+	if delay, ok := config["delay_ms"].(int); ok {
+		p.delay = time.Duration(delay) * time.Millisecond
+	} else if delay, ok := config["delay_ms"].(float64); ok {
+		p.delay = time.Duration(delay) * time.Millisecond
+	}
+	return p, nil
+}
+
+// next 取出下一条识别结果，没有结果时返回空字符串
+func (p *MockAsrProvider) next() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.results) == 0 {
+		return ""
+	}
+	if p.index >= len(p.results) {
+		if !p.loop {
+			return ""
+		}
+		p.index = 0
+	}
+	text := p.results[p.index]
+	p.index++
+	return text
+}
+
+// Process 忽略音频内容，返回下一条结果
+func (p *MockAsrProvider) Process(pcmData []float32) (string, error) {
+	if len(pcmData) == 0 {
+		return "", nil
+	}
+	return p.next(), nil
+}
+
+// StreamingRecognize 读取音频直到输入结束，收到过音频时返回下一条结果作为最终结果
+func (p *MockAsrProvider) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	resultChan := make(chan types.StreamingResult, 1)
+	go func() {
+		defer close(resultChan)
+
+		var sampleCount int
+	recvLoop:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case pcmData, ok := <-audioStream:
+				if !ok {
+					break recvLoop
+				}
+				sampleCount += len(pcmData)
+			}
+		}
+
+		if p.delay > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(p.delay):
+			}
+		}
+
+		var text string
+		if sampleCount > 0 {
+			text = p.next()
+		}
+		log.Debugf("模拟ASR返回识别结果: %s, 音频采样数: %d", text, sampleCount)
+		select {
+		case <-ctx.Done():
+		case resultChan <- types.StreamingResult{Text: text, IsFinal: true}:
+		}
+	}()
+	return resultChan, nil
+}
+
+// stringList 将配置中的字符串列表转换为 []string，兼容 json 解析后的 []interface{}
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
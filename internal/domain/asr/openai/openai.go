@@ -0,0 +1,361 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/data/audio"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	"xiaozhi-esp32-server-golang/internal/util"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// vadWindowMs 分段时每次送入VAD检测的音频时长
+const vadWindowMs = 60
+
+// 全局HTTP客户端，实现连接池
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+// 获取配置了连接池的HTTP客户端
+func getHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		transport := &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		}
+		httpClient = &http.Client{
+			Transport: transport,
+		}
+	})
+	return httpClient
+}
+
+// OpenAIASRConfig OpenAI兼容 /v1/audio/transcriptions 接口配置
+type OpenAIASRConfig struct {
+	APIKey           string  // API密钥，本地部署的 faster-whisper 服务可为空
+	APIURL           string  // 完整的转写接口地址
+	Model            string  // 模型名称
+	Language         string  // 语言(ISO-639-1)，为空时由服务端自动识别
+	Prompt           string  // 提示词，可用于热词/风格引导
+	Temperature      float64 // 采样温度
+	SampleRate       int     // 输入音频采样率
+	Timeout          int     // 单次请求超时时间(秒)
+	SegmentSilenceMs int     // 流式识别时按静音分段的阈值(毫秒)，0 表示不分段
+	MinSegmentMs     int     // 最短分段时长(毫秒)，避免过碎的请求
+	MaxSegmentMs     int     // 最长分段时长(毫秒)，超过时强制分段
+}
+
+// DefaultConfig 默认配置
+var DefaultConfig = OpenAIASRConfig{
+	APIURL:           "https://api.openai.com/v1/audio/transcriptions",
+	Model:            "whisper-1",
+	SampleRate:       audio.SampleRate,
+	Timeout:          30,
+	SegmentSilenceMs: 600,
+	MinSegmentMs:     1000,
+	MaxSegmentMs:     15000,
+}
+
+// transcriptionResponse 转写接口响应(response_format=json)
+type transcriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// OpenAIASRProvider OpenAI兼容的 Whisper ASR 提供者
+type OpenAIASRProvider struct {
+	config OpenAIASRConfig
+	// 会话注入的分段VAD, 用于流式识别时按静音分段, 为nil时不分段
+	voiceDetector types.VoiceDetector
+}
+
+// NewOpenAIASRProvider 创建新的OpenAI兼容ASR提供者
+func NewOpenAIASRProvider(config map[string]interface{}) (*OpenAIASRProvider, error) {
+	openaiConfig := DefaultConfig
+
+	if apiKey, ok := config["api_key"].(string); ok {
+		openaiConfig.APIKey = apiKey
+	}
+	if apiURL, ok := config["api_url"].(string); ok && apiURL != "" {
+		openaiConfig.APIURL = apiURL
+	}
+	if model, ok := config["model"].(string); ok && model != "" {
+		openaiConfig.Model = model
+	}
+	if language, ok := config["language"].(string); ok {
+		openaiConfig.Language = language
+	}
+	if prompt, ok := config["prompt"].(string); ok {
+		openaiConfig.Prompt = prompt
+	}
+	if temperature, ok := config["temperature"].(float64); ok && temperature >= 0 {
+		openaiConfig.Temperature = temperature
+	} else if temperatureInt, ok := config["temperature"].(int); ok && temperatureInt >= 0 {
+		openaiConfig.Temperature = float64(temperatureInt)
+	}
+	if sampleRate, ok := config["sample_rate"].(int); ok && sampleRate > 0 {
+		openaiConfig.SampleRate = sampleRate
+	} else if sampleRateFloat, ok := config["sample_rate"].(float64); ok && sampleRateFloat > 0 {
+		openaiConfig.SampleRate = int(sampleRateFloat)
+	}
+	if timeout, ok := config["timeout"].(int); ok && timeout > 0 {
+		openaiConfig.Timeout = timeout
+	} else if timeoutFloat, ok := config["timeout"].(float64); ok && timeoutFloat > 0 {
+		openaiConfig.Timeout = int(timeoutFloat)
+	}
+	if segmentSilenceMs, ok := config["segment_silence_ms"].(int); ok && segmentSilenceMs >= 0 {
+		openaiConfig.SegmentSilenceMs = segmentSilenceMs
+	} else if segmentSilenceMsFloat, ok := config["segment_silence_ms"].(float64); ok && segmentSilenceMsFloat >= 0 {
+		openaiConfig.SegmentSilenceMs = int(segmentSilenceMsFloat)
+	}
+	if minSegmentMs, ok := config["min_segment_ms"].(int); ok && minSegmentMs > 0 {
+		openaiConfig.MinSegmentMs = minSegmentMs
+	} else if minSegmentMsFloat, ok := config["min_segment_ms"].(float64); ok && minSegmentMsFloat > 0 {
+		openaiConfig.MinSegmentMs = int(minSegmentMsFloat)
+	}
+	if maxSegmentMs, ok := config["max_segment_ms"].(int); ok && maxSegmentMs > 0 {
+		openaiConfig.MaxSegmentMs = maxSegmentMs
+	} else if maxSegmentMsFloat, ok := config["max_segment_ms"].(float64); ok && maxSegmentMsFloat > 0 {
+		openaiConfig.MaxSegmentMs = int(maxSegmentMsFloat)
+	}
+
+	if openaiConfig.APIURL == "" {
+		return nil, fmt.Errorf("缺少api_url配置")
+	}
+
+	voiceDetector, _ := config[types.ConfigKeyVoiceDetector].(types.VoiceDetector)
+
+	log.Infof("OpenAI ASR 配置: api_url: %s, model: %s, language: %s", openaiConfig.APIURL, openaiConfig.Model, openaiConfig.Language)
+	return &OpenAIASRProvider{config: openaiConfig, voiceDetector: voiceDetector}, nil
+}
+
+// Process 一次性处理整段音频，返回完整识别结果
+func (p *OpenAIASRProvider) Process(pcmData []float32) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(p.config.Timeout)*time.Second)
+	defer cancel()
+	return p.transcribe(ctx, pcmData)
+}
+
+// StreamingRecognize 流式识别接口
+// 接口本身不支持流式，这里在输入音频中按分段VAD检测到的静音分段，每段单独请求转写
+// 中间分段输出非最终结果，输入结束后剩余音频的转写作为最终结果
+// 各段结果为增量文本，调用方按顺序拼接即可得到完整文本
+func (p *OpenAIASRProvider) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	resultChan := make(chan types.StreamingResult, 10)
+	segmentChan := make(chan asrSegment, 10)
+
+	go p.splitSegments(ctx, audioStream, segmentChan)
+	go p.transcribeSegments(ctx, segmentChan, resultChan)
+
+	return resultChan, nil
+}
+
+// asrSegment 待转写的音频分段
+type asrSegment struct {
+	pcmData  []float32
+	hasVoice bool
+	isFinal  bool
+}
+
+// splitSegments 读取输入音频，按静音切分为多个分段
+func (p *OpenAIASRProvider) splitSegments(ctx context.Context, audioStream <-chan []float32, segmentChan chan asrSegment) {
+	defer close(segmentChan)
+
+	var voiceDetector types.VoiceDetector
+	if p.config.SegmentSilenceMs > 0 && p.voiceDetector != nil {
+		voiceDetector = p.voiceDetector
+		defer voiceDetector.Release()
+	}
+
+	windowSize := p.config.SampleRate * vadWindowMs / 1000
+	var segment, window []float32
+	var hasVoice, pushed bool
+	var silenceMs int
+
+	pushSegment := func(isFinal bool) bool {
+		// 会话只在检测到语音后才开始识别, 没有分过段时整段音频都需要转写
+		item := asrSegment{pcmData: segment, hasVoice: hasVoice || voiceDetector == nil || !pushed, isFinal: isFinal}
+		segment, hasVoice, silenceMs, pushed = nil, false, 0, true
+		select {
+		case <-ctx.Done():
+			return false
+		case segmentChan <- item:
+			return true
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debugf("OpenAI ASR splitSegments 已取消: %v", ctx.Err())
+			return
+		case pcmChunk, ok := <-audioStream:
+			if !ok {
+				pushSegment(true)
+				return
+			}
+			segment = append(segment, pcmChunk...)
+			if voiceDetector == nil {
+				continue
+			}
+
+			window = append(window, pcmChunk...)
+			for len(window) >= windowSize {
+				isVoice, err := voiceDetector.IsVADExt(window[:windowSize], p.config.SampleRate, windowSize)
+				window = window[windowSize:]
+				if err != nil {
+					log.Debugf("OpenAI ASR VAD检测失败: %v", err)
+					continue
+				}
+				if isVoice {
+					hasVoice = true
+					silenceMs = 0
+				} else {
+					silenceMs += vadWindowMs
+				}
+			}
+
+			segmentMs := len(segment) * 1000 / p.config.SampleRate
+			if !hasVoice || segmentMs < p.config.MinSegmentMs {
+				continue
+			}
+			if silenceMs >= p.config.SegmentSilenceMs || segmentMs >= p.config.MaxSegmentMs {
+				log.Debugf("OpenAI ASR 分段, 时长: %dms, 尾部静音: %dms", segmentMs, silenceMs)
+				if !pushSegment(false) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// transcribeSegments 按顺序转写分段并输出识别结果
+func (p *OpenAIASRProvider) transcribeSegments(ctx context.Context, segmentChan chan asrSegment, resultChan chan types.StreamingResult) {
+	defer close(resultChan)
+
+	for segment := range segmentChan {
+		var text string
+		if segment.hasVoice && len(segment.pcmData) > 0 {
+			reqCtx, cancel := context.WithTimeout(ctx, time.Duration(p.config.Timeout)*time.Second)
+			var err error
+			text, err = p.transcribe(reqCtx, segment.pcmData)
+			cancel()
+			if err != nil {
+				log.Errorf("OpenAI ASR 转写失败: %v", err)
+				sendResult(ctx, resultChan, types.StreamingResult{IsFinal: true, Error: err})
+				return
+			}
+		}
+
+		if !segment.isFinal && text == "" {
+			continue
+		}
+		if !sendResult(ctx, resultChan, types.StreamingResult{Text: text, IsFinal: segment.isFinal}) {
+			return
+		}
+		if segment.isFinal {
+			return
+		}
+	}
+}
+
+// transcribe 将PCM编码为WAV后调用转写接口
+func (p *OpenAIASRProvider) transcribe(ctx context.Context, pcmData []float32) (string, error) {
+	startTs := time.Now().UnixMilli()
+
+	wavData, err := util.PCMFloat32BytesToWav(util.Float32SliceToBytes(pcmData), p.config.SampleRate, 1)
+	if err != nil {
+		return "", fmt.Errorf("编码WAV失败: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", fmt.Errorf("创建表单文件失败: %v", err)
+	}
+	if _, err = part.Write(wavData); err != nil {
+		return "", fmt.Errorf("写入音频数据失败: %v", err)
+	}
+	fields := map[string]string{
+		"model":           p.config.Model,
+		"response_format": "json",
+		"temperature":     strconv.FormatFloat(p.config.Temperature, 'f', -1, 64),
+	}
+	if p.config.Language != "" {
+		fields["language"] = p.config.Language
+	}
+	if p.config.Prompt != "" {
+		fields["prompt"] = p.config.Prompt
+	}
+	for k, v := range fields {
+		if err := writer.WriteField(k, v); err != nil {
+			return "", fmt.Errorf("写入表单字段 %s 失败: %v", k, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("关闭表单失败: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.config.APIURL, body)
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if p.config.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.config.APIKey))
+	}
+
+	resp, err := getHTTPClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("发送请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result transcriptionResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("解析响应失败: %v, 响应: %s", err, string(respBody))
+	}
+
+	text := strings.TrimSpace(result.Text)
+	log.Debugf("OpenAI ASR 转写完成, 音频时长: %dms, 耗时: %dms, 结果: %s",
+		len(pcmData)*1000/p.config.SampleRate, time.Now().UnixMilli()-startTs, text)
+	return text, nil
+}
+
+func sendResult(ctx context.Context, resultChan chan types.StreamingResult, result types.StreamingResult) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case resultChan <- result:
+		return true
+	}
+}
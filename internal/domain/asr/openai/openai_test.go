@@ -0,0 +1,178 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, texts []string) *httptest.Server {
+	index := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			t.Errorf("解析表单失败: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("model") != "whisper-1" {
+			t.Errorf("model 字段错误: %s", r.FormValue("model"))
+		}
+		if r.FormValue("language") != "zh" {
+			t.Errorf("language 字段错误: %s", r.FormValue("language"))
+		}
+		if _, _, err := r.FormFile("file"); err != nil {
+			t.Errorf("缺少音频文件: %v", err)
+		}
+
+		text := ""
+		if index < len(texts) {
+			text = texts[index]
+		}
+		index++
+		json.NewEncoder(w).Encode(transcriptionResponse{Text: text})
+	}))
+}
+
+func TestOpenAIASRProcess(t *testing.T) {
+	server := newTestServer(t, []string{"你好小智"})
+	defer server.Close()
+
+	provider, err := NewOpenAIASRProvider(map[string]interface{}{
+		"api_url":  server.URL,
+		"language": "zh",
+	})
+	if err != nil {
+		t.Fatalf("创建ASR提供者失败: %v", err)
+	}
+
+	text, err := provider.Process(make([]float32, 16000))
+	if err != nil {
+		t.Fatalf("Process失败: %v", err)
+	}
+	if text != "你好小智" {
+		t.Errorf("识别结果错误: %s", text)
+	}
+}
+
+func TestOpenAIASRStreamingRecognize(t *testing.T) {
+	server := newTestServer(t, []string{"今天天气怎么样"})
+	defer server.Close()
+
+	// 关闭分段，整段音频在输入结束时一次性转写
+	provider, err := NewOpenAIASRProvider(map[string]interface{}{
+		"api_url":            server.URL,
+		"language":           "zh",
+		"segment_silence_ms": 0,
+	})
+	if err != nil {
+		t.Fatalf("创建ASR提供者失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	audioStream := make(chan []float32, 10)
+	resultChan, err := provider.StreamingRecognize(ctx, audioStream)
+	if err != nil {
+		t.Fatalf("StreamingRecognize失败: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		audioStream <- make([]float32, 960)
+	}
+	close(audioStream)
+
+	var results []string
+	for result := range resultChan {
+		if result.Error != nil {
+			t.Fatalf("识别出错: %v", result.Error)
+		}
+		results = append(results, result.Text)
+		if result.IsFinal {
+			break
+		}
+	}
+	if len(results) != 1 || results[0] != "今天天气怎么样" {
+		t.Errorf("识别结果错误: %+v", results)
+	}
+}
+
+// fakeVoiceDetector 样本不为0时视为语音, 记录检测和归还次数
+type fakeVoiceDetector struct {
+	calls    int
+	released int
+}
+
+func (d *fakeVoiceDetector) IsVADExt(pcmData []float32, sampleRate int, frameSize int) (bool, error) {
+	d.calls++
+	return pcmData[0] != 0, nil
+}
+
+func (d *fakeVoiceDetector) Release() {
+	d.released++
+}
+
+func TestOpenAIASRStreamingRecognizeVad(t *testing.T) {
+	server := newTestServer(t, []string{"第一段", "第二段"})
+	defer server.Close()
+
+	detector := &fakeVoiceDetector{}
+	provider, err := NewOpenAIASRProvider(map[string]interface{}{
+		"api_url":            server.URL,
+		"language":           "zh",
+		"segment_silence_ms": 600,
+		"min_segment_ms":     1000,
+		"voice_detector":     detector,
+	})
+	if err != nil {
+		t.Fatalf("创建ASR提供者失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	audioStream := make(chan []float32, 64)
+	resultChan, err := provider.StreamingRecognize(ctx, audioStream)
+	if err != nil {
+		t.Fatalf("StreamingRecognize失败: %v", err)
+	}
+	frame := func(value float32) []float32 {
+		pcm := make([]float32, 960)
+		for i := range pcm {
+			pcm[i] = value
+		}
+		return pcm
+	}
+	// 1200ms 语音 + 600ms 静音后分段, 剩余 600ms 语音在输入结束时转写
+	for i := 0; i < 20; i++ {
+		audioStream <- frame(0.5)
+	}
+	for i := 0; i < 10; i++ {
+		audioStream <- frame(0)
+	}
+	for i := 0; i < 10; i++ {
+		audioStream <- frame(0.5)
+	}
+	close(audioStream)
+
+	// 读到结果通道关闭, 此时分段协程已经退出
+	var results []string
+	for result := range resultChan {
+		if result.Error != nil {
+			t.Fatalf("识别出错: %v", result.Error)
+		}
+		results = append(results, result.Text)
+	}
+	if len(results) != 2 || results[0] != "第一段" || results[1] != "第二段" {
+		t.Errorf("分段识别结果错误: %+v", results)
+	}
+	if detector.calls != 40 {
+		t.Errorf("VAD 检测次数错误: %d", detector.calls)
+	}
+	// 识别结束后归还分段用的 VAD 实例
+	if detector.released != 1 {
+		t.Errorf("VAD 实例未归还: %d", detector.released)
+	}
+}
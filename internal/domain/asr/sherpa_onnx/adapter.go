@@ -0,0 +1,123 @@
+package sherpa_onnx
+
+import (
+	"context"
+	"fmt"
+
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// SherpaOnnxAdapter 适配器，实现现有的AsrProvider接口
+type SherpaOnnxAdapter struct {
+	engine *SherpaOnnxASR
+}
+
+// NewSherpaOnnxAdapter 创建一个新的本地 sherpa-onnx ASR适配器
+func NewSherpaOnnxAdapter(config map[string]interface{}) (*SherpaOnnxAdapter, error) {
+	// 创建本地ASR引擎
+	engine, err := NewSherpaOnnxASR(parseConfig(config))
+	if err != nil {
+		log.Errorf("创建sherpa-onnx ASR引擎失败: %v", err)
+		return nil, fmt.Errorf("创建sherpa-onnx ASR引擎失败: %v", err)
+	}
+
+	return &SherpaOnnxAdapter{
+		engine: engine,
+	}, nil
+}
+
+// parseConfig 从配置 map 解析 sherpa-onnx 配置，未配置的项使用 DefaultConfig
+// yaml 中的数字解析为 int，json 中的数字解析为 float64，两种都支持
+func parseConfig(config map[string]interface{}) SherpaOnnxConfig {
+	sherpaConfig := DefaultConfig
+
+	// 从map中获取配置项
+	if mode, ok := config["mode"].(string); ok && mode != "" {
+		sherpaConfig.Mode = mode
+	}
+	if modelType, ok := config["model_type"].(string); ok && modelType != "" {
+		sherpaConfig.ModelType = modelType
+	}
+	if encoder, ok := config["encoder"].(string); ok && encoder != "" {
+		sherpaConfig.Encoder = encoder
+	}
+	if decoder, ok := config["decoder"].(string); ok && decoder != "" {
+		sherpaConfig.Decoder = decoder
+	}
+	if joiner, ok := config["joiner"].(string); ok && joiner != "" {
+		sherpaConfig.Joiner = joiner
+	}
+	if model, ok := config["model"].(string); ok && model != "" {
+		sherpaConfig.Model = model
+	}
+	if tokens, ok := config["tokens"].(string); ok && tokens != "" {
+		sherpaConfig.Tokens = tokens
+	}
+	if language, ok := config["language"].(string); ok {
+		sherpaConfig.Language = language
+	}
+	if task, ok := config["task"].(string); ok && task != "" {
+		sherpaConfig.Task = task
+	}
+	if useItn, ok := config["use_itn"].(bool); ok {
+		sherpaConfig.UseItn = useItn
+	}
+	if sampleRate, ok := config["sample_rate"].(int); ok && sampleRate > 0 {
+		sherpaConfig.SampleRate = sampleRate
+	} else if sampleRateFloat, ok := config["sample_rate"].(float64); ok && sampleRateFloat > 0 {
+		sherpaConfig.SampleRate = int(sampleRateFloat)
+	}
+	if featureDim, ok := config["feature_dim"].(int); ok && featureDim > 0 {
+		sherpaConfig.FeatureDim = featureDim
+	} else if featureDimFloat, ok := config["feature_dim"].(float64); ok && featureDimFloat > 0 {
+		sherpaConfig.FeatureDim = int(featureDimFloat)
+	}
+	if numThreads, ok := config["num_threads"].(int); ok && numThreads > 0 {
+		sherpaConfig.NumThreads = numThreads
+	} else if numThreadsFloat, ok := config["num_threads"].(float64); ok && numThreadsFloat > 0 {
+		sherpaConfig.NumThreads = int(numThreadsFloat)
+	}
+	if provider, ok := config["provider"].(string); ok && provider != "" {
+		sherpaConfig.Provider = provider
+	}
+	if decodingMethod, ok := config["decoding_method"].(string); ok && decodingMethod != "" {
+		sherpaConfig.DecodingMethod = decodingMethod
+	}
+	if maxActivePaths, ok := config["max_active_paths"].(int); ok && maxActivePaths > 0 {
+		sherpaConfig.MaxActivePaths = maxActivePaths
+	} else if maxActivePathsFloat, ok := config["max_active_paths"].(float64); ok && maxActivePathsFloat > 0 {
+		sherpaConfig.MaxActivePaths = int(maxActivePathsFloat)
+	}
+	if enableEndpoint, ok := config["enable_endpoint"].(bool); ok {
+		sherpaConfig.EnableEndpoint = enableEndpoint
+	}
+	if rule1, ok := config["rule1_min_trailing_silence"].(float64); ok && rule1 > 0 {
+		sherpaConfig.Rule1Silence = float32(rule1)
+	}
+	if rule2, ok := config["rule2_min_trailing_silence"].(float64); ok && rule2 > 0 {
+		sherpaConfig.Rule2Silence = float32(rule2)
+	}
+	if rule3, ok := config["rule3_min_utterance_length"].(float64); ok && rule3 > 0 {
+		sherpaConfig.Rule3MaxLength = float32(rule3)
+	}
+	if tailPaddingMs, ok := config["tail_padding_ms"].(int); ok && tailPaddingMs >= 0 {
+		sherpaConfig.TailPaddingMs = tailPaddingMs
+	} else if tailPaddingMsFloat, ok := config["tail_padding_ms"].(float64); ok && tailPaddingMsFloat >= 0 {
+		sherpaConfig.TailPaddingMs = int(tailPaddingMsFloat)
+	}
+	if debug, ok := config["debug"].(bool); ok {
+		sherpaConfig.Debug = debug
+	}
+	return sherpaConfig
+}
+
+// Process 实现一次性处理整段音频，返回完整识别结果
+func (a *SherpaOnnxAdapter) Process(pcmData []float32) (string, error) {
+	return a.engine.Process(pcmData)
+}
+
+// StreamingRecognize 实现流式识别接口
+func (a *SherpaOnnxAdapter) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	return a.engine.StreamingRecognize(ctx, audioStream)
+}
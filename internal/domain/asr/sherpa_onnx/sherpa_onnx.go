@@ -0,0 +1,324 @@
+package sherpa_onnx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	sherpa "github.com/k2-fsa/sherpa-onnx-go/sherpa_onnx"
+
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 模型加载耗时且占用内存较大，相同配置的识别器在进程内共享
+// onnxruntime 的 Session 支持并发推理，每次识别只需创建独立的 stream
+var (
+	recognizerMutex      sync.Mutex
+	onlineRecognizerMap  = make(map[string]*sherpa.OnlineRecognizer)
+	offlineRecognizerMap = make(map[string]*sherpa.OfflineRecognizer)
+)
+
+// SherpaOnnxASR 基于 sherpa-onnx(onnxruntime) 的本地ASR实现
+type SherpaOnnxASR struct {
+	config SherpaOnnxConfig
+}
+
+// NewSherpaOnnxASR 创建一个新的本地ASR实例，并预加载模型
+func NewSherpaOnnxASR(config SherpaOnnxConfig) (*SherpaOnnxASR, error) {
+	if config.Tokens == "" {
+		return nil, fmt.Errorf("缺少tokens配置")
+	}
+	if config.Mode == "" {
+		config.Mode = DefaultConfig.Mode
+	}
+	if config.Mode != ModeOnline && config.Mode != ModeOffline {
+		return nil, fmt.Errorf("不支持的识别模式: %s", config.Mode)
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = DefaultConfig.SampleRate
+	}
+	if config.FeatureDim == 0 {
+		config.FeatureDim = DefaultConfig.FeatureDim
+	}
+	if config.NumThreads == 0 {
+		config.NumThreads = DefaultConfig.NumThreads
+	}
+	if config.Provider == "" {
+		config.Provider = DefaultConfig.Provider
+	}
+	if config.DecodingMethod == "" {
+		config.DecodingMethod = DefaultConfig.DecodingMethod
+	}
+	if config.MaxActivePaths == 0 {
+		config.MaxActivePaths = DefaultConfig.MaxActivePaths
+	}
+	if config.Task == "" {
+		config.Task = DefaultConfig.Task
+	}
+
+	s := &SherpaOnnxASR{config: config}
+
+	// 创建时即加载模型，避免首次识别时才发现模型路径错误
+	var err error
+	if config.Mode == ModeOnline {
+		_, err = s.getOnlineRecognizer()
+	} else {
+		_, err = s.getOfflineRecognizer()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SherpaOnnxASR) recognizerKey() string {
+	return fmt.Sprintf("%+v", s.config)
+}
+
+// getOnlineRecognizer 获取(或创建)流式识别器
+func (s *SherpaOnnxASR) getOnlineRecognizer() (*sherpa.OnlineRecognizer, error) {
+	recognizerMutex.Lock()
+	defer recognizerMutex.Unlock()
+
+	key := s.recognizerKey()
+	if recognizer, ok := onlineRecognizerMap[key]; ok {
+		return recognizer, nil
+	}
+
+	c := s.config
+	config := sherpa.OnlineRecognizerConfig{}
+	config.FeatConfig = sherpa.FeatureConfig{SampleRate: c.SampleRate, FeatureDim: c.FeatureDim}
+	switch c.ModelType {
+	case "transducer", "":
+		config.ModelConfig.Transducer.Encoder = c.Encoder
+		config.ModelConfig.Transducer.Decoder = c.Decoder
+		config.ModelConfig.Transducer.Joiner = c.Joiner
+	case "paraformer":
+		config.ModelConfig.Paraformer.Encoder = c.Encoder
+		config.ModelConfig.Paraformer.Decoder = c.Decoder
+	case "zipformer2_ctc":
+		config.ModelConfig.Zipformer2Ctc.Model = c.Model
+	default:
+		return nil, fmt.Errorf("online 模式不支持的模型类型: %s", c.ModelType)
+	}
+	config.ModelConfig.Tokens = c.Tokens
+	config.ModelConfig.NumThreads = c.NumThreads
+	config.ModelConfig.Provider = c.Provider
+	config.ModelConfig.Debug = boolToInt(c.Debug)
+	config.DecodingMethod = c.DecodingMethod
+	config.MaxActivePaths = c.MaxActivePaths
+	config.EnableEndpoint = boolToInt(c.EnableEndpoint)
+	config.Rule1MinTrailingSilence = c.Rule1Silence
+	config.Rule2MinTrailingSilence = c.Rule2Silence
+	config.Rule3MinUtteranceLength = c.Rule3MaxLength
+
+	recognizer := sherpa.NewOnlineRecognizer(&config)
+	if recognizer == nil {
+		return nil, fmt.Errorf("创建sherpa-onnx流式识别器失败，请检查模型路径: %+v", c)
+	}
+	onlineRecognizerMap[key] = recognizer
+	log.Infof("sherpa-onnx 流式识别器加载完成, model_type: %s, tokens: %s", c.ModelType, c.Tokens)
+	return recognizer, nil
+}
+
+// getOfflineRecognizer 获取(或创建)非流式识别器
+func (s *SherpaOnnxASR) getOfflineRecognizer() (*sherpa.OfflineRecognizer, error) {
+	recognizerMutex.Lock()
+	defer recognizerMutex.Unlock()
+
+	key := s.recognizerKey()
+	if recognizer, ok := offlineRecognizerMap[key]; ok {
+		return recognizer, nil
+	}
+
+	c := s.config
+	config := sherpa.OfflineRecognizerConfig{}
+	config.FeatConfig = sherpa.FeatureConfig{SampleRate: c.SampleRate, FeatureDim: c.FeatureDim}
+	switch c.ModelType {
+	case "whisper":
+		config.ModelConfig.Whisper.Encoder = c.Encoder
+		config.ModelConfig.Whisper.Decoder = c.Decoder
+		config.ModelConfig.Whisper.Language = c.Language
+		config.ModelConfig.Whisper.Task = c.Task
+	case "sense_voice":
+		config.ModelConfig.SenseVoice.Model = c.Model
+		config.ModelConfig.SenseVoice.Language = c.Language
+		config.ModelConfig.SenseVoice.UseInverseTextNormalization = boolToInt(c.UseItn)
+	case "paraformer":
+		config.ModelConfig.Paraformer.Model = c.Model
+	case "transducer":
+		config.ModelConfig.Transducer.Encoder = c.Encoder
+		config.ModelConfig.Transducer.Decoder = c.Decoder
+		config.ModelConfig.Transducer.Joiner = c.Joiner
+	default:
+		return nil, fmt.Errorf("offline 模式不支持的模型类型: %s", c.ModelType)
+	}
+	config.ModelConfig.Tokens = c.Tokens
+	config.ModelConfig.NumThreads = c.NumThreads
+	config.ModelConfig.Provider = c.Provider
+	config.ModelConfig.Debug = boolToInt(c.Debug)
+	config.DecodingMethod = c.DecodingMethod
+	config.MaxActivePaths = c.MaxActivePaths
+
+	recognizer := sherpa.NewOfflineRecognizer(&config)
+	if recognizer == nil {
+		return nil, fmt.Errorf("创建sherpa-onnx非流式识别器失败，请检查模型路径: %+v", c)
+	}
+	offlineRecognizerMap[key] = recognizer
+	log.Infof("sherpa-onnx 非流式识别器加载完成, model_type: %s, tokens: %s", c.ModelType, c.Tokens)
+	return recognizer, nil
+}
+
+// Process 一次性识别整段音频
+func (s *SherpaOnnxASR) Process(pcmData []float32) (string, error) {
+	if s.config.Mode == ModeOffline {
+		return s.decodeOffline(pcmData)
+	}
+
+	recognizer, err := s.getOnlineRecognizer()
+	if err != nil {
+		return "", err
+	}
+	stream := sherpa.NewOnlineStream(recognizer)
+	defer sherpa.DeleteOnlineStream(stream)
+
+	stream.AcceptWaveform(s.config.SampleRate, pcmData)
+	s.finishOnlineStream(recognizer, stream)
+	return strings.TrimSpace(recognizer.GetResult(stream).Text), nil
+}
+
+// StreamingRecognize 实现流式识别
+// online 模式下每检测到一个端点输出一段非最终结果，输入结束后输出剩余文本作为最终结果
+// offline 模式下缓存全部音频，输入结束后一次性识别并输出最终结果
+// 与 funasr 一致，各段结果为增量文本，调用方按顺序拼接即可得到完整文本
+func (s *SherpaOnnxASR) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	resultChan := make(chan types.StreamingResult, 20)
+
+	if s.config.Mode == ModeOffline {
+		go s.recognizeOfflineStream(ctx, audioStream, resultChan)
+		return resultChan, nil
+	}
+
+	recognizer, err := s.getOnlineRecognizer()
+	if err != nil {
+		return nil, err
+	}
+	stream := sherpa.NewOnlineStream(recognizer)
+	go s.recognizeOnlineStream(ctx, recognizer, stream, audioStream, resultChan)
+	return resultChan, nil
+}
+
+func (s *SherpaOnnxASR) recognizeOnlineStream(ctx context.Context, recognizer *sherpa.OnlineRecognizer, stream *sherpa.OnlineStream, audioStream <-chan []float32, resultChan chan types.StreamingResult) {
+	defer func() {
+		close(resultChan)
+		sherpa.DeleteOnlineStream(stream)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debugf("sherpa-onnx recognizeOnlineStream 已取消: %v", ctx.Err())
+			return
+		case pcmChunk, ok := <-audioStream:
+			if !ok {
+				// 输入结束，冲刷剩余音频并输出最终结果
+				s.finishOnlineStream(recognizer, stream)
+				text := strings.TrimSpace(recognizer.GetResult(stream).Text)
+				log.Debugf("sherpa-onnx recognizeOnlineStream 最终结果: %s", text)
+				sendResult(ctx, resultChan, types.StreamingResult{Text: text, IsFinal: true})
+				return
+			}
+
+			stream.AcceptWaveform(s.config.SampleRate, pcmChunk)
+			for recognizer.IsReady(stream) {
+				recognizer.Decode(stream)
+			}
+
+			if !recognizer.IsEndpoint(stream) {
+				continue
+			}
+			text := strings.TrimSpace(recognizer.GetResult(stream).Text)
+			recognizer.Reset(stream)
+			if text == "" {
+				continue
+			}
+			log.Debugf("sherpa-onnx recognizeOnlineStream 分段结果: %s", text)
+			if !sendResult(ctx, resultChan, types.StreamingResult{Text: text, IsFinal: false}) {
+				return
+			}
+		}
+	}
+}
+
+func (s *SherpaOnnxASR) recognizeOfflineStream(ctx context.Context, audioStream <-chan []float32, resultChan chan types.StreamingResult) {
+	defer close(resultChan)
+
+	var pcmData []float32
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debugf("sherpa-onnx recognizeOfflineStream 已取消: %v", ctx.Err())
+			return
+		case pcmChunk, ok := <-audioStream:
+			if ok {
+				pcmData = append(pcmData, pcmChunk...)
+				continue
+			}
+
+			text, err := s.decodeOffline(pcmData)
+			if err != nil {
+				sendResult(ctx, resultChan, types.StreamingResult{IsFinal: true, Error: err})
+				return
+			}
+			log.Debugf("sherpa-onnx recognizeOfflineStream 最终结果: %s", text)
+			sendResult(ctx, resultChan, types.StreamingResult{Text: text, IsFinal: true})
+			return
+		}
+	}
+}
+
+// finishOnlineStream 补齐尾部静音并标记输入结束，解码全部剩余帧
+func (s *SherpaOnnxASR) finishOnlineStream(recognizer *sherpa.OnlineRecognizer, stream *sherpa.OnlineStream) {
+	if s.config.TailPaddingMs > 0 {
+		tailPadding := make([]float32, s.config.SampleRate*s.config.TailPaddingMs/1000)
+		stream.AcceptWaveform(s.config.SampleRate, tailPadding)
+	}
+	stream.InputFinished()
+	for recognizer.IsReady(stream) {
+		recognizer.Decode(stream)
+	}
+}
+
+func (s *SherpaOnnxASR) decodeOffline(pcmData []float32) (string, error) {
+	if len(pcmData) == 0 {
+		return "", nil
+	}
+	recognizer, err := s.getOfflineRecognizer()
+	if err != nil {
+		return "", err
+	}
+	stream := sherpa.NewOfflineStream(recognizer)
+	defer sherpa.DeleteOfflineStream(stream)
+
+	stream.AcceptWaveform(s.config.SampleRate, pcmData)
+	recognizer.Decode(stream)
+	return strings.TrimSpace(stream.GetResult().Text), nil
+}
+
+func sendResult(ctx context.Context, resultChan chan types.StreamingResult, result types.StreamingResult) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case resultChan <- result:
+		return true
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
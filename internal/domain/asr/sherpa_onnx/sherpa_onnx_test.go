@@ -0,0 +1,102 @@
+package sherpa_onnx
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	// 未配置时使用默认值
+	if config := parseConfig(map[string]interface{}{}); config != DefaultConfig {
+		t.Errorf("默认配置错误: %+v", config)
+	}
+
+	// yaml 的数字为 int，json 的数字为 float64
+	config := parseConfig(map[string]interface{}{
+		"mode":                       "offline",
+		"model_type":                 "sense_voice",
+		"model":                      "model.onnx",
+		"tokens":                     "tokens.txt",
+		"language":                   "zh",
+		"use_itn":                    false,
+		"sample_rate":                8000,
+		"num_threads":                float64(4),
+		"enable_endpoint":            false,
+		"rule2_min_trailing_silence": 1.2,
+		"tail_padding_ms":            0,
+	})
+	if config.Mode != ModeOffline || config.ModelType != "sense_voice" || config.Model != "model.onnx" || config.Tokens != "tokens.txt" {
+		t.Errorf("模型配置错误: %+v", config)
+	}
+	if config.Language != "zh" || config.UseItn || config.EnableEndpoint {
+		t.Errorf("开关配置错误: %+v", config)
+	}
+	if config.SampleRate != 8000 || config.NumThreads != 4 || config.Rule2Silence != 1.2 || config.TailPaddingMs != 0 {
+		t.Errorf("数值配置错误: %+v", config)
+	}
+	// 未配置的项保持默认值
+	if config.FeatureDim != DefaultConfig.FeatureDim || config.DecodingMethod != DefaultConfig.DecodingMethod {
+		t.Errorf("未配置的项应使用默认值: %+v", config)
+	}
+}
+
+// TestNewSherpaOnnxASRInvalid 配置错误时在加载模型前返回错误
+func TestNewSherpaOnnxASRInvalid(t *testing.T) {
+	cases := []struct {
+		config SherpaOnnxConfig
+		want   string
+	}{
+		{SherpaOnnxConfig{}, "缺少tokens配置"},
+		{SherpaOnnxConfig{Tokens: "tokens.txt", Mode: "batch"}, "不支持的识别模式"},
+		{SherpaOnnxConfig{Tokens: "tokens.txt", Mode: ModeOnline, ModelType: "whisper"}, "online 模式不支持的模型类型"},
+		{SherpaOnnxConfig{Tokens: "tokens.txt", Mode: ModeOffline, ModelType: "zipformer2_ctc"}, "offline 模式不支持的模型类型"},
+	}
+	for _, tc := range cases {
+		if _, err := NewSherpaOnnxASR(tc.config); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: 错误 %v, 期望包含 %q", tc.config, err, tc.want)
+		}
+	}
+}
+
+// TestRecognizeOfflineStreamEmpty 没有音频时不加载模型，直接输出空的最终结果
+func TestRecognizeOfflineStreamEmpty(t *testing.T) {
+	s := &SherpaOnnxASR{config: SherpaOnnxConfig{Mode: ModeOffline, ModelType: "sense_voice"}}
+	audioStream := make(chan []float32)
+	close(audioStream)
+
+	resultChan, err := s.StreamingRecognize(context.Background(), audioStream)
+	if err != nil {
+		t.Fatalf("开始识别失败: %v", err)
+	}
+	result, ok := <-resultChan
+	if !ok || !result.IsFinal || result.Text != "" || result.Error != nil {
+		t.Errorf("识别结果错误: %+v", result)
+	}
+	if _, ok := <-resultChan; ok {
+		t.Errorf("最终结果后应关闭结果通道")
+	}
+}
+
+func TestRecognizeOfflineStreamCancel(t *testing.T) {
+	s := &SherpaOnnxASR{config: SherpaOnnxConfig{Mode: ModeOffline, ModelType: "sense_voice"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	audioStream := make(chan []float32)
+
+	resultChan, err := s.StreamingRecognize(ctx, audioStream)
+	if err != nil {
+		t.Fatalf("开始识别失败: %v", err)
+	}
+	audioStream <- make([]float32, 160)
+	cancel()
+
+	select {
+	case result, ok := <-resultChan:
+		if ok {
+			t.Errorf("取消后不应输出结果: %+v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("取消后应关闭结果通道")
+	}
+}
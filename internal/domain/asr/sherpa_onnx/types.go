@@ -0,0 +1,53 @@
+package sherpa_onnx
+
+import "xiaozhi-esp32-server-golang/internal/data/audio"
+
+const (
+	ModeOnline  = "online"  // 流式模型(transducer/paraformer/zipformer2_ctc)，边说边出结果
+	ModeOffline = "offline" // 非流式模型(whisper/sense_voice/paraformer)，整段音频结束后识别
+)
+
+// SherpaOnnxConfig 本地 sherpa-onnx ASR 配置结构体
+type SherpaOnnxConfig struct {
+	Mode           string  // 识别模式: online/offline
+	ModelType      string  // 模型类型: transducer/paraformer/zipformer2_ctc/whisper/sense_voice
+	Encoder        string  // encoder 模型路径
+	Decoder        string  // decoder 模型路径
+	Joiner         string  // joiner 模型路径(transducer)
+	Model          string  // 单文件模型路径(sense_voice/paraformer离线/zipformer2_ctc)
+	Tokens         string  // tokens.txt 路径
+	Language       string  // 语言(whisper/sense_voice)，为空时自动识别
+	Task           string  // whisper 任务: transcribe/translate
+	UseItn         bool    // sense_voice 是否启用逆文本正则化
+	SampleRate     int     // 输入音频采样率
+	FeatureDim     int     // 特征维度
+	NumThreads     int     // 推理线程数
+	Provider       string  // onnxruntime 执行后端: cpu/cuda/coreml
+	DecodingMethod string  // 解码方式: greedy_search/modified_beam_search
+	MaxActivePaths int     // modified_beam_search 的搜索宽度
+	EnableEndpoint bool    // 是否启用端点检测(仅 online 模式)，检测到端点时输出分段结果
+	Rule1Silence   float32 // 未识别出文字时的尾部静音阈值(秒)
+	Rule2Silence   float32 // 已识别出文字时的尾部静音阈值(秒)
+	Rule3MaxLength float32 // 单段最大时长(秒)
+	TailPaddingMs  int     // 输入结束后补齐的静音时长(毫秒)，避免尾字丢失
+	Debug          bool    // 是否打印 sherpa-onnx 调试信息
+}
+
+// DefaultConfig 默认配置
+var DefaultConfig = SherpaOnnxConfig{
+	Mode:           ModeOnline,
+	ModelType:      "transducer",
+	Task:           "transcribe",
+	UseItn:         true,
+	SampleRate:     audio.SampleRate,
+	FeatureDim:     80,
+	NumThreads:     2,
+	Provider:       "cpu",
+	DecodingMethod: "greedy_search",
+	MaxActivePaths: 4,
+	EnableEndpoint: true,
+	Rule1Silence:   2.4,
+	Rule2Silence:   0.8,
+	Rule3MaxLength: 20,
+	TailPaddingMs:  300,
+}
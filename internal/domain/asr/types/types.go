@@ -6,3 +6,13 @@ type StreamingResult struct {
 	IsFinal bool   // 是否为最终结果
 	Error   error  // 错误信息
 }
+
+// ConfigKeyVoiceDetector ASR 配置中传入 VoiceDetector 的键, 由会话在创建 ASR 提供者时注入, 不写入配置文件
+const ConfigKeyVoiceDetector = "voice_detector"
+
+// VoiceDetector 需要按静音分段的 ASR 提供者使用的语音检测, 每次检测前重置状态
+// 会话为它单独从 VAD 资源池获取实例, 不与监听时的 VAD 共用; 一次识别结束后调用 Release 归还实例
+type VoiceDetector interface {
+	IsVADExt(pcmData []float32, sampleRate int, frameSize int) (bool, error)
+	Release()
+}
@@ -53,3 +53,19 @@ func (a *AudioProcesser) Encoder(pcmData []int16, audio []byte) (int, error) {
 	}
 	return a.encoder.Encode(pcmData, audio)
 }
+
+// DecoderPLC 丢包补偿, 根据解码器状态生成一帧补偿数据, pcmData 长度决定补偿的帧长
+func (a *AudioProcesser) DecoderPLC(pcmData []int16) error {
+	if a.decoder == nil {
+		return errors.New("decoder is nil")
+	}
+	return a.decoder.DecodePLC(pcmData)
+}
+
+// DecoderFEC 用下一个数据包中携带的前向纠错数据恢复丢失的那一帧, 数据包不带FEC时退化为PLC
+func (a *AudioProcesser) DecoderFEC(audio []byte, pcmData []int16) error {
+	if a.decoder == nil {
+		return errors.New("decoder is nil")
+	}
+	return a.decoder.DecodeFEC(audio, pcmData)
+}
@@ -0,0 +1,235 @@
+package hotreload
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change 单个配置项的变化, Old 为 nil 表示新增, New 为 nil 表示删除
+type Change struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+// Diff 两份配置之间的差异, 按 key 排序
+type Diff []Change
+
+// Changed 是否有 prefix 下的配置项发生变化, prefix 为点分格式, 如 "vad" 或 "mcp.global"
+func (d Diff) Changed(prefix string) bool {
+	for _, change := range d {
+		if matchPrefix(change.Key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter prefix 下发生变化的配置项
+func (d Diff) Filter(prefix string) Diff {
+	var result Diff
+	for _, change := range d {
+		if matchPrefix(change.Key, prefix) {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+// Keys 发生变化的配置项
+func (d Diff) Keys() []string {
+	keys := make([]string, 0, len(d))
+	for _, change := range d {
+		keys = append(keys, change.Key)
+	}
+	return keys
+}
+
+// String 用于打印日志, 密钥类配置只显示是否变化
+func (c Change) String() string {
+	oldValue, newValue := formatValue(c.Key, c.Old), formatValue(c.Key, c.New)
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("+ %s: %s", c.Key, newValue)
+	case c.New == nil:
+		return fmt.Sprintf("- %s: %s", c.Key, oldValue)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Key, oldValue, newValue)
+	}
+}
+
+// Compare 对比两份配置(viper.AllSettings 的结果), key 转为点分格式, 列表整体比较
+func Compare(oldSettings, newSettings map[string]interface{}) Diff {
+	oldFlat := make(map[string]interface{})
+	newFlat := make(map[string]interface{})
+	flatten("", oldSettings, oldFlat)
+	flatten("", newSettings, newFlat)
+
+	var diff Diff
+	for key, oldValue := range oldFlat {
+		newValue, ok := newFlat[key]
+		if !ok {
+			diff = append(diff, Change{Key: key, Old: oldValue})
+			continue
+		}
+		if !reflect.DeepEqual(normalize(oldValue), normalize(newValue)) {
+			diff = append(diff, Change{Key: key, Old: oldValue, New: newValue})
+		}
+	}
+	for key, newValue := range newFlat {
+		if _, ok := oldFlat[key]; !ok {
+			diff = append(diff, Change{Key: key, New: newValue})
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].Key < diff[j].Key
+	})
+	return diff
+}
+
+func flatten(prefix string, settings map[string]interface{}, out map[string]interface{}) {
+	for key, value := range settings {
+		fullKey := strings.ToLower(key)
+		if prefix != "" {
+			fullKey = prefix + "." + fullKey
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(fullKey, v, out)
+		case map[interface{}]interface{}:
+			m := make(map[string]interface{}, len(v))
+			for k, item := range v {
+				m[fmt.Sprint(k)] = item
+			}
+			flatten(fullKey, m, out)
+		default:
+			if value != nil {
+				out[fullKey] = value
+			}
+		}
+	}
+}
+
+// normalize 配置文件和管理后台下发的配置中数字类型不同(int/float64), 统一后再比较
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalize(item)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[strings.ToLower(key)] = normalize(item)
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[strings.ToLower(fmt.Sprint(key))] = normalize(item)
+		}
+		return result
+	}
+	return value
+}
+
+func matchPrefix(key, prefix string) bool {
+	return key == prefix || strings.HasPrefix(key, prefix+".")
+}
+
+// 配置路径或字段名中含有这些词(包括复数、前缀, 如 api_keys、apikey、X-Api-Key)时视为密钥
+var secretKeywords = []string{"key", "secret", "password", "passwd", "token", "credential", "authorization", "cookie"}
+
+const maskedValue = "******"
+
+// isSecretName 字段名按非字母数字切分成词, 任意一个词以密钥关键词结尾时视为密钥
+func isSecretName(name string) bool {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	for _, word := range words {
+		singular := strings.TrimSuffix(word, "s")
+		for _, keyword := range secretKeywords {
+			if strings.HasSuffix(word, keyword) || strings.HasSuffix(singular, keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSecretKey 点分路径中任意一段是密钥时, 整个值(包括列表和 map)都不打印
+func isSecretKey(key string) bool {
+	for _, segment := range strings.Split(key, ".") {
+		if isSecretName(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact 递归替换列表和 map 中密钥字段的值, 如 mcp 服务的 headers、token
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = redact(item)
+		}
+		return result
+	case []string:
+		return v
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if isSecretName(key) {
+				result[key] = maskedValue
+			} else {
+				result[key] = redact(item)
+			}
+		}
+		return result
+	case map[string]string:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if isSecretName(key) {
+				result[key] = maskedValue
+			} else {
+				result[key] = item
+			}
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			name := fmt.Sprint(key)
+			if isSecretName(name) {
+				result[name] = maskedValue
+			} else {
+				result[name] = redact(item)
+			}
+		}
+		return result
+	}
+	return value
+}
+
+func formatValue(key string, value interface{}) string {
+	if value == nil {
+		return "<nil>"
+	}
+	if isSecretKey(key) {
+		return maskedValue
+	}
+	return fmt.Sprintf("%v", redact(value))
+}
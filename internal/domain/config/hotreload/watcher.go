@@ -0,0 +1,237 @@
+package hotreload
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// Validator 校验新配置, 返回错误时放弃本次更新, 继续使用旧配置
+type Validator func(v *viper.Viper) error
+
+// Overlay 在配置文件之上叠加其它来源的配置, 如管理后台下发的系统配置
+type Overlay func(v *viper.Viper) error
+
+// Subscriber 配置生效后的回调, diff 只包含订阅的配置项
+type Subscriber func(diff Diff)
+
+type subscription struct {
+	prefixes []string
+	fn       Subscriber
+}
+
+// Watcher 监听配置文件变化, 校验通过后更新到 viper 并通知订阅者
+//
+// 会话创建时从 viper 读取 vad/asr/llm/tts 等配置, 更新后新会话使用新配置, 已有会话保持不变
+type Watcher struct {
+	file     string
+	target   *viper.Viper
+	debounce time.Duration
+	overlay  Overlay
+
+	mu          sync.Mutex
+	validators  []Validator
+	subscribers []subscription
+
+	watcher *fsnotify.Watcher
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Option Watcher 配置选项
+type Option func(*Watcher)
+
+// WithViper 更新指定的 viper 实例, 默认为全局 viper
+func WithViper(v *viper.Viper) Option {
+	return func(w *Watcher) {
+		w.target = v
+	}
+}
+
+// WithDebounce 编辑器保存时会连续触发多个事件, 合并一段时间内的事件后再加载
+func WithDebounce(debounce time.Duration) Option {
+	return func(w *Watcher) {
+		w.debounce = debounce
+	}
+}
+
+// WithOverlay 设置叠加在配置文件之上的配置
+func WithOverlay(overlay Overlay) Option {
+	return func(w *Watcher) {
+		w.overlay = overlay
+	}
+}
+
+// New 创建配置文件监听器
+func New(file string, opts ...Option) *Watcher {
+	w := &Watcher{
+		file:     filepath.Clean(file),
+		target:   viper.GetViper(),
+		debounce: 500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// AddValidator 添加配置校验
+func (w *Watcher) AddValidator(validator Validator) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.validators = append(w.validators, validator)
+}
+
+// Subscribe 订阅 prefixes 下配置项的变化, 不传 prefixes 时订阅所有变化
+func (w *Watcher) Subscribe(fn Subscriber, prefixes ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, subscription{prefixes: prefixes, fn: fn})
+}
+
+// Start 开始监听配置文件
+func (w *Watcher) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建文件监听失败: %v", err)
+	}
+	// 监听所在目录而不是文件本身, 编辑器保存和 Kubernetes ConfigMap 更新都是替换文件
+	if err := watcher.Add(filepath.Dir(w.file)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("监听配置目录失败: %v", err)
+	}
+	w.watcher = watcher
+	w.stop = make(chan struct{})
+
+	w.wg.Add(1)
+	go w.run()
+
+	log.Infof("配置热更新已启动, 监听文件: %s", w.file)
+	return nil
+}
+
+// Stop 停止监听
+func (w *Watcher) Stop() {
+	if w.watcher == nil {
+		return
+	}
+	close(w.stop)
+	w.watcher.Close()
+	w.wg.Wait()
+	w.watcher = nil
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	realPath, _ := filepath.EvalSymlinks(w.file)
+	var timer *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-w.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			currentPath, _ := filepath.EvalSymlinks(w.file)
+			fileChanged := filepath.Clean(event.Name) == w.file && event.Has(fsnotify.Write|fsnotify.Create)
+			linkChanged := currentPath != "" && currentPath != realPath
+			if !fileChanged && !linkChanged {
+				continue
+			}
+			realPath = currentPath
+			if timer == nil {
+				timer = time.NewTimer(w.debounce)
+			} else {
+				timer.Reset(w.debounce)
+			}
+			fire = timer.C
+		case <-fire:
+			fire = nil
+			if _, err := w.Reload(); err != nil {
+				log.Errorf("配置热更新失败, 继续使用旧配置: %v", err)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warnf("监听配置文件出错: %v", err)
+		}
+	}
+}
+
+// Reload 读取并校验配置文件, 生效后通知订阅者, 返回发生变化的配置项
+func (w *Watcher) Reload() (Diff, error) {
+	candidate := viper.New()
+	candidate.SetConfigFile(w.file)
+	if err := candidate.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	if w.overlay != nil {
+		// 叠加的配置获取失败时放弃本次更新, 避免丢失这部分配置
+		if err := w.overlay(candidate); err != nil {
+			return nil, fmt.Errorf("叠加配置失败: %v", err)
+		}
+	}
+
+	w.mu.Lock()
+	validators := append([]Validator(nil), w.validators...)
+	subscribers := append([]subscription(nil), w.subscribers...)
+	w.mu.Unlock()
+
+	for _, validator := range validators {
+		if err := validator(candidate); err != nil {
+			return nil, fmt.Errorf("配置校验失败: %v", err)
+		}
+	}
+
+	newSettings := candidate.AllSettings()
+	diff := Compare(w.target.AllSettings(), newSettings)
+	if len(diff) == 0 {
+		log.Debugf("配置文件 %s 内容未变化", w.file)
+		return nil, nil
+	}
+
+	// 先重新读取配置文件以去掉已删除的配置项, 再合并叠加的配置
+	if err := w.target.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("重新读取配置文件失败: %v", err)
+	}
+	if err := w.target.MergeConfigMap(newSettings); err != nil {
+		return nil, fmt.Errorf("合并配置失败: %v", err)
+	}
+
+	log.Infof("配置文件 %s 已更新, %d 项变化:", w.file, len(diff))
+	for _, change := range diff {
+		log.Infof("  %s", change)
+	}
+
+	for _, sub := range subscribers {
+		subDiff := diff
+		if len(sub.prefixes) > 0 {
+			subDiff = nil
+			for _, change := range diff {
+				for _, prefix := range sub.prefixes {
+					if matchPrefix(change.Key, prefix) {
+						subDiff = append(subDiff, change)
+						break
+					}
+				}
+			}
+		}
+		if len(subDiff) > 0 {
+			sub.fn(subDiff)
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,187 @@
+package hotreload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const baseConfig = `
+vad:
+  provider: "silero_vad"
+  silero_vad:
+    threshold: 0.5
+    pool_size: 10
+mcp:
+  global:
+    servers:
+      - name: "filesystem"
+        url: "http://localhost:3001/sse"
+llm:
+  provider: "openai"
+  openai:
+    api_key: "sk-old"
+`
+
+func writeConfig(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	oldSettings := map[string]interface{}{
+		"vad": map[string]interface{}{
+			"provider":   "silero_vad",
+			"silero_vad": map[string]interface{}{"pool_size": 10, "threshold": 0.5},
+		},
+		"removed": "x",
+	}
+	newSettings := map[string]interface{}{
+		"vad": map[string]interface{}{
+			"provider":   "silero_vad",
+			"silero_vad": map[string]interface{}{"pool_size": float64(10), "threshold": 0.6},
+		},
+		"added": true,
+	}
+
+	diff := Compare(oldSettings, newSettings)
+	keys := diff.Keys()
+	expected := []string{"added", "removed", "vad.silero_vad.threshold"}
+	if len(keys) != len(expected) {
+		t.Fatalf("差异错误: %v", keys)
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("差异[%d] = %s, 期望 %s", i, keys[i], expected[i])
+		}
+	}
+	if !diff.Changed("vad") || diff.Changed("va") || diff.Changed("mcp") {
+		t.Errorf("Changed 前缀匹配错误")
+	}
+	if filtered := diff.Filter("vad.silero_vad"); len(filtered) != 1 {
+		t.Errorf("Filter 结果错误: %v", filtered)
+	}
+
+	change := Change{Key: "llm.openai.api_key", Old: "sk-old", New: "sk-new"}
+	if s := change.String(); s != "~ llm.openai.api_key: ****** -> ******" {
+		t.Errorf("密钥不应打印到日志: %s", s)
+	}
+}
+
+func TestChangeStringMasksSecrets(t *testing.T) {
+	cases := []struct {
+		change Change
+		want   string
+	}{
+		// 复数和列表整体隐藏
+		{Change{Key: "openai_api.api_keys", Old: []interface{}{"sk-a"}, New: []interface{}{"sk-a", "sk-b"}}, "~ openai_api.api_keys: ****** -> ******"},
+		{Change{Key: "auth.tokens", New: map[string]interface{}{"dev": "t1"}}, "+ auth.tokens: ******"},
+		{Change{Key: "asr.xunfei.apikey", Old: "a"}, "- asr.xunfei.apikey: ******"},
+		// 嵌套的 map 中按字段名隐藏
+		{Change{Key: "mcp.global.servers", New: []interface{}{
+			map[string]interface{}{
+				"name":    "amap",
+				"url":     "https://example.com/sse?x=1",
+				"headers": map[string]interface{}{"Authorization": "Bearer abc", "X-Api-Key": "k1", "Accept": "text/event-stream"},
+				"token":   "t2",
+			},
+		}}, "+ mcp.global.servers: [map[headers:map[Accept:text/event-stream Authorization:****** X-Api-Key:******] name:amap token:****** url:https://example.com/sse?x=1]]"},
+		{Change{Key: "vad.threshold", Old: 0.5, New: 0.6}, "~ vad.threshold: 0.5 -> 0.6"},
+	}
+	for _, tc := range cases {
+		if s := tc.change.String(); s != tc.want {
+			t.Errorf("日志输出错误:\n%s\n期望:\n%s", s, tc.want)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, file, baseConfig)
+
+	target := viper.New()
+	target.SetConfigFile(file)
+	if err := target.ReadInConfig(); err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+	// 模拟管理后台下发的配置
+	overlay := map[string]interface{}{"system_prompt": "来自管理后台"}
+	target.MergeConfigMap(overlay)
+
+	w := New(file, WithViper(target), WithOverlay(func(v *viper.Viper) error {
+		return v.MergeConfigMap(overlay)
+	}))
+	w.AddValidator(func(v *viper.Viper) error {
+		if v.GetString("vad.provider") == "" {
+			return errors.New("vad.provider 不能为空")
+		}
+		return nil
+	})
+
+	var vadDiff, mcpDiff Diff
+	w.Subscribe(func(diff Diff) { vadDiff = diff }, "vad")
+	w.Subscribe(func(diff Diff) { mcpDiff = diff }, "mcp.global")
+
+	// 内容未变化
+	if diff, err := w.Reload(); err != nil || len(diff) != 0 {
+		t.Fatalf("配置未变化时不应有差异: %v, %v", diff, err)
+	}
+
+	writeConfig(t, file, `
+vad:
+  provider: "silero_vad"
+  silero_vad:
+    threshold: 0.6
+    pool_size: 10
+mcp:
+  global:
+    servers:
+      - name: "filesystem"
+        url: "http://localhost:3001/sse"
+`)
+	diff, err := w.Reload()
+	if err != nil {
+		t.Fatalf("热更新失败: %v", err)
+	}
+	if len(diff) != 3 {
+		t.Errorf("差异错误: %v", diff.Keys())
+	}
+	if len(vadDiff) != 1 || vadDiff[0].Key != "vad.silero_vad.threshold" {
+		t.Errorf("vad 订阅者收到的差异错误: %v", vadDiff)
+	}
+	if mcpDiff != nil {
+		t.Errorf("mcp 配置未变化, 不应通知: %v", mcpDiff)
+	}
+	if target.GetFloat64("vad.silero_vad.threshold") != 0.6 {
+		t.Errorf("新配置未生效")
+	}
+	if target.IsSet("llm.openai.api_key") {
+		t.Errorf("已删除的配置项应被移除")
+	}
+	if target.GetString("system_prompt") != "来自管理后台" {
+		t.Errorf("叠加的配置应保留")
+	}
+
+	// 校验失败时保留旧配置
+	writeConfig(t, file, "vad:\n  provider: \"\"\n")
+	if _, err := w.Reload(); err == nil {
+		t.Errorf("校验失败时应返回错误")
+	}
+	if target.GetString("vad.provider") != "silero_vad" {
+		t.Errorf("校验失败时不应修改配置")
+	}
+
+	// 语法错误时保留旧配置
+	writeConfig(t, file, "vad: [\n")
+	if _, err := w.Reload(); err == nil {
+		t.Errorf("解析失败时应返回错误")
+	}
+	if target.GetFloat64("vad.silero_vad.threshold") != 0.6 {
+		t.Errorf("解析失败时不应修改配置")
+	}
+}
@@ -26,4 +26,7 @@ type UserConfigProvider interface {
 	NotifyDeviceEvent(ctx context.Context, eventType string, eventData map[string]interface{})
 	//注册下行事件处理函数(比如消息注入等)
 	RegisterMessageEventHandler(ctx context.Context, eventType string, eventHandler types.EventHandler)
+
+	// SearchKnowledge 检索设备所属智能体知识库中与 query 相关的内容, 不支持知识库时返回空字符串
+	SearchKnowledge(ctx context.Context, deviceID string, agentID string, query string, topK int) (string, error)
 }
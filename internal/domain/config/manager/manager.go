@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 	"xiaozhi-esp32-server-golang/internal/components/http"
 	"xiaozhi-esp32-server-golang/internal/domain/config/types"
@@ -77,8 +79,11 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 				TTSConfigID *string  `json:"tts_config_id"`
 				Voice       *string  `json:"voice"`
 			} `json:"voice_identify"`
-			Prompt  string `json:"prompt"`
-			AgentId string `json:"agent_id"`
+			Prompt    string                 `json:"prompt"`
+			AgentId   string                 `json:"agent_id"`
+			UserId    string                 `json:"user_id"`
+			Context   map[string]interface{} `json:"context"`
+			Knowledge bool                   `json:"knowledge"`
 		} `json:"data"`
 	}
 
@@ -152,6 +157,9 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 		},
 		VoiceIdentify: voiceIdentifyData,
 		AgentId:       response.Data.AgentId,
+		UserId:        response.Data.UserId,
+		Context:       response.Data.Context,
+		Knowledge:     response.Data.Knowledge,
 	}
 
 	log.Log().Infof("成功获取设备配置: deviceId: %s, config: %+v", deviceID, config)
@@ -238,3 +246,37 @@ func (c *ConfigManager) NotifyDeviceEvent(ctx context.Context, eventType string,
 func (c *ConfigManager) RegisterMessageEventHandler(ctx context.Context, eventType string, handler types.EventHandler) {
 	GetDefaultClient().RegisterMessageHandler(ctx, eventType, handler)
 }
+
+// SearchKnowledge 检索设备所属智能体的知识库, 返回按相关度排序的文档片段
+func (c *ConfigManager) SearchKnowledge(ctx context.Context, deviceID string, agentID string, query string, topK int) (string, error) {
+	var response struct {
+		Data struct {
+			Results []struct {
+				DocumentName string  `json:"document_name"`
+				Content      string  `json:"content"`
+				Score        float64 `json:"score"`
+			} `json:"results"`
+		} `json:"data"`
+	}
+
+	err := c.client.DoRequest(ctx, http.RequestOptions{
+		Method: "GET",
+		Path:   "/api/internal/knowledge/search",
+		QueryParams: map[string]string{
+			"device_id": deviceID,
+			"agent_id":  agentID,
+			"query":     query,
+			"top_k":     strconv.Itoa(topK),
+		},
+		Response: &response,
+	})
+	if err != nil {
+		return "", fmt.Errorf("检索知识库失败: %w", err)
+	}
+
+	parts := make([]string, 0, len(response.Data.Results))
+	for _, result := range response.Data.Results {
+		parts = append(parts, fmt.Sprintf("【%s】\n%s", result.DocumentName, result.Content))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
@@ -211,6 +211,11 @@ func (u *UserConfig) RegisterMessageEventHandler(ctx context.Context, deviceID s
 	return
 }
 
+// SearchKnowledge 知识库由管理后台提供, redis 配置不支持
+func (u *UserConfig) SearchKnowledge(ctx context.Context, deviceID string, agentID string, query string, topK int) (string, error) {
+	return "", nil
+}
+
 // Init 初始化Redis配置提供者
 func Init(ctx context.Context) error {
 	log.Log().Info("Redis config provider initialized successfully")
@@ -49,6 +49,9 @@ type UConfig struct {
 	Memory        MemoryConfig                `json:"memory"`
 	VoiceIdentify map[string]SpeakerGroupInfo `json:"voice_identify"` // 声纹识别配置
 	AgentId       string                      `json:"agent_id"`       //所属agent_id
+	UserId        string                      `json:"user_id"`        //所属用户id
+	Context       map[string]interface{}      `json:"context"`        //智能体的上下文窗口配置, 覆盖 context_window
+	Knowledge     bool                        `json:"knowledge"`      //智能体是否有可检索的知识库
 }
 
 type TtsConfigItem struct {
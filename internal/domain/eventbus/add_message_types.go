@@ -34,7 +34,8 @@ type AddMessageEvent struct {
 
 	// 元数据（不属于 schema.Message 标准格式）
 	Timestamp   time.Time
-	TTSDuration int // TTS 耗时（毫秒）
+	TTSDuration int                    // TTS 耗时（毫秒）
+	Metadata    map[string]interface{} // 附加信息, 如 token 用量, 合并到聊天历史的 metadata
 
 	// 阶段标识
 	IsUpdate bool // true=更新音频，false=新增消息
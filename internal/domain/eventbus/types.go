@@ -3,6 +3,8 @@ package eventbus
 const (
 	TopicAddMessage = "add_message"
 	TopicSessionEnd = "session_end"
+	// 设备 hello 完成, 可以向设备播报
+	TopicSessionStart = "session_start"
 
 	// 聊天历史相关事件（已废弃，统一使用 TopicAddMessage）
 	// Deprecated: 使用 TopicAddMessage 替代
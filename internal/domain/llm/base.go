@@ -8,6 +8,8 @@ import (
 
 	"xiaozhi-esp32-server-golang/constants"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/eino_llm"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/mock"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/router"
 )
 
 // LLMProvider 大语言模型提供者接口
@@ -34,7 +36,7 @@ type LLMFactory interface {
 }
 
 // GetLLMProvider 创建LLM提供者
-// 统一使用EinoLLMProvider处理所有类型
+// 统一使用EinoLLMProvider处理所有类型, router 类型按意图分发到其它类型的模型
 func GetLLMProvider(providerName string, config map[string]interface{}) (LLMProvider, error) {
 	llmType := config["type"].(string)
 	switch llmType {
@@ -45,6 +47,16 @@ func GetLLMProvider(providerName string, config map[string]interface{}) (LLMProv
 			return nil, fmt.Errorf("创建Eino LLM提供者失败: %v", err)
 		}
 		return provider, nil
+	case constants.LlmTypeMock:
+		return mock.NewMockLLMProvider(config), nil
+	case constants.LlmTypeRouter:
+		provider, err := router.NewRouterLLMProvider(config, func(config map[string]interface{}) (router.Provider, error) {
+			return GetLLMProvider("", config)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("创建路由LLM提供者失败: %v", err)
+		}
+		return provider, nil
 	}
 	return nil, fmt.Errorf("不支持的LLM提供者: %s", llmType)
 }
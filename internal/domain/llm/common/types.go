@@ -18,4 +18,22 @@ type LLMResponseStruct struct {
 	IsStart   bool              `json:"is_start"`
 	IsEnd     bool              `json:"is_end"`
 	ToolCalls []schema.ToolCall `json:"tool_calls,omitempty"`
+	// Usage 本轮请求的 token 用量, 仅在 IsEnd 时携带, 模型未返回时为 nil
+	Usage *schema.TokenUsage `json:"usage,omitempty"`
+	// Route 路由模型选择的模型, 仅在 IsEnd 时携带, 未使用路由模型时为 nil
+	Route *RouteDecision `json:"route,omitempty"`
+}
+
+// ExtraKeyRoute 路由模型在响应消息 Extra 中记录路由结果使用的 key
+const ExtraKeyRoute = "llm_route"
+
+// RouteDecision 路由模型为一次请求选择的模型及原因
+type RouteDecision struct {
+	Route     string `json:"route"`                // 路由名称
+	Model     string `json:"model,omitempty"`      // 实际使用的模型
+	Reason    string `json:"reason"`               // 选择原因: tool_result, image, keyword, classifier, default
+	Keyword   string `json:"keyword,omitempty"`    // 命中的关键词
+	LatencyMs int64  `json:"latency_ms,omitempty"` // 分类耗时
+	// ClassifierTokens 意图分类消耗的 token, 模型未返回用量时按文本估算, 需要计入配额
+	ClassifierTokens int64 `json:"classifier_tokens,omitempty"`
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -254,6 +255,7 @@ func (p *EinoLLMProvider) EinoResponseWithTools(ctx context.Context, sessionID s
 			p.chatModel, err = p.chatModel.WithTools(tools)
 			if err != nil {
 				log.Errorf("绑定工具失败: %v", err)
+				metrics.IncProviderError(metrics.ComponentLlm, p.modelName)
 				return
 			}
 		}
@@ -268,6 +270,7 @@ func (p *EinoLLMProvider) EinoResponseWithTools(ctx context.Context, sessionID s
 				message, genErr := p.chatModel.Generate(ctx, messages, model.WithMaxTokens(p.maxTokens))
 				if genErr != nil {
 					log.Errorf("Eino工具生成响应失败: %v", genErr)
+					metrics.IncProviderError(metrics.ComponentLlm, p.modelName)
 					return
 				}
 				if message != nil {
@@ -282,6 +285,8 @@ func (p *EinoLLMProvider) EinoResponseWithTools(ctx context.Context, sessionID s
 				var currentToolCall *schema.ToolCall
 				var toolCallBuffer string
 				var isToolCallComplete bool
+				// token 用量通常在最后一个不含内容的分片中返回, 工具调用分片会被重新组装, 因此单独记录并在结束时发送
+				var usage *schema.TokenUsage
 
 				// 处理流式响应
 				for {
@@ -300,9 +305,16 @@ func (p *EinoLLMProvider) EinoResponseWithTools(ctx context.Context, sessionID s
 					}
 					if err != nil {
 						log.Errorf("接收流式响应失败: %v", err)
+						if ctx.Err() == nil {
+							metrics.IncProviderError(metrics.ComponentLlm, p.modelName)
+						}
 						break
 					}
 
+					if message != nil && message.ResponseMeta != nil && message.ResponseMeta.Usage != nil {
+						usage = message.ResponseMeta.Usage
+					}
+
 					if message != nil {
 						// 检查是否是工具调用的开始
 						if len(message.ToolCalls) > 0 {
@@ -344,12 +356,20 @@ func (p *EinoLLMProvider) EinoResponseWithTools(ctx context.Context, sessionID s
 						}
 					}
 				}
+
+				if usage != nil {
+					responseChan <- &schema.Message{
+						Role:         schema.Assistant,
+						ResponseMeta: &schema.ResponseMeta{Usage: usage},
+					}
+				}
 			}
 		} else {
 			// 直接使用Eino的Generate方法
 			message, err := p.chatModel.Generate(ctx, messages, model.WithMaxTokens(p.maxTokens))
 			if err != nil {
 				log.Errorf("Eino工具生成响应失败: %v", err)
+				metrics.IncProviderError(metrics.ComponentLlm, p.modelName)
 				return
 			}
 
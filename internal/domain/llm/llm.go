@@ -7,10 +7,14 @@ import (
 	"time"
 	"unicode"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
+	"xiaozhi-esp32-server-golang/internal/domain/tracing"
 
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/cloudwego/eino/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // 句子结束的标点符号
@@ -44,18 +48,25 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 	var (
 		llmResponse interface{}
 	)
+	model := getModelName(llmProvider)
+	ctx, span := tracing.StartSpan(ctx, "llm", tracing.AttrModel.String(model), attribute.Int("xiaozhi.tools", len(tools)))
 	llmResponse = llmProvider.ResponseWithContext(ctx, sessionID, dialogue, tools)
 
 	sentenceChannel := make(chan common.LLMResponseStruct, 2)
 	startTs := time.Now().UnixMilli()
 	var firstFrame bool
+	var firstToken bool
 	fullText := ""
 	var buffer bytes.Buffer // 用于累积接收到的内容
 	isFirst := true
+	var usage *schema.TokenUsage
+	var route *common.RouteDecision
 
 	go func() {
 		defer func() {
 			log.Debugf("full Response with %d tools, fullText: %s", len(tools), fullText)
+			span.SetAttributes(tracing.TextAttrs(tracing.AttrText, fullText)...)
+			tracing.EndSpan(span, ctx.Err())
 			close(sentenceChannel)
 		}()
 		msgChan, ok := llmResponse.(chan *schema.Message)
@@ -81,6 +92,8 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 						case sentenceChannel <- common.LLMResponseStruct{
 							Text:  remaining,
 							IsEnd: true,
+							Usage: usage,
+							Route: route,
 						}:
 						}
 
@@ -92,6 +105,8 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 						case sentenceChannel <- common.LLMResponseStruct{
 							Text:  "",
 							IsEnd: true,
+							Usage: usage,
+							Route: route,
 						}:
 						}
 					}
@@ -100,6 +115,22 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 				if message == nil {
 					break
 				}
+				if decision, ok := message.Extra[common.ExtraKeyRoute].(*common.RouteDecision); ok {
+					route = decision
+					span.SetAttributes(attribute.String("xiaozhi.llm_route", decision.Route), tracing.AttrModel.String(decision.Model))
+				}
+				if message.ResponseMeta != nil && message.ResponseMeta.Usage != nil {
+					usage = message.ResponseMeta.Usage
+					span.SetAttributes(
+						attribute.Int("xiaozhi.prompt_tokens", usage.PromptTokens),
+						attribute.Int("xiaozhi.completion_tokens", usage.CompletionTokens),
+					)
+				}
+				if !firstToken && (message.Content != "" || len(message.ToolCalls) > 0) {
+					firstToken = true
+					metrics.ObserveLlmFirstToken(model, time.Since(time.UnixMilli(startTs)))
+					span.AddEvent("first_token")
+				}
 				//byteMessage, _ := json.Marshal(message)
 				//log.Debugf("收到message: %s", string(byteMessage))
 				if message.Content != "" {
@@ -113,6 +144,7 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 									if !firstFrame {
 										firstFrame = true
 										log.Infof("耗时统计: llm工具首句: %d ms", time.Now().UnixMilli()-startTs)
+										metrics.ObserveLlmFirstSentence(model, time.Since(time.UnixMilli(startTs)))
 									}
 									log.Infof("处理完整句子: %s", sentence)
 									select {
@@ -142,6 +174,9 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 				// 工具调用响应（假设 ToolCalls 字段）
 				if message.ToolCalls != nil && len(message.ToolCalls) > 0 {
 					log.Infof("处理工具调用: %+v", message.ToolCalls)
+					for _, toolCall := range message.ToolCalls {
+						span.AddEvent("tool_call", trace.WithAttributes(tracing.AttrTool.String(toolCall.Function.Name)))
+					}
 					select {
 					case <-ctx.Done():
 						log.Infof("上下文已取消，停止LLM响应处理: %v, context done, exit", ctx.Err())
@@ -159,6 +194,14 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 	return sentenceChannel, nil
 }
 
+// getModelName 获取用于统计的模型名称
+func getModelName(llmProvider LLMProvider) string {
+	if name, ok := llmProvider.GetModelInfo()["model_name"].(string); ok && name != "" {
+		return name
+	}
+	return "unknown"
+}
+
 // 判断字符串是否为数字加点号格式（如"1."、"2."等）
 func isNumberWithDot(s string) bool {
 	trimmed := strings.TrimSpace(s)
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm/mock"
+)
+
+// TestHandleLLMUsage 模型返回的 token 用量随最后一条响应返回
+func TestHandleLLMUsage(t *testing.T) {
+	provider := mock.NewMockLLMProvider(map[string]interface{}{
+		"reply": "你好。今天天气不错",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dialogue := []*schema.Message{schema.SystemMessage("你是小智"), schema.UserMessage("你好")}
+	responses, err := HandleLLMWithContextAndTools(ctx, provider, dialogue, nil, "session")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+
+	var text string
+	var ended bool
+	for resp := range responses {
+		text += resp.Text
+		if !resp.IsEnd {
+			if resp.Usage != nil {
+				t.Errorf("用量只应在最后一条响应中返回")
+			}
+			continue
+		}
+		ended = true
+		if resp.Usage == nil {
+			t.Fatalf("最后一条响应应携带用量")
+		}
+		if resp.Usage.PromptTokens != 6 || resp.Usage.CompletionTokens != 9 || resp.Usage.TotalTokens != 15 {
+			t.Errorf("用量错误: %+v", resp.Usage)
+		}
+	}
+	if !ended {
+		t.Errorf("未收到结束响应")
+	}
+	if text != "你好。今天天气不错" {
+		t.Errorf("回复内容错误: %s", text)
+	}
+}
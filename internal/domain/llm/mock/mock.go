@@ -0,0 +1,251 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// MockLLMProvider 不调用真实模型，按顺序返回配置中的回复
+// 用于会话回放和端到端测试，不依赖任何外部服务
+type MockLLMProvider struct {
+	mu        sync.Mutex
+	replies   []mockReply
+	index     int
+	callCount int
+	loop      bool          // 回复用完后是否从头开始
+	echo      bool          // 没有可用回复时复述用户最后一句话
+	chunkSize int           // 流式返回时每个分片的字数
+	delay     time.Duration // 每个分片之间的延迟，模拟生成耗时
+}
+
+// mockReply 一次LLM调用的回复，可以带工具调用
+type mockReply struct {
+	content   string
+	toolCalls []mockToolCall
+}
+
+type mockToolCall struct {
+	name      string
+	arguments string
+}
+
+// NewMockLLMProvider 创建模拟LLM
+// config: replies 回复列表（或 reply 单条回复）, loop 是否循环, echo 是否复述用户输入, chunk_size 分片字数, delay_ms 分片间延迟
+// replies 中的每一项可以是字符串，也可以是带工具调用的对象:
+//
+//	{"content": "好的", "tool_calls": [{"name": "adjust_volume", "arguments": {"volume": 50}}]}
+//
+// 每次调用LLM（包括工具调用结果返回后的再次调用）依次消耗一项
+func NewMockLLMProvider(config map[string]interface{}) *MockLLMProvider {
+	p := &MockLLMProvider{
+		replies:   parseReplies(config["replies"]),
+		chunkSize: 4,
+	}
+	if reply, ok := config["reply"].(string); ok && reply != "" {
+		p.replies = append(p.replies, mockReply{content: reply})
+	}
+	if loop, ok := config["loop"].(bool); ok {
+		p.loop = loop
+	}
+	if echo, ok := config["echo"].(bool); ok {
+		p.echo = echo
+	}
+	if chunkSize := configInt(config, "chunk_size"); chunkSize > 0 {
+		p.chunkSize = chunkSize
+	}
+	if delay := configInt(config, "delay_ms"); delay > 0 {
+		p.delay = time.Duration(delay) * time.Millisecond
+	}
+	return p
+}
+
+// next 取出下一条回复
+func (p *MockLLMProvider) next(dialogue []*schema.Message) mockReply {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.callCount++
+	if p.index >= len(p.replies) && p.loop && len(p.replies) > 0 {
+		p.index = 0
+	}
+	if p.index < len(p.replies) {
+		reply := p.replies[p.index]
+		p.index++
+		return reply
+	}
+	if p.echo {
+		for i := len(dialogue) - 1; i >= 0; i-- {
+			if dialogue[i].Role == schema.User {
+				return mockReply{content: dialogue[i].Content}
+			}
+		}
+	}
+	return mockReply{}
+}
+
+// CallCount 被调用的次数
+func (p *MockLLMProvider) CallCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.callCount
+}
+
+// ResponseWithContext 将回复按 chunk_size 分片流式返回，有工具调用时最后返回一条带 ToolCalls 的消息
+func (p *MockLLMProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	responseChan := make(chan *schema.Message, 10)
+	mock := p.next(dialogue)
+	reply := []rune(mock.content)
+	log.Debugf("模拟LLM回复, sessionID: %s, reply: %s, tool_calls: %d", sessionID, mock.content, len(mock.toolCalls))
+
+	go func() {
+		defer close(responseChan)
+		for start := 0; start < len(reply); start += p.chunkSize {
+			end := start + p.chunkSize
+			if end > len(reply) {
+				end = len(reply)
+			}
+			if p.delay > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(p.delay):
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case responseChan <- &schema.Message{Role: schema.Assistant, Content: string(reply[start:end])}:
+			}
+		}
+
+		if len(mock.toolCalls) > 0 {
+			toolCalls := make([]schema.ToolCall, 0, len(mock.toolCalls))
+			for i, toolCall := range mock.toolCalls {
+				index := i
+				toolCalls = append(toolCalls, schema.ToolCall{
+					Index: &index,
+					ID:    fmt.Sprintf("call_mock_%d_%d", p.CallCount(), i),
+					Type:  "function",
+					Function: schema.FunctionCall{
+						Name:      toolCall.name,
+						Arguments: toolCall.arguments,
+					},
+				})
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case responseChan <- &schema.Message{Role: schema.Assistant, ToolCalls: toolCalls}:
+			}
+		}
+
+		// 与真实模型一样在最后返回 token 用量, 按字数计算
+		select {
+		case <-ctx.Done():
+		case responseChan <- &schema.Message{Role: schema.Assistant, ResponseMeta: &schema.ResponseMeta{Usage: mockUsage(dialogue, reply)}}:
+		}
+	}()
+	return responseChan
+}
+
+// mockUsage 每个字计为一个 token
+func mockUsage(dialogue []*schema.Message, reply []rune) *schema.TokenUsage {
+	usage := &schema.TokenUsage{CompletionTokens: len(reply)}
+	for _, msg := range dialogue {
+		if msg != nil {
+			usage.PromptTokens += len([]rune(msg.Content))
+		}
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// ResponseWithVllm 忽略图片，直接返回下一条回复
+func (p *MockLLMProvider) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	return p.next([]*schema.Message{schema.UserMessage(text)}).content, nil
+}
+
+func (p *MockLLMProvider) GetModelInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"model_name": "mock",
+		"type":       "mock",
+	}
+}
+
+// parseReplies 解析回复列表，兼容 []string 和 json/yaml 解析后的 []interface{}
+func parseReplies(value interface{}) []mockReply {
+	var items []interface{}
+	switch v := value.(type) {
+	case []string:
+		for _, s := range v {
+			items = append(items, s)
+		}
+	case []interface{}:
+		items = v
+	}
+
+	replies := make([]mockReply, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			replies = append(replies, mockReply{content: v})
+		case map[string]interface{}:
+			replies = append(replies, parseReplyMap(v))
+		case map[interface{}]interface{}:
+			m := make(map[string]interface{}, len(v))
+			for k, val := range v {
+				m[fmt.Sprint(k)] = val
+			}
+			replies = append(replies, parseReplyMap(m))
+		}
+	}
+	return replies
+}
+
+func parseReplyMap(m map[string]interface{}) mockReply {
+	reply := mockReply{}
+	reply.content, _ = m["content"].(string)
+	toolCalls, _ := m["tool_calls"].([]interface{})
+	for _, item := range toolCalls {
+		tc, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := tc["name"].(string)
+		if name == "" {
+			continue
+		}
+		var arguments string
+		switch args := tc["arguments"].(type) {
+		case string:
+			arguments = args
+		case nil:
+			arguments = "{}"
+		default:
+			data, err := json.Marshal(args)
+			if err != nil {
+				log.Warnf("模拟LLM工具参数序列化失败: %v", err)
+				data = []byte("{}")
+			}
+			arguments = string(data)
+		}
+		reply.toolCalls = append(reply.toolCalls, mockToolCall{name: name, arguments: arguments})
+	}
+	return reply
+}
+
+func configInt(config map[string]interface{}, key string) int {
+	switch v := config[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
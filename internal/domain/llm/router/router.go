@@ -0,0 +1,422 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/window"
+	"xiaozhi-esp32-server-golang/internal/domain/metrics"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 路由原因
+const (
+	ReasonToolResult = "tool_result" // 上一条消息是工具结果, 由工具路由继续处理
+	ReasonImage      = "image"       // 用户消息带图片
+	ReasonKeyword    = "keyword"     // 命中关键词
+	ReasonClassifier = "classifier"  // 分类模型的判断
+	ReasonDefault    = "default"     // 以上都未命中
+)
+
+const defaultClassifierTimeout = 2 * time.Second
+
+const classifierPrompt = `你是语音助手的意图分类器。根据用户最后一句话，从下面的选项中选择最合适的一项，只输出选项名称，不要输出其它内容。
+选项:
+%s`
+
+// Provider 被路由的模型, llm.LLMProvider 满足此接口
+type Provider interface {
+	ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message
+	ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error)
+	GetModelInfo() map[string]interface{}
+}
+
+// Factory 根据配置创建模型, 由 llm 包传入以避免循环引用
+type Factory func(config map[string]interface{}) (Provider, error)
+
+type route struct {
+	name        string
+	config      map[string]interface{}
+	description string
+	keywords    []string
+}
+
+// RouterLLMProvider 按意图将请求分发到不同的模型, 例如闲聊使用快速便宜的模型, 需要调用工具时使用能力更强的模型
+// 选择顺序: 工具结果 -> 图片 -> 关键词 -> 分类模型 -> 默认路由
+type RouterLLMProvider struct {
+	routes            map[string]*route
+	names             []string // 排序后的路由名称, 关键词长度相同时按此顺序
+	defaultRoute      string
+	toolRoute         string
+	visionRoute       string
+	classifierRoute   string
+	classifierTimeout time.Duration
+	factory           Factory
+
+	mu        sync.Mutex
+	providers map[string]Provider
+}
+
+// NewRouterLLMProvider 创建路由模型
+// config:
+//
+//	default: 默认路由, 必填
+//	tool_route: 上一条消息是工具结果时使用的路由
+//	vision_route: 带图片的请求和 ResponseWithVllm 使用的路由
+//	classifier: 用于意图分类的路由, 为空时只按关键词匹配
+//	classifier_timeout_ms: 分类超时时间, 超时使用默认路由
+//	routes: 路由名称 -> {llm, description, keywords}
+//	  llm 为 llm 下的配置名(包含 "." 时为完整配置路径), 也可以直接写模型配置
+//	  description 提供给分类模型的说明, keywords 命中后直接使用该路由
+func NewRouterLLMProvider(config map[string]interface{}, factory Factory) (*RouterLLMProvider, error) {
+	p := &RouterLLMProvider{
+		routes:            make(map[string]*route),
+		classifierTimeout: defaultClassifierTimeout,
+		factory:           factory,
+		providers:         make(map[string]Provider),
+	}
+	p.defaultRoute, _ = config["default"].(string)
+	p.toolRoute, _ = config["tool_route"].(string)
+	p.visionRoute, _ = config["vision_route"].(string)
+	p.classifierRoute, _ = config["classifier"].(string)
+	if timeout := configInt(config["classifier_timeout_ms"]); timeout > 0 {
+		p.classifierTimeout = time.Duration(timeout) * time.Millisecond
+	}
+
+	for name, value := range toStringMap(config["routes"]) {
+		r, err := parseRoute(name, toStringMap(value))
+		if err != nil {
+			return nil, err
+		}
+		p.routes[name] = r
+		p.names = append(p.names, name)
+	}
+	sort.Strings(p.names)
+
+	if p.defaultRoute == "" {
+		return nil, fmt.Errorf("路由模型未配置 default")
+	}
+	for _, name := range []string{p.defaultRoute, p.toolRoute, p.visionRoute, p.classifierRoute} {
+		if _, ok := p.routes[name]; name != "" && !ok {
+			return nil, fmt.Errorf("路由 %s 不存在", name)
+		}
+	}
+	return p, nil
+}
+
+func parseRoute(name string, value map[string]interface{}) (*route, error) {
+	r := &route{name: name}
+	r.description, _ = value["description"].(string)
+	switch v := value["llm"].(type) {
+	case string:
+		path := v
+		if !strings.Contains(path, ".") {
+			path = "llm." + path
+		}
+		r.config = viper.GetStringMap(path)
+		if len(r.config) == 0 {
+			return nil, fmt.Errorf("路由 %s 引用的模型配置 %s 不存在", name, path)
+		}
+	default:
+		r.config = toStringMap(v)
+	}
+	llmType, _ := r.config["type"].(string)
+	if llmType == "" {
+		return nil, fmt.Errorf("路由 %s 的模型配置缺少 type", name)
+	}
+	if llmType == constants.LlmTypeRouter {
+		return nil, fmt.Errorf("路由 %s 不能嵌套路由模型", name)
+	}
+
+	switch keywords := value["keywords"].(type) {
+	case []string:
+		r.keywords = keywords
+	case []interface{}:
+		for _, keyword := range keywords {
+			if s, ok := keyword.(string); ok && s != "" {
+				r.keywords = append(r.keywords, s)
+			}
+		}
+	}
+	return r, nil
+}
+
+// provider 获取路由对应的模型, 首次使用时创建
+func (p *RouterLLMProvider) provider(name string) (Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if provider, ok := p.providers[name]; ok {
+		return provider, nil
+	}
+	r, ok := p.routes[name]
+	if !ok {
+		return nil, fmt.Errorf("路由 %s 不存在", name)
+	}
+	provider, err := p.factory(r.config)
+	if err != nil {
+		return nil, fmt.Errorf("创建路由 %s 的模型失败: %v", name, err)
+	}
+	p.providers[name] = provider
+	return provider, nil
+}
+
+// Route 为本次请求选择路由
+func (p *RouterLLMProvider) Route(ctx context.Context, sessionID string, dialogue []*schema.Message) common.RouteDecision {
+	if len(dialogue) > 0 && dialogue[len(dialogue)-1] != nil && dialogue[len(dialogue)-1].Role == schema.Tool && p.toolRoute != "" {
+		return common.RouteDecision{Route: p.toolRoute, Reason: ReasonToolResult}
+	}
+
+	input := lastUserMessage(dialogue)
+	if input == nil {
+		return common.RouteDecision{Route: p.defaultRoute, Reason: ReasonDefault}
+	}
+	if hasImage(input) && p.visionRoute != "" {
+		return common.RouteDecision{Route: p.visionRoute, Reason: ReasonImage}
+	}
+
+	text := messageText(input)
+	if name, keyword := p.matchKeyword(text); name != "" {
+		return common.RouteDecision{Route: name, Reason: ReasonKeyword, Keyword: keyword}
+	}
+
+	if p.classifierRoute != "" && text != "" {
+		startTs := time.Now()
+		name, tokens, err := p.classify(ctx, sessionID, text)
+		latency := time.Since(startTs)
+		metrics.ObserveLlmRouteClassify(latency)
+		if err != nil {
+			log.Warnf("意图分类失败, 使用默认路由, sessionID: %s, 耗时: %dms, error: %v", sessionID, latency.Milliseconds(), err)
+			// 分类失败时模型可能已经处理了请求, 同样计入用量
+			return common.RouteDecision{Route: p.defaultRoute, Reason: ReasonDefault, LatencyMs: latency.Milliseconds(), ClassifierTokens: tokens}
+		}
+		return common.RouteDecision{Route: name, Reason: ReasonClassifier, LatencyMs: latency.Milliseconds(), ClassifierTokens: tokens}
+	}
+	return common.RouteDecision{Route: p.defaultRoute, Reason: ReasonDefault}
+}
+
+// matchKeyword 选择命中关键词最长的路由
+func (p *RouterLLMProvider) matchKeyword(text string) (string, string) {
+	if text == "" {
+		return "", ""
+	}
+	text = strings.ToLower(text)
+	var matched, matchedKeyword string
+	for _, name := range p.names {
+		for _, keyword := range p.routes[name].keywords {
+			if len(keyword) > len(matchedKeyword) && strings.Contains(text, strings.ToLower(keyword)) {
+				matched, matchedKeyword = name, keyword
+			}
+		}
+	}
+	return matched, matchedKeyword
+}
+
+// classify 使用分类模型判断用户意图, 返回路由名称和消耗的 token 数
+func (p *RouterLLMProvider) classify(ctx context.Context, sessionID string, text string) (string, int64, error) {
+	provider, err := p.provider(p.classifierRoute)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var options strings.Builder
+	for _, name := range p.names {
+		if description := p.routes[name].description; description != "" {
+			options.WriteString(fmt.Sprintf("- %s: %s\n", name, description))
+		}
+	}
+	if options.Len() == 0 {
+		return "", 0, fmt.Errorf("没有配置路由说明")
+	}
+	dialogue := []*schema.Message{
+		schema.SystemMessage(fmt.Sprintf(classifierPrompt, options.String())),
+		schema.UserMessage(text),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.classifierTimeout)
+	defer cancel()
+	var output strings.Builder
+	var usage *schema.TokenUsage
+	for msg := range provider.ResponseWithContext(ctx, sessionID, dialogue, nil) {
+		if msg != nil {
+			output.WriteString(msg.Content)
+			if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+				usage = msg.ResponseMeta.Usage
+			}
+		}
+	}
+	tokens := classifierTokens(dialogue, output.String(), usage)
+	if err := ctx.Err(); err != nil {
+		return "", tokens, err
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(output.String()))
+	if _, ok := p.routes[answer]; ok {
+		return answer, tokens, nil
+	}
+	// 模型可能输出多余的文字, 选择出现位置最靠前的路由名称
+	matched, position := "", -1
+	for _, name := range p.names {
+		if i := strings.Index(answer, strings.ToLower(name)); i >= 0 && (position < 0 || i < position) {
+			matched, position = name, i
+		}
+	}
+	if matched == "" {
+		return "", tokens, fmt.Errorf("无法识别分类结果: %s", answer)
+	}
+	return matched, tokens, nil
+}
+
+// classifierTokens 优先使用模型返回的用量, 未返回时按请求和输出文本估算
+func classifierTokens(dialogue []*schema.Message, output string, usage *schema.TokenUsage) int64 {
+	if usage != nil {
+		return int64(usage.TotalTokens)
+	}
+	tokens := window.EstimateTokens(output)
+	for _, msg := range dialogue {
+		tokens += window.EstimateMessage(msg)
+	}
+	return int64(tokens)
+}
+
+// ResponseWithContext 选择路由后由对应的模型响应, 在第一条消息的 Extra 中记录路由结果
+func (p *RouterLLMProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	responseChan := make(chan *schema.Message, 10)
+
+	decision := p.Route(ctx, sessionID, dialogue)
+	provider, err := p.provider(decision.Route)
+	if err != nil && decision.Route != p.defaultRoute {
+		log.Errorf("%v, 使用默认路由", err)
+		decision = common.RouteDecision{Route: p.defaultRoute, Reason: ReasonDefault}
+		provider, err = p.provider(decision.Route)
+	}
+	if err != nil {
+		log.Errorf("%v", err)
+		close(responseChan)
+		return responseChan
+	}
+	decision.Model = modelName(provider)
+	log.Infof("LLM 路由, sessionID: %s, route: %s, model: %s, reason: %s, keyword: %s, 分类耗时: %dms",
+		sessionID, decision.Route, decision.Model, decision.Reason, decision.Keyword, decision.LatencyMs)
+
+	upstream := provider.ResponseWithContext(ctx, sessionID, dialogue, functions)
+	go func() {
+		defer close(responseChan)
+		first := true
+		for msg := range upstream {
+			if msg != nil && first {
+				first = false
+				if msg.Extra == nil {
+					msg.Extra = make(map[string]any)
+				}
+				msg.Extra[common.ExtraKeyRoute] = &decision
+			}
+			select {
+			case <-ctx.Done():
+				// 下游已退出, 继续读完上游避免其阻塞
+				for range upstream {
+				}
+				return
+			case responseChan <- msg:
+			}
+		}
+	}()
+	return responseChan
+}
+
+// ResponseWithVllm 由视觉路由识别图片, 未配置时使用默认路由
+func (p *RouterLLMProvider) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	name := p.visionRoute
+	if name == "" {
+		name = p.defaultRoute
+	}
+	provider, err := p.provider(name)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("LLM 路由, 图片识别, route: %s, model: %s", name, modelName(provider))
+	return provider.ResponseWithVllm(ctx, file, text, mimeType)
+}
+
+func (p *RouterLLMProvider) GetModelInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"model_name": constants.LlmTypeRouter,
+		"type":       constants.LlmTypeRouter,
+		"default":    p.defaultRoute,
+		"routes":     p.names,
+	}
+}
+
+func modelName(provider Provider) string {
+	if name, ok := provider.GetModelInfo()["model_name"].(string); ok {
+		return name
+	}
+	return ""
+}
+
+// lastUserMessage 本轮的用户输入
+func lastUserMessage(dialogue []*schema.Message) *schema.Message {
+	for i := len(dialogue) - 1; i >= 0; i-- {
+		if dialogue[i] != nil && dialogue[i].Role == schema.User {
+			return dialogue[i]
+		}
+	}
+	return nil
+}
+
+func messageText(msg *schema.Message) string {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	var parts []string
+	for _, part := range msg.MultiContent {
+		if part.Type == schema.ChatMessagePartTypeText {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func hasImage(msg *schema.Message) bool {
+	for _, part := range msg.MultiContent {
+		if part.Type == schema.ChatMessagePartTypeImageURL {
+			return true
+		}
+	}
+	return false
+}
+
+// toStringMap 兼容 json 和 yaml 解析后的 map
+func toStringMap(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = item
+		}
+		return result
+	}
+	return nil
+}
+
+func configInt(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
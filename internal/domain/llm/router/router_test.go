@@ -0,0 +1,177 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/mock"
+)
+
+func mockFactory(config map[string]interface{}) (Provider, error) {
+	return mock.NewMockLLMProvider(config), nil
+}
+
+func mockRoute(reply string, extra map[string]interface{}) map[string]interface{} {
+	route := map[string]interface{}{
+		"llm": map[string]interface{}{"type": "mock", "reply": reply, "loop": true},
+	}
+	for k, v := range extra {
+		route[k] = v
+	}
+	return route
+}
+
+func newTestRouter(t *testing.T, config map[string]interface{}) *RouterLLMProvider {
+	routes := map[string]interface{}{
+		"fast": mockRoute("快速回复", map[string]interface{}{
+			"description": "闲聊、问候",
+			"keywords":    []interface{}{"你好", "笑话"},
+		}),
+		"smart": mockRoute("深度回复", map[string]interface{}{
+			"description": "需要调用工具或推理",
+			"keywords":    []interface{}{"讲个笑话并解释"},
+		}),
+		"classifier": mockRoute("smart", nil),
+	}
+	cfg := map[string]interface{}{
+		"default":    "fast",
+		"tool_route": "smart",
+		"routes":     routes,
+	}
+	for k, v := range config {
+		cfg[k] = v
+	}
+	p, err := NewRouterLLMProvider(cfg, mockFactory)
+	if err != nil {
+		t.Fatalf("创建路由模型失败: %v", err)
+	}
+	return p
+}
+
+func TestRoute(t *testing.T) {
+	p := newTestRouter(t, nil)
+	ctx := context.Background()
+
+	cases := []struct {
+		name     string
+		dialogue []*schema.Message
+		route    string
+		reason   string
+	}{
+		{"关键词", []*schema.Message{schema.UserMessage("你好呀")}, "fast", ReasonKeyword},
+		{"最长关键词", []*schema.Message{schema.UserMessage("讲个笑话并解释一下")}, "smart", ReasonKeyword},
+		{"工具结果", []*schema.Message{schema.UserMessage("你好"), schema.ToolMessage("晴", "call_1")}, "smart", ReasonToolResult},
+		{"默认", []*schema.Message{schema.UserMessage("今天星期几")}, "fast", ReasonDefault},
+	}
+	for _, c := range cases {
+		decision := p.Route(ctx, "session", c.dialogue)
+		if decision.Route != c.route || decision.Reason != c.reason {
+			t.Errorf("%s: 路由错误: %+v", c.name, decision)
+		}
+	}
+}
+
+func TestRouteClassifier(t *testing.T) {
+	p := newTestRouter(t, map[string]interface{}{"classifier": "classifier", "classifier_timeout_ms": float64(1000)})
+	decision := p.Route(context.Background(), "session", []*schema.Message{schema.UserMessage("帮我查一下明天的天气")})
+	if decision.Route != "smart" || decision.Reason != ReasonClassifier {
+		t.Errorf("应使用分类模型的结果: %+v", decision)
+	}
+	if decision.ClassifierTokens <= 0 {
+		t.Errorf("应记录分类消耗的 token: %+v", decision)
+	}
+
+	// 关键词优先于分类模型
+	decision = p.Route(context.Background(), "session", []*schema.Message{schema.UserMessage("你好")})
+	if decision.Route != "fast" || decision.Reason != ReasonKeyword || decision.ClassifierTokens != 0 {
+		t.Errorf("应优先按关键词路由: %+v", decision)
+	}
+}
+
+// blockingProvider 通过无缓冲通道逐条返回消息, 结束时关闭 done
+type blockingProvider struct {
+	done chan struct{}
+}
+
+func (b *blockingProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	out := make(chan *schema.Message)
+	go func() {
+		defer close(b.done)
+		defer close(out)
+		for i := 0; i < 20; i++ {
+			out <- schema.AssistantMessage("片段", nil)
+		}
+	}()
+	return out
+}
+
+func (b *blockingProvider) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	return "", nil
+}
+
+func (b *blockingProvider) GetModelInfo() map[string]interface{} {
+	return map[string]interface{}{"model_name": "blocking"}
+}
+
+func TestResponseWithContextDrainsUpstream(t *testing.T) {
+	upstream := &blockingProvider{done: make(chan struct{})}
+	p, err := NewRouterLLMProvider(map[string]interface{}{
+		"default": "fast",
+		"routes":  map[string]interface{}{"fast": mockRoute("", nil)},
+	}, func(config map[string]interface{}) (Provider, error) {
+		return upstream, nil
+	})
+	if err != nil {
+		t.Fatalf("创建路由模型失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	responseChan := p.ResponseWithContext(ctx, "session", []*schema.Message{schema.UserMessage("你好")}, nil)
+	<-responseChan
+	// 下游不再读取后上游仍能发送完毕, 不会阻塞
+	cancel()
+	select {
+	case <-upstream.done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("下游退出后上游被阻塞")
+	}
+}
+
+func TestResponseWithContextRecordsRoute(t *testing.T) {
+	p := newTestRouter(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var text string
+	var decision *common.RouteDecision
+	for msg := range p.ResponseWithContext(ctx, "session", []*schema.Message{schema.UserMessage("讲个笑话并解释")}, nil) {
+		text += msg.Content
+		if d, ok := msg.Extra[common.ExtraKeyRoute].(*common.RouteDecision); ok {
+			decision = d
+		}
+	}
+	if text != "深度回复" {
+		t.Errorf("应由 smart 路由回复: %s", text)
+	}
+	if decision == nil || decision.Route != "smart" || decision.Model != "mock" {
+		t.Errorf("应记录路由结果: %+v", decision)
+	}
+}
+
+func TestNewRouterLLMProviderInvalid(t *testing.T) {
+	routes := map[string]interface{}{"fast": mockRoute("你好", nil)}
+	if _, err := NewRouterLLMProvider(map[string]interface{}{"routes": routes}, mockFactory); err == nil {
+		t.Errorf("未配置 default 应返回错误")
+	}
+	if _, err := NewRouterLLMProvider(map[string]interface{}{"default": "fast", "tool_route": "smart", "routes": routes}, mockFactory); err == nil {
+		t.Errorf("引用不存在的路由应返回错误")
+	}
+	nested := map[string]interface{}{"fast": map[string]interface{}{"llm": map[string]interface{}{"type": "router"}}}
+	if _, err := NewRouterLLMProvider(map[string]interface{}{"default": "fast", "routes": nested}, mockFactory); err == nil {
+		t.Errorf("不应允许嵌套路由模型")
+	}
+}
@@ -0,0 +1,91 @@
+package window
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const summaryPrompt = `你负责为语音助手压缩对话历史。请把"之前的摘要"和"新的对话"合并成一段新的摘要，供后续对话参考。
+要求：
+1. 保留用户的身份信息、偏好、提出过的请求和尚未完成的事项，以及助手做出的承诺和调用工具得到的关键结果；
+2. 省略寒暄和重复内容，用第三人称陈述，不要编造对话中没有的信息；
+3. 直接输出摘要正文，不超过%d字。`
+
+// toolResultMaxRunes 工具结果可能很长, 总结时只保留开头部分
+const toolResultMaxRunes = 200
+
+// Responder 用于生成摘要的模型, llm.LLMProvider 满足此接口
+type Responder interface {
+	ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message
+}
+
+// Summarize 将之前的摘要和较早的对话合并为新的摘要, 返回摘要和模型返回的 token 用量(可能为 nil)
+func Summarize(ctx context.Context, model Responder, sessionID string, previous string, messages []*schema.Message, maxTokens int) (string, *schema.TokenUsage, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("之前的摘要:\n")
+		transcript.WriteString(previous)
+		transcript.WriteString("\n\n")
+	}
+	transcript.WriteString("新的对话:\n")
+	for _, msg := range messages {
+		if line := formatMessage(msg); line != "" {
+			transcript.WriteString(line)
+			transcript.WriteString("\n")
+		}
+	}
+
+	dialogue := []*schema.Message{
+		schema.SystemMessage(fmt.Sprintf(summaryPrompt, maxTokens)),
+		schema.UserMessage(transcript.String()),
+	}
+
+	var summary strings.Builder
+	var usage *schema.TokenUsage
+	for msg := range model.ResponseWithContext(ctx, sessionID, dialogue, nil) {
+		if msg == nil {
+			continue
+		}
+		summary.WriteString(msg.Content)
+		if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+			usage = msg.ResponseMeta.Usage
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", usage, err
+	}
+	result := strings.TrimSpace(summary.String())
+	if result == "" {
+		return "", usage, fmt.Errorf("模型返回的摘要为空")
+	}
+	return result, usage, nil
+}
+
+func formatMessage(msg *schema.Message) string {
+	if msg == nil {
+		return ""
+	}
+	switch msg.Role {
+	case schema.User:
+		return "用户: " + msg.Content
+	case schema.Assistant:
+		var parts []string
+		if msg.Content != "" {
+			parts = append(parts, "助手: "+msg.Content)
+		}
+		for _, toolCall := range msg.ToolCalls {
+			parts = append(parts, fmt.Sprintf("助手调用工具 %s: %s", toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+		return strings.Join(parts, "\n")
+	case schema.Tool:
+		content := []rune(msg.Content)
+		if len(content) > toolResultMaxRunes {
+			content = append(content[:toolResultMaxRunes], []rune("...")...)
+		}
+		return "工具结果: " + string(content)
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package window
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+)
+
+const (
+	// messageOverhead 每条消息的角色、分隔符等固定开销
+	messageOverhead = 4
+	// DefaultMaxMessages 未配置时最多发送的历史消息条数
+	DefaultMaxMessages = 10
+)
+
+// Config 上下文窗口配置, 全局默认值在 context_window 下, 智能体可单独覆盖
+type Config struct {
+	MaxTokens        int  // 系统提示词、摘要、历史消息和本轮输入的 token 预算, 0 表示只按条数限制
+	MaxMessages      int  // 最多参与计算的历史消息条数
+	EnableSummary    bool // 超出预算时将较早的对话总结为摘要
+	SummaryMaxTokens int  // 摘要的最大长度
+}
+
+// LoadConfig 读取全局配置并用智能体配置覆盖, 每次请求时读取以支持热更新
+func LoadConfig(agentConfig map[string]interface{}) Config {
+	cfg := Config{
+		MaxTokens:        viper.GetInt("context_window.max_tokens"),
+		MaxMessages:      viper.GetInt("context_window.max_messages"),
+		EnableSummary:    viper.GetBool("context_window.enable_summary"),
+		SummaryMaxTokens: viper.GetInt("context_window.summary_max_tokens"),
+	}
+	if v, ok := toInt(agentConfig["max_tokens"]); ok {
+		cfg.MaxTokens = v
+	}
+	if v, ok := toInt(agentConfig["max_messages"]); ok {
+		cfg.MaxMessages = v
+	}
+	if v, ok := agentConfig["enable_summary"].(bool); ok {
+		cfg.EnableSummary = v
+	}
+	if v, ok := toInt(agentConfig["summary_max_tokens"]); ok {
+		cfg.SummaryMaxTokens = v
+	}
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = DefaultMaxMessages
+	}
+	if cfg.SummaryMaxTokens <= 0 {
+		cfg.SummaryMaxTokens = 300
+	}
+	return cfg
+}
+
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// EstimateTokens 粗略估算文本的 token 数, 中日韩文字按每字 1 个, 其它字符按每 4 个 1 个
+func EstimateTokens(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			cjk++
+		} else if !unicode.IsSpace(r) {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// EstimateMessage 估算单条消息的 token 数, 包括工具调用的名称和参数
+func EstimateMessage(msg *schema.Message) int {
+	if msg == nil {
+		return 0
+	}
+	tokens := messageOverhead + EstimateTokens(msg.Content)
+	for _, toolCall := range msg.ToolCalls {
+		tokens += messageOverhead + EstimateTokens(toolCall.Function.Name) + EstimateTokens(toolCall.Function.Arguments)
+	}
+	return tokens
+}
+
+// Result 构建结果
+type Result struct {
+	Messages []*schema.Message // 发送给 LLM 的消息
+	Tokens   int               // Messages 的估算 token 数
+	Dropped  int               // 超出预算未发送的历史消息条数
+	// Fold 建议合并到摘要中的较早消息, 未开启摘要或未超出预算时为空
+	// 为避免每轮都触发总结, 超出预算时会多合并一些, 使剩余的历史消息不超过预算的一半
+	Fold []*schema.Message
+}
+
+// Build 按 token 预算组装消息: 系统提示词(附带摘要) + 尽可能多的最近历史消息 + 本轮输入
+// 带工具调用的助手消息和对应的工具结果作为整体保留或丢弃, 不会拆开
+func Build(cfg Config, systemPrompt string, summary string, history []*schema.Message, input *schema.Message) Result {
+	if summary != "" {
+		systemPrompt += fmt.Sprintf("\n之前的对话摘要: \n%s", summary)
+	}
+	system := schema.SystemMessage(systemPrompt)
+
+	groups := groupMessages(history)
+
+	fixed := EstimateMessage(system) + EstimateMessage(input)
+	budget := cfg.MaxTokens - fixed
+
+	// 从最近的消息开始向前选取, 同时受 token 预算和条数限制
+	start := len(groups)
+	used, count := 0, 0
+	for start > 0 {
+		g := groups[start-1]
+		if cfg.MaxTokens > 0 && used+g.tokens > budget {
+			break
+		}
+		if cfg.MaxMessages > 0 && count+len(g.messages) > cfg.MaxMessages {
+			break
+		}
+		used += g.tokens
+		count += len(g.messages)
+		start--
+	}
+
+	result := Result{Messages: []*schema.Message{system}}
+	for _, g := range groups[start:] {
+		result.Messages = append(result.Messages, g.messages...)
+	}
+	if input != nil {
+		result.Messages = append(result.Messages, input)
+	}
+	result.Tokens = fixed + used
+	for _, g := range groups[:start] {
+		result.Dropped += len(g.messages)
+	}
+
+	if cfg.EnableSummary && start > 0 {
+		// 合并到剩余消息的 token 数和条数都不超过限制的一半, 至少合并所有被丢弃的消息, 最近的一组始终保留
+		fold := start
+		remaining, remainingCount := used, count
+		for fold < len(groups)-1 && ((cfg.MaxTokens > 0 && remaining > budget/2) || remainingCount > cfg.MaxMessages/2) {
+			remaining -= groups[fold].tokens
+			remainingCount -= len(groups[fold].messages)
+			fold++
+		}
+		for _, g := range groups[:fold] {
+			result.Fold = append(result.Fold, g.messages...)
+		}
+	}
+	return result
+}
+
+type messageGroup struct {
+	messages []*schema.Message
+	tokens   int
+}
+
+// groupMessages 将带工具调用的助手消息与其后的工具结果分为一组, 其它消息各自一组
+func groupMessages(messages []*schema.Message) []messageGroup {
+	var groups []messageGroup
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		if msg.Role == schema.Tool && len(groups) > 0 {
+			last := &groups[len(groups)-1]
+			if first := last.messages[0]; first.Role == schema.Assistant && len(first.ToolCalls) > 0 {
+				last.messages = append(last.messages, msg)
+				last.tokens += EstimateMessage(msg)
+				continue
+			}
+		}
+		groups = append(groups, messageGroup{messages: []*schema.Message{msg}, tokens: EstimateMessage(msg)})
+	}
+	return groups
+}
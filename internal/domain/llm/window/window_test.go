@@ -0,0 +1,160 @@
+package window
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func toolCallMessage(id string) *schema.Message {
+	return schema.AssistantMessage("", []schema.ToolCall{{
+		ID:       id,
+		Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`},
+	}})
+}
+
+// 每条消息 4 + 10 = 14 个 token
+func turn(user, assistant string) []*schema.Message {
+	return []*schema.Message{
+		schema.UserMessage(strings.Repeat(user, 10)),
+		schema.AssistantMessage(strings.Repeat(assistant, 10), nil),
+	}
+}
+
+func TestBuildWithinBudget(t *testing.T) {
+	var history []*schema.Message
+	history = append(history, turn("一", "二")...)
+	history = append(history, turn("三", "四")...)
+
+	result := Build(Config{MaxTokens: 1000, MaxMessages: 50}, "你是小智", "", history, schema.UserMessage("你好"))
+	if len(result.Messages) != 6 || result.Dropped != 0 || len(result.Fold) != 0 {
+		t.Fatalf("预算内应保留全部消息: %d, dropped: %d", len(result.Messages), result.Dropped)
+	}
+	if result.Messages[0].Role != schema.System || result.Messages[5].Content != "你好" {
+		t.Errorf("消息顺序错误")
+	}
+}
+
+func TestBuildOverBudget(t *testing.T) {
+	var history []*schema.Message
+	for i := 0; i < 4; i++ {
+		history = append(history, turn("问", "答")...)
+	}
+	system := "你是小智"
+	input := schema.UserMessage("你好")
+	fixed := EstimateMessage(schema.SystemMessage(system)) + EstimateMessage(input)
+
+	// 只够放 3 条历史消息
+	cfg := Config{MaxTokens: fixed + 14*3 + 5, MaxMessages: 50}
+	result := Build(cfg, system, "", history, input)
+	if len(result.Messages) != 5 || result.Dropped != 5 {
+		t.Fatalf("应只保留最近 3 条历史消息: %d, dropped: %d", len(result.Messages), result.Dropped)
+	}
+	if result.Tokens > cfg.MaxTokens {
+		t.Errorf("超出预算: %d > %d", result.Tokens, cfg.MaxTokens)
+	}
+	if len(result.Fold) != 0 {
+		t.Errorf("未开启摘要时不应合并")
+	}
+
+	// 开启摘要后合并到剩余不超过预算的一半
+	cfg.EnableSummary = true
+	result = Build(cfg, system, "用户叫小明", history, input)
+	if len(result.Fold) != 7 {
+		t.Errorf("应合并 7 条消息, 实际: %d", len(result.Fold))
+	}
+	if !strings.Contains(result.Messages[0].Content, "用户叫小明") {
+		t.Errorf("系统提示词应包含摘要")
+	}
+
+	// 条数限制
+	result = Build(Config{MaxMessages: 4}, system, "", history, input)
+	if len(result.Messages) != 6 || result.Dropped != 4 {
+		t.Errorf("应只保留 4 条历史消息: %d, dropped: %d", len(result.Messages), result.Dropped)
+	}
+}
+
+// TestBuildKeepsToolPairs 工具调用和工具结果不会被拆开
+func TestBuildKeepsToolPairs(t *testing.T) {
+	history := []*schema.Message{
+		schema.UserMessage("北京天气怎么样"),
+		toolCallMessage("call_1"),
+		schema.ToolMessage(strings.Repeat("晴", 40), "call_1"),
+		schema.AssistantMessage("北京今天晴", nil),
+	}
+	system := "你是小智"
+	fixed := EstimateMessage(schema.SystemMessage(system))
+	last := EstimateMessage(history[3])
+	toolResult := EstimateMessage(history[2])
+
+	// 预算够放最后一条和工具结果, 但不够放工具调用
+	cfg := Config{MaxTokens: fixed + last + toolResult + 1, MaxMessages: 50}
+	result := Build(cfg, system, "", history, nil)
+	for _, msg := range result.Messages {
+		if msg.Role == schema.Tool {
+			t.Fatalf("工具结果不应脱离工具调用单独保留")
+		}
+	}
+	if len(result.Messages) != 2 || result.Dropped != 3 {
+		t.Errorf("应只保留最后一条回复: %d, dropped: %d", len(result.Messages), result.Dropped)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg := LoadConfig(map[string]interface{}{
+		"max_tokens":     float64(2000),
+		"enable_summary": true,
+	})
+	if cfg.MaxTokens != 2000 || !cfg.EnableSummary {
+		t.Errorf("智能体配置未生效: %+v", cfg)
+	}
+	if cfg.MaxMessages != 10 || cfg.SummaryMaxTokens != 300 {
+		t.Errorf("默认值错误: %+v", cfg)
+	}
+}
+
+type fakeModel struct {
+	dialogue []*schema.Message
+	reply    string
+}
+
+func (m *fakeModel) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	m.dialogue = dialogue
+	ch := make(chan *schema.Message, 2)
+	ch <- schema.AssistantMessage(m.reply, nil)
+	ch <- &schema.Message{Role: schema.Assistant, ResponseMeta: &schema.ResponseMeta{Usage: &schema.TokenUsage{TotalTokens: 100}}}
+	close(ch)
+	return ch
+}
+
+func TestSummarize(t *testing.T) {
+	model := &fakeModel{reply: " 用户叫小明，询问了北京天气，今天晴。 "}
+	messages := []*schema.Message{
+		schema.UserMessage("我叫小明"),
+		toolCallMessage("call_1"),
+		schema.ToolMessage(strings.Repeat("晴", 300), "call_1"),
+		schema.AssistantMessage("北京今天晴", nil),
+	}
+	summary, usage, err := Summarize(context.Background(), model, "session", "用户喜欢听故事", messages, 200)
+	if err != nil {
+		t.Fatalf("总结失败: %v", err)
+	}
+	if summary != "用户叫小明，询问了北京天气，今天晴。" {
+		t.Errorf("摘要错误: %q", summary)
+	}
+	if usage == nil || usage.TotalTokens != 100 {
+		t.Errorf("应返回模型的用量: %+v", usage)
+	}
+
+	prompt := model.dialogue[1].Content
+	for _, want := range []string{"用户喜欢听故事", "用户: 我叫小明", "助手调用工具 get_weather", "助手: 北京今天晴"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("总结请求缺少 %q: %s", want, prompt)
+		}
+	}
+	if strings.Count(prompt, "晴") > toolResultMaxRunes+10 {
+		t.Errorf("工具结果应被截断")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -38,6 +39,7 @@ type GlobalMCPManager struct {
 	cancel        context.CancelFunc
 	reconnectConf ReconnectConfig
 	httpClient    *http.Client
+	monitoring    atomic.Bool
 }
 
 // ReconnectConfig 重连配置
@@ -125,7 +127,7 @@ func (g *GlobalMCPManager) Start() error {
 	log.Infof("成功连接了 %d 个MCP服务器", connectedCount)
 
 	// 启动监控goroutine
-	go g.monitorConnections()
+	g.startMonitor()
 
 	log.Info("全局MCP管理器已启动")
 	return nil
@@ -151,6 +153,79 @@ func (g *GlobalMCPManager) Stop() error {
 	return nil
 }
 
+// Reload 配置热更新后重新加载 mcp.global, 只重连新增或配置发生变化的服务器
+func (g *GlobalMCPManager) Reload() error {
+	var serverConfigs []MCPServerConfig
+	if viper.GetBool("mcp.global.enabled") {
+		if err := viper.UnmarshalKey("mcp.global.servers", &serverConfigs); err != nil {
+			return fmt.Errorf("解析MCP服务器配置失败: %v", err)
+		}
+	}
+
+	desired := make(map[string]MCPServerConfig, len(serverConfigs))
+	for _, config := range serverConfigs {
+		if config.Enabled && config.Name != "" {
+			desired[config.Name] = config
+		}
+	}
+
+	g.mu.Lock()
+	g.reconnectConf = ReconnectConfig{
+		Interval:    time.Duration(viper.GetInt("mcp.global.reconnect_interval")) * time.Second,
+		MaxAttempts: viper.GetInt("mcp.global.max_reconnect_attempts"),
+	}
+	current := make(map[string]*MCPServerConnection, len(g.servers))
+	for name, conn := range g.servers {
+		current[name] = conn
+	}
+	g.mu.Unlock()
+
+	for name, conn := range current {
+		if config, ok := desired[name]; ok && config == conn.config {
+			continue
+		}
+		log.Infof("MCP服务器 %s 配置已删除或变更, 断开连接", name)
+		g.removeServer(name, conn)
+	}
+
+	for name, config := range desired {
+		if conn, ok := current[name]; ok && conn.config == config {
+			continue
+		}
+		go func(config MCPServerConfig) {
+			if err := g.connectToServer(config); err != nil {
+				log.Errorf("连接到MCP服务器 %s 失败: %v", config.Name, err)
+			}
+		}(config)
+	}
+
+	if len(desired) > 0 {
+		g.startMonitor()
+	}
+	return nil
+}
+
+// removeServer 断开并移除服务器及其工具
+func (g *GlobalMCPManager) removeServer(name string, conn *MCPServerConnection) {
+	g.mu.Lock()
+	if g.servers[name] == conn {
+		delete(g.servers, name)
+	}
+	g.mu.Unlock()
+
+	if err := conn.disconnect(); err != nil {
+		log.Errorf("断开MCP服务器 %s 连接失败: %v", name, err)
+	}
+	g.updateGlobalTools(name, nil)
+}
+
+// startMonitor 启动连接监控, 只启动一次
+func (g *GlobalMCPManager) startMonitor() {
+	if g.monitoring.CompareAndSwap(false, true) {
+		go g.monitorConnections()
+	}
+}
+
 // createFailedConnection 创建失败的连接对象用于后续重连
 func (g *GlobalMCPManager) createFailedConnection(config MCPServerConfig) {
 	conn := &MCPServerConnection{
@@ -383,6 +458,20 @@ func (g *GlobalMCPManager) GetAllTools() map[string]tool.InvokableTool {
 	return result
 }
 
+// GetServerStatus 获取各MCP服务器的连接状态
+func (g *GlobalMCPManager) GetServerStatus() map[string]bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	status := make(map[string]bool, len(g.servers))
+	for name, conn := range g.servers {
+		conn.mu.RLock()
+		status[name] = conn.connected
+		conn.mu.RUnlock()
+	}
+	return status
+}
+
 // GetToolByName 根据名称获取工具
 func (g *GlobalMCPManager) GetToolByName(name string) (tool.InvokableTool, bool) {
 	g.mu.RLock()
@@ -411,6 +500,7 @@ func isSessionClosedError(err error) bool {
 func (g *GlobalMCPManager) monitorConnections() {
 	pingTicker := time.NewTicker(20 * time.Second) // 每60秒ping一次
 	defer pingTicker.Stop()
+	defer g.monitoring.Store(false)
 
 	for {
 		select {
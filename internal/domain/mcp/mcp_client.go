@@ -5,13 +5,36 @@ import (
 
 	"github.com/cloudwego/eino/components/tool"
 	mcp_go "github.com/mark3labs/mcp-go/mcp"
+	"github.com/spf13/viper"
 )
 
-func GetToolByName(deviceId string, toolName string) (tool.InvokableTool, bool) {
-	// 优先从本地管理器获取
+// RemoteToolsProvider 集群模式下获取智能体连接在其它节点上的 ws endpoint MCP 工具
+type RemoteToolsProvider func(agentId string) map[string]tool.InvokableTool
+
+var remoteToolsProvider RemoteToolsProvider
+
+// SetRemoteToolsProvider 设置其它节点工具的获取方式, 与本节点同名的工具以本节点为准
+func SetRemoteToolsProvider(provider RemoteToolsProvider) {
+	remoteToolsProvider = provider
+}
+
+// IsLocalToolEnabledForAgent 本地工具是否对智能体启用
+// 优先使用 local_mcp.agents.<agentId>.<toolName>, 智能体未配置时使用全局开关 local_mcp.<toolName>, 都未配置时启用
+func IsLocalToolEnabledForAgent(agentId string, toolName string) bool {
+	if agentId != "" {
+		if key := "local_mcp.agents." + agentId + "." + toolName; viper.IsSet(key) {
+			return viper.GetBool(key)
+		}
+	}
+	key := "local_mcp." + toolName
+	return !viper.IsSet(key) || viper.GetBool(key)
+}
+
+func GetToolByName(deviceId string, agentId string, toolName string) (tool.InvokableTool, bool) {
+	// 优先从本地管理器获取, 对智能体关闭的本地工具不可调用
 	localManager := GetLocalMCPManager()
 	tool, ok := localManager.GetToolByName(toolName)
-	if ok {
+	if ok && IsLocalToolEnabledForAgent(agentId, toolName) {
 		return tool, ok
 	}
 
@@ -50,6 +73,9 @@ func GetToolsByDeviceId(deviceId string, agentId string) (map[string]tool.Invoka
 	localManager := GetLocalMCPManager()
 	localTools := localManager.GetAllTools()
 	for toolName, tool := range localTools {
+		if !IsLocalToolEnabledForAgent(agentId, toolName) {
+			continue
+		}
 		retTools[toolName] = tool
 	}
 	log.Infof("从本地管理器获取到 %d 个工具", len(localTools))
@@ -77,6 +103,17 @@ func GetToolsByDeviceId(deviceId string, agentId string) (map[string]tool.Invoka
 		}
 	}
 	log.Infof("从设备 %s 获取到 %d 个工具", deviceId, len(deviceTools))
+
+	// 集群模式下, 智能体的 ws endpoint MCP 可能连接在其它节点上
+	if remoteToolsProvider != nil && agentId != "" {
+		remoteTools := remoteToolsProvider(agentId)
+		for toolName, tool := range remoteTools {
+			if _, exists := retTools[toolName]; !exists {
+				retTools[toolName] = tool
+			}
+		}
+		log.Infof("从其它节点获取到智能体 %s 的 %d 个工具", agentId, len(remoteTools))
+	}
 	log.Infof("设备 %s 总共获取到 %d 个工具", deviceId, len(retTools))
 
 	return retTools, nil
@@ -86,6 +123,11 @@ func GetWsEndpointMcpTools(agentId string) (map[string]tool.InvokableTool, error
 	return mcpClientPool.GetWsEndpointMcpTools(agentId)
 }
 
+// GetWsEndpointAgentIds 当前节点上有 ws endpoint MCP 连接的智能体
+func GetWsEndpointAgentIds() []string {
+	return mcpClientPool.GetWsEndpointAgentIds()
+}
+
 func GetAudioResourceByTool(tool McpTool, resourceLink mcp_go.ResourceLink) (mcp_go.ReadResourceResult, error) {
 	/*client := tool.GetClient()
 	resourceRequest := mcp_go.ReadResourceRequest{
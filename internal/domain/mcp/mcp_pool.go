@@ -76,6 +76,22 @@ func (p *McpClientPool) GetWsEndpointMcpTools(agentId string) (map[string]tool.I
 	return retTools, nil
 }
 
+// GetWsEndpointAgentIds 当前有 ws endpoint MCP 连接的智能体
+func (p *McpClientPool) GetWsEndpointAgentIds() []string {
+	var agentIds []string
+	for agentId, client := range p.device2McpClient.Items() {
+		hasWsEndpoint := false
+		client.wsEndPointMcp.Range(func(_, _ interface{}) bool {
+			hasWsEndpoint = true
+			return false
+		})
+		if hasWsEndpoint {
+			agentIds = append(agentIds, agentId)
+		}
+	}
+	return agentIds
+}
+
 func (p *McpClientPool) checkOffline() {
 	for _, client := range p.device2McpClient.Items() {
 		// 检查WebSocket端点MCP连接
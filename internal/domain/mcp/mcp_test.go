@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cloudwego/eino/schema"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -44,16 +45,13 @@ func TestGlobalMCPManager_StartStop(t *testing.T) {
 }
 
 func TestMCPTool_Info(t *testing.T) {
-	tool := &mcpTool{
-		name:        "test_tool",
-		description: "测试工具",
-		inputSchema: map[string]interface{}{
-			"type": "object",
-			"properties": map[string]interface{}{
-				"query": map[string]interface{}{
-					"type": "string",
-				},
-			},
+	tool := &McpTool{
+		info: &schema.ToolInfo{
+			Name: "test_tool",
+			Desc: "测试工具",
+			ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+				"query": {Type: schema.String},
+			}),
 		},
 		serverName: "test_server",
 		client:     nil, // 测试中不需要真实客户端
@@ -67,12 +65,10 @@ func TestMCPTool_Info(t *testing.T) {
 }
 
 func TestMCPTool_InvokableRun(t *testing.T) {
-	tool := &mcpTool{
-		name:        "test_tool",
-		description: "测试工具",
-		inputSchema: map[string]interface{}{},
-		serverName:  "test_server",
-		client:      nil, // 测试中不需要真实客户端
+	tool := &McpTool{
+		info:       &schema.ToolInfo{Name: "test_tool", Desc: "测试工具"},
+		serverName: "test_server",
+		client:     nil, // 测试中不需要真实客户端
 	}
 
 	// 这个测试会失败，因为客户端为nil
@@ -179,12 +175,8 @@ func TestMCPGoStructures(t *testing.T) {
 
 // 创建测试工具
 func TestMCPTool_InvokableRun_NewTool(t *testing.T) {
-	testTool := &mcpTool{
-		name:        "test_tool",
-		description: "测试工具",
-		inputSchema: map[string]interface{}{
-			"type": "object",
-		},
+	testTool := &McpTool{
+		info:       &schema.ToolInfo{Name: "test_tool", Desc: "测试工具"},
 		serverName: "test_server",
 		client:     nil, // 测试中不需要真实客户端
 	}
@@ -194,3 +186,51 @@ func TestMCPTool_InvokableRun_NewTool(t *testing.T) {
 	_, err := testTool.InvokableRun(context.Background(), `{"query": "test"}`)
 	assert.Error(t, err) // 预期会有网络错误
 }
+
+func TestIsLocalToolEnabledForAgent(t *testing.T) {
+	previous := viper.Get("local_mcp")
+	t.Cleanup(func() { viper.Set("local_mcp", previous) })
+	viper.Set("local_mcp", map[string]interface{}{
+		"forget_memory": false,
+		"recall_memory": true,
+		"agents": map[string]interface{}{
+			"agent1": map[string]interface{}{"forget_memory": true, "recall_memory": false},
+		},
+	})
+
+	// 智能体配置优先于全局开关
+	assert.True(t, IsLocalToolEnabledForAgent("agent1", "forget_memory"), "智能体可以开启全局关闭的工具")
+	assert.False(t, IsLocalToolEnabledForAgent("agent1", "recall_memory"), "智能体可以关闭全局开启的工具")
+	// 智能体未配置时使用全局开关, 都未配置时启用
+	assert.False(t, IsLocalToolEnabledForAgent("agent2", "forget_memory"))
+	assert.False(t, IsLocalToolEnabledForAgent("", "forget_memory"))
+	assert.True(t, IsLocalToolEnabledForAgent("agent2", "recall_memory"))
+	assert.True(t, IsLocalToolEnabledForAgent("agent1", "search_knowledge"), "未配置的工具默认启用")
+}
+
+func TestGetToolByNameLocalToolEnabled(t *testing.T) {
+	previous := viper.Get("local_mcp")
+	t.Cleanup(func() { viper.Set("local_mcp", previous) })
+	viper.Set("local_mcp", map[string]interface{}{
+		"test_local_tool": false,
+		"agents": map[string]interface{}{
+			"agent1": map[string]interface{}{"test_local_tool": true},
+		},
+	})
+
+	handler := func(ctx context.Context, argumentsInJSON string) (string, error) { return "ok", nil }
+	require.NoError(t, GetLocalMCPManager().RegisterToolFunc("test_local_tool", "测试工具", struct{}{}, handler))
+	t.Cleanup(func() { GetLocalMCPManager().UnregisterTool("test_local_tool") })
+
+	_, ok := GetToolByName("dev", "agent1", "test_local_tool")
+	assert.True(t, ok, "智能体开启的工具应可以调用")
+	_, ok = GetToolByName("dev", "agent2", "test_local_tool")
+	assert.False(t, ok, "全局关闭的工具不应可以调用")
+
+	tools, err := GetToolsByDeviceId("dev", "agent1")
+	require.NoError(t, err)
+	assert.Contains(t, tools, "test_local_tool")
+	tools, err = GetToolsByDeviceId("dev", "agent2")
+	require.NoError(t, err)
+	assert.NotContains(t, tools, "test_local_tool")
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 
+	"xiaozhi-esp32-server-golang/internal/domain/memory/llm_memory"
 	"xiaozhi-esp32-server-golang/internal/domain/memory/mem0"
 	"xiaozhi-esp32-server-golang/internal/domain/memory/memobase"
 	"xiaozhi-esp32-server-golang/internal/domain/memory/nomemo"
+	"xiaozhi-esp32-server-golang/internal/domain/memory/vector"
 
 	"github.com/cloudwego/eino/schema"
 )
@@ -33,6 +35,20 @@ type MemoryProvider interface {
 	ResetMemory(ctx context.Context, agentId string) error
 }
 
+// MemoryForgetter 支持按内容删除记忆的提供者可选实现的接口
+type MemoryForgetter interface {
+	// Forget 删除与 query 相关的记忆, 返回删除的条数
+	Forget(ctx context.Context, agentId string, query string) (int, error)
+}
+
+// MemoryRecaller 记忆工具主动检索和记住时使用的可选接口, 不受每轮对话前检索开关和自动保存条件(如最少字数)的限制
+type MemoryRecaller interface {
+	// Recall 检索与 query 相关的记忆
+	Recall(ctx context.Context, agentId string, query string, topK int) (string, error)
+	// Remember 保存用户明确要求记住的内容
+	Remember(ctx context.Context, agentId string, fact string) error
+}
+
 // MemoryType 记忆类型
 type MemoryType string
 
@@ -40,6 +56,8 @@ const (
 	MemoryTypeNone     MemoryType = "nomemo"
 	MemoryTypeMemobase MemoryType = "memobase" // Memobase 长期记忆
 	MemoryTypeMem0     MemoryType = "mem0"     // Mem0 记忆服务
+	MemoryTypeLLM      MemoryType = "llm"      // 基于 Redis 的摘要和 BM25 搜索, 不依赖外部记忆服务
+	MemoryTypeVector   MemoryType = "vector"   // 本地向量记忆, 通过 /v1/embeddings 接口计算向量
 )
 
 // GetProvider 获取指定类型的记忆提供者
@@ -59,6 +77,10 @@ func GetProviderByType(memoryType MemoryType, config map[string]interface{}) (Me
 		return memobase.GetWithConfig(config)
 	case MemoryTypeMem0:
 		return mem0.GetMem0ClientWithConfig(config)
+	case MemoryTypeLLM:
+		return llm_memory.NewProvider(config)
+	case MemoryTypeVector:
+		return vector.NewProvider(config)
 	default:
 		return nil, fmt.Errorf("unsupported memory type: %v", memoryType)
 	}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/cloudwego/eino/schema"
@@ -27,6 +28,10 @@ type Memory struct {
 	redisClient *redis.Client
 	keyPrefix   string
 	sync.RWMutex
+
+	summaryModel     llm.LLMProvider // 生成记忆摘要的模型, 首次使用时创建
+	summaryModelName string
+	summarizing      sync.Map // 正在生成摘要的 memoryID
 }
 
 // Get 获取记忆体实例
@@ -151,6 +156,21 @@ func (m *Memory) getMemoryKey(deviceID string) string {
 	return fmt.Sprintf("%s:llm:%s", m.keyPrefix, deviceID)
 }
 
+// getTurnsKey 生成长期记忆消息的 Redis key, memoryID 为智能体ID或设备ID
+func (m *Memory) getTurnsKey(memoryID string) string {
+	return fmt.Sprintf("%s:llm:memory:%s", m.keyPrefix, memoryID)
+}
+
+// getSummaryKey 生成长期记忆摘要的 Redis key
+func (m *Memory) getSummaryKey(memoryID string) string {
+	return fmt.Sprintf("%s:llm:summary:%s", m.keyPrefix, memoryID)
+}
+
+// getDialogueSummaryKey 生成设备对话历史中较早对话摘要的 Redis key
+func (m *Memory) getDialogueSummaryKey(deviceID string) string {
+	return fmt.Sprintf("%s:llm:dialogue_summary:%s", m.keyPrefix, deviceID)
+}
+
 // getSystemPromptKey 生成设备对应的系统 prompt 的 Redis key
 func (m *Memory) getSystemPromptKey(deviceID string) string {
 	return fmt.Sprintf("%s:llm:system:%s", m.keyPrefix, deviceID)
@@ -244,6 +264,35 @@ func (m *Memory) SetSystemPrompt(ctx context.Context, deviceID string, prompt st
 	return m.redisClient.Set(ctx, key, prompt, 0).Err()
 }
 
+// SetDialogueSummary 保存已经从对话历史中移除的较早对话的摘要, 重新连接后与历史消息一起加载
+func (m *Memory) SetDialogueSummary(ctx context.Context, deviceID string, summary string) error {
+	if m.redisClient == nil {
+		log.Log().Warn("redis client is nil")
+		return nil
+	}
+
+	key := m.getDialogueSummaryKey(deviceID)
+	return m.redisClient.Set(ctx, key, summary, 0).Err()
+}
+
+// GetDialogueSummary 获取设备较早对话的摘要, 没有时返回空字符串
+func (m *Memory) GetDialogueSummary(ctx context.Context, deviceID string) (string, error) {
+	if m.redisClient == nil {
+		log.Log().Warn("redis client is nil")
+		return "", nil
+	}
+
+	key := m.getDialogueSummaryKey(deviceID)
+	result, err := m.redisClient.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get dialogue summary failed: %w", err)
+	}
+	return result, nil
+}
+
 // GetSystemPrompt 获取设备的系统 prompt
 func (m *Memory) GetSystemPrompt(ctx context.Context, deviceID string) (schema.Message, error) {
 	if m.redisClient == nil {
@@ -274,9 +323,9 @@ func (m *Memory) ResetMemory(ctx context.Context, deviceID string) error {
 		return nil
 	}
 
-	// 删除对话历史
+	// 删除对话历史和摘要
 	historyKey := m.getMemoryKey(deviceID)
-	if err := m.redisClient.Del(ctx, historyKey).Err(); err != nil {
+	if err := m.redisClient.Del(ctx, historyKey, m.getDialogueSummaryKey(deviceID)).Err(); err != nil {
 		return fmt.Errorf("delete history failed: %w", err)
 	}
 
@@ -322,26 +371,3 @@ func (m *Memory) RemoveOldMessages(ctx context.Context, deviceID string, before
 
 	return m.redisClient.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("%f", score)).Err()
 }
-
-// Summary 获取对话的摘要
-func (m *Memory) GetSummary(ctx context.Context, deviceID string) (string, error) {
-	return "", nil
-}
-
-// SetSummary 设置对话的摘要
-func (m *Memory) SetSummary(ctx context.Context, deviceID string, summary string) error {
-	return nil
-}
-
-// 进行总结
-func (m *Memory) Summary(ctx context.Context, deviceID string, msgList []schema.Message) (string, error) {
-	return "", nil
-}
-
-func (m *Memory) GetContext(ctx context.Context, deviceID string, agentID string, maxToken int) (string, error) {
-	return "", nil
-}
-
-func (m *Memory) Search(ctx context.Context, deviceID string, query string, topK int, timeRangeDays int64) (string, error) {
-	return "", nil
-}
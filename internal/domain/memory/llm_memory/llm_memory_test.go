@@ -0,0 +1,144 @@
+package llm_memory
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cloudwego/eino/schema"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTokenize(t *testing.T) {
+	got := strings.Join(tokenize("我喜欢Go语言!"), ",")
+	if got != "我,我喜,喜,喜欢,欢,go,语,语言,言" {
+		t.Errorf("分词结果错误: %s", got)
+	}
+}
+
+func TestRankBM25(t *testing.T) {
+	docs := []string{
+		"今天天气怎么样\n今天北京晴",
+		"我家的猫叫咪咪\n咪咪这个名字真可爱",
+		"给我讲个故事\n从前有座山",
+		"咪咪今天不吃饭\n可能是天气太热了",
+	}
+	ranked := rankBM25("我的猫叫什么名字", docs, 2)
+	if len(ranked) != 2 || ranked[0] != 1 {
+		t.Fatalf("最相关的应为第 2 条: %v", ranked)
+	}
+	if got := rankBM25("音乐", docs, 5); len(got) != 0 {
+		t.Errorf("没有共同词时不应返回结果: %v", got)
+	}
+}
+
+func TestFormatContext(t *testing.T) {
+	summary := `{
+		"时空档案": {
+			"身份图谱": {"现用名": "小明", "特征标记": ["北京", "程序员"]},
+			"记忆立方": [
+				{"事件": "养了一只猫", "时间戳": "2024-03-01", "情感值": 0.5},
+				{"事件": "入职新公司", "时间戳": "2024-03-20", "情感值": 0.9}
+			]
+		},
+		"待响应": {"紧急事项": ["明天早上提醒开会"], "潜在关怀": []},
+		"高光语录": ["今天真开心"]
+	}`
+	context := formatContext(summary, 0)
+	lines := strings.Split(context, "\n")
+	want := []string{
+		"- 用户名字: 小明, 特征: 北京、程序员",
+		"- 待办: 明天早上提醒开会",
+		"- 经历: 入职新公司(2024-03-20)",
+		"- 经历: 养了一只猫(2024-03-01)",
+		"- 用户说过: 今天真开心",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("关键信息条数错误: %s", context)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("第 %d 条错误: %s", i+1, lines[i])
+		}
+	}
+
+	// 按 token 限制截断
+	if limited := formatContext(summary, 25); strings.Count(limited, "\n") != 1 {
+		t.Errorf("应只保留前 2 条: %s", limited)
+	}
+	// 非约定结构按原文截断
+	if raw := formatContext("用户叫小明，喜欢猫", 4); raw != "用户叫小" {
+		t.Errorf("原文截断错误: %s", raw)
+	}
+}
+
+func TestTrimCodeFence(t *testing.T) {
+	if got := trimCodeFence("```json\n{\"a\": 1}\n```"); got != `{"a": 1}` {
+		t.Errorf("去掉代码块标记失败: %s", got)
+	}
+}
+
+// TestTurnMemberDuplicate 相同内容的消息生成不同的 ZSET 成员, 解析后内容不变
+func TestTurnMemberDuplicate(t *testing.T) {
+	msg := schema.UserMessage("好的")
+	first, err := turnMember(*msg, 1)
+	if err != nil {
+		t.Fatalf("生成成员失败: %v", err)
+	}
+	second, err := turnMember(*msg, 2)
+	if err != nil {
+		t.Fatalf("生成成员失败: %v", err)
+	}
+	if first == second {
+		t.Fatalf("相同内容的消息不应生成相同的成员: %s", first)
+	}
+	for _, member := range []string{first, second} {
+		var decoded schema.Message
+		if err := json.Unmarshal([]byte(member), &decoded); err != nil {
+			t.Fatalf("解析成员失败: %v", err)
+		}
+		if decoded.Role != schema.User || decoded.Content != "好的" {
+			t.Errorf("解析后的消息错误: %+v", decoded)
+		}
+	}
+}
+
+// TestSearchExcludesQuery 当前问题已在 ASR 识别后写入记忆, 搜索时不应作为历史信息返回
+func TestSearchExcludesQuery(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	m := &Memory{redisClient: client, keyPrefix: "xiaozhi"}
+
+	ctx := context.Background()
+	ts := time.Now().Add(-time.Hour).UnixNano()
+	messages := []*schema.Message{
+		schema.UserMessage("明天北京天气怎么样"),
+		schema.AssistantMessage("明天北京晴", nil),
+		schema.UserMessage("北京有什么好吃的"),
+		schema.AssistantMessage("推荐烤鸭", nil),
+		schema.UserMessage("北京天气"),
+	}
+	for i, msg := range messages {
+		member, err := turnMember(*msg, ts+int64(i))
+		if err != nil {
+			t.Fatalf("生成成员失败: %v", err)
+		}
+		client.ZAdd(ctx, m.getTurnsKey("dev"), redis.Z{Score: float64(ts + int64(i)), Member: member})
+	}
+
+	result, err := m.Search(ctx, "dev", " 北京天气 ", 10, 0)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	lines := strings.Split(result, "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "明天北京天气怎么样") {
+		t.Fatalf("搜索结果错误: %q", result)
+	}
+	if strings.Contains(result, "用户: 北京天气 ") || strings.HasSuffix(result, "用户: 北京天气") {
+		t.Errorf("搜索结果不应包含当前问题: %q", result)
+	}
+}
@@ -0,0 +1,191 @@
+package llm_memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/redis/go-redis/v9"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	defaultSummaryInterval = 20   // 默认每新增多少条消息更新一次摘要
+	defaultMaxMessages     = 2000 // 默认最多保留的长期记忆消息条数
+)
+
+// Provider 基于 Redis 的长期记忆, 实现 memory.MemoryProvider
+// 保存用户和助手的对话, 定期由 LLM 合并为滚动摘要, GetContext 返回摘要中的关键信息, Search 按 BM25 搜索历史对话
+type Provider struct {
+	memory          *Memory
+	summaryInterval int
+	maxMessages     int
+}
+
+// NewProvider 创建长期记忆提供者
+// config: summary_interval 每新增多少条消息更新一次摘要, max_messages 最多保留的消息条数
+// 摘要使用的模型由 memory.llm.summary_llm 指定, 未配置时使用 llm.provider
+func NewProvider(config map[string]interface{}) (*Provider, error) {
+	m := Get()
+	if m.redisClient == nil {
+		return nil, fmt.Errorf("无法获取 Redis 客户端")
+	}
+	p := &Provider{
+		memory:          m,
+		summaryInterval: defaultSummaryInterval,
+		maxMessages:     defaultMaxMessages,
+	}
+	if v := configInt(config["summary_interval"]); v > 0 {
+		p.summaryInterval = v
+	}
+	if v := configInt(config["max_messages"]); v > 0 {
+		p.maxMessages = v
+	}
+	return p, nil
+}
+
+func configInt(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// AddMessage 保存用户和助手的文本消息, 未总结的消息达到 summary_interval 条时在后台更新摘要
+func (p *Provider) AddMessage(ctx context.Context, agentID string, msg schema.Message) error {
+	if (msg.Role != schema.User && msg.Role != schema.Assistant) || msg.Content == "" {
+		return nil
+	}
+	ts := time.Now().UnixNano()
+	member, err := turnMember(msg, ts)
+	if err != nil {
+		return fmt.Errorf("marshal message failed: %w", err)
+	}
+
+	key := p.memory.getTurnsKey(agentID)
+	client := p.memory.redisClient
+	pipe := client.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(ts), Member: member})
+	pipe.ZRemRangeByRank(ctx, key, 0, int64(-p.maxMessages-1))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("add memory message failed: %w", err)
+	}
+
+	mark, err := p.memory.getSummaryMark(ctx, agentID)
+	if err != nil {
+		return fmt.Errorf("get summary mark failed: %w", err)
+	}
+	pending, err := client.ZCount(ctx, key, "("+strconv.FormatInt(mark, 10), "+inf").Result()
+	if err != nil {
+		return fmt.Errorf("count pending messages failed: %w", err)
+	}
+	if pending >= int64(p.summaryInterval) {
+		go func() {
+			if err := p.memory.SummarizePending(context.Background(), agentID); err != nil {
+				log.Warnf("更新长期记忆摘要失败, memoryID: %s, error: %v", agentID, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// turnRecord 长期记忆 ZSET 的成员, 读取时按 schema.Message 解析
+type turnRecord struct {
+	Role    schema.RoleType `json:"role"`
+	Content string          `json:"content"`
+	Ts      int64           `json:"ts"`
+}
+
+// turnMember 生成 ZSET 成员, 带上写入时间, 相同内容的消息(如多次说"好的")各自保存, 不会覆盖之前的记录
+func turnMember(msg schema.Message, ts int64) (string, error) {
+	data, err := json.Marshal(turnRecord{Role: msg.Role, Content: msg.Content, Ts: ts})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GetMessages 获取最近的 count 条长期记忆消息
+func (p *Provider) GetMessages(ctx context.Context, agentId string, count int) ([]*schema.Message, error) {
+	if count <= 0 {
+		count = 10
+	}
+	results, err := p.memory.redisClient.ZRange(ctx, p.memory.getTurnsKey(agentId), int64(-count), -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get messages failed: %w", err)
+	}
+	messages := make([]*schema.Message, 0, len(results))
+	for _, result := range results {
+		msg := &schema.Message{}
+		if err := json.Unmarshal([]byte(result), msg); err != nil {
+			return nil, fmt.Errorf("unmarshal message failed: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// GetContext 返回摘要中的关键信息
+func (p *Provider) GetContext(ctx context.Context, agentId string, maxToken int) (string, error) {
+	return p.memory.GetContext(ctx, agentId, "", maxToken)
+}
+
+// Search 按 BM25 搜索历史对话
+func (p *Provider) Search(ctx context.Context, agentId string, query string, topK int, timeRangeDays int64) (string, error) {
+	return p.memory.Search(ctx, agentId, query, topK, timeRangeDays)
+}
+
+// Flush 会话结束时将未总结的消息合并到摘要中
+func (p *Provider) Flush(ctx context.Context, agentId string) error {
+	return p.memory.SummarizePending(ctx, agentId)
+}
+
+// ResetMemory 删除长期记忆的消息和摘要
+func (p *Provider) ResetMemory(ctx context.Context, agentId string) error {
+	return p.memory.redisClient.Del(ctx, p.memory.getTurnsKey(agentId), p.memory.getSummaryKey(agentId)).Err()
+}
+
+// Forget 删除内容包含 query 的消息, 并删除摘要, 下次总结时由剩余消息重新生成
+func (p *Provider) Forget(ctx context.Context, agentId string, query string) (int, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return 0, nil
+	}
+	client := p.memory.redisClient
+	key := p.memory.getTurnsKey(agentId)
+	results, err := client.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("get messages failed: %w", err)
+	}
+	var members []interface{}
+	for _, result := range results {
+		var msg schema.Message
+		if err := json.Unmarshal([]byte(result), &msg); err != nil {
+			continue
+		}
+		if strings.Contains(strings.ToLower(msg.Content), query) {
+			members = append(members, result)
+		}
+	}
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	pipe := client.TxPipeline()
+	pipe.ZRem(ctx, key, members...)
+	pipe.Del(ctx, p.memory.getSummaryKey(agentId))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("forget messages failed: %w", err)
+	}
+	return len(members), nil
+}
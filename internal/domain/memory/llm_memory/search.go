@@ -0,0 +1,214 @@
+package llm_memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/redis/go-redis/v9"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// searchMaxMessages 搜索时最多读取的最近消息条数
+const searchMaxMessages = 2000
+
+// turn 一轮对话: 用户消息和随后的助手回复
+type turn struct {
+	time      time.Time
+	user      string
+	assistant string
+}
+
+func (t turn) text() string {
+	return t.user + "\n" + t.assistant
+}
+
+func (t turn) format() string {
+	line := fmt.Sprintf("[%s] 用户: %s", t.time.Format("2006-01-02 15:04"), t.user)
+	if t.assistant != "" {
+		line += " 助手: " + t.assistant
+	}
+	return line
+}
+
+// Search 在长期记忆的对话中按 BM25 搜索与 query 相关的 topK 轮对话, timeRangeDays 大于 0 时只搜索最近若干天
+func (m *Memory) Search(ctx context.Context, deviceID string, query string, topK int, timeRangeDays int64) (string, error) {
+	if m.redisClient == nil || strings.TrimSpace(query) == "" {
+		return "", nil
+	}
+	if topK <= 0 {
+		topK = 5
+	}
+
+	minScore := "-inf"
+	if timeRangeDays > 0 {
+		minScore = strconv.FormatInt(time.Now().Add(-time.Duration(timeRangeDays)*24*time.Hour).UnixNano(), 10)
+	}
+	results, err := m.redisClient.ZRevRangeByScoreWithScores(ctx, m.getTurnsKey(deviceID), &redis.ZRangeBy{
+		Min:   minScore,
+		Max:   "+inf",
+		Count: searchMaxMessages,
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("search messages failed: %w", err)
+	}
+
+	// 结果按时间倒序, 反转后组装成轮次
+	var turns []turn
+	for i := len(results) - 1; i >= 0; i-- {
+		var msg schema.Message
+		if err := json.Unmarshal([]byte(results[i].Member.(string)), &msg); err != nil {
+			continue
+		}
+		switch msg.Role {
+		case schema.User:
+			turns = append(turns, turn{time: time.Unix(0, int64(results[i].Score)), user: msg.Content})
+		case schema.Assistant:
+			if len(turns) > 0 && msg.Content != "" {
+				last := &turns[len(turns)-1]
+				last.assistant = strings.TrimSpace(last.assistant + " " + msg.Content)
+			}
+		}
+	}
+
+	// 本轮用户消息在 ASR 识别后已写入记忆, 与 query 完全相同的轮次不作为搜索结果, 避免把当前问题当作历史信息返回
+	query = strings.TrimSpace(query)
+	filtered := turns[:0]
+	for _, t := range turns {
+		if strings.TrimSpace(t.user) != query {
+			filtered = append(filtered, t)
+		}
+	}
+	turns = filtered
+
+	docs := make([]string, len(turns))
+	for i, t := range turns {
+		docs[i] = t.text()
+	}
+	var lines []string
+	for _, i := range rankBM25(query, docs, topK) {
+		lines = append(lines, turns[i].format())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// rankBM25 返回与 query 相关的文档下标, 按相关度从高到低, 不包含没有共同词的文档
+func rankBM25(query string, docs []string, topK int) []int {
+	queryTerms := uniqueTerms(tokenize(query))
+	if len(queryTerms) == 0 || len(docs) == 0 {
+		return nil
+	}
+
+	termFreqs := make([]map[string]int, len(docs))
+	docLens := make([]int, len(docs))
+	docFreq := make(map[string]int)
+	totalLen := 0
+	for i, doc := range docs {
+		terms := tokenize(doc)
+		tf := make(map[string]int, len(terms))
+		for _, term := range terms {
+			tf[term]++
+		}
+		for term := range tf {
+			docFreq[term]++
+		}
+		termFreqs[i] = tf
+		docLens[i] = len(terms)
+		totalLen += len(terms)
+	}
+	avgLen := float64(totalLen) / float64(len(docs))
+	if avgLen == 0 {
+		return nil
+	}
+
+	n := float64(len(docs))
+	scores := make([]float64, len(docs))
+	var matched []int
+	for i := range docs {
+		for _, term := range queryTerms {
+			f := float64(termFreqs[i][term])
+			if f == 0 {
+				continue
+			}
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			scores[i] += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(docLens[i])/avgLen))
+		}
+		if scores[i] > 0 {
+			matched = append(matched, i)
+		}
+	}
+
+	// 相关度相同时较新的对话在前
+	sort.SliceStable(matched, func(a, b int) bool {
+		if scores[matched[a]] != scores[matched[b]] {
+			return scores[matched[a]] > scores[matched[b]]
+		}
+		return matched[a] > matched[b]
+	})
+	if len(matched) > topK {
+		matched = matched[:topK]
+	}
+	return matched
+}
+
+// tokenize 分词: 英文和数字按单词切分并转为小写, 连续的汉字切分为单字和相邻二字组合, 不依赖词典
+func tokenize(text string) []string {
+	var tokens []string
+	var word, han []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		for i := range han {
+			tokens = append(tokens, string(han[i]))
+			if i+1 < len(han) {
+				tokens = append(tokens, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return tokens
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	var result []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			result = append(result, term)
+		}
+	}
+	return result
+}
@@ -0,0 +1,351 @@
+package llm_memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/window"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 摘要 hash 中的字段
+const (
+	summaryField     = "summary"
+	summaryMarkField = "mark" // 已合并到摘要中的最后一条消息的时间戳(纳秒)
+	summaryTimeout   = 60 * time.Second
+)
+
+// GetSummary 获取长期记忆摘要, memoryID 为智能体ID或设备ID
+func (m *Memory) GetSummary(ctx context.Context, deviceID string) (string, error) {
+	if m.redisClient == nil {
+		return "", nil
+	}
+	summary, err := m.redisClient.HGet(ctx, m.getSummaryKey(deviceID), summaryField).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get summary failed: %w", err)
+	}
+	return summary, nil
+}
+
+// SetSummary 设置长期记忆摘要, 当前时间之前的消息视为已合并
+func (m *Memory) SetSummary(ctx context.Context, deviceID string, summary string) error {
+	return m.setSummary(ctx, deviceID, summary, time.Now().UnixNano())
+}
+
+func (m *Memory) setSummary(ctx context.Context, memoryID string, summary string, mark int64) error {
+	if m.redisClient == nil {
+		log.Log().Warn("redis client is nil")
+		return nil
+	}
+	return m.redisClient.HSet(ctx, m.getSummaryKey(memoryID), summaryField, summary, summaryMarkField, mark).Err()
+}
+
+// getSummaryMark 已合并到摘要中的最后一条消息的时间戳
+func (m *Memory) getSummaryMark(ctx context.Context, memoryID string) (int64, error) {
+	mark, err := m.redisClient.HGet(ctx, m.getSummaryKey(memoryID), summaryMarkField).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return mark, err
+}
+
+// Summary 将对话合并到之前的摘要中, 生成新的摘要并保存
+func (m *Memory) Summary(ctx context.Context, deviceID string, msgList []schema.Message) (string, error) {
+	previous, err := m.GetSummary(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	summary, err := m.summarize(ctx, deviceID, previous, msgList)
+	if err != nil {
+		return "", err
+	}
+	if err := m.SetSummary(ctx, deviceID, summary); err != nil {
+		return "", err
+	}
+	return summary, nil
+}
+
+// SummarizePending 将上次总结之后的消息合并到摘要中, 同一 memoryID 同一时间只进行一次总结
+func (m *Memory) SummarizePending(ctx context.Context, memoryID string) error {
+	if m.redisClient == nil {
+		return nil
+	}
+	if _, loaded := m.summarizing.LoadOrStore(memoryID, struct{}{}); loaded {
+		return nil
+	}
+	defer m.summarizing.Delete(memoryID)
+
+	mark, err := m.getSummaryMark(ctx, memoryID)
+	if err != nil {
+		return fmt.Errorf("get summary mark failed: %w", err)
+	}
+	results, err := m.redisClient.ZRangeByScoreWithScores(ctx, m.getTurnsKey(memoryID), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(mark, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("get pending messages failed: %w", err)
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	msgList := make([]schema.Message, 0, len(results))
+	for _, result := range results {
+		var msg schema.Message
+		if err := json.Unmarshal([]byte(result.Member.(string)), &msg); err != nil {
+			continue
+		}
+		msgList = append(msgList, msg)
+	}
+	previous, err := m.GetSummary(ctx, memoryID)
+	if err != nil {
+		return err
+	}
+
+	startTs := time.Now()
+	summary, err := m.summarize(ctx, memoryID, previous, msgList)
+	if err != nil {
+		return err
+	}
+	// 只标记已读取的消息, 总结期间新增的消息在下次合并
+	if err := m.setSummary(ctx, memoryID, summary, int64(results[len(results)-1].Score)); err != nil {
+		return err
+	}
+	log.Infof("长期记忆摘要已更新, memoryID: %s, 合并消息: %d, 耗时: %dms", memoryID, len(msgList), time.Since(startTs).Milliseconds())
+	return nil
+}
+
+// summarize 调用模型按 MemorySummaryPrompt 生成新的摘要
+func (m *Memory) summarize(ctx context.Context, memoryID string, previous string, msgList []schema.Message) (string, error) {
+	model, err := m.getSummaryModel()
+	if err != nil {
+		return "", err
+	}
+
+	var input strings.Builder
+	input.WriteString(fmt.Sprintf("当前时间: %s\n", time.Now().Format("2006-01-02 15:04")))
+	if previous != "" {
+		input.WriteString("之前的记忆:\n")
+		input.WriteString(previous)
+		input.WriteString("\n")
+	}
+	input.WriteString("新的对话:\n")
+	for _, msg := range msgList {
+		switch msg.Role {
+		case schema.User:
+			input.WriteString("user: " + msg.Content + "\n")
+		case schema.Assistant:
+			if msg.Content != "" {
+				input.WriteString("assistant: " + msg.Content + "\n")
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+	defer cancel()
+	dialogue := []*schema.Message{
+		schema.SystemMessage(MemorySummaryPrompt),
+		schema.UserMessage(input.String()),
+	}
+	var output strings.Builder
+	for msg := range model.ResponseWithContext(ctx, "memory_"+memoryID, dialogue, nil) {
+		if msg != nil {
+			output.WriteString(msg.Content)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	summary := trimCodeFence(output.String())
+	if summary == "" {
+		return "", fmt.Errorf("模型返回的记忆摘要为空")
+	}
+	return summary, nil
+}
+
+// getSummaryModel 生成摘要使用 memory.llm.summary_llm 指定的模型, 未配置时使用 llm.provider
+func (m *Memory) getSummaryModel() (llm.LLMProvider, error) {
+	name := viper.GetString("memory.llm.summary_llm")
+	if name == "" {
+		name = viper.GetString("llm.provider")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if m.summaryModel != nil && m.summaryModelName == name {
+		return m.summaryModel, nil
+	}
+	config := viper.GetStringMap("llm." + name)
+	if _, ok := config["type"].(string); !ok {
+		return nil, fmt.Errorf("记忆摘要模型 %s 的配置不存在", name)
+	}
+	model, err := llm.GetLLMProvider(name, config)
+	if err != nil {
+		return nil, err
+	}
+	m.summaryModel, m.summaryModelName = model, name
+	return model, nil
+}
+
+// trimCodeFence 去掉模型输出中包裹 json 的代码块标记
+func trimCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	return strings.TrimSpace(text)
+}
+
+// GetContext 返回长期记忆摘要中的关键信息, 按重要程度排列, 不超过 maxToken
+func (m *Memory) GetContext(ctx context.Context, deviceID string, agentID string, maxToken int) (string, error) {
+	memoryID := deviceID
+	if agentID != "" {
+		memoryID = agentID
+	}
+	summary, err := m.GetSummary(ctx, memoryID)
+	if err != nil || summary == "" {
+		return "", err
+	}
+	return formatContext(summary, maxToken), nil
+}
+
+// memorySummary MemorySummaryPrompt 约定的摘要结构
+type memorySummary struct {
+	Archive struct {
+		Identity struct {
+			Name string   `json:"现用名"`
+			Tags []string `json:"特征标记"`
+		} `json:"身份图谱"`
+		Events []struct {
+			Event   string  `json:"事件"`
+			Time    string  `json:"时间戳"`
+			Emotion float64 `json:"情感值"`
+		} `json:"记忆立方"`
+	} `json:"时空档案"`
+	Relations struct {
+		Topics map[string]float64 `json:"高频话题"`
+	} `json:"关系网络"`
+	Pending struct {
+		Urgent []string `json:"紧急事项"`
+		Care   []string `json:"潜在关怀"`
+	} `json:"待响应"`
+	Quotes []string `json:"高光语录"`
+}
+
+// formatContext 将摘要整理为关键信息列表, 依次为身份、待办、按情感值排序的事件、高频话题、语录和关怀
+// 摘要不是约定的 json 结构时按原文截断
+func formatContext(summary string, maxToken int) string {
+	var s memorySummary
+	if err := json.Unmarshal([]byte(summary), &s); err != nil {
+		return truncateTokens(summary, maxToken)
+	}
+
+	var facts []string
+	identity := s.Archive.Identity
+	if identity.Name != "" || len(identity.Tags) > 0 {
+		fact := "用户"
+		if identity.Name != "" {
+			fact += "名字: " + identity.Name
+		}
+		if tags := nonEmpty(identity.Tags); len(tags) > 0 {
+			fact += ", 特征: " + strings.Join(tags, "、")
+		}
+		facts = append(facts, fact)
+	}
+	for _, item := range nonEmpty(s.Pending.Urgent) {
+		facts = append(facts, "待办: "+item)
+	}
+
+	events := s.Archive.Events
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Emotion > events[j].Emotion })
+	for _, event := range events {
+		if event.Event == "" {
+			continue
+		}
+		fact := "经历: " + event.Event
+		if event.Time != "" {
+			fact += "(" + event.Time + ")"
+		}
+		facts = append(facts, fact)
+	}
+
+	if len(s.Relations.Topics) > 0 {
+		topics := make([]string, 0, len(s.Relations.Topics))
+		for topic := range s.Relations.Topics {
+			if topic != "" {
+				topics = append(topics, topic)
+			}
+		}
+		sort.SliceStable(topics, func(i, j int) bool {
+			if s.Relations.Topics[topics[i]] != s.Relations.Topics[topics[j]] {
+				return s.Relations.Topics[topics[i]] > s.Relations.Topics[topics[j]]
+			}
+			return topics[i] < topics[j]
+		})
+		if len(topics) > 0 {
+			facts = append(facts, "常聊话题: "+strings.Join(topics, "、"))
+		}
+	}
+	for _, quote := range nonEmpty(s.Quotes) {
+		facts = append(facts, "用户说过: "+quote)
+	}
+	for _, item := range nonEmpty(s.Pending.Care) {
+		facts = append(facts, "可主动关心: "+item)
+	}
+
+	var result []string
+	used := 0
+	for _, fact := range facts {
+		tokens := window.EstimateTokens(fact)
+		if maxToken > 0 && used+tokens > maxToken {
+			break
+		}
+		used += tokens
+		result = append(result, "- "+fact)
+	}
+	return strings.Join(result, "\n")
+}
+
+func nonEmpty(items []string) []string {
+	var result []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// truncateTokens 按估算的 token 数截断文本
+func truncateTokens(text string, maxToken int) string {
+	if maxToken <= 0 || window.EstimateTokens(text) <= maxToken {
+		return text
+	}
+	runes := []rune(text)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if window.EstimateTokens(string(runes[:mid])) <= maxToken {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return string(runes[:lo])
+}
@@ -0,0 +1,108 @@
+package vector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Embedder 将文本转换为向量
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+var embeddingHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// OpenAIEmbedder 调用 OpenAI 兼容的 /v1/embeddings 接口
+// 本地部署可以使用 Ollama、text-embeddings-inference 等提供此接口的服务
+type OpenAIEmbedder struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	dimensions int
+}
+
+// NewOpenAIEmbedder 创建向量模型客户端
+// config: base_url 接口地址(包含 /v1), api_key, model_name, dimensions 向量维度(可选, 模型支持时生效)
+func NewOpenAIEmbedder(config map[string]interface{}) (*OpenAIEmbedder, error) {
+	e := &OpenAIEmbedder{}
+	e.baseURL, _ = config["base_url"].(string)
+	e.apiKey, _ = config["api_key"].(string)
+	e.model, _ = config["model_name"].(string)
+	e.dimensions = configInt(config["dimensions"])
+	if e.baseURL == "" || e.model == "" {
+		return nil, fmt.Errorf("向量模型配置不完整: base_url 或 model_name 为空")
+	}
+	e.baseURL = strings.TrimRight(e.baseURL, "/")
+	return e, nil
+}
+
+type embeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Embed 批量计算文本的向量, 返回顺序与输入一致
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embeddingRequest{Model: e.model, Input: texts, Dimensions: e.dimensions})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := embeddingHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求向量模型失败: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取向量模型响应失败: %w", err)
+	}
+
+	var result embeddingResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析向量模型响应失败, status: %d, body: %s", resp.StatusCode, string(respBody))
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("向量模型返回错误: %s", result.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("向量模型返回错误, status: %d, body: %s", resp.StatusCode, string(respBody))
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("向量数量与输入不一致: %d != %d", len(result.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("向量下标越界: %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
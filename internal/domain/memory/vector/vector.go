@@ -0,0 +1,409 @@
+package vector
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+
+	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/window"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// profileQuery GetContext 没有用户输入, 用这句话检索与用户个人情况最相关的记忆
+const profileQuery = "用户的名字、身份、家庭、喜好、习惯和计划"
+
+// scanBatchSize 检索时每次从 Redis 读取的记忆条数
+const scanBatchSize = 200
+
+// Provider 本地向量记忆, 实现 memory.MemoryProvider
+// 用户说的话经向量模型转换后保存在 Redis 中, Search 按余弦相似度检索, GetContext 返回与用户个人情况最相关的 top-k 条
+type Provider struct {
+	redisClient     *redis.Client
+	keyPrefix       string
+	embedder        Embedder
+	maxEntries      int
+	minChars        int
+	enableSearch    bool
+	searchThreshold float64
+	searchTopK      int
+	contextTopK     int
+	forgetThreshold float64
+	scanLimit       int
+}
+
+// entry 一条记忆
+type entry struct {
+	Text   string `json:"text"`
+	Vector string `json:"vector"` // float32 小端序的 base64 编码
+	Ts     int64  `json:"ts"`     // 写入时间, 保证相同内容的话各自保存为不同的成员
+}
+
+type scoredEntry struct {
+	member string
+	text   string
+	time   time.Time
+	score  float64
+}
+
+// NewProvider 创建向量记忆
+// config:
+//
+//	embedding: 向量模型配置, 见 NewOpenAIEmbedder
+//	max_entries: 每个智能体最多保留的记忆条数, 默认 1000
+//	min_chars: 少于该字数的话不保存, 默认 4
+//	enable_search/search_threshold/search_top_k: 每轮对话前的检索开关、相似度阈值和调用方未指定时的条数
+//	context_top_k: 会话开始时加入提示词的记忆条数, 默认 5
+//	forget_threshold: 按内容删除记忆时的相似度阈值, 默认 0.75
+//	scan_limit: 每次检索最多比较最近的多少条记忆, 默认 500, 按内容删除时不限制
+func NewProvider(config map[string]interface{}) (*Provider, error) {
+	client := i_redis.GetClient()
+	if client == nil {
+		return nil, fmt.Errorf("无法获取 Redis 客户端")
+	}
+	embeddingConfig, _ := config["embedding"].(map[string]interface{})
+	embedder, err := NewOpenAIEmbedder(embeddingConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		redisClient:     client,
+		keyPrefix:       viper.GetString("redis.key_prefix"),
+		embedder:        embedder,
+		maxEntries:      1000,
+		minChars:        4,
+		enableSearch:    true,
+		searchThreshold: 0.5,
+		searchTopK:      3,
+		contextTopK:     5,
+		forgetThreshold: 0.75,
+		scanLimit:       500,
+	}
+	if v := configInt(config["max_entries"]); v > 0 {
+		p.maxEntries = v
+	}
+	if v := configInt(config["min_chars"]); v > 0 {
+		p.minChars = v
+	}
+	if v, ok := config["enable_search"].(bool); ok {
+		p.enableSearch = v
+	}
+	if v, ok := config["search_threshold"].(float64); ok {
+		p.searchThreshold = v
+	}
+	if v := configInt(config["search_top_k"]); v > 0 {
+		p.searchTopK = v
+	}
+	if v := configInt(config["context_top_k"]); v > 0 {
+		p.contextTopK = v
+	}
+	if v, ok := config["forget_threshold"].(float64); ok {
+		p.forgetThreshold = v
+	}
+	if v := configInt(config["scan_limit"]); v > 0 {
+		p.scanLimit = v
+	}
+	return p, nil
+}
+
+func configInt(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func (p *Provider) getKey(agentID string) string {
+	return i_redis.GetKeyWithPrefix(p.keyPrefix, "vector:"+agentID)
+}
+
+// AddMessage 保存用户说的话, 助手的回复和过短的话不保存
+func (p *Provider) AddMessage(ctx context.Context, agentID string, msg schema.Message) error {
+	text := strings.TrimSpace(msg.Content)
+	if msg.Role != schema.User || len([]rune(text)) < p.minChars {
+		return nil
+	}
+	return p.add(ctx, agentID, text)
+}
+
+// Remember 保存用户明确要求记住的内容, 不受 min_chars 限制
+func (p *Provider) Remember(ctx context.Context, agentID string, fact string) error {
+	text := strings.TrimSpace(fact)
+	if text == "" {
+		return nil
+	}
+	return p.add(ctx, agentID, text)
+}
+
+func (p *Provider) add(ctx context.Context, agentID string, text string) error {
+	vectors, err := p.embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return err
+	}
+	ts := time.Now().UnixNano()
+	member, err := json.Marshal(entry{Text: text, Vector: encodeVector(vectors[0]), Ts: ts})
+	if err != nil {
+		return err
+	}
+
+	key := p.getKey(agentID)
+	pipe := p.redisClient.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(ts), Member: string(member)})
+	pipe.ZRemRangeByRank(ctx, key, 0, int64(-p.maxEntries-1))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("保存向量记忆失败: %w", err)
+	}
+	return nil
+}
+
+// GetMessages 获取最近保存的 count 条记忆
+func (p *Provider) GetMessages(ctx context.Context, agentId string, count int) ([]*schema.Message, error) {
+	if count <= 0 {
+		count = 10
+	}
+	results, err := p.redisClient.ZRange(ctx, p.getKey(agentId), int64(-count), -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取向量记忆失败: %w", err)
+	}
+	messages := make([]*schema.Message, 0, len(results))
+	for _, result := range results {
+		var e entry
+		if err := json.Unmarshal([]byte(result), &e); err != nil {
+			continue
+		}
+		messages = append(messages, schema.UserMessage(e.Text))
+	}
+	return messages, nil
+}
+
+// GetContext 返回与用户个人情况最相关的 context_top_k 条记忆, 不超过 maxToken
+func (p *Provider) GetContext(ctx context.Context, agentId string, maxToken int) (string, error) {
+	results, err := p.search(ctx, agentId, profileQuery, "", p.contextTopK, 0, 0, p.scanLimit)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	used := 0
+	for _, result := range results {
+		line := formatEntry(result)
+		tokens := window.EstimateTokens(line)
+		if maxToken > 0 && used+tokens > maxToken {
+			break
+		}
+		used += tokens
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Search 按余弦相似度检索与 query 相关的记忆, topK 不大于 0 时使用 search_top_k
+// 本轮用户说的话在 ASR 识别后已写入记忆, 与 query 内容相同的记忆不作为结果返回
+func (p *Provider) Search(ctx context.Context, agentId string, query string, topK int, timeRangeDays int64) (string, error) {
+	if !p.enableSearch {
+		return "", nil
+	}
+	return p.searchText(ctx, agentId, query, strings.TrimSpace(query), topK, timeRangeDays)
+}
+
+// Recall 供记忆工具主动检索, 不受 enable_search 限制
+func (p *Provider) Recall(ctx context.Context, agentId string, query string, topK int) (string, error) {
+	return p.searchText(ctx, agentId, query, "", topK, 0)
+}
+
+func (p *Provider) searchText(ctx context.Context, agentId string, query string, exclude string, topK int, timeRangeDays int64) (string, error) {
+	if strings.TrimSpace(query) == "" {
+		return "", nil
+	}
+	if topK <= 0 {
+		topK = p.searchTopK
+	}
+	results, err := p.search(ctx, agentId, query, exclude, topK, p.searchThreshold, timeRangeDays, p.scanLimit)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, 0, len(results))
+	for _, result := range results {
+		lines = append(lines, formatEntry(result))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// search 从最新的记忆开始分批读取并比较, 最多比较 limit 条, limit 不大于 0 时比较全部, 内容等于 exclude 的记忆不参与比较
+func (p *Provider) search(ctx context.Context, agentId string, query string, exclude string, topK int, threshold float64, timeRangeDays int64, limit int) ([]scoredEntry, error) {
+	minScore := "-inf"
+	if timeRangeDays > 0 {
+		minScore = strconv.FormatInt(time.Now().Add(-time.Duration(timeRangeDays)*24*time.Hour).UnixNano(), 10)
+	}
+
+	var queryVector []float32
+	var scored []scoredEntry
+	scanned := 0
+	maxScore := "+inf"
+	startTs := time.Now()
+	for limit <= 0 || scanned < limit {
+		count := scanBatchSize
+		if limit > 0 && limit-scanned < count {
+			count = limit - scanned
+		}
+		// 按分数(写入时间)翻页, 检索期间新写入的记忆不影响后面的批次; 两句话的写入间隔远大于分数的精度, 不会有相同的分数
+		results, err := p.redisClient.ZRevRangeByScoreWithScores(ctx, p.getKey(agentId), &redis.ZRangeBy{
+			Min:   minScore,
+			Max:   maxScore,
+			Count: int64(count),
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("读取向量记忆失败: %w", err)
+		}
+		if len(results) == 0 {
+			break
+		}
+		if queryVector == nil {
+			vectors, err := p.embedder.Embed(ctx, []string{query})
+			if err != nil {
+				return nil, err
+			}
+			queryVector = vectors[0]
+		}
+		scored = mergeTopK(scored, rank(queryVector, results, exclude, topK, threshold), topK)
+		scanned += len(results)
+		if len(results) < count {
+			break
+		}
+		maxScore = "(" + strconv.FormatFloat(results[len(results)-1].Score, 'f', -1, 64)
+	}
+	log.Debugf("向量记忆检索, agentId: %s, 比较条数: %d, 命中: %d, 耗时: %dms", agentId, scanned, len(scored), time.Since(startTs).Milliseconds())
+	return scored, nil
+}
+
+// mergeTopK 合并两批按相似度排好序的结果, 保留 topK 条, topK 不大于 0 时全部保留
+func mergeTopK(a, b []scoredEntry, topK int) []scoredEntry {
+	merged := append(a, b...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].score > merged[j].score })
+	if topK > 0 && len(merged) > topK {
+		merged = merged[:topK]
+	}
+	return merged
+}
+
+// rank 计算与 query 向量的余弦相似度, 返回不低于 threshold 的 topK 条, 按相似度从高到低, 跳过内容等于 exclude 的记忆
+func rank(query []float32, results []redis.Z, exclude string, topK int, threshold float64) []scoredEntry {
+	var scored []scoredEntry
+	for _, result := range results {
+		member, _ := result.Member.(string)
+		var e entry
+		if err := json.Unmarshal([]byte(member), &e); err != nil {
+			continue
+		}
+		if exclude != "" && e.Text == exclude {
+			continue
+		}
+		vector, err := decodeVector(e.Vector)
+		if err != nil {
+			continue
+		}
+		score := cosine(query, vector)
+		if score < threshold {
+			continue
+		}
+		scored = append(scored, scoredEntry{member: member, text: e.Text, time: time.Unix(0, int64(result.Score)), score: score})
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+	if topK > 0 && len(scored) > topK {
+		scored = scored[:topK]
+	}
+	return scored
+}
+
+func formatEntry(e scoredEntry) string {
+	return fmt.Sprintf("- %s [%s]", e.text, e.time.Format("2006-01-02 15:04"))
+}
+
+// Flush 消息在 AddMessage 时已保存
+func (p *Provider) Flush(ctx context.Context, agentID string) error {
+	return nil
+}
+
+// ResetMemory 删除智能体的全部向量记忆
+func (p *Provider) ResetMemory(ctx context.Context, agentId string) error {
+	return p.redisClient.Del(ctx, p.getKey(agentId)).Err()
+}
+
+// Forget 删除与 query 相似度不低于 forget_threshold 的记忆
+func (p *Provider) Forget(ctx context.Context, agentId string, query string) (int, error) {
+	if strings.TrimSpace(query) == "" {
+		return 0, nil
+	}
+	results, err := p.search(ctx, agentId, query, "", 0, p.forgetThreshold, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	members := make([]interface{}, 0, len(results))
+	for _, result := range results {
+		members = append(members, result.member)
+	}
+	removed, err := p.redisClient.ZRem(ctx, p.getKey(agentId), members...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("删除向量记忆失败: %w", err)
+	}
+	return int(removed), nil
+}
+
+// cosine 余弦相似度, 维度不一致时返回 0
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func encodeVector(vector []float32) string {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func decodeVector(s string) ([]float32, error) {
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("向量长度错误: %d", len(buf))
+	}
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector, nil
+}
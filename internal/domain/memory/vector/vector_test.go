@@ -0,0 +1,119 @@
+package vector
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestEncodeVector(t *testing.T) {
+	vector := []float32{0.1, -2.5, 3}
+	decoded, err := decodeVector(encodeVector(vector))
+	if err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	for i := range vector {
+		if decoded[i] != vector[i] {
+			t.Fatalf("解码结果错误: %v", decoded)
+		}
+	}
+}
+
+func TestCosine(t *testing.T) {
+	if got := cosine([]float32{1, 0}, []float32{2, 0}); math.Abs(got-1) > 1e-9 {
+		t.Errorf("同方向应为 1: %f", got)
+	}
+	if got := cosine([]float32{1, 0}, []float32{0, 1}); got != 0 {
+		t.Errorf("正交应为 0: %f", got)
+	}
+	if got := cosine([]float32{1, 0}, []float32{1, 0, 0}); got != 0 {
+		t.Errorf("维度不一致应为 0: %f", got)
+	}
+}
+
+func member(text string, vector []float32) string {
+	data, _ := json.Marshal(entry{Text: text, Vector: encodeVector(vector)})
+	return string(data)
+}
+
+func TestRank(t *testing.T) {
+	now := float64(time.Now().UnixNano())
+	results := []redis.Z{
+		{Score: now, Member: member("我叫小明", []float32{1, 0.1})},
+		{Score: now, Member: member("今天很热", []float32{0, 1})},
+		{Score: now, Member: member("我喜欢猫", []float32{0.8, 0.6})},
+	}
+	scored := rank([]float32{1, 0}, results, "", 2, 0.5)
+	if len(scored) != 2 || scored[0].text != "我叫小明" || scored[1].text != "我喜欢猫" {
+		t.Errorf("排序错误: %+v", scored)
+	}
+	if scored := rank([]float32{1, 0}, results, "", 5, 0.9); len(scored) != 1 {
+		t.Errorf("应过滤低于阈值的记忆: %+v", scored)
+	}
+	// 当前问题已写入记忆, 检索时跳过
+	if scored := rank([]float32{1, 0}, results, "我叫小明", 5, 0.5); len(scored) != 1 || scored[0].text != "我喜欢猫" {
+		t.Errorf("应跳过与 query 相同的记忆: %+v", scored)
+	}
+}
+
+func TestMergeTopK(t *testing.T) {
+	a := []scoredEntry{{text: "a", score: 0.9}, {text: "b", score: 0.6}}
+	b := []scoredEntry{{text: "c", score: 0.8}, {text: "d", score: 0.5}}
+	merged := mergeTopK(a, b, 3)
+	if len(merged) != 3 || merged[0].text != "a" || merged[1].text != "c" || merged[2].text != "b" {
+		t.Errorf("合并结果错误: %+v", merged)
+	}
+	if merged := mergeTopK(nil, b, 0); len(merged) != 2 {
+		t.Errorf("topK 为 0 时应全部保留: %+v", merged)
+	}
+}
+
+// TestEntryDuplicate 相同内容的话写入时间不同, 生成不同的 ZSET 成员
+func TestEntryDuplicate(t *testing.T) {
+	vector := encodeVector([]float32{1, 0})
+	first, _ := json.Marshal(entry{Text: "我喜欢猫", Vector: vector, Ts: 1})
+	second, _ := json.Marshal(entry{Text: "我喜欢猫", Vector: vector, Ts: 2})
+	if string(first) == string(second) {
+		t.Errorf("相同内容的话不应生成相同的成员: %s", first)
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req embeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		// 倒序返回, 按 index 还原顺序
+		w.Write([]byte(`{"data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}]}`))
+	}))
+	defer server.Close()
+
+	embedder, err := NewOpenAIEmbedder(map[string]interface{}{
+		"base_url":   server.URL + "/v1/",
+		"api_key":    "key",
+		"model_name": "bge-m3",
+	})
+	if err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	vectors, err := embedder.Embed(context.Background(), []string{"你好", "再见"})
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("向量顺序错误: %v", vectors)
+	}
+
+	if _, err := NewOpenAIEmbedder(map[string]interface{}{"base_url": server.URL}); err == nil {
+		t.Errorf("缺少 model_name 应返回错误")
+	}
+}
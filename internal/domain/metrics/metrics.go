@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const namespace = "xiaozhi"
+
+// 错误计数的组件类型
+const (
+	ComponentAsr = "asr"
+	ComponentLlm = "llm"
+	ComponentTts = "tts"
+	ComponentVad = "vad"
+	ComponentMcp = "mcp"
+)
+
+// 语音交互的耗时大多在几百毫秒到十几秒之间
+var latencyBuckets = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 1.5, 2, 3, 5, 8, 13, 20}
+
+var (
+	asrLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "asr_latency_seconds",
+		Help:      "语音结束到ASR返回最终结果的耗时",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	llmFirstToken = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_first_token_seconds",
+		Help:      "LLM请求到收到首个token的耗时",
+		Buckets:   latencyBuckets,
+	}, []string{"model"})
+
+	llmFirstSentence = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_first_sentence_seconds",
+		Help:      "LLM请求到切分出首个完整句子的耗时",
+		Buckets:   latencyBuckets,
+	}, []string{"model"})
+
+	llmRouteClassify = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_route_classify_seconds",
+		Help:      "路由模型意图分类的耗时, 分类完成前不会开始请求实际的模型",
+		Buckets:   latencyBuckets,
+	})
+
+	ttsFirstFrame = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tts_first_frame_seconds",
+		Help:      "TTS请求到收到首个音频帧的耗时",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	turnLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "turn_latency_seconds",
+		Help:      "语音结束到下发首个TTS音频帧的端到端耗时",
+		Buckets:   latencyBuckets,
+	})
+
+	providerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_errors_total",
+		Help:      "各提供者的错误次数",
+	}, []string{"component", "provider"})
+
+	bargeIns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "barge_in_total",
+		Help:      "TTS播放期间用户插话打断的次数",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(asrLatency, llmFirstToken, llmFirstSentence, llmRouteClassify, ttsFirstFrame, turnLatency, providerErrors, bargeIns)
+}
+
+// ObserveAsrLatency 记录ASR耗时
+func ObserveAsrLatency(provider string, d time.Duration) {
+	asrLatency.WithLabelValues(provider).Observe(d.Seconds())
+}
+
+// ObserveLlmFirstToken 记录LLM首token耗时
+func ObserveLlmFirstToken(model string, d time.Duration) {
+	llmFirstToken.WithLabelValues(model).Observe(d.Seconds())
+}
+
+// ObserveLlmFirstSentence 记录LLM首句耗时
+func ObserveLlmFirstSentence(model string, d time.Duration) {
+	llmFirstSentence.WithLabelValues(model).Observe(d.Seconds())
+}
+
+// ObserveLlmRouteClassify 记录路由模型意图分类耗时
+func ObserveLlmRouteClassify(d time.Duration) {
+	llmRouteClassify.Observe(d.Seconds())
+}
+
+// ObserveTtsFirstFrame 记录TTS首帧耗时
+func ObserveTtsFirstFrame(provider string, d time.Duration) {
+	ttsFirstFrame.WithLabelValues(provider).Observe(d.Seconds())
+}
+
+// ObserveTurnLatency 记录一轮对话的端到端耗时
+func ObserveTurnLatency(d time.Duration) {
+	turnLatency.Observe(d.Seconds())
+}
+
+// IncProviderError 记录一次提供者错误
+func IncProviderError(component string, provider string) {
+	providerErrors.WithLabelValues(component, provider).Inc()
+}
+
+// IncBargeIn 记录一次插话打断
+func IncBargeIn() {
+	bargeIns.Inc()
+}
+
+// RegisterGaugeFunc 注册一个在采集时才计算取值的指标
+func RegisterGaugeFunc(name string, help string, f func() float64) {
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, f)
+	if err := prometheus.Register(gauge); err != nil {
+		log.Warnf("注册指标 %s 失败: %v", name, err)
+	}
+}
+
+// RegisterCollector 注册自定义采集器
+func RegisterCollector(c prometheus.Collector) {
+	if err := prometheus.Register(c); err != nil {
+		log.Warnf("注册指标采集器失败: %v", err)
+	}
+}
+
+// NewDesc 创建带命名空间的指标描述
+func NewDesc(name string, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+}
+
+// Handler 返回 /metrics 的 HTTP 处理器
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,297 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+
+	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/window"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// Scope 配额维度
+type Scope string
+
+const (
+	ScopeDevice Scope = "device"
+	ScopeAgent  Scope = "agent"
+	ScopeUser   Scope = "user"
+)
+
+var scopes = []Scope{ScopeDevice, ScopeAgent, ScopeUser}
+
+// Metric 配额项
+type Metric string
+
+const (
+	MetricTurns     Metric = "turns"      // 每分钟对话轮数
+	MetricLLMTokens Metric = "llm_tokens" // 每天 LLM token 数
+	MetricTTSChars  Metric = "tts_chars"  // 每天 TTS 字数
+)
+
+var metrics = []Metric{MetricTurns, MetricLLMTokens, MetricTTSChars}
+
+// ErrExceeded 超出配额, 具体信息见 *ExceededError
+var ErrExceeded = errors.New("quota exceeded")
+
+// ExceededError 超出的配额项
+type ExceededError struct {
+	Scope  Scope
+	ID     string
+	Metric Metric
+	Limit  int64
+	Used   int64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s %s 超出配额 %s: %d/%d", e.Scope, e.ID, e.Metric, e.Used, e.Limit)
+}
+
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrExceeded
+}
+
+// Subject 配额的归属, 同时按设备、智能体、用户计数, 为空的维度不计数
+type Subject struct {
+	DeviceID string `json:"device_id"`
+	AgentID  string `json:"agent_id"`
+	UserID   string `json:"user_id"`
+}
+
+func (s Subject) id(scope Scope) string {
+	switch scope {
+	case ScopeDevice:
+		return s.DeviceID
+	case ScopeAgent:
+		return s.AgentID
+	case ScopeUser:
+		return s.UserID
+	}
+	return ""
+}
+
+// Limits 单个维度的限额, 0 表示不限制
+type Limits struct {
+	TurnsPerMinute  int64
+	LLMTokensPerDay int64
+	TTSCharsPerDay  int64
+}
+
+func (l Limits) get(metric Metric) int64 {
+	switch metric {
+	case MetricTurns:
+		return l.TurnsPerMinute
+	case MetricLLMTokens:
+		return l.LLMTokensPerDay
+	case MetricTTSChars:
+		return l.TTSCharsPerDay
+	}
+	return 0
+}
+
+// Config 配额配置, 对应 quota
+type Config struct {
+	Enable          bool
+	FallbackMessage string
+	Limits          map[Scope]Limits
+}
+
+// LoadConfig 从 quota 配置读取, 每次检查时读取以支持配置热更新
+func LoadConfig() Config {
+	cfg := Config{
+		Enable:          viper.GetBool("quota.enable"),
+		FallbackMessage: viper.GetString("quota.fallback_message"),
+		Limits:          make(map[Scope]Limits, len(scopes)),
+	}
+	if cfg.FallbackMessage == "" {
+		cfg.FallbackMessage = "今天聊得有点多啦，先休息一下，稍后再来找我吧。"
+	}
+	for _, scope := range scopes {
+		cfg.Limits[scope] = Limits{
+			TurnsPerMinute:  viper.GetInt64(fmt.Sprintf("quota.%s.turns_per_minute", scope)),
+			LLMTokensPerDay: viper.GetInt64(fmt.Sprintf("quota.%s.llm_tokens_per_day", scope)),
+			TTSCharsPerDay:  viper.GetInt64(fmt.Sprintf("quota.%s.tts_chars_per_day", scope)),
+		}
+	}
+	return cfg
+}
+
+// Usage 单个维度单项配额的用量, Limit 为 0 表示不限制
+type Usage struct {
+	Scope  Scope  `json:"scope"`
+	ID     string `json:"id"`
+	Metric Metric `json:"metric"`
+	Window string `json:"window"`
+	Used   int64  `json:"used"`
+	Limit  int64  `json:"limit"`
+}
+
+// Manager 基于 Redis 计数的配额管理, 多个节点共享计数
+//
+// 计数 key: {prefix}:quota:{scope}:{id}:{metric}:{window}, 轮数按分钟、其它按天分窗口, 过期自动清理
+// Redis 不可用时不做限制
+type Manager struct {
+	client     *redis.Client
+	prefix     string
+	now        func() time.Time
+	loadConfig func() Config
+}
+
+var (
+	defaultManager *Manager
+	once           sync.Once
+)
+
+// Get 获取全局配额管理器
+func Get() *Manager {
+	once.Do(func() {
+		defaultManager = New(i_redis.GetClient(), viper.GetString("redis.key_prefix"))
+	})
+	return defaultManager
+}
+
+// New 创建配额管理器
+func New(client *redis.Client, prefix string) *Manager {
+	return &Manager{
+		client:     client,
+		prefix:     prefix,
+		now:        time.Now,
+		loadConfig: LoadConfig,
+	}
+}
+
+// FallbackMessage 超出配额时播报的提示
+func (m *Manager) FallbackMessage() string {
+	return m.loadConfig().FallbackMessage
+}
+
+func (m *Manager) key(scope Scope, id string, metric Metric, window string) string {
+	return i_redis.GetKeyWithPrefix(m.prefix, fmt.Sprintf("quota:%s:%s:%s:%s", scope, id, metric, window))
+}
+
+// window 计数窗口和过期时间
+func (m *Manager) window(metric Metric) (string, time.Duration) {
+	now := m.now()
+	if metric == MetricTurns {
+		return now.Format("200601021504"), 2 * time.Minute
+	}
+	return now.Format("20060102"), 48 * time.Hour
+}
+
+// enabled 配额已开启且 Redis 可用
+func (m *Manager) enabled() (Config, bool) {
+	if m == nil || m.client == nil {
+		return Config{}, false
+	}
+	cfg := m.loadConfig()
+	return cfg, cfg.Enable
+}
+
+// CheckTurn 开始一轮对话前调用, 轮数计数加一, 任一维度的轮数、LLM token 或 TTS 字数超限时返回 *ExceededError
+func (m *Manager) CheckTurn(ctx context.Context, subject Subject) error {
+	if err := m.Add(ctx, subject, MetricTurns, 1); err != nil {
+		return err
+	}
+	return m.check(ctx, subject, MetricTurns, MetricLLMTokens, MetricTTSChars)
+}
+
+// CheckLLM LLM 请求前调用, 包括工具调用后的再次请求, token 用量超限时返回 *ExceededError
+func (m *Manager) CheckLLM(ctx context.Context, subject Subject) error {
+	return m.check(ctx, subject, MetricLLMTokens)
+}
+
+// Add 累加用量, 未开启配额时不计数
+func (m *Manager) Add(ctx context.Context, subject Subject, metric Metric, n int64) error {
+	if _, ok := m.enabled(); !ok || n <= 0 {
+		return nil
+	}
+	window, ttl := m.window(metric)
+	pipe := m.client.Pipeline()
+	for _, scope := range scopes {
+		id := subject.id(scope)
+		if id == "" {
+			continue
+		}
+		key := m.key(scope, id, metric, window)
+		pipe.IncrBy(ctx, key, n)
+		pipe.Expire(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warnf("配额计数失败, subject: %+v, metric: %s, error: %v", subject, metric, err)
+	}
+	return nil
+}
+
+func (m *Manager) check(ctx context.Context, subject Subject, checkMetrics ...Metric) error {
+	cfg, ok := m.enabled()
+	if !ok {
+		return nil
+	}
+	usages, err := m.usage(ctx, cfg, subject, checkMetrics)
+	if err != nil {
+		// Redis 不可用时不影响对话
+		log.Warnf("检查配额失败, subject: %+v, error: %v", subject, err)
+		return nil
+	}
+	for _, usage := range usages {
+		if usage.Limit > 0 && usage.Used > usage.Limit {
+			return &ExceededError{Scope: usage.Scope, ID: usage.ID, Metric: usage.Metric, Limit: usage.Limit, Used: usage.Used}
+		}
+	}
+	return nil
+}
+
+// Usage 查询当前窗口的用量, 供管理后台展示
+func (m *Manager) Usage(ctx context.Context, subject Subject) ([]Usage, error) {
+	if m == nil || m.client == nil {
+		return nil, errors.New("redis 未初始化")
+	}
+	return m.usage(ctx, m.loadConfig(), subject, metrics)
+}
+
+func (m *Manager) usage(ctx context.Context, cfg Config, subject Subject, usageMetrics []Metric) ([]Usage, error) {
+	var usages []Usage
+	var cmds []*redis.StringCmd
+	pipe := m.client.Pipeline()
+	for _, scope := range scopes {
+		id := subject.id(scope)
+		if id == "" {
+			continue
+		}
+		for _, metric := range usageMetrics {
+			window, _ := m.window(metric)
+			usages = append(usages, Usage{
+				Scope:  scope,
+				ID:     id,
+				Metric: metric,
+				Window: window,
+				Limit:  cfg.Limits[scope].get(metric),
+			})
+			cmds = append(cmds, pipe.Get(ctx, m.key(scope, id, metric, window)))
+		}
+	}
+	if len(cmds) == 0 {
+		return usages, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		if value, err := cmd.Result(); err == nil {
+			usages[i].Used, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return usages, nil
+}
+
+// EstimateTokens 粗略估算 token 数, 模型未返回用量时使用
+func EstimateTokens(text string) int64 {
+	return int64(window.EstimateTokens(text))
+}
@@ -0,0 +1,71 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	cases := []struct {
+		text string
+		want int64
+	}{
+		{"", 0},
+		{"你好", 2},
+		{"hello world", 3},
+		{"今天天气 sunny", 6},
+	}
+	for _, c := range cases {
+		if got := EstimateTokens(c.text); got != c.want {
+			t.Errorf("EstimateTokens(%q) = %d, 期望 %d", c.text, got, c.want)
+		}
+	}
+}
+
+func TestExceededError(t *testing.T) {
+	var err error = &ExceededError{Scope: ScopeDevice, ID: "d1", Metric: MetricTurns, Limit: 10, Used: 11}
+	if !errors.Is(fmt.Errorf("wrap: %w", err), ErrExceeded) {
+		t.Errorf("ExceededError 应匹配 ErrExceeded")
+	}
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Metric != MetricTurns {
+		t.Errorf("应能取出超出的配额项")
+	}
+}
+
+// TestFailOpen Redis 不可用时不限制对话
+func TestFailOpen(t *testing.T) {
+	viper.Set("quota.enable", true)
+	viper.Set("quota.device.turns_per_minute", 1)
+	defer viper.Set("quota.enable", false)
+
+	m := New(nil, "")
+	subject := Subject{DeviceID: "d1"}
+	for i := 0; i < 3; i++ {
+		if err := m.CheckTurn(context.Background(), subject); err != nil {
+			t.Fatalf("Redis 未初始化时不应限制: %v", err)
+		}
+	}
+	if _, err := m.Usage(context.Background(), subject); err == nil {
+		t.Errorf("Redis 未初始化时查询用量应返回错误")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	viper.Set("quota.user.llm_tokens_per_day", 1000)
+	viper.Set("quota.fallback_message", "")
+	cfg := LoadConfig()
+	if cfg.Limits[ScopeUser].get(MetricLLMTokens) != 1000 {
+		t.Errorf("用户 token 限额错误: %+v", cfg.Limits[ScopeUser])
+	}
+	if cfg.Limits[ScopeAgent].get(MetricTurns) != 0 {
+		t.Errorf("未配置的限额应为 0")
+	}
+	if cfg.FallbackMessage == "" {
+		t.Errorf("应有默认提示语")
+	}
+}
@@ -0,0 +1,399 @@
+package reminder
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+
+	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// ErrUnavailable Redis 未初始化, 无法使用定时提醒
+var ErrUnavailable = errors.New("定时提醒需要 Redis")
+
+// Reminder 一条定时提醒
+type Reminder struct {
+	ID       string `json:"id"`
+	DeviceID string `json:"device_id"`
+	AgentID  string `json:"agent_id"`
+	// 到时间后设备播报的内容
+	Message string `json:"message"`
+	// cron 表达式, 为空时只提醒一次
+	Cron      string    `json:"cron,omitempty"`
+	NextAt    time.Time `json:"next_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Manager 基于 Redis 的定时提醒, 多个节点共享
+//
+// {prefix}:reminder:jobs       hash, id -> 提醒 JSON
+// {prefix}:reminder:due        zset, id, score 为下次提醒的 unix 秒, 节点通过脚本比较并更新提醒内容来领取, 保证只播报一次
+// {prefix}:reminder:device:{id} set, 设备的提醒 id
+// {prefix}:reminder:pending:{id} list, 设备离线时到期的提醒, 下次连接时播报
+type Manager struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+var (
+	defaultManager *Manager
+	once           sync.Once
+)
+
+// Get 获取全局定时提醒管理器
+func Get() *Manager {
+	once.Do(func() {
+		defaultManager = New(i_redis.GetClient(), viper.GetString("redis.key_prefix"))
+	})
+	return defaultManager
+}
+
+// New 创建定时提醒管理器
+func New(client *redis.Client, prefix string) *Manager {
+	return &Manager{
+		client: client,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+// Available Redis 是否可用
+func (m *Manager) Available() bool {
+	return m != nil && m.client != nil
+}
+
+func (m *Manager) key(parts ...string) string {
+	key := "reminder"
+	for _, part := range parts {
+		key += ":" + part
+	}
+	return i_redis.GetKeyWithPrefix(m.prefix, key)
+}
+
+// maxPerDevice 每个设备最多保留的提醒数
+func maxPerDevice() int64 {
+	if v := viper.GetInt64("reminder.max_per_device"); v > 0 {
+		return v
+	}
+	return 20
+}
+
+// pendingTTL 离线提醒的保留时间, 超过后不再补播
+func pendingTTL() time.Duration {
+	if v := viper.GetInt("reminder.pending_ttl_hours"); v > 0 {
+		return time.Duration(v) * time.Hour
+	}
+	return 12 * time.Hour
+}
+
+// lateGrace 到期后允许播报的延迟, 服务停机等原因超过后才领取的提醒不再播报
+func lateGrace() time.Duration {
+	if v := viper.GetInt("reminder.late_grace_seconds"); v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// Late 提醒到期后是否已超过 late_grace_seconds, 过时的提醒播报出来会让用户困惑
+func (m *Manager) Late(r Reminder) bool {
+	return m.now().Sub(r.NextAt) > lateGrace()
+}
+
+// 生成 ID 冲突时的重试次数
+const maxAddAttempts = 5
+
+// newID 提醒 ID, 用户通过语音取消提醒, 不宜太长, 写入时用 HSETNX 保证不覆盖已有的提醒
+func newID() string {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// 设备提醒数未达上限且 ID 未被占用时保存, 返回 -1 表示达到上限, 0 表示 ID 冲突
+var addScript = redis.NewScript(`
+if redis.call('SCARD', KEYS[3]) >= tonumber(ARGV[4]) then
+	return -1
+end
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+redis.call('SADD', KEYS[3], ARGV[1])
+return 1
+`)
+
+// 提醒内容未被其它节点改动时领取: ARGV[3] 为空时删除, 否则保存下一次的内容和时间
+// 领取后内容已经改变或删除, 其它节点读到的旧内容不再匹配, 保证每次到期只被领取一次
+var claimScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] or not redis.call('ZSCORE', KEYS[2], ARGV[1]) then
+	return 0
+end
+if ARGV[3] == '' then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('SREM', KEYS[3], ARGV[1])
+else
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+	redis.call('ZADD', KEYS[2], ARGV[4], ARGV[1])
+end
+return 1
+`)
+
+// Add 保存提醒, 填充 ID 和 CreatedAt, 重复提醒按 Cron 计算 NextAt
+func (m *Manager) Add(ctx context.Context, r *Reminder) error {
+	if !m.Available() {
+		return ErrUnavailable
+	}
+	now := m.now()
+	if r.Cron != "" {
+		schedule, err := ParseCron(r.Cron)
+		if err != nil {
+			return err
+		}
+		// NextAt 本身满足 cron 时从 NextAt 开始, 否则取 now 之后的下一次
+		after := now
+		if r.NextAt.After(now) {
+			after = r.NextAt.Add(-time.Minute)
+		}
+		if r.NextAt = schedule.Next(after); r.NextAt.IsZero() {
+			return fmt.Errorf("cron 表达式 %q 没有可触发的时间", r.Cron)
+		}
+	}
+	if !r.NextAt.After(now) {
+		return fmt.Errorf("提醒时间 %s 已经过去", r.NextAt.Format("2006-01-02 15:04"))
+	}
+
+	r.CreatedAt = now
+	for i := 0; i < maxAddAttempts; i++ {
+		r.ID = newID()
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		result, err := addScript.Run(ctx, m.client,
+			[]string{m.key("jobs"), m.key("due"), m.key("device", r.DeviceID)},
+			r.ID, data, r.NextAt.Unix(), maxPerDevice(),
+		).Int()
+		if err != nil {
+			return fmt.Errorf("保存提醒失败: %w", err)
+		}
+		switch result {
+		case 1:
+			return nil
+		case -1:
+			return fmt.Errorf("提醒数量已达上限 %d 个, 请先取消不需要的提醒", maxPerDevice())
+		}
+	}
+	return fmt.Errorf("保存提醒失败: 生成提醒 ID 冲突")
+}
+
+// List 设备的全部提醒, 按下次提醒时间排序
+func (m *Manager) List(ctx context.Context, deviceID string) ([]Reminder, error) {
+	if !m.Available() {
+		return nil, ErrUnavailable
+	}
+	deviceKey := m.key("device", deviceID)
+	ids, err := m.client.SMembers(ctx, deviceKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取提醒失败: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	values, err := m.client.HMGet(ctx, m.key("jobs"), ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取提醒失败: %w", err)
+	}
+	reminders := make([]Reminder, 0, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		var r Reminder
+		if !ok || json.Unmarshal([]byte(data), &r) != nil {
+			// 已经提醒过的一次性提醒
+			m.client.SRem(ctx, deviceKey, ids[i])
+			continue
+		}
+		reminders = append(reminders, r)
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].NextAt.Before(reminders[j].NextAt) })
+	return reminders, nil
+}
+
+// Cancel 取消设备的提醒, 同时删除离线期间到期、等待补播的副本, 提醒不存在或不属于该设备时返回 false
+func (m *Manager) Cancel(ctx context.Context, deviceID string, id string) (bool, error) {
+	if !m.Available() {
+		return false, ErrUnavailable
+	}
+	removed, err := m.removePending(ctx, deviceID, id)
+	if err != nil {
+		return false, err
+	}
+	deviceKey := m.key("device", deviceID)
+	exists, err := m.client.SIsMember(ctx, deviceKey, id).Result()
+	if err != nil {
+		return false, fmt.Errorf("读取提醒失败: %w", err)
+	}
+	if !exists {
+		return removed, nil
+	}
+	pipe := m.client.TxPipeline()
+	pipe.HDel(ctx, m.key("jobs"), id)
+	pipe.ZRem(ctx, m.key("due"), id)
+	pipe.SRem(ctx, deviceKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("取消提醒失败: %w", err)
+	}
+	return true, nil
+}
+
+// TakeDue 领取最多 limit 条到期的提醒, 返回的 NextAt 为本次到期的时间
+// 领取时原子地把重复提醒改为下一次时间、删除一次性提醒, 播报前节点退出也不会丢失之后的重复提醒
+func (m *Manager) TakeDue(ctx context.Context, limit int64) ([]Reminder, error) {
+	if !m.Available() {
+		return nil, ErrUnavailable
+	}
+	now := m.now()
+	ids, err := m.client.ZRangeByScore(ctx, m.key("due"), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取到期提醒失败: %w", err)
+	}
+
+	var due []Reminder
+	for _, id := range ids {
+		data, err := m.client.HGet(ctx, m.key("jobs"), id).Result()
+		if err == redis.Nil {
+			m.client.ZRem(ctx, m.key("due"), id)
+			continue
+		} else if err != nil {
+			continue
+		}
+		var r Reminder
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			log.Warnf("解析提醒 %s 失败: %v", id, err)
+			m.client.HDel(ctx, m.key("jobs"), id)
+			m.client.ZRem(ctx, m.key("due"), id)
+			continue
+		}
+
+		// 一次性提醒传空内容, 领取时删除
+		var nextData string
+		var nextScore int64
+		if next, ok := nextOccurrence(r, now); ok {
+			value, err := json.Marshal(next)
+			if err != nil {
+				continue
+			}
+			nextData, nextScore = string(value), next.NextAt.Unix()
+		}
+		claimed, err := claimScript.Run(ctx, m.client,
+			[]string{m.key("jobs"), m.key("due"), m.key("device", r.DeviceID)},
+			id, data, nextData, nextScore,
+		).Int()
+		if err != nil {
+			log.Warnf("领取提醒 %s 失败: %v", id, err)
+			continue
+		}
+		// 其它节点已经领取
+		if claimed == 0 {
+			continue
+		}
+		due = append(due, r)
+	}
+	return due, nil
+}
+
+// nextOccurrence 重复提醒在 now 之后的下一次, 一次性提醒或没有下一次时返回 false
+func nextOccurrence(r Reminder, now time.Time) (Reminder, bool) {
+	if r.Cron == "" {
+		return r, false
+	}
+	schedule, err := ParseCron(r.Cron)
+	if err != nil {
+		return r, false
+	}
+	if r.NextAt = schedule.Next(now); r.NextAt.IsZero() {
+		return r, false
+	}
+	return r, true
+}
+
+// AddPending 保存设备离线时到期的提醒
+func (m *Manager) AddPending(ctx context.Context, r Reminder) error {
+	if !m.Available() {
+		return ErrUnavailable
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := m.key("pending", r.DeviceID)
+	pipe := m.client.TxPipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, -maxPerDevice(), -1)
+	pipe.Expire(ctx, key, pendingTTL())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("保存离线提醒失败: %w", err)
+	}
+	return nil
+}
+
+// removePending 删除设备等待补播的提醒中 ID 为 id 的副本
+func (m *Manager) removePending(ctx context.Context, deviceID string, id string) (bool, error) {
+	key := m.key("pending", deviceID)
+	values, err := m.client.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return false, fmt.Errorf("读取离线提醒失败: %w", err)
+	}
+	removed := false
+	for _, value := range values {
+		var r Reminder
+		if err := json.Unmarshal([]byte(value), &r); err != nil || r.ID != id {
+			continue
+		}
+		if err := m.client.LRem(ctx, key, 0, value).Err(); err != nil {
+			return false, fmt.Errorf("删除离线提醒失败: %w", err)
+		}
+		removed = true
+	}
+	return removed, nil
+}
+
+// TakePending 取出设备离线期间到期的提醒, 超过 pending_ttl_hours 的不再返回
+func (m *Manager) TakePending(ctx context.Context, deviceID string) ([]Reminder, error) {
+	if !m.Available() {
+		return nil, ErrUnavailable
+	}
+	key := m.key("pending", deviceID)
+	pipe := m.client.TxPipeline()
+	values := pipe.LRange(ctx, key, 0, -1)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("读取离线提醒失败: %w", err)
+	}
+	expireBefore := m.now().Add(-pendingTTL())
+	var reminders []Reminder
+	for _, value := range values.Val() {
+		var r Reminder
+		if err := json.Unmarshal([]byte(value), &r); err != nil || r.NextAt.Before(expireBefore) {
+			continue
+		}
+		reminders = append(reminders, r)
+	}
+	return reminders, nil
+}
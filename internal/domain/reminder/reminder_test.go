@@ -0,0 +1,197 @@
+package reminder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestManager(t *testing.T, now time.Time) *Manager {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	m := New(client, "xiaozhi")
+	m.now = func() time.Time { return now }
+	return m
+}
+
+func TestNextOccurrence(t *testing.T) {
+	now := mustTime(t, "2025-03-07 20:30")
+
+	// 重复提醒从本次到期时间之后计算下一次, 其它字段不变
+	r := Reminder{ID: "a1b2c3d4", DeviceID: "dev", Message: "喝水", Cron: "30 20 * * *", NextAt: now}
+	next, ok := nextOccurrence(r, now)
+	if !ok || !next.NextAt.Equal(mustTime(t, "2025-03-08 20:30")) {
+		t.Fatalf("下一次提醒时间错误: %v, %v", next.NextAt, ok)
+	}
+	if next.ID != r.ID || next.Message != r.Message || !r.NextAt.Equal(now) {
+		t.Errorf("不应修改提醒的其它字段: %+v, %+v", next, r)
+	}
+
+	// 一次性提醒和无效的 cron 没有下一次, 领取时删除
+	if _, ok := nextOccurrence(Reminder{NextAt: now}, now); ok {
+		t.Errorf("一次性提醒不应有下一次")
+	}
+	if _, ok := nextOccurrence(Reminder{Cron: "invalid", NextAt: now}, now); ok {
+		t.Errorf("无效的 cron 不应有下一次")
+	}
+}
+
+func TestNewID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := newID()
+		if len(id) != 8 {
+			t.Fatalf("ID 长度错误: %q", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) < 999 {
+		t.Errorf("ID 重复过多: %d", 1000-len(seen))
+	}
+}
+
+func TestAddScript(t *testing.T) {
+	m := newTestManager(t, time.Now())
+	ctx := context.Background()
+	keys := []string{m.key("jobs"), m.key("due"), m.key("device", "dev")}
+
+	run := func(id string, limit int) int {
+		result, err := addScript.Run(ctx, m.client, keys, id, `{"id":"`+id+`"}`, 100, limit).Int()
+		if err != nil {
+			t.Fatalf("执行脚本失败: %v", err)
+		}
+		return result
+	}
+	if result := run("a", 2); result != 1 {
+		t.Fatalf("保存提醒失败: %d", result)
+	}
+	// ID 已被占用时不覆盖
+	if result := run("a", 2); result != 0 {
+		t.Errorf("ID 冲突时应返回 0: %d", result)
+	}
+	if data, _ := m.client.HGet(ctx, keys[0], "a").Result(); data != `{"id":"a"}` {
+		t.Errorf("ID 冲突时不应覆盖已有的提醒: %s", data)
+	}
+	if result := run("b", 2); result != 1 {
+		t.Fatalf("保存提醒失败: %d", result)
+	}
+	// 达到上限时不保存
+	if result := run("c", 2); result != -1 {
+		t.Errorf("达到上限时应返回 -1: %d", result)
+	}
+	if n := m.client.SCard(ctx, keys[2]).Val(); n != 2 {
+		t.Errorf("设备提醒数错误: %d", n)
+	}
+	if _, err := m.client.HGet(ctx, keys[0], "c").Result(); err != redis.Nil {
+		t.Errorf("达到上限时不应保存提醒")
+	}
+}
+
+func TestTakeDueOnce(t *testing.T) {
+	now := mustTime(t, "2025-03-07 20:00")
+	m := newTestManager(t, now)
+	ctx := context.Background()
+
+	once := &Reminder{DeviceID: "dev", Message: "开会", NextAt: now.Add(time.Minute)}
+	daily := &Reminder{DeviceID: "dev", Message: "喝水", Cron: "30 20 * * *"}
+	for _, r := range []*Reminder{once, daily} {
+		if err := m.Add(ctx, r); err != nil {
+			t.Fatalf("添加提醒失败: %v", err)
+		}
+	}
+
+	// 到期后只能领取一次, 一次性提醒领取时删除, 重复提醒更新为下一次
+	m.now = func() time.Time { return mustTime(t, "2025-03-07 20:30") }
+	due, err := m.TakeDue(ctx, 10)
+	if err != nil || len(due) != 2 {
+		t.Fatalf("领取到期提醒错误: %+v, %v", due, err)
+	}
+	if due, _ := m.TakeDue(ctx, 10); len(due) != 0 {
+		t.Errorf("同一次到期不应被重复领取: %+v", due)
+	}
+	reminders, err := m.List(ctx, "dev")
+	if err != nil || len(reminders) != 1 || reminders[0].ID != daily.ID || !reminders[0].NextAt.Equal(mustTime(t, "2025-03-08 20:30")) {
+		t.Errorf("领取后的提醒错误: %+v, %v", reminders, err)
+	}
+
+	// 其它节点已领取时内容不匹配, 脚本不再领取
+	data := m.client.HGet(ctx, m.key("jobs"), daily.ID).Val()
+	keys := []string{m.key("jobs"), m.key("due"), m.key("device", "dev")}
+	if claimed, _ := claimScript.Run(ctx, m.client, keys, daily.ID, data, "", 0).Int(); claimed != 1 {
+		t.Fatalf("领取失败: %d", claimed)
+	}
+	if claimed, _ := claimScript.Run(ctx, m.client, keys, daily.ID, data, "", 0).Int(); claimed != 0 {
+		t.Errorf("重复领取应返回 0: %d", claimed)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	now := mustTime(t, "2025-03-07 20:00")
+	m := newTestManager(t, now)
+	ctx := context.Background()
+
+	r := &Reminder{DeviceID: "dev", Message: "开会", NextAt: now.Add(time.Hour)}
+	if err := m.Add(ctx, r); err != nil {
+		t.Fatalf("添加提醒失败: %v", err)
+	}
+	if ok, err := m.Cancel(ctx, "other", r.ID); ok || err != nil {
+		t.Errorf("不应取消其它设备的提醒: %v, %v", ok, err)
+	}
+	if ok, err := m.Cancel(ctx, "dev", r.ID); !ok || err != nil {
+		t.Fatalf("取消提醒失败: %v, %v", ok, err)
+	}
+	if reminders, _ := m.List(ctx, "dev"); len(reminders) != 0 {
+		t.Errorf("取消后不应再列出: %+v", reminders)
+	}
+	if n := m.client.ZCard(ctx, m.key("due")).Val(); n != 0 {
+		t.Errorf("取消后不应再到期: %d", n)
+	}
+
+	// 离线期间到期、等待补播的提醒取消后不再补播
+	pending := Reminder{ID: "p1", DeviceID: "dev", Message: "吃药", NextAt: now}
+	m.AddPending(ctx, pending)
+	m.AddPending(ctx, Reminder{ID: "p2", DeviceID: "dev", Message: "散步", NextAt: now})
+	if ok, err := m.Cancel(ctx, "dev", "p1"); !ok || err != nil {
+		t.Fatalf("取消离线提醒失败: %v, %v", ok, err)
+	}
+	rest, err := m.TakePending(ctx, "dev")
+	if err != nil || len(rest) != 1 || rest[0].ID != "p2" {
+		t.Errorf("取消后的离线提醒错误: %+v, %v", rest, err)
+	}
+}
+
+func TestListRemovesFinished(t *testing.T) {
+	now := mustTime(t, "2025-03-07 20:00")
+	m := newTestManager(t, now)
+	ctx := context.Background()
+
+	// 设备集合中已经没有内容的 ID 在列出时清理
+	m.client.SAdd(ctx, m.key("device", "dev"), "gone")
+	r := &Reminder{DeviceID: "dev", Message: "开会", NextAt: now.Add(time.Hour)}
+	if err := m.Add(ctx, r); err != nil {
+		t.Fatalf("添加提醒失败: %v", err)
+	}
+	reminders, err := m.List(ctx, "dev")
+	if err != nil || len(reminders) != 1 || reminders[0].ID != r.ID {
+		t.Fatalf("列出提醒错误: %+v, %v", reminders, err)
+	}
+	if m.client.SIsMember(ctx, m.key("device", "dev"), "gone").Val() {
+		t.Errorf("应清理已经不存在的提醒 ID")
+	}
+}
+
+func TestLate(t *testing.T) {
+	now := mustTime(t, "2025-03-07 20:00")
+	m := newTestManager(t, now)
+	if m.Late(Reminder{NextAt: now.Add(-time.Minute)}) {
+		t.Errorf("刚到期的提醒应播报")
+	}
+	if !m.Late(Reminder{NextAt: now.Add(-time.Hour)}) {
+		t.Errorf("停机期间到期的提醒不应播报")
+	}
+}
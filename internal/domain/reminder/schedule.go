@@ -0,0 +1,168 @@
+package reminder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 重复方式的简写, 与提醒时间的时分组合成 cron 表达式
+var repeatAliases = map[string]string{
+	"daily":    "*",
+	"weekdays": "1-5",
+	"weekends": "0,6",
+}
+
+// Schedule 标准 5 段 cron 表达式: 分 时 日 月 周, 支持 *、逗号列表、a-b 范围和 /步长, 周日为 0 或 7
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// 日和周都不是 * 时满足其一即可, 与 crontab 一致
+	domStar, dowStar bool
+}
+
+// ParseCron 解析 5 段 cron 表达式
+func ParseCron(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron 表达式需要 5 段(分 时 日 月 周): %q", spec)
+	}
+	s := &Schedule{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 7 和 0 都表示周日
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("cron 步长错误: %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("cron 字段错误: %q", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("cron 字段错误: %q", part)
+				}
+			} else if step > 1 {
+				// 5/10 表示从 5 开始每 10 个
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("cron 字段超出范围 %d-%d: %q", min, max, part)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next 返回 after 之后的下一次触发时间, 使用 after 的时区, 5 年内没有触发时间时返回零值
+func (s *Schedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < 366*5; i++ {
+		d := day.AddDate(0, 0, i)
+		if !s.matchDay(d) {
+			continue
+		}
+		for h := 0; h < 24; h++ {
+			if s.hour&(1<<uint(h)) == 0 {
+				continue
+			}
+			for m := 0; m < 60; m++ {
+				if s.minute&(1<<uint(m)) == 0 {
+					continue
+				}
+				if t := time.Date(d.Year(), d.Month(), d.Day(), h, m, 0, 0, loc); t.After(after) {
+					return t
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// ParseTime 解析提醒时间, 支持 "2006-01-02 15:04" 和 "15:04", 只有时分时取 now 之后最近的一次
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, now.Location()); err == nil {
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("时间格式错误, 应为 HH:MM 或 YYYY-MM-DD HH:MM: %q", value)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// RepeatToCron 将重复方式转换为 cron 表达式
+// repeat 为 daily、weekdays、weekends、weekly 时取 at 的时分(weekly 还取星期), 其它值按 cron 表达式校验后原样返回
+func RepeatToCron(repeat string, at time.Time) (string, error) {
+	repeat = strings.TrimSpace(repeat)
+	if repeat == "" {
+		return "", nil
+	}
+	if repeat == "weekly" {
+		return fmt.Sprintf("%d %d * * %d", at.Minute(), at.Hour(), at.Weekday()), nil
+	}
+	if dow, ok := repeatAliases[repeat]; ok {
+		return fmt.Sprintf("%d %d * * %s", at.Minute(), at.Hour(), dow), nil
+	}
+	if _, err := ParseCron(repeat); err != nil {
+		return "", err
+	}
+	return repeat, nil
+}
@@ -0,0 +1,111 @@
+package reminder
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	tm, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+	if err != nil {
+		t.Fatalf("解析时间失败: %v", err)
+	}
+	return tm
+}
+
+func TestScheduleNext(t *testing.T) {
+	// 2025-03-07 是周五
+	now := mustTime(t, "2025-03-07 20:30")
+	cases := []struct {
+		spec string
+		want string
+	}{
+		{"30 20 * * *", "2025-03-08 20:30"},
+		{"45 20 * * *", "2025-03-07 20:45"},
+		{"30 20 * * 1-5", "2025-03-10 20:30"},
+		{"0 9 * * 0,6", "2025-03-08 09:00"},
+		{"0 9 * * 7", "2025-03-09 09:00"},
+		{"*/15 * * * *", "2025-03-07 20:45"},
+		{"0 8 1 * *", "2025-04-01 08:00"},
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		// 日和周都指定时满足其一即可
+		{"0 7 15 * 1", "2025-03-10 07:00"},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.spec)
+		if err != nil {
+			t.Fatalf("解析 %q 失败: %v", c.spec, err)
+		}
+		if got := schedule.Next(now); !got.Equal(mustTime(t, c.want)) {
+			t.Errorf("%q 的下一次时间为 %s, 期望 %s", c.spec, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+}
+
+func TestParseCronError(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("%q 应解析失败", spec)
+		}
+	}
+	if schedule, _ := ParseCron("0 0 30 2 *"); !schedule.Next(time.Now()).IsZero() {
+		t.Errorf("2 月 30 日不应有触发时间")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := mustTime(t, "2025-03-07 20:30")
+	cases := map[string]string{
+		"21:00":            "2025-03-07 21:00",
+		"20:30":            "2025-03-08 20:30",
+		"07:00":            "2025-03-08 07:00",
+		"2025-03-10 08:15": "2025-03-10 08:15",
+	}
+	for value, want := range cases {
+		got, err := ParseTime(value, now)
+		if err != nil {
+			t.Fatalf("解析 %q 失败: %v", value, err)
+		}
+		if !got.Equal(mustTime(t, want)) {
+			t.Errorf("ParseTime(%q) = %s, 期望 %s", value, got.Format("2006-01-02 15:04"), want)
+		}
+	}
+	if _, err := ParseTime("明天早上", now); err == nil {
+		t.Errorf("无法识别的时间应返回错误")
+	}
+}
+
+func TestRepeatToCron(t *testing.T) {
+	at := mustTime(t, "2025-03-07 20:30")
+	cases := map[string]string{
+		"":             "",
+		"daily":        "30 20 * * *",
+		"weekdays":     "30 20 * * 1-5",
+		"weekends":     "30 20 * * 0,6",
+		"weekly":       "30 20 * * 5",
+		"0 21 * * 1-5": "0 21 * * 1-5",
+	}
+	for repeat, want := range cases {
+		got, err := RepeatToCron(repeat, at)
+		if err != nil || got != want {
+			t.Errorf("RepeatToCron(%q) = %q, %v, 期望 %q", repeat, got, err, want)
+		}
+	}
+	if _, err := RepeatToCron("monthly", at); err == nil {
+		t.Errorf("不支持的重复方式应返回错误")
+	}
+}
+
+// TestUnavailable Redis 未初始化时返回 ErrUnavailable
+func TestUnavailable(t *testing.T) {
+	m := New(nil, "")
+	if err := m.Add(context.Background(), &Reminder{DeviceID: "d1", NextAt: time.Now().Add(time.Hour)}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Add 应返回 ErrUnavailable: %v", err)
+	}
+	if _, err := m.TakeDue(context.Background(), 10); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("TakeDue 应返回 ErrUnavailable: %v", err)
+	}
+}
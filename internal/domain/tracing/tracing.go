@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const tracerName = "xiaozhi-esp32-server-golang"
+
+// 导出方式
+const (
+	ExporterOTLP = "otlp" // 通过 OTLP/HTTP 发送到 collector
+	ExporterFile = "file" // 以 JSON 写入本地文件，无需 collector
+)
+
+// 常用的span属性
+const (
+	AttrSessionID = attribute.Key("xiaozhi.session_id")
+	AttrDeviceID  = attribute.Key("xiaozhi.device_id")
+	AttrProvider  = attribute.Key("xiaozhi.provider")
+	AttrText      = attribute.Key("xiaozhi.text")
+	AttrModel     = attribute.Key("xiaozhi.model")
+	AttrTool      = attribute.Key("xiaozhi.tool")
+)
+
+// 记录对话文本时默认的最大字数
+const defaultMaxTextLength = 200
+
+var tracerProvider *sdktrace.TracerProvider
+
+// Init 根据 tracing 配置初始化全局 TracerProvider，未启用时使用默认的空实现
+func Init() error {
+	if !viper.GetBool("tracing.enable") {
+		return nil
+	}
+
+	exporter, err := newExporter(viper.GetString("tracing.exporter"))
+	if err != nil {
+		return err
+	}
+
+	serviceName := viper.GetString("tracing.service_name")
+	if serviceName == "" {
+		serviceName = "xiaozhi-server"
+	}
+	sampleRatio := 1.0
+	if viper.IsSet("tracing.sample_ratio") {
+		sampleRatio = viper.GetFloat64("tracing.sample_ratio")
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	log.Infof("链路追踪已启用, 导出方式: %s, 采样率: %.2f", viper.GetString("tracing.exporter"), sampleRatio)
+	return nil
+}
+
+func newExporter(exporterType string) (sdktrace.SpanExporter, error) {
+	switch exporterType {
+	case ExporterOTLP, "":
+		opts := []otlptracehttp.Option{}
+		if endpoint := viper.GetString("tracing.otlp.endpoint"); endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if viper.GetBool("tracing.otlp.insecure") {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if headers := viper.GetStringMapString("tracing.otlp.headers"); len(headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(headers))
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	case ExporterFile:
+		path := viper.GetString("tracing.file.path")
+		if path == "" {
+			path = "logs/traces.json"
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("创建追踪文件目录失败: %v", err)
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("打开追踪文件失败: %v", err)
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("不支持的追踪导出方式: %s", exporterType)
+	}
+}
+
+// Shutdown 导出剩余的span并关闭
+func Shutdown(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
+
+// StartSpan 以 ctx 中的span为父span创建子span
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartTurn 开始一轮对话的根span
+func StartTurn(ctx context.Context, sessionID string, deviceID string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "chat.turn",
+		trace.WithNewRoot(),
+		trace.WithAttributes(AttrSessionID.String(sessionID), AttrDeviceID.String(deviceID)),
+	)
+}
+
+// TextAttrs 对话文本属性。文本可能包含用户隐私，开启 tracing.record_text 时才记录，超过 tracing.max_text_length 个字时截断
+// 未开启时返回空，调用方展开后传给 StartSpan 或 SetAttributes
+func TextAttrs(key attribute.Key, text string) []attribute.KeyValue {
+	if !viper.GetBool("tracing.record_text") {
+		return nil
+	}
+	maxLength := viper.GetInt("tracing.max_text_length")
+	if maxLength <= 0 {
+		maxLength = defaultMaxTextLength
+	}
+	if runes := []rune(text); len(runes) > maxLength {
+		text = string(runes[:maxLength]) + "..."
+	}
+	return []attribute.KeyValue{key.String(text)}
+}
+
+// EndSpan 结束span，err 不为空时标记为错误
+func EndSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// WithSpan 将 from 中的span放入 ctx，保留 ctx 原有的取消控制
+func WithSpan(ctx context.Context, from context.Context) context.Context {
+	if from == nil {
+		return ctx
+	}
+	return trace.ContextWithSpan(ctx, trace.SpanFromContext(from))
+}
@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTextAttrs(t *testing.T) {
+	previous := viper.Get("tracing")
+	t.Cleanup(func() { viper.Set("tracing", previous) })
+
+	// 默认不记录对话文本
+	viper.Set("tracing", map[string]interface{}{})
+	if attrs := TextAttrs(AttrText, "你好"); len(attrs) != 0 {
+		t.Fatalf("未开启时不应记录文本: %v", attrs)
+	}
+
+	viper.Set("tracing", map[string]interface{}{"record_text": true, "max_text_length": 3})
+	attrs := TextAttrs(AttrText, "今天天气不错")
+	if len(attrs) != 1 || attrs[0].Key != AttrText || attrs[0].Value.AsString() != "今天天..." {
+		t.Fatalf("文本应按字数截断: %v", attrs)
+	}
+	if attrs := TextAttrs(AttrText, "你好"); attrs[0].Value.AsString() != "你好" {
+		t.Errorf("未超长的文本不应截断: %v", attrs)
+	}
+
+	// 未配置长度时使用默认值
+	viper.Set("tracing", map[string]interface{}{"record_text": true})
+	if attrs := TextAttrs(AttrText, strings.Repeat("字", 300)); len([]rune(attrs[0].Value.AsString())) != defaultMaxTextLength+3 {
+		t.Errorf("默认长度错误: %d", len([]rune(attrs[0].Value.AsString())))
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"xiaozhi-esp32-server-golang/internal/domain/tts/doubao"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/edge"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/edge_offline"
+	"xiaozhi-esp32-server-golang/internal/domain/tts/mock"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/openai"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/xiaozhi"
 )
@@ -24,6 +25,12 @@ type TTSProvider interface {
 	BaseTTSProvider
 }
 
+// StreamResultTTSProvider 流式合成结束后通过 done 通道报告结果，nil 表示完整合成
+// 未实现的提供者中途出错时同样只是关闭输出通道，调用方无法和正常结束区分
+type StreamResultTTSProvider interface {
+	TextToSpeechStreamWithResult(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (outputChan chan []byte, done <-chan error, err error)
+}
+
 // GetTTSProvider 获取一个完整的TTS提供者（支持Context）
 func GetTTSProvider(providerName string, config map[string]interface{}) (TTSProvider, error) {
 	var baseProvider BaseTTSProvider
@@ -43,6 +50,14 @@ func GetTTSProvider(providerName string, config map[string]interface{}) (TTSProv
 		baseProvider = xiaozhi.NewXiaozhiProvider(config)
 	case constants.TtsTypeOpenAI:
 		baseProvider = openai.NewOpenAITTSProvider(config)
+	case constants.TtsTypeFailover:
+		failoverProvider, err := NewFailoverTTSProvider(config)
+		if err != nil {
+			return nil, err
+		}
+		baseProvider = failoverProvider
+	case constants.TtsTypeMock:
+		baseProvider = mock.NewMockTTSProvider(config)
 	default:
 		return nil, fmt.Errorf("不支持的TTS提供者: %s", providerName)
 	}
@@ -72,6 +87,15 @@ func (a *ContextTTSAdapter) TextToSpeechStream(ctx context.Context, text string,
 	return a.Provider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
 }
 
+// TextToSpeechStreamWithResult 提供者支持时报告流式合成结果，否则 done 为 nil
+func (a *ContextTTSAdapter) TextToSpeechStreamWithResult(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (outputChan chan []byte, done <-chan error, err error) {
+	if provider, ok := a.Provider.(StreamResultTTSProvider); ok {
+		return provider.TextToSpeechStreamWithResult(ctx, text, sampleRate, channels, frameDuration)
+	}
+	outputChan, err = a.Provider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+	return outputChan, nil, err
+}
+
 // TextToSpeechWithContext 使用Context版本的文本转语音
 func (a *ContextTTSAdapter) TextToSpeechWithContext(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
 	// 检查提供者是否直接支持Context版本
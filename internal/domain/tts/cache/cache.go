@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+// Config TTS音频缓存配置
+type Config struct {
+	Enable        bool          // 是否启用缓存
+	MaxEntries    int           // 内存缓存最多条目数
+	MaxBytes      int64         // 内存缓存最大字节数
+	MaxTextLength int           // 只缓存不超过该长度(字符数)的文本，长句很少重复
+	TTL           time.Duration // Redis/磁盘缓存过期时间，0 表示不过期
+	RedisEnable   bool          // 是否启用Redis缓存
+	DiskDir       string        // 磁盘缓存目录，为空表示不启用
+}
+
+// store 内存之外的二级缓存
+type store interface {
+	Get(ctx context.Context, key string) ([][]byte, bool)
+	Set(ctx context.Context, key string, frames [][]byte)
+}
+
+type entry struct {
+	key    string
+	frames [][]byte
+	size   int64
+}
+
+// Cache 存储TTS生成的Opus帧，内存LRU + 可选的Redis/磁盘二级缓存
+type Cache struct {
+	config Config
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	bytes int64
+
+	stores []store
+
+	hits   int64
+	misses int64
+}
+
+var (
+	globalCache *Cache
+	globalOnce  sync.Once
+)
+
+// GetCache 获取全局TTS缓存，配置读取自 tts_cache
+func GetCache() *Cache {
+	globalOnce.Do(func() {
+		config := Config{
+			Enable:        viper.GetBool("tts_cache.enable"),
+			MaxEntries:    viper.GetInt("tts_cache.max_entries"),
+			MaxBytes:      viper.GetInt64("tts_cache.max_memory_mb") * 1024 * 1024,
+			MaxTextLength: viper.GetInt("tts_cache.max_text_length"),
+			TTL:           time.Duration(viper.GetInt("tts_cache.ttl")) * time.Second,
+			RedisEnable:   viper.GetBool("tts_cache.redis.enable"),
+			DiskDir:       viper.GetString("tts_cache.disk.dir"),
+		}
+		globalCache = NewCache(config)
+		if config.Enable {
+			log.Infof("TTS音频缓存已启用, 内存条目: %d, 内存上限: %d bytes, redis: %v, 磁盘: %s",
+				globalCache.config.MaxEntries, globalCache.config.MaxBytes, config.RedisEnable, config.DiskDir)
+		}
+	})
+	return globalCache
+}
+
+// NewCache 创建TTS缓存
+func NewCache(config Config) *Cache {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 500
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 64 * 1024 * 1024
+	}
+	if config.MaxTextLength <= 0 {
+		config.MaxTextLength = 64
+	}
+
+	c := &Cache{
+		config: config,
+		lru:    list.New(),
+		items:  make(map[string]*list.Element),
+	}
+	if !config.Enable {
+		return c
+	}
+
+	if config.RedisEnable {
+		if client := i_redis.GetClient(); client != nil {
+			c.stores = append(c.stores, &redisStore{
+				client: client,
+				prefix: viper.GetString("redis.key_prefix") + "tts_cache:",
+				ttl:    config.TTL,
+			})
+		} else {
+			log.Warnf("TTS缓存未能启用Redis: Redis客户端未初始化")
+		}
+	}
+	if config.DiskDir != "" {
+		if err := os.MkdirAll(config.DiskDir, 0755); err != nil {
+			log.Warnf("TTS缓存未能启用磁盘缓存, 创建目录 %s 失败: %v", config.DiskDir, err)
+		} else {
+			c.stores = append(c.stores, &diskStore{dir: config.DiskDir, ttl: config.TTL})
+		}
+	}
+	return c
+}
+
+// Enabled 是否启用缓存
+func (c *Cache) Enabled() bool {
+	return c != nil && c.config.Enable
+}
+
+// Cacheable 判断文本是否适合缓存
+func (c *Cache) Cacheable(text string) bool {
+	n := len([]rune(text))
+	return c.Enabled() && n > 0 && n <= c.config.MaxTextLength
+}
+
+// Get 先查内存，再依次查二级缓存，命中二级缓存时回填内存
+func (c *Cache) Get(ctx context.Context, key string) ([][]byte, bool) {
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		c.lru.MoveToFront(elem)
+		c.hits++
+		frames := elem.Value.(*entry).frames
+		c.mu.Unlock()
+		return frames, true
+	}
+	c.mu.Unlock()
+
+	for _, s := range c.stores {
+		if frames, ok := s.Get(ctx, key); ok {
+			c.setMemory(key, frames)
+			c.mu.Lock()
+			c.hits++
+			c.mu.Unlock()
+			return frames, true
+		}
+	}
+
+	c.mu.Lock()
+	c.misses++
+	c.mu.Unlock()
+	return nil, false
+}
+
+// Set 写入内存及所有二级缓存
+func (c *Cache) Set(ctx context.Context, key string, frames [][]byte) {
+	if len(frames) == 0 {
+		return
+	}
+	c.setMemory(key, frames)
+	for _, s := range c.stores {
+		s.Set(ctx, key, frames)
+	}
+}
+
+// Stats 返回命中次数、未命中次数和内存中的条目数
+func (c *Cache) Stats() (hits int64, misses int64, entries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses, c.lru.Len()
+}
+
+func (c *Cache) setMemory(key string, frames [][]byte) {
+	var size int64
+	for _, frame := range frames {
+		size += int64(len(frame))
+	}
+	if size > c.config.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		old := elem.Value.(*entry)
+		c.bytes += size - old.size
+		old.frames = frames
+		old.size = size
+		c.lru.MoveToFront(elem)
+	} else {
+		c.items[key] = c.lru.PushFront(&entry{key: key, frames: frames, size: size})
+		c.bytes += size
+	}
+
+	for c.lru.Len() > c.config.MaxEntries || c.bytes > c.config.MaxBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		e := oldest.Value.(*entry)
+		c.lru.Remove(oldest)
+		delete(c.items, e.key)
+		c.bytes -= e.size
+	}
+}
+
+// encodeFrames 将Opus帧编码为 [4字节长度][帧数据]... 的格式
+func encodeFrames(frames [][]byte) []byte {
+	size := 0
+	for _, frame := range frames {
+		size += 4 + len(frame)
+	}
+	data := make([]byte, 0, size)
+	for _, frame := range frames {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(frame)))
+		data = append(data, frame...)
+	}
+	return data
+}
+
+func decodeFrames(data []byte) ([][]byte, error) {
+	var frames [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("缓存数据格式错误")
+		}
+		n := int(binary.BigEndian.Uint32(data))
+		data = data[4:]
+		if len(data) < n {
+			return nil, errors.New("缓存数据格式错误")
+		}
+		frames = append(frames, data[:n:n])
+		data = data[n:]
+	}
+	return frames, nil
+}
+
+// redisStore Redis二级缓存，多实例间共享
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([][]byte, bool) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Warnf("读取TTS Redis缓存失败: %v", err)
+		}
+		return nil, false
+	}
+	frames, err := decodeFrames(data)
+	if err != nil {
+		log.Warnf("解析TTS Redis缓存失败: %v", err)
+		return nil, false
+	}
+	return frames, true
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, frames [][]byte) {
+	if err := s.client.Set(ctx, s.prefix+key, encodeFrames(frames), s.ttl).Err(); err != nil {
+		log.Warnf("写入TTS Redis缓存失败: %v", err)
+	}
+}
+
+// diskStore 磁盘二级缓存，重启后仍然有效
+type diskStore struct {
+	dir string
+	ttl time.Duration
+}
+
+func (s *diskStore) path(key string) string {
+	return filepath.Join(s.dir, key+".opus")
+}
+
+func (s *diskStore) Get(ctx context.Context, key string) ([][]byte, bool) {
+	path := s.path(key)
+	if s.ttl > 0 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, false
+		}
+		if time.Since(info.ModTime()) > s.ttl {
+			os.Remove(path)
+			return nil, false
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	frames, err := decodeFrames(data)
+	if err != nil {
+		log.Warnf("解析TTS磁盘缓存 %s 失败: %v", path, err)
+		return nil, false
+	}
+	return frames, true
+}
+
+func (s *diskStore) Set(ctx context.Context, key string, frames [][]byte) {
+	// 先写临时文件再重命名，避免并发读取到不完整的数据
+	tmp, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		log.Warnf("写入TTS磁盘缓存失败: %v", err)
+		return
+	}
+	_, err = tmp.Write(encodeFrames(frames))
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Warnf("写入TTS磁盘缓存失败: %v", err)
+	}
+}
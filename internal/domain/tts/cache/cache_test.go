@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingTTSProvider 记录合成次数的TTS提供者，streamErr 不为空时模拟合成中途出错
+type countingTTSProvider struct {
+	calls     int
+	frames    [][]byte
+	streamErr error
+}
+
+func (p *countingTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	p.calls++
+	return p.frames, nil
+}
+
+func (p *countingTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	outputChan, _, err := p.TextToSpeechStreamWithResult(ctx, text, sampleRate, channels, frameDuration)
+	return outputChan, err
+}
+
+func (p *countingTTSProvider) TextToSpeechStreamWithResult(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, <-chan error, error) {
+	p.calls++
+	outputChan := make(chan []byte, len(p.frames))
+	for _, frame := range p.frames {
+		outputChan <- frame
+	}
+	close(outputChan)
+	done := make(chan error, 1)
+	done <- p.streamErr
+	return outputChan, done, nil
+}
+
+func TestCacheLRUEviction(t *testing.T) {
+	c := NewCache(Config{Enable: true, MaxEntries: 2})
+	ctx := context.Background()
+	c.Set(ctx, "a", [][]byte{[]byte("a")})
+	c.Set(ctx, "b", [][]byte{[]byte("b")})
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", [][]byte{[]byte("c")})
+
+	if _, ok := c.Get(ctx, "b"); ok {
+		t.Error("最久未使用的条目应被淘汰")
+	}
+	if _, ok := c.Get(ctx, "a"); !ok {
+		t.Error("最近使用的条目不应被淘汰")
+	}
+}
+
+func TestCacheDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	frames := [][]byte{[]byte("frame1"), {}, []byte("frame3")}
+
+	NewCache(Config{Enable: true, DiskDir: dir}).Set(ctx, "key", frames)
+
+	// 新的缓存实例内存为空，应从磁盘读取
+	got, ok := NewCache(Config{Enable: true, DiskDir: dir}).Get(ctx, "key")
+	if !ok || len(got) != len(frames) || string(got[0]) != "frame1" || string(got[2]) != "frame3" {
+		t.Errorf("磁盘缓存读取错误: %v, %v", ok, got)
+	}
+}
+
+func TestCachedTTSProviderStream(t *testing.T) {
+	provider := &countingTTSProvider{frames: [][]byte{[]byte("1"), []byte("2")}}
+	cached := NewCachedTTSProvider(provider, NewCache(Config{Enable: true}), "edge", map[string]interface{}{"voice": "zh-CN-XiaoxiaoNeural"})
+
+	for i := 0; i < 2; i++ {
+		outputChan, err := cached.TextToSpeechStream(context.Background(), "你好，我是小智", 16000, 1, 60)
+		if err != nil {
+			t.Fatalf("TextToSpeechStream失败: %v", err)
+		}
+		var frames []string
+		for frame := range outputChan {
+			frames = append(frames, string(frame))
+		}
+		if len(frames) != 2 || frames[0] != "1" || frames[1] != "2" {
+			t.Errorf("第 %d 次音频帧错误: %v", i+1, frames)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("第二次应命中缓存, 实际合成次数: %d", provider.calls)
+	}
+
+	// 不同采样率不应命中
+	outputChan, _ := cached.TextToSpeechStream(context.Background(), "你好，我是小智", 24000, 1, 60)
+	for range outputChan {
+	}
+	if provider.calls != 2 {
+		t.Errorf("不同采样率不应命中缓存, 实际合成次数: %d", provider.calls)
+	}
+}
+
+// TestCachedTTSProviderStreamError 合成中途出错时已输出的部分音频不写入缓存
+func TestCachedTTSProviderStreamError(t *testing.T) {
+	provider := &countingTTSProvider{frames: [][]byte{[]byte("1")}, streamErr: errors.New("连接断开")}
+	cached := NewCachedTTSProvider(provider, NewCache(Config{Enable: true}), "edge", map[string]interface{}{})
+
+	for i := 0; i < 2; i++ {
+		outputChan, err := cached.TextToSpeechStream(context.Background(), "你好", 16000, 1, 60)
+		if err != nil {
+			t.Fatalf("TextToSpeechStream失败: %v", err)
+		}
+		for range outputChan {
+		}
+	}
+	if provider.calls != 2 {
+		t.Errorf("不完整的音频不应写入缓存, 实际合成次数: %d", provider.calls)
+	}
+}
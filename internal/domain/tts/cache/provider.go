@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"xiaozhi-esp32-server-golang/internal/domain/tts"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// CachedTTSProvider 为TTS提供者增加音频缓存
+// 命中缓存时直接输出缓存的Opus帧，播放节奏由 SendTTSAudio 的流控保证
+type CachedTTSProvider struct {
+	provider tts.TTSProvider
+	cache    *Cache
+	prefix   string // 提供者、音色及其它配置组成的键前缀
+}
+
+// Wrap 使用全局缓存包装TTS提供者，未启用缓存时原样返回
+func Wrap(provider tts.TTSProvider, providerName string, config map[string]interface{}) tts.TTSProvider {
+	c := GetCache()
+	if !c.Enabled() {
+		return provider
+	}
+	return NewCachedTTSProvider(provider, c, providerName, config)
+}
+
+// NewCachedTTSProvider 创建带缓存的TTS提供者
+func NewCachedTTSProvider(provider tts.TTSProvider, c *Cache, providerName string, config map[string]interface{}) *CachedTTSProvider {
+	voice, _ := config["voice"].(string)
+	if voice == "" {
+		voice, _ = config["spk_id"].(string)
+	}
+	// 语速、音量等其它参数同样影响输出，一并计入键
+	configData, _ := json.Marshal(config)
+	return &CachedTTSProvider{
+		provider: provider,
+		cache:    c,
+		prefix:   fmt.Sprintf("%s|%s|%s", providerName, voice, configData),
+	}
+}
+
+func (p *CachedTTSProvider) cacheKey(text string, sampleRate int, frameDuration int) string {
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d|%d", p.prefix, text, sampleRate, frameDuration)))
+	return hex.EncodeToString(hash[:])
+}
+
+// TextToSpeech 非流式合成，优先读取缓存
+func (p *CachedTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	if !p.cache.Cacheable(text) {
+		return p.provider.TextToSpeech(ctx, text, sampleRate, channels, frameDuration)
+	}
+
+	key := p.cacheKey(text, sampleRate, frameDuration)
+	if frames, ok := p.cache.Get(ctx, key); ok {
+		log.Debugf("TTS缓存命中: %s, 帧数: %d", text, len(frames))
+		return frames, nil
+	}
+
+	frames, err := p.provider.TextToSpeech(ctx, text, sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.Set(context.Background(), key, frames)
+	return frames, nil
+}
+
+// TextToSpeechStream 流式合成，命中缓存时一次性输出全部帧，未命中时边转发边收集
+// 只有提供者报告合成完整时才写入缓存，不支持报告结果的提供者流式合成的结果不缓存
+func (p *CachedTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	if !p.cache.Cacheable(text) {
+		return p.provider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+	}
+
+	key := p.cacheKey(text, sampleRate, frameDuration)
+	if frames, ok := p.cache.Get(ctx, key); ok {
+		log.Debugf("TTS缓存命中: %s, 帧数: %d", text, len(frames))
+		outputChan := make(chan []byte, len(frames))
+		for _, frame := range frames {
+			outputChan <- frame
+		}
+		close(outputChan)
+		return outputChan, nil
+	}
+
+	resultProvider, ok := p.provider.(tts.StreamResultTTSProvider)
+	if !ok {
+		return p.provider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+	}
+	streamChan, done, err := resultProvider.TextToSpeechStreamWithResult(ctx, text, sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, err
+	}
+	if done == nil {
+		return streamChan, nil
+	}
+
+	outputChan := make(chan []byte, 100)
+	go func() {
+		defer close(outputChan)
+		var frames [][]byte
+		for frame := range streamChan {
+			frameCopy := make([]byte, len(frame))
+			copy(frameCopy, frame)
+			frames = append(frames, frameCopy)
+
+			select {
+			case <-ctx.Done():
+				// 被打断的合成结果不完整，不写入缓存
+				go func() {
+					for range streamChan {
+					}
+				}()
+				return
+			case outputChan <- frame:
+			}
+		}
+		if err := <-done; err != nil {
+			log.Debugf("TTS合成未完成, 不写入缓存: %s, err: %v", text, err)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		p.cache.Set(context.Background(), key, frames)
+	}()
+	return outputChan, nil
+}
@@ -301,6 +301,12 @@ func (p *DoubaoWSProvider) TextToSpeech(ctx context.Context, text string, sample
 
 // TextToSpeech 将文本转换为语音，返回音频帧数据和错误
 func (p *DoubaoWSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (outputOpusChan chan []byte, err error) {
+	outputOpusChan, _, err = p.TextToSpeechStreamWithResult(ctx, text, sampleRate, channels, frameDuration)
+	return outputOpusChan, err
+}
+
+// TextToSpeechStreamWithResult 流式合成，输出通道关闭后通过 done 报告是否完整合成
+func (p *DoubaoWSProvider) TextToSpeechStreamWithResult(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (outputOpusChan chan []byte, done <-chan error, err error) {
 	var operation string
 	if p.UseStream {
 		operation = optSubmit // 流式合成
@@ -316,7 +322,7 @@ func (p *DoubaoWSProvider) TextToSpeechStream(ctx context.Context, text string,
 	// 获取或创建WebSocket连接
 	conn, err := p.getWSConnection()
 	if err != nil {
-		return nil, fmt.Errorf("获取WebSocket连接失败: %v", err)
+		return nil, nil, fmt.Errorf("获取WebSocket连接失败: %v", err)
 	}
 
 	// 压缩输入
@@ -338,7 +344,7 @@ func (p *DoubaoWSProvider) TextToSpeechStream(ctx context.Context, text string,
 	if err != nil {
 		// 连接可能已关闭，移除并重试
 		p.removeWSConnection(conn)
-		return nil, fmt.Errorf("发送WebSocket消息失败: %v", err)
+		return nil, nil, fmt.Errorf("发送WebSocket消息失败: %v", err)
 	}
 
 	// 设置读取超时
@@ -347,25 +353,30 @@ func (p *DoubaoWSProvider) TextToSpeechStream(ctx context.Context, text string,
 	pipeReader, pipeWriter := io.Pipe()
 
 	outputOpusChan = make(chan []byte, 1000)
+	doneChan := make(chan error, 1)
 
 	go func() {
 		mp3Decoder, err := util.CreateAudioDecoder(ctx, pipeReader, outputOpusChan, frameDuration, "mp3")
 		if err != nil {
 			log.Errorf("创建MP3解码器失败: %v", err)
+			pipeReader.Close()
 			close(outputOpusChan)
+			doneChan <- err
 			return
 		}
 		err = mp3Decoder.Run(startTs)
+		// 解码器提前退出时避免写端阻塞
+		pipeReader.Close()
 		if err != nil {
 			log.Errorf("MP3解码器运行失败: %v", err)
-			return
+		} else if ctx.Err() != nil {
+			err = ctx.Err()
 		}
+		doneChan <- err
 	}()
 	go func() {
-		defer func() {
-			pipeReader.Close()
-			pipeWriter.Close()
-		}()
+		// 只关闭写端，解码器读完剩余数据后得到 EOF
+		defer pipeWriter.Close()
 		// 流式合成
 		chunkCount := 0
 		//var allAudio []byte
@@ -374,7 +385,8 @@ func (p *DoubaoWSProvider) TextToSpeechStream(ctx context.Context, text string,
 			if err != nil {
 				p.removeWSConnection(conn)
 				log.Errorf("读取WebSocket消息失败: %v", err)
-
+				// 音频不完整，解码器据此返回错误
+				pipeWriter.CloseWithError(err)
 				return
 			}
 
@@ -382,6 +394,7 @@ func (p *DoubaoWSProvider) TextToSpeechStream(ctx context.Context, text string,
 			if err != nil {
 				p.removeWSConnection(conn)
 				log.Errorf("解析响应失败: %v", err)
+				pipeWriter.CloseWithError(err)
 				return
 			}
 
@@ -418,7 +431,7 @@ func (p *DoubaoWSProvider) TextToSpeechStream(ctx context.Context, text string,
 		}
 	}()
 
-	return outputOpusChan, nil
+	return outputOpusChan, doneChan, nil
 }
 
 // GetVoiceInfo 获取语音信息
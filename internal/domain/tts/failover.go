@@ -0,0 +1,363 @@
+package tts
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/constants"
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 后端失败后的冷却记录，同一配置的后端在所有会话间共享
+var (
+	ttsCooldownMu sync.Mutex
+	ttsCooldown   = make(map[string]time.Time)
+)
+
+// ttsBackend 故障转移链中的一个TTS后端
+type ttsBackend struct {
+	name     string
+	key      string
+	provider TTSProvider
+}
+
+func (b *ttsBackend) available() bool {
+	ttsCooldownMu.Lock()
+	defer ttsCooldownMu.Unlock()
+	return time.Now().After(ttsCooldown[b.key])
+}
+
+func (b *ttsBackend) markFailed(cooldown time.Duration) {
+	if cooldown <= 0 {
+		return
+	}
+	ttsCooldownMu.Lock()
+	defer ttsCooldownMu.Unlock()
+	ttsCooldown[b.key] = time.Now().Add(cooldown)
+}
+
+func (b *ttsBackend) markRecovered() {
+	ttsCooldownMu.Lock()
+	defer ttsCooldownMu.Unlock()
+	delete(ttsCooldown, b.key)
+}
+
+// FailoverTTSProvider 按顺序组合多个TTS后端
+// 流式合成时若首帧在超时时间内没有到达则切换到下一个后端，也可以同时请求前两个后端，使用先返回首帧的结果
+type FailoverTTSProvider struct {
+	backends          []*ttsBackend
+	firstFrameTimeout time.Duration // 等待首帧的超时时间
+	race              bool          // 是否同时请求两个后端
+	cooldown          time.Duration // 后端失败后跳过的时长
+}
+
+// NewFailoverTTSProvider 创建故障转移TTS提供者
+// config 示例:
+//
+//	providers:                    # 按优先级排列，每项与 TtsConfig 结构一致
+//	  - provider: edge
+//	    config: {...}
+//	  - provider: cosyvoice
+//	    config: {...}
+//	first_frame_timeout_ms: 3000  # 首帧超时(毫秒)
+//	race: false                   # 同时请求前两个可用后端
+//	cooldown: 30                  # 后端失败后跳过的时长(秒)
+func NewFailoverTTSProvider(config map[string]interface{}) (*FailoverTTSProvider, error) {
+	f := &FailoverTTSProvider{
+		firstFrameTimeout: 3 * time.Second,
+		cooldown:          30 * time.Second,
+	}
+	if timeoutMs := configInt(config, "first_frame_timeout_ms"); timeoutMs > 0 {
+		f.firstFrameTimeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	if _, ok := config["cooldown"]; ok {
+		f.cooldown = time.Duration(configInt(config, "cooldown")) * time.Second
+	}
+	f.race, _ = config["race"].(bool)
+
+	rawProviders, ok := config["providers"].([]interface{})
+	if !ok || len(rawProviders) == 0 {
+		return nil, fmt.Errorf("failover TTS 缺少 providers 配置")
+	}
+	for i, rawProvider := range rawProviders {
+		item, ok := rawProvider.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failover TTS 第 %d 个 provider 配置格式错误", i)
+		}
+		backendConfig := config_types.TtsConfig{Config: map[string]interface{}{}}
+		backendConfig.Provider, _ = item["provider"].(string)
+		if backendConfig.Provider == "" || backendConfig.Provider == constants.TtsTypeFailover {
+			return nil, fmt.Errorf("failover TTS 第 %d 个 provider 类型无效: %q", i, backendConfig.Provider)
+		}
+		if c, ok := item["config"].(map[string]interface{}); ok {
+			backendConfig.Config = c
+		}
+		name, _ := item["name"].(string)
+		if name == "" {
+			name = fmt.Sprintf("%s#%d", backendConfig.Provider, i)
+		}
+
+		provider, err := GetTTSProvider(backendConfig.Provider, backendConfig.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failover TTS 创建后端 %s 失败: %v", name, err)
+		}
+		data, _ := json.Marshal(backendConfig)
+		hash := md5.Sum(data)
+		f.backends = append(f.backends, &ttsBackend{
+			name:     name,
+			key:      backendConfig.Provider + ":" + hex.EncodeToString(hash[:]),
+			provider: provider,
+		})
+	}
+	return f, nil
+}
+
+// configInt 读取整数配置，兼容 yaml(int) 与 json(float64)
+func configInt(config map[string]interface{}, key string) int {
+	switch v := config[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// orderedBackends 返回本次请求使用的后端顺序，冷却中的后端排在最后作为兜底
+func (f *FailoverTTSProvider) orderedBackends() []*ttsBackend {
+	ordered := make([]*ttsBackend, 0, len(f.backends))
+	var cooling []*ttsBackend
+	for _, b := range f.backends {
+		if b.available() {
+			ordered = append(ordered, b)
+		} else {
+			cooling = append(cooling, b)
+		}
+	}
+	return append(ordered, cooling...)
+}
+
+// TextToSpeech 按顺序尝试各个后端
+func (f *FailoverTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	var lastErr error
+	for _, backend := range f.orderedBackends() {
+		frames, err := backend.provider.TextToSpeech(ctx, text, sampleRate, channels, frameDuration)
+		if err == nil && len(frames) > 0 {
+			backend.markRecovered()
+			return frames, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			err = errors.New("未返回音频数据")
+		}
+		lastErr = fmt.Errorf("TTS后端 %s 合成失败: %v", backend.name, err)
+		log.Warnf("%v", lastErr)
+		backend.markFailed(f.cooldown)
+	}
+	return nil, lastErr
+}
+
+// ttsAttempt 一次向某个后端发起的流式合成
+type ttsAttempt struct {
+	backend *ttsBackend
+	cancel  context.CancelFunc
+	frames  chan []byte
+	done    <-chan error // 后端不支持报告合成结果时为 nil
+}
+
+// ttsFirstFrame 流式合成的首帧结果
+type ttsFirstFrame struct {
+	attempt *ttsAttempt
+	frame   []byte
+	err     error
+}
+
+func (f *FailoverTTSProvider) startAttempt(ctx context.Context, backend *ttsBackend, text string, sampleRate int, channels int, frameDuration int) (*ttsAttempt, error) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	var frames chan []byte
+	var done <-chan error
+	var err error
+	if provider, ok := backend.provider.(StreamResultTTSProvider); ok {
+		frames, done, err = provider.TextToSpeechStreamWithResult(attemptCtx, text, sampleRate, channels, frameDuration)
+	} else {
+		frames, err = backend.provider.TextToSpeechStream(attemptCtx, text, sampleRate, channels, frameDuration)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &ttsAttempt{backend: backend, cancel: cancel, frames: frames, done: done}, nil
+}
+
+// waitFirstFrame 等待首帧，超时或通道关闭视为失败
+func (f *FailoverTTSProvider) waitFirstFrame(ctx context.Context, attempt *ttsAttempt, result chan<- ttsFirstFrame) {
+	timer := time.NewTimer(f.firstFrameTimeout)
+	defer timer.Stop()
+
+	r := ttsFirstFrame{attempt: attempt}
+	select {
+	case <-ctx.Done():
+		r.err = ctx.Err()
+	case frame, ok := <-attempt.frames:
+		if ok {
+			r.frame = frame
+		} else {
+			r.err = errors.New("未返回音频数据")
+		}
+	case <-timer.C:
+		r.err = fmt.Errorf("首帧超时(%v)", f.firstFrameTimeout)
+	}
+	result <- r
+}
+
+// abandonDrainTimeout 放弃合成后排空输出通道的最长时间，后端取消后仍不关闭通道时不再等待
+const abandonDrainTimeout = 5 * time.Second
+
+// abandon 取消被放弃的合成，并排空其输出通道，避免后端阻塞
+func (a *ttsAttempt) abandon() {
+	a.cancel()
+	go func() {
+		timer := time.NewTimer(abandonDrainTimeout)
+		defer timer.Stop()
+		for {
+			select {
+			case _, ok := <-a.frames:
+				if !ok {
+					return
+				}
+			case <-timer.C:
+				log.Warnf("TTS后端 %s 取消后 %v 内未关闭输出通道, 停止排空", a.backend.name, abandonDrainTimeout)
+				return
+			}
+		}
+	}()
+}
+
+// TextToSpeechStream 流式合成，返回时已拿到首帧
+// 首帧到达后不再切换后端，避免同一句话重复播放
+func (f *FailoverTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	outputChan, _, err := f.TextToSpeechStreamWithResult(ctx, text, sampleRate, channels, frameDuration)
+	return outputChan, err
+}
+
+// TextToSpeechStreamWithResult 流式合成，done 报告选中后端的合成结果，该后端不支持报告时 done 为 nil
+func (f *FailoverTTSProvider) TextToSpeechStreamWithResult(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, <-chan error, error) {
+	backends := f.orderedBackends()
+	results := make(chan ttsFirstFrame, len(backends))
+	pending := 0
+	next := 0
+	var lastErr error
+
+	// launch 启动下一个后端，启动失败时继续尝试后面的后端
+	launch := func() {
+		for next < len(backends) {
+			backend := backends[next]
+			next++
+			attempt, err := f.startAttempt(ctx, backend, text, sampleRate, channels, frameDuration)
+			if err != nil {
+				lastErr = fmt.Errorf("TTS后端 %s 合成失败: %v", backend.name, err)
+				log.Warnf("%v", lastErr)
+				backend.markFailed(f.cooldown)
+				continue
+			}
+			pending++
+			go f.waitFirstFrame(ctx, attempt, results)
+			return
+		}
+	}
+
+	launch()
+	if f.race {
+		launch()
+	}
+
+	for pending > 0 {
+		r := <-results
+		pending--
+		if r.err != nil {
+			r.attempt.abandon()
+			if ctx.Err() != nil {
+				lastErr = ctx.Err()
+				continue
+			}
+			lastErr = fmt.Errorf("TTS后端 %s 合成失败: %v", r.attempt.backend.name, r.err)
+			log.Warnf("%v, 尝试切换后端", lastErr)
+			r.attempt.backend.markFailed(f.cooldown)
+			launch()
+			continue
+		}
+
+		// 已拿到首帧，放弃其余仍在进行的请求
+		r.attempt.backend.markRecovered()
+		if pending > 0 {
+			go func(n int) {
+				for i := 0; i < n; i++ {
+					(<-results).attempt.abandon()
+				}
+			}(pending)
+		}
+		outputChan, done := f.forward(ctx, r.attempt, r.frame)
+		return outputChan, done, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("没有可用的TTS后端")
+	}
+	return nil, nil, lastErr
+}
+
+// forward 将选中后端的音频帧转发到输出通道，后端支持报告结果时转发其结果
+func (f *FailoverTTSProvider) forward(ctx context.Context, attempt *ttsAttempt, firstFrame []byte) (chan []byte, <-chan error) {
+	outputChan := make(chan []byte, 100)
+	var done chan error
+	if attempt.done != nil {
+		done = make(chan error, 1)
+	}
+	go func() {
+		var result error
+		defer func() {
+			close(outputChan)
+			if done != nil {
+				done <- result
+			}
+		}()
+		defer attempt.cancel()
+
+		frame := firstFrame
+		for {
+			select {
+			case <-ctx.Done():
+				attempt.abandon()
+				result = ctx.Err()
+				return
+			case outputChan <- frame:
+			}
+			var ok bool
+			select {
+			case <-ctx.Done():
+				attempt.abandon()
+				result = ctx.Err()
+				return
+			case frame, ok = <-attempt.frames:
+				if !ok {
+					if attempt.done != nil {
+						result = <-attempt.done
+					}
+					return
+				}
+			}
+		}
+	}()
+	return outputChan, done
+}
@@ -0,0 +1,104 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeTTSProvider 按设定延迟输出固定音频帧
+type fakeTTSProvider struct {
+	delay  time.Duration
+	frames [][]byte
+	err    error
+}
+
+func (p *fakeTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	return p.frames, p.err
+}
+
+func (p *fakeTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	outputChan := make(chan []byte)
+	go func() {
+		defer close(outputChan)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.delay):
+		}
+		for _, frame := range p.frames {
+			select {
+			case <-ctx.Done():
+				return
+			case outputChan <- frame:
+			}
+		}
+	}()
+	return outputChan, nil
+}
+
+func newTestFailoverProvider(race bool, providers ...*fakeTTSProvider) *FailoverTTSProvider {
+	f := &FailoverTTSProvider{
+		firstFrameTimeout: 100 * time.Millisecond,
+		race:              race,
+	}
+	for i, p := range providers {
+		name := string(rune('a' + i))
+		f.backends = append(f.backends, &ttsBackend{name: name, key: "test:" + name, provider: &ContextTTSAdapter{p}})
+	}
+	return f
+}
+
+func collectFrames(t *testing.T, outputChan chan []byte) []string {
+	var frames []string
+	for frame := range outputChan {
+		frames = append(frames, string(frame))
+	}
+	return frames
+}
+
+func TestFailoverTTSStreamFirstFrameTimeout(t *testing.T) {
+	f := newTestFailoverProvider(false,
+		&fakeTTSProvider{delay: time.Second, frames: [][]byte{[]byte("slow")}},
+		&fakeTTSProvider{err: errors.New("连接失败")},
+		&fakeTTSProvider{frames: [][]byte{[]byte("1"), []byte("2")}},
+	)
+
+	outputChan, err := f.TextToSpeechStream(context.Background(), "你好", 16000, 1, 60)
+	if err != nil {
+		t.Fatalf("TextToSpeechStream失败: %v", err)
+	}
+	if frames := collectFrames(t, outputChan); len(frames) != 2 || frames[0] != "1" || frames[1] != "2" {
+		t.Errorf("音频帧错误: %v", frames)
+	}
+}
+
+func TestFailoverTTSStreamRace(t *testing.T) {
+	f := newTestFailoverProvider(true,
+		&fakeTTSProvider{delay: 50 * time.Millisecond, frames: [][]byte{[]byte("slow")}},
+		&fakeTTSProvider{frames: [][]byte{[]byte("fast")}},
+	)
+
+	outputChan, err := f.TextToSpeechStream(context.Background(), "你好", 16000, 1, 60)
+	if err != nil {
+		t.Fatalf("TextToSpeechStream失败: %v", err)
+	}
+	if frames := collectFrames(t, outputChan); len(frames) != 1 || frames[0] != "fast" {
+		t.Errorf("音频帧错误: %v", frames)
+	}
+}
+
+func TestFailoverTTSStreamAllFailed(t *testing.T) {
+	f := newTestFailoverProvider(false,
+		&fakeTTSProvider{err: errors.New("连接失败")},
+		&fakeTTSProvider{},
+	)
+
+	if _, err := f.TextToSpeechStream(context.Background(), "你好", 16000, 1, 60); err == nil {
+		t.Error("所有后端失败时应返回错误")
+	}
+}
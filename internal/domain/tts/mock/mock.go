@@ -0,0 +1,114 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"gopkg.in/hraban/opus.v2"
+)
+
+// MockTTSProvider 不调用真实合成服务，按文本长度输出正弦波音调的Opus帧
+// 用于会话回放和端到端测试，不依赖任何外部服务
+type MockTTSProvider struct {
+	CharDuration int // 每个字对应的音频时长(ms)
+	ToneHz       int // 音调频率，0 表示输出静音
+}
+
+// NewMockTTSProvider 创建模拟TTS
+// config: char_duration_ms 每个字对应的音频时长，默认200ms; tone_hz 音调频率，默认440Hz，0为静音
+func NewMockTTSProvider(config map[string]interface{}) *MockTTSProvider {
+	p := &MockTTSProvider{CharDuration: 200, ToneHz: 440}
+	switch v := config["char_duration_ms"].(type) {
+	case int:
+		p.CharDuration = v
+	case float64:
+		p.CharDuration = int(v)
+	}
+	switch v := config["tone_hz"].(type) {
+	case int:
+		p.ToneHz = v
+	case float64:
+		p.ToneHz = int(v)
+	}
+	return p
+}
+
+// TextToSpeech 一次性返回全部音频帧
+func (p *MockTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	return p.toneFrames(p.frameCount(text, frameDuration), sampleRate, channels, frameDuration)
+}
+
+// TextToSpeechStream 流式返回音频帧
+func (p *MockTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	outputChan, _, err := p.TextToSpeechStreamWithResult(ctx, text, sampleRate, channels, frameDuration)
+	return outputChan, err
+}
+
+// TextToSpeechStreamWithResult 流式返回音频帧，全部输出后 done 返回 nil，被取消时返回 ctx 的错误
+func (p *MockTTSProvider) TextToSpeechStreamWithResult(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, <-chan error, error) {
+	frames, err := p.toneFrames(p.frameCount(text, frameDuration), sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, nil, err
+	}
+	outputChan := make(chan []byte, 10)
+	done := make(chan error, 1)
+	go func() {
+		defer close(outputChan)
+		for _, frame := range frames {
+			select {
+			case <-ctx.Done():
+				done <- ctx.Err()
+				return
+			case outputChan <- frame:
+			}
+		}
+		done <- nil
+	}()
+	return outputChan, done, nil
+}
+
+// frameCount 根据文本字数计算帧数，至少1帧
+func (p *MockTTSProvider) frameCount(text string, frameDuration int) int {
+	if frameDuration <= 0 {
+		frameDuration = 60
+	}
+	count := len([]rune(text)) * p.CharDuration / frameDuration
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
+// toneFrames 生成连续的正弦波并逐帧编码为Opus，相位在帧之间保持连续
+func (p *MockTTSProvider) toneFrames(frameCount int, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	if frameDuration <= 0 {
+		frameDuration = 60
+	}
+	enc, err := opus.NewEncoder(sampleRate, channels, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
+	}
+	samplesPerFrame := sampleRate * frameDuration / 1000
+	pcm := make([]int16, samplesPerFrame*channels)
+	frames := make([][]byte, 0, frameCount)
+	for i := 0; i < frameCount; i++ {
+		for j := 0; j < samplesPerFrame; j++ {
+			var sample int16
+			if p.ToneHz > 0 {
+				t := float64(i*samplesPerFrame+j) / float64(sampleRate)
+				sample = int16(0.3 * math.MaxInt16 * math.Sin(2*math.Pi*float64(p.ToneHz)*t))
+			}
+			for ch := 0; ch < channels; ch++ {
+				pcm[j*channels+ch] = sample
+			}
+		}
+		buf := make([]byte, 1000)
+		n, err := enc.Encode(pcm, buf)
+		if err != nil {
+			return nil, fmt.Errorf("编码音频帧失败: %v", err)
+		}
+		frames = append(frames, buf[:n])
+	}
+	return frames, nil
+}
@@ -196,6 +196,12 @@ func (p *OpenAITTSProvider) TextToSpeech(ctx context.Context, text string, sampl
 
 // TextToSpeechStream 流式语音合成实现
 func (p *OpenAITTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (outputChan chan []byte, err error) {
+	outputChan, _, err = p.TextToSpeechStreamWithResult(ctx, text, sampleRate, channels, frameDuration)
+	return outputChan, err
+}
+
+// TextToSpeechStreamWithResult 流式语音合成，输出通道关闭后通过 done 报告是否完整合成
+func (p *OpenAITTSProvider) TextToSpeechStreamWithResult(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (outputChan chan []byte, done <-chan error, err error) {
 	startTs := time.Now().UnixMilli()
 
 	// 创建请求体
@@ -210,13 +216,13 @@ func (p *OpenAITTSProvider) TextToSpeechStream(ctx context.Context, text string,
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("序列化请求失败: %v", err)
+		return nil, nil, fmt.Errorf("序列化请求失败: %v", err)
 	}
 
 	// 创建HTTP请求
 	req, err := http.NewRequestWithContext(ctx, "POST", p.APIURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %v", err)
+		return nil, nil, fmt.Errorf("创建请求失败: %v", err)
 	}
 
 	// 设置请求头
@@ -228,13 +234,20 @@ func (p *OpenAITTSProvider) TextToSpeechStream(ctx context.Context, text string,
 
 	// 创建输出通道
 	outputChan = make(chan []byte, 100)
+	doneChan := make(chan error, 1)
 
 	// 启动goroutine处理流式响应
 	go func() {
+		var streamErr error
+		defer func() {
+			doneChan <- streamErr
+		}()
+
 		// 发送请求
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Errorf("发送OpenAI请求失败: %v", err)
+			streamErr = err
 			close(outputChan)
 			return
 		}
@@ -244,6 +257,7 @@ func (p *OpenAITTSProvider) TextToSpeechStream(ctx context.Context, text string,
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
 			log.Errorf("OpenAI API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+			streamErr = fmt.Errorf("OpenAI API请求失败，状态码: %d", resp.StatusCode)
 			close(outputChan)
 			return
 		}
@@ -255,6 +269,7 @@ func (p *OpenAITTSProvider) TextToSpeechStream(ctx context.Context, text string,
 		// 判断Content-Length是否合理
 		if contentLength == 0 {
 			log.Errorf("OpenAI API返回空响应，Content-Length为0")
+			streamErr = fmt.Errorf("OpenAI API返回空响应")
 			close(outputChan)
 			return
 		}
@@ -265,6 +280,7 @@ func (p *OpenAITTSProvider) TextToSpeechStream(ctx context.Context, text string,
 			decoder, err := util.CreateAudioDecoder(ctx, resp.Body, outputChan, frameDuration, p.ResponseFormat)
 			if err != nil {
 				log.Errorf("创建OpenAI音频解码器失败: %v", err)
+				streamErr = err
 				close(outputChan)
 				return
 			}
@@ -272,21 +288,24 @@ func (p *OpenAITTSProvider) TextToSpeechStream(ctx context.Context, text string,
 			// 启动解码过程
 			if err := decoder.Run(startTs); err != nil {
 				log.Errorf("OpenAI音频解码失败: %v", err)
+				streamErr = err
 				return
 			}
 
 			select {
 			case <-ctx.Done():
 				log.Debugf("OpenAI TTS流式合成取消, 文本: %s", text)
+				streamErr = ctx.Err()
 				return
 			default:
 				log.Infof("OpenAI TTS耗时: 从输入至获取音频数据结束耗时: %d ms", time.Now().UnixMilli()-startTs)
 			}
 		} else {
 			log.Errorf("当前仅支持MP3和Opus格式的流式合成")
+			streamErr = fmt.Errorf("不支持的流式音频格式: %s", p.ResponseFormat)
 			close(outputChan)
 		}
 	}()
 
-	return outputChan, nil
+	return outputChan, doneChan, nil
 }
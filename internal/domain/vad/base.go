@@ -42,6 +42,28 @@ func ReleaseVAD(vad inter.VAD) error {
 	return nil
 }
 
+// IsSupportedProvider 是否为可以初始化资源池的VAD提供商
+func IsSupportedProvider(provider string) bool {
+	switch provider {
+	case constants.VadTypeSileroVad, constants.VadTypeWebRTCVad, constants.VadTypeTenVad:
+		return true
+	}
+	return false
+}
+
+// GetPoolStats 获取当前VAD提供者的资源池统计信息
+func GetPoolStats(provider string) map[string]interface{} {
+	switch provider {
+	case constants.VadTypeSileroVad:
+		return silero_vad.GetPoolStats()
+	case constants.VadTypeWebRTCVad:
+		return webrtc_vad.GetPoolStats()
+	case constants.VadTypeTenVad:
+		return ten_vad.GetPoolStats()
+	}
+	return nil
+}
+
 // InitVAD 从全局配置初始化VAD资源池
 func InitVAD() error {
 	log.Infof("开始初始化 VAD 资源池...")
@@ -78,3 +100,21 @@ func InitVAD() error {
 		return err
 	}
 }
+
+// ReloadVAD 配置热更新后调整当前VAD提供商的资源池, 切换提供商时初始化新的资源池, 旧资源池中的实例随会话结束归还
+func ReloadVAD() error {
+	vadProvider := viper.GetString("vad.provider")
+	vadConfig := viper.GetStringMap(fmt.Sprintf("vad.%s", vadProvider))
+
+	log.Infof("VAD 配置已更新, 调整 %s 资源池", vadProvider)
+	switch vadProvider {
+	case constants.VadTypeSileroVad:
+		return silero_vad.ReloadPool(vadConfig)
+	case constants.VadTypeTenVad:
+		return ten_vad.ReloadPool(vadConfig)
+	case constants.VadTypeWebRTCVad:
+		return webrtc_vad.ReloadPool(vadConfig)
+	default:
+		return fmt.Errorf("不支持的 VAD 提供商: %s", vadProvider)
+	}
+}
@@ -3,6 +3,7 @@ package silero_vad
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
@@ -17,6 +18,8 @@ type VADResourcePool struct {
 	availableVADs chan VAD
 	// 已分配的VAD实例映射，用于跟踪和管理
 	allocatedVADs sync.Map
+	// 配置热更新前分配出去的实例，归还时按新配置重建
+	staleVADs sync.Map
 	// 池大小配置
 	maxSize int
 	// 获取VAD超时时间（毫秒）
@@ -119,6 +122,22 @@ func (p *VADResourcePool) ReleaseVAD(vad VAD) {
 		// 从已分配映射中删除
 		p.allocatedVADs.Delete(vad)
 
+		// 配置热更新前分配的实例，按新配置重建，重建失败时保留旧实例，避免资源池缩小
+		if _, stale := p.staleVADs.LoadAndDelete(vad); stale {
+			p.mu.Lock()
+			vadConfig := p.defaultConfig
+			p.mu.Unlock()
+			if newVAD, err := CreateVAD(vadConfig); err != nil {
+				log.Errorf("按新配置重建VAD实例失败, 继续使用旧实例: %v", err)
+				vad.Reset()
+			} else {
+				if sileroVAD, ok := vad.(*SileroVAD); ok {
+					sileroVAD.Close()
+				}
+				vad = newVAD
+			}
+		}
+
 		// 如果资源池已关闭，直接销毁实例
 		if p.availableVADs == nil {
 			if sileroVAD, ok := vad.(*SileroVAD); ok {
@@ -198,6 +217,15 @@ func (p *VADResourcePool) Resize(newSize int) error {
 
 	// 如果新大小大于当前大小，需要增加实例数量
 	if newSize > currentSize {
+		// 可用队列容量固定，扩容时换一个更大的队列
+		if newSize > cap(p.availableVADs) {
+			availableVADs := make(chan VAD, newSize)
+			for len(p.availableVADs) > 0 {
+				availableVADs <- <-p.availableVADs
+			}
+			p.availableVADs = availableVADs
+		}
+
 		// 计算需要增加的实例数量
 		toAdd := newSize - currentSize
 
@@ -237,6 +265,69 @@ func (p *VADResourcePool) Resize(newSize int) error {
 	return nil
 }
 
+// Reload 热更新配置，检测参数变化时替换空闲实例，正在使用的实例归还时再替换
+func (p *VADResourcePool) Reload(vadConfig map[string]interface{}, poolSize int, acquireTimeout int64) error {
+	p.mu.Lock()
+	if acquireTimeout > 0 {
+		p.acquireTimeout = acquireTimeout
+	}
+	if !reflect.DeepEqual(vadConfig, p.defaultConfig) {
+		// 先按新配置创建一个实例，失败时继续使用旧配置
+		probe, err := CreateVAD(vadConfig)
+		if err != nil {
+			p.mu.Unlock()
+			return fmt.Errorf("按新配置创建VAD实例失败: %v", err)
+		}
+		probe.Close()
+
+		p.defaultConfig = vadConfig
+		p.allocatedVADs.Range(func(key, _ interface{}) bool {
+			p.staleVADs.Store(key, struct{}{})
+			return true
+		})
+
+		replaced := 0
+		for count := len(p.availableVADs); count > 0; count-- {
+			var vad VAD
+			select {
+			case vad = <-p.availableVADs:
+			default:
+			}
+			if vad == nil {
+				break
+			}
+			newVAD, err := CreateVAD(vadConfig)
+			if err != nil {
+				// 放回旧实例，下次归还时再重建
+				log.Errorf("按新配置重建VAD实例失败, 继续使用旧实例: %v", err)
+				p.staleVADs.Store(vad, struct{}{})
+				select {
+				case p.availableVADs <- vad:
+				default:
+					vad.Close()
+				}
+				continue
+			}
+			if sileroVAD, ok := vad.(*SileroVAD); ok {
+				sileroVAD.Close()
+			}
+			select {
+			case p.availableVADs <- newVAD:
+				replaced++
+			default:
+				newVAD.Close()
+			}
+		}
+		log.Infof("VAD检测参数已更新，替换了 %d 个空闲实例", replaced)
+	}
+	p.mu.Unlock()
+
+	if poolSize > 0 {
+		return p.Resize(poolSize)
+	}
+	return nil
+}
+
 // Close 关闭资源池，释放所有资源
 func (p *VADResourcePool) Close() {
 	p.mu.Lock()
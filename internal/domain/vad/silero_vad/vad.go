@@ -258,6 +258,68 @@ func InitVadPool(config map[string]interface{}) {
 
 }
 
+// ReloadPool 配置热更新后调整资源池，已有会话使用的实例不受影响
+func ReloadPool(config map[string]interface{}) error {
+	if globalVADResourcePool == nil {
+		InitVadPool(config)
+		return nil
+	}
+	if !globalVADResourcePool.initialized {
+		return InitVADFromConfig(config)
+	}
+
+	globalVADResourcePool.mu.Lock()
+	vadConfig := make(map[string]interface{}, len(globalVADResourcePool.defaultConfig))
+	for key, value := range globalVADResourcePool.defaultConfig {
+		vadConfig[key] = value
+	}
+	globalVADResourcePool.mu.Unlock()
+
+	if modelPath, ok := config["model_path"].(string); ok && modelPath != "" {
+		vadConfig["model_path"] = modelPath
+	}
+	if threshold, ok := toFloat64(config["threshold"]); ok && threshold > 0 {
+		vadConfig["threshold"] = threshold
+	}
+	if silenceMs, ok := toInt(config["min_silence_duration_ms"]); ok && silenceMs > 0 {
+		vadConfig["min_silence_duration_ms"] = int64(silenceMs)
+	}
+	for _, key := range []string{"sample_rate", "channels", "speech_pad_ms"} {
+		if value, ok := toInt(config[key]); ok && value > 0 {
+			vadConfig[key] = value
+		}
+	}
+
+	poolSize, _ := toInt(config["pool_size"])
+	timeout, _ := toInt(config["acquire_timeout_ms"])
+	return globalVADResourcePool.Reload(vadConfig, poolSize, int64(timeout))
+}
+
+// toInt 配置文件中为int，管理后台下发的JSON中为float64
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
 // AcquireVAD 获取一个VAD实例
 func AcquireVAD(config map[string]interface{}) (VAD, error) {
 	if globalVADResourcePool == nil || !globalVADResourcePool.initialized {
@@ -275,6 +337,18 @@ func ReleaseVAD(vad VAD) error {
 	return nil
 }
 
+// GetPoolStats 获取资源池统计信息，字段与 util.ResourcePool.Stats 保持一致
+func GetPoolStats() map[string]interface{} {
+	if globalVADResourcePool == nil || !globalVADResourcePool.initialized {
+		return nil
+	}
+	return map[string]interface{}{
+		"in_use_resources":    globalVADResourcePool.GetActiveCount(),
+		"available_resources": globalVADResourcePool.GetAvailableCount(),
+		"max_size":            globalVADResourcePool.maxSize,
+	}
+}
+
 // Reset 重置VAD检测器状态
 func (s *SileroVAD) Reset() error {
 	s.mu.Lock()
@@ -3,6 +3,7 @@ package ten_vad
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
@@ -36,6 +37,8 @@ type VADResourcePool struct {
 	availableVADs chan VAD
 	// 已分配的VAD实例映射，用于跟踪和管理
 	allocatedVADs sync.Map
+	// 配置热更新前分配出去的实例，归还时按新配置重建
+	staleVADs sync.Map
 	// 池大小配置
 	maxSize int
 	// 获取VAD超时时间（毫秒）
@@ -153,6 +156,47 @@ func InitVadPool(config map[string]interface{}) {
 	})
 }
 
+// ReloadPool 配置热更新后调整资源池，已有会话使用的实例不受影响
+func ReloadPool(config map[string]interface{}) error {
+	if globalVADResourcePool == nil {
+		InitVadPool(config)
+		return nil
+	}
+	if !globalVADResourcePool.initialized {
+		return InitVADFromConfig(config)
+	}
+
+	globalVADResourcePool.mu.Lock()
+	vadConfig := make(map[string]interface{}, len(globalVADResourcePool.defaultConfig))
+	for key, value := range globalVADResourcePool.defaultConfig {
+		vadConfig[key] = value
+	}
+	globalVADResourcePool.mu.Unlock()
+
+	if hopSize, ok := config["hop_size"].(int); ok && hopSize > 0 {
+		vadConfig["hop_size"] = hopSize
+	} else if hopSizeFloat, ok := config["hop_size"].(float64); ok && hopSizeFloat > 0 {
+		vadConfig["hop_size"] = int(hopSizeFloat)
+	}
+	if threshold, ok := config["threshold"].(float64); ok && threshold > 0 {
+		vadConfig["threshold"] = threshold
+	}
+
+	var poolSize int
+	if size, ok := config["pool_size"].(int); ok {
+		poolSize = size
+	} else if sizeFloat, ok := config["pool_size"].(float64); ok {
+		poolSize = int(sizeFloat)
+	}
+	var timeout int64
+	if t, ok := config["acquire_timeout_ms"].(int); ok {
+		timeout = int64(t)
+	} else if tFloat, ok := config["acquire_timeout_ms"].(float64); ok {
+		timeout = int64(tFloat)
+	}
+	return globalVADResourcePool.Reload(vadConfig, poolSize, timeout)
+}
+
 // AcquireVAD 获取一个VAD实例
 func AcquireVAD(config map[string]interface{}) (VAD, error) {
 	if globalVADResourcePool == nil || !globalVADResourcePool.initialized {
@@ -170,6 +214,18 @@ func ReleaseVAD(vad VAD) error {
 	return nil
 }
 
+// GetPoolStats 获取资源池统计信息，字段与 util.ResourcePool.Stats 保持一致
+func GetPoolStats() map[string]interface{} {
+	if globalVADResourcePool == nil || !globalVADResourcePool.initialized {
+		return nil
+	}
+	return map[string]interface{}{
+		"in_use_resources":    globalVADResourcePool.GetActiveCount(),
+		"available_resources": globalVADResourcePool.GetAvailableCount(),
+		"max_size":            globalVADResourcePool.maxSize,
+	}
+}
+
 // AcquireVAD 从资源池获取一个VAD实例
 func (p *VADResourcePool) AcquireVAD() (VAD, error) {
 	if !p.initialized {
@@ -212,6 +268,22 @@ func (p *VADResourcePool) ReleaseVAD(vad VAD) {
 		// 从已分配映射中删除
 		p.allocatedVADs.Delete(vad)
 
+		// 配置热更新前分配的实例，按新配置重建，重建失败时保留旧实例，避免资源池缩小
+		if _, stale := p.staleVADs.LoadAndDelete(vad); stale {
+			p.mu.Lock()
+			vadConfig := p.defaultConfig
+			p.mu.Unlock()
+			if newVAD, err := CreateVAD(vadConfig); err != nil {
+				log.Errorf("按新配置重建TEN-VAD实例失败, 继续使用旧实例: %v", err)
+				vad.Reset()
+			} else {
+				if tenVAD, ok := vad.(*TenVAD); ok {
+					tenVAD.Close()
+				}
+				vad = newVAD
+			}
+		}
+
 		// 如果资源池已关闭，直接销毁实例
 		if p.availableVADs == nil {
 			if tenVAD, ok := vad.(*TenVAD); ok {
@@ -254,6 +326,82 @@ func (p *VADResourcePool) GetAvailableCount() int {
 	return len(p.availableVADs)
 }
 
+// Reload 热更新配置，检测参数变化时替换空闲实例，正在使用的实例归还时再替换
+func (p *VADResourcePool) Reload(vadConfig map[string]interface{}, poolSize int, acquireTimeout int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if acquireTimeout > 0 {
+		p.acquireTimeout = acquireTimeout
+	}
+
+	if !reflect.DeepEqual(vadConfig, p.defaultConfig) {
+		// 先按新配置创建一个实例，失败时继续使用旧配置
+		probe, err := CreateVAD(vadConfig)
+		if err != nil {
+			return fmt.Errorf("按新配置创建TEN-VAD实例失败: %v", err)
+		}
+		probe.Close()
+
+		p.defaultConfig = vadConfig
+		p.allocatedVADs.Range(func(key, _ interface{}) bool {
+			p.staleVADs.Store(key, struct{}{})
+			return true
+		})
+
+		// 空闲实例直接替换，扩缩容在下面统一处理
+		for count := len(p.availableVADs); count > 0; count-- {
+			var vad VAD
+			select {
+			case vad = <-p.availableVADs:
+			default:
+			}
+			if vad == nil {
+				break
+			}
+			if newVAD, err := CreateVAD(vadConfig); err != nil {
+				// 放回旧实例，下次归还时再重建
+				log.Errorf("按新配置重建TEN-VAD实例失败, 继续使用旧实例: %v", err)
+				p.staleVADs.Store(vad, struct{}{})
+				p.availableVADs <- vad
+			} else {
+				vad.Close()
+				p.availableVADs <- newVAD
+			}
+		}
+		log.Infof("TEN-VAD检测参数已更新: %v", vadConfig)
+	}
+
+	if poolSize <= 0 || poolSize == p.maxSize {
+		return nil
+	}
+
+	// 可用队列容量固定，扩缩容时换一个新队列
+	oldSize := p.maxSize
+	availableVADs := make(chan VAD, poolSize)
+	for len(p.availableVADs) > 0 {
+		vad := <-p.availableVADs
+		select {
+		case availableVADs <- vad:
+		default:
+			vad.Close()
+		}
+	}
+	inUse := p.GetActiveCount()
+	for i := len(availableVADs) + inUse; i < poolSize; i++ {
+		vad, err := CreateVAD(p.defaultConfig)
+		if err != nil {
+			log.Errorf("创建TEN-VAD实例失败: %v", err)
+			break
+		}
+		availableVADs <- vad
+	}
+	p.availableVADs = availableVADs
+	p.maxSize = poolSize
+	log.Infof("TEN-VAD资源池大小已调整：%d -> %d", oldSize, poolSize)
+	return nil
+}
+
 // Close 关闭资源池，释放所有资源
 func (p *VADResourcePool) Close() {
 	p.mu.Lock()
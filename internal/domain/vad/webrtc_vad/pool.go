@@ -60,6 +60,11 @@ func (p *WebRTCVADPool) ReleaseVAD(vad inter.VAD) error {
 	return p.pool.Release(webrtcVAD)
 }
 
+// Resize 调整资源池最大容量
+func (p *WebRTCVADPool) Resize(maxSize int) error {
+	return p.pool.Resize(maxSize)
+}
+
 // Close 关闭资源池
 func (p *WebRTCVADPool) Close() error {
 	return p.pool.Close()
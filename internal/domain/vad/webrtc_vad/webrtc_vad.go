@@ -60,6 +60,23 @@ func ReleaseVAD(vad inter.VAD) error {
 	return nil
 }
 
+// ReloadPool 配置热更新后调整资源池容量，资源池尚未创建时首次使用会读取新配置
+func ReloadPool(config map[string]interface{}) error {
+	if vadPool == nil {
+		return nil
+	}
+	poolConfig := getPoolConfigFromMap(config)
+	return vadPool.Resize(poolConfig.MaxSize)
+}
+
+// GetPoolStats 获取资源池统计信息，资源池尚未创建时返回 nil
+func GetPoolStats() map[string]interface{} {
+	if vadPool == nil {
+		return nil
+	}
+	return vadPool.Stats()
+}
+
 // NewWebRTCVAD 创建新的 WebRTC VAD 实例
 func NewWebRTCVAD() inter.VAD {
 	return &WebRTCVAD{
@@ -391,6 +391,11 @@ func (d *AudioDecoder) RunMp3Decoder(startTs int64) error {
 			}
 
 			if !ok {
+				// 输入中途出错(如上游连接断开)时返回错误，调用方据此判断音频是否完整
+				streamErr := d.streamer.Err()
+				if streamErr != nil {
+					log.Warnf("MP3流读取失败: %v", streamErr)
+				}
 				log.Debugf("MP3流读取结束，处理剩余数据")
 				// 处理剩余不足一帧的数据
 				if currentFramePos > 0 {
@@ -439,6 +444,9 @@ func (d *AudioDecoder) RunMp3Decoder(startTs int64) error {
 						}
 					}
 				}
+				if streamErr != nil {
+					return fmt.Errorf("读取MP3数据失败: %v", streamErr)
+				}
 				return nil
 			}
 
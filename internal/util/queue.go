@@ -105,6 +105,13 @@ func (q *Queue[T]) Pop(ctx context.Context, timeout time.Duration) (T, error) {
 	}
 }
 
+// Len returns the number of items currently in the queue.
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.ch)
+}
+
 // Clear empties the queue and ensures all Pop calls return immediately.
 func (q *Queue[T]) Clear() {
 	q.mu.Lock()
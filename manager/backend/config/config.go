@@ -14,6 +14,7 @@ type Config struct {
 	SpeakerService SpeakerServiceConfig `json:"speaker_service"`
 	Storage        StorageConfig        `json:"storage"`
 	History        HistoryConfig        `json:"history"`
+	Knowledge      KnowledgeConfig      `json:"knowledge"`
 }
 
 type ServerConfig struct {
@@ -49,6 +50,22 @@ type HistoryConfig struct {
 	MaxFileSize   int64  `json:"max_file_size"`   // 最大文件大小(字节)，默认10MB
 }
 
+type KnowledgeConfig struct {
+	Embedding    EmbeddingConfig `json:"embedding"`     // OpenAI 兼容的 /v1/embeddings 接口
+	ChunkSize    int             `json:"chunk_size"`    // 每个分块的最大字数，默认500
+	ChunkOverlap int             `json:"chunk_overlap"` // 相邻分块重叠的字数，默认50
+	TopK         int             `json:"top_k"`         // 检索返回的分块数，默认3
+	Threshold    float64         `json:"threshold"`     // 相似度阈值，低于该值的分块不返回
+	MaxFileSize  int64           `json:"max_file_size"` // 最大文件大小(字节)，默认5MB
+}
+
+type EmbeddingConfig struct {
+	BaseURL    string `json:"base_url"` // 接口地址(包含 /v1)
+	APIKey     string `json:"api_key"`
+	ModelName  string `json:"model_name"`
+	Dimensions int    `json:"dimensions"` // 向量维度，0 表示使用模型默认值
+}
+
 func Load() *Config {
 	return LoadWithPath("config/config.json")
 }
@@ -82,6 +99,14 @@ func LoadWithPath(configPath string) *Config {
 		config.History.AudioBasePath = audioBasePath
 	}
 
+	// 优先使用环境变量覆盖知识库向量模型配置
+	if baseURL := os.Getenv("EMBEDDING_BASE_URL"); baseURL != "" {
+		config.Knowledge.Embedding.BaseURL = baseURL
+	}
+	if apiKey := os.Getenv("EMBEDDING_API_KEY"); apiKey != "" {
+		config.Knowledge.Embedding.APIKey = apiKey
+	}
+
 	fmt.Println("config", config)
 
 	return config
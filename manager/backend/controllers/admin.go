@@ -66,6 +66,9 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		VoiceIdentify map[string]SpeakerGroupInfo `json:"voice_identify"`
 		Prompt        string                      `json:"prompt"`
 		AgentID       string                      `json:"agent_id"`
+		UserID        string                      `json:"user_id"`
+		Context       map[string]interface{}      `json:"context,omitempty"`
+		Knowledge     bool                        `json:"knowledge"` // 智能体是否有可检索的知识库文档
 	}
 
 	var response ConfigResponse
@@ -89,6 +92,7 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		// 设备存在，查找智能体
 		deviceFound = true
 		response.AgentID = fmt.Sprintf("%d", device.AgentID)
+		response.UserID = fmt.Sprintf("%d", device.UserID)
 		log.Printf("设备 %s 存在，AgentID: %d", deviceID, device.AgentID)
 		if err := ac.DB.First(&agent, device.AgentID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
@@ -103,6 +107,16 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 			response.Prompt = agent.CustomPrompt
 			// 将{{assistant_name}}替换为智能体昵称
 			response.Prompt = strings.ReplaceAll(response.Prompt, "{{assistant_name}}", agent.Name)
+			// 智能体的上下文窗口配置
+			if agent.ContextConfig != "" {
+				if err := json.Unmarshal([]byte(agent.ContextConfig), &response.Context); err != nil {
+					log.Printf("智能体 %d 的上下文窗口配置解析失败: %v", agent.ID, err)
+				}
+			}
+			// 智能体是否有已向量化的知识库文档
+			var knowledgeCount int64
+			ac.DB.Model(&models.KnowledgeDocument{}).Where("agent_id = ? AND status = ?", agent.ID, "ready").Count(&knowledgeCount)
+			response.Knowledge = knowledgeCount > 0
 		}
 	}
 
@@ -1176,7 +1190,13 @@ func (ac *AdminController) UpdateAgent(c *gin.Context) {
 
 func (ac *AdminController) DeleteAgent(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := ac.DB.Delete(&models.Agent{}, id).Error; err != nil {
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteAgentKnowledge(tx, uint(id)); err != nil {
+			return err
+		}
+		return tx.Delete(&models.Agent{}, id).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除智能体失败"})
 		return
 	}
@@ -2540,8 +2560,8 @@ func (ac *AdminController) CreateMemoryConfig(c *gin.Context) {
 	config.Type = "memory"
 
 	// 验证provider字段
-	if config.Provider != "memobase" && config.Provider != "mem0" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider必须是memobase或mem0"})
+	if config.Provider != "memobase" && config.Provider != "mem0" && config.Provider != "llm" && config.Provider != "vector" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider必须是memobase、mem0、llm或vector"})
 		return
 	}
 
@@ -2586,8 +2606,8 @@ func (ac *AdminController) UpdateMemoryConfig(c *gin.Context) {
 	}
 
 	// 验证provider字段
-	if updateData.Provider != "memobase" && updateData.Provider != "mem0" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider必须是memobase或mem0"})
+	if updateData.Provider != "memobase" && updateData.Provider != "mem0" && updateData.Provider != "llm" && updateData.Provider != "vector" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider必须是memobase、mem0、llm或vector"})
 		return
 	}
 
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"time"
 	"xiaozhi/manager/backend/models"
@@ -379,6 +380,135 @@ func (c *ChatHistoryController) ExportMessages(ctx *gin.Context) {
 	})
 }
 
+// UsageReportItem 智能体每天的token用量
+type UsageReportItem struct {
+	Date             string `json:"date"`
+	AgentID          string `json:"agent_id"`
+	AgentName        string `json:"agent_name"`
+	Rounds           int    `json:"rounds"` // LLM请求次数（包括工具调用后的请求）
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+}
+
+// GetUsageReport 管理员按智能体、按天统计token用量（来自助手消息metadata中的usage）
+func (c *ChatHistoryController) GetUsageReport(ctx *gin.Context) {
+	agentID := ctx.Query("agent_id")
+	// 默认统计最近7天
+	now := time.Now()
+	endTime := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+	startTime := endTime.AddDate(0, 0, -7)
+	if startDate := ctx.Query("start_date"); startDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", startDate, time.Local)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "start_date 格式错误，应为 YYYY-MM-DD"})
+			return
+		}
+		startTime = t
+	}
+	if endDate := ctx.Query("end_date"); endDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", endDate, time.Local)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "end_date 格式错误，应为 YYYY-MM-DD"})
+			return
+		}
+		// 结束日期包含整天
+		endTime = t.Add(24 * time.Hour)
+	}
+
+	query := c.DB.Model(&models.ChatMessage{}).
+		Select("id", "agent_id", "metadata", "created_at").
+		Where("role = ? AND created_at >= ? AND created_at < ?", "assistant", startTime, endTime).
+		Where("metadata LIKE ?", "%\"usage\"%")
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+
+	items := make(map[string]*UsageReportItem)
+	var messages []models.ChatMessage
+	err := query.FindInBatches(&messages, 500, func(tx *gorm.DB, batch int) error {
+		for _, msg := range messages {
+			usage, ok := msg.Metadata["usage"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			date := msg.CreatedAt.In(time.Local).Format("2006-01-02")
+			key := date + "|" + msg.AgentID
+			item, exists := items[key]
+			if !exists {
+				item = &UsageReportItem{Date: date, AgentID: msg.AgentID}
+				items[key] = item
+			}
+			item.Rounds++
+			item.PromptTokens += usageValue(usage["prompt_tokens"])
+			item.CompletionTokens += usageValue(usage["completion_tokens"])
+			item.TotalTokens += usageValue(usage["total_tokens"])
+		}
+		return nil
+	}).Error
+	if err != nil {
+		log.Printf("[GetUsageReport] 查询失败: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	// 补充智能体名称
+	agentIDs := make([]string, 0)
+	for _, item := range items {
+		agentIDs = append(agentIDs, item.AgentID)
+	}
+	agentNames := make(map[string]string)
+	if len(agentIDs) > 0 {
+		var agents []models.Agent
+		c.DB.Select("id", "name").Where("id IN ?", agentIDs).Find(&agents)
+		for _, agent := range agents {
+			agentNames[strconv.FormatUint(uint64(agent.ID), 10)] = agent.Name
+		}
+	}
+
+	report := make([]UsageReportItem, 0, len(items))
+	var total UsageReportItem
+	for _, item := range items {
+		item.AgentName = agentNames[item.AgentID]
+		report = append(report, *item)
+		total.Rounds += item.Rounds
+		total.PromptTokens += item.PromptTokens
+		total.CompletionTokens += item.CompletionTokens
+		total.TotalTokens += item.TotalTokens
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Date != report[j].Date {
+			return report[i].Date < report[j].Date
+		}
+		return report[i].AgentID < report[j].AgentID
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"start_date": startTime.Format("2006-01-02"),
+		"end_date":   endTime.Add(-24 * time.Hour).Format("2006-01-02"),
+		"total": gin.H{
+			"rounds":            total.Rounds,
+			"prompt_tokens":     total.PromptTokens,
+			"completion_tokens": total.CompletionTokens,
+			"total_tokens":      total.TotalTokens,
+		},
+		"data": report,
+	})
+}
+
+// usageValue metadata反序列化后数字为float64
+func usageValue(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case int:
+		return int64(n)
+	case int64:
+		return n
+	}
+	return 0
+}
+
 // saveAudioFile 保存音频文件到文件系统（两级hash打散）
 func (c *ChatHistoryController) saveAudioFile(messageID, audioDataBase64 string) (string, error) {
 	// 解码base64音频数据
@@ -0,0 +1,428 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// KnowledgeController 知识库控制器
+// 每个智能体可以上传若干文档，文档按段落分块并向量化后保存在数据库中，对话时由主程序按语义检索
+type KnowledgeController struct {
+	DB       *gorm.DB
+	Config   config.KnowledgeConfig
+	Embedder *KnowledgeEmbedder
+}
+
+// NewKnowledgeController 创建知识库控制器
+func NewKnowledgeController(db *gorm.DB, cfg *config.Config) *KnowledgeController {
+	knowledgeConfig := cfg.Knowledge
+	if knowledgeConfig.ChunkSize <= 0 {
+		knowledgeConfig.ChunkSize = 500
+	}
+	if knowledgeConfig.ChunkOverlap < 0 || knowledgeConfig.ChunkOverlap >= knowledgeConfig.ChunkSize {
+		knowledgeConfig.ChunkOverlap = 0
+	}
+	if knowledgeConfig.TopK <= 0 {
+		knowledgeConfig.TopK = 3
+	}
+	if knowledgeConfig.MaxFileSize <= 0 {
+		knowledgeConfig.MaxFileSize = 5 * 1024 * 1024 // 默认5MB
+	}
+
+	return &KnowledgeController{
+		DB:       db,
+		Config:   knowledgeConfig,
+		Embedder: NewKnowledgeEmbedder(knowledgeConfig.Embedding),
+	}
+}
+
+// 每次检索最多返回的分块数
+const knowledgeMaxTopK = 20
+
+// 支持上传的文档类型
+var knowledgeFileExts = map[string]bool{
+	".txt":      true,
+	".md":       true,
+	".markdown": true,
+	".pdf":      true,
+}
+
+// GetDocuments 获取智能体的知识库文档列表
+func (kc *KnowledgeController) GetDocuments(c *gin.Context) {
+	agent, ok := kc.getUserAgent(c)
+	if !ok {
+		return
+	}
+
+	var documents []models.KnowledgeDocument
+	if err := kc.DB.Where("agent_id = ?", agent.ID).Order("created_at DESC").Find(&documents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询知识库文档失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": documents})
+}
+
+// UploadDocument 上传知识库文档
+// 支持 multipart 上传 txt/markdown/pdf 文件(字段名 file)，或 JSON 提交 {"name": "...", "content": "..."}
+// PDF 在上传时提取文本层，扫描件没有文本层，需要先 OCR 成文本后再上传或通过 JSON 提交
+func (kc *KnowledgeController) UploadDocument(c *gin.Context) {
+	agent, ok := kc.getUserAgent(c)
+	if !ok {
+		return
+	}
+
+	var name, content string
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+			return
+		}
+		defer file.Close()
+
+		ext := strings.ToLower(filepath.Ext(header.Filename))
+		if !knowledgeFileExts[ext] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "只支持 txt、markdown 和 pdf 文件"})
+			return
+		}
+		if header.Size > kc.Config.MaxFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小超过限制"})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, kc.Config.MaxFileSize+1))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败: " + err.Error()})
+			return
+		}
+		if int64(len(data)) > kc.Config.MaxFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小超过限制"})
+			return
+		}
+		name = header.Filename
+		if formName := strings.TrimSpace(c.PostForm("name")); formName != "" {
+			name = formName
+		}
+		content = string(data)
+		if ext == ".pdf" {
+			if content, err = extractPDFText(data); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "解析PDF失败: " + err.Error()})
+				return
+			}
+			if strings.TrimSpace(content) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "PDF中没有可提取的文本，扫描件请先OCR成文本后上传"})
+				return
+			}
+		}
+	} else {
+		var req struct {
+			Name    string `json:"name" binding:"required,max=255"`
+			Content string `json:"content" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+			return
+		}
+		if int64(len(req.Content)) > kc.Config.MaxFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "文档大小超过限制"})
+			return
+		}
+		name = req.Name
+		content = req.Content
+	}
+
+	if !utf8.ValidString(content) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文档必须是 UTF-8 编码的文本"})
+		return
+	}
+	content = strings.TrimSpace(strings.TrimPrefix(content, "\ufeff"))
+	if content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文档内容为空"})
+		return
+	}
+
+	document := models.KnowledgeDocument{
+		UserID:  agent.UserID,
+		AgentID: agent.ID,
+		Name:    name,
+		Content: content,
+		Size:    utf8.RuneCountInString(content),
+		Status:  "pending",
+	}
+	if err := kc.DB.Create(&document).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文档失败: " + err.Error()})
+		return
+	}
+
+	// 分块和向量化耗时较长，在后台完成，前端通过文档状态查看进度
+	// 进程在完成前退出时文档保持 pending，下次启动由 ResumePendingDocuments 重新处理
+	go kc.indexDocument(document)
+
+	c.JSON(http.StatusCreated, gin.H{"data": document})
+}
+
+// DeleteDocument 删除知识库文档及其分块
+func (kc *KnowledgeController) DeleteDocument(c *gin.Context) {
+	agent, ok := kc.getUserAgent(c)
+	if !ok {
+		return
+	}
+
+	var document models.KnowledgeDocument
+	if err := kc.DB.Where("id = ? AND agent_id = ?", c.Param("doc_id"), agent.ID).First(&document).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+		return
+	}
+
+	err := kc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", document.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&document).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除文档失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// deleteAgentKnowledge 删除智能体的全部知识库文档和分块，在删除智能体的事务中调用
+func deleteAgentKnowledge(tx *gorm.DB, agentID uint) error {
+	if err := tx.Where("agent_id = ?", agentID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("agent_id = ?", agentID).Delete(&models.KnowledgeDocument{}).Error
+}
+
+// SearchDocuments 在智能体的知识库中检索，用于验证知识库效果
+func (kc *KnowledgeController) SearchDocuments(c *gin.Context) {
+	agent, ok := kc.getUserAgent(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Query string `json:"query" binding:"required"`
+		TopK  int    `json:"top_k"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	results, err := kc.search(c.Request.Context(), agent.ID, req.Query, req.TopK)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检索知识库失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": results})
+}
+
+// InternalSearch 供主程序在对话中检索智能体的知识库（内部服务接口）
+// 与 /internal/history 一样要求 device_id 和 agent_id 匹配，只能检索设备当前所属智能体的知识库
+func (kc *KnowledgeController) InternalSearch(c *gin.Context) {
+	deviceID := c.Query("device_id")
+	agentID, err := strconv.ParseUint(c.Query("agent_id"), 10, 32)
+	if deviceID == "" || err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id 和 agent_id 不能为空"})
+		return
+	}
+	var device models.Device
+	if err := kc.DB.Where("device_name = ? AND agent_id = ?", deviceID, agentID).First(&device).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "设备不属于该智能体"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询设备失败"})
+		}
+		return
+	}
+	query := strings.TrimSpace(c.Query("query"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter is required"})
+		return
+	}
+	topK, _ := strconv.Atoi(c.Query("top_k"))
+
+	results, err := kc.search(c.Request.Context(), uint(agentID), query, topK)
+	if err != nil {
+		log.Printf("检索智能体 %d 的知识库失败: %v", agentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检索知识库失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"results": results}})
+}
+
+// getUserAgent 获取路径中属于当前用户的智能体，失败时已写入响应
+func (kc *KnowledgeController) getUserAgent(c *gin.Context) (models.Agent, bool) {
+	userID, _ := c.Get("user_id")
+
+	var agent models.Agent
+	if err := kc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&agent).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询智能体失败"})
+		}
+		return agent, false
+	}
+	return agent, true
+}
+
+// ResumePendingDocuments 重新处理上次退出时还未完成向量化的文档，启动时调用
+// 逐个处理，避免大量文档同时请求向量模型
+func (kc *KnowledgeController) ResumePendingDocuments() {
+	// 数据库未初始化时(首次安装)没有文档
+	if kc.DB == nil {
+		return
+	}
+
+	var documents []models.KnowledgeDocument
+	if err := kc.DB.Where("status = ?", "pending").Order("id").Find(&documents).Error; err != nil {
+		log.Printf("查询待处理的知识库文档失败: %v", err)
+		return
+	}
+	if len(documents) == 0 {
+		return
+	}
+
+	log.Printf("重新处理 %d 个未完成向量化的知识库文档", len(documents))
+	go func() {
+		for _, document := range documents {
+			kc.indexDocument(document)
+		}
+	}()
+}
+
+// indexDocument 将文档分块并向量化，保存分块后更新文档状态
+func (kc *KnowledgeController) indexDocument(document models.KnowledgeDocument) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	startTs := time.Now()
+	chunks := splitKnowledgeChunks(document.Content, kc.Config.ChunkSize, kc.Config.ChunkOverlap)
+	vectors, err := kc.Embedder.Embed(ctx, chunks)
+	if err != nil {
+		log.Printf("知识库文档 %d 向量化失败: %v", document.ID, err)
+		kc.DB.Model(&models.KnowledgeDocument{}).Where("id = ?", document.ID).Updates(map[string]interface{}{
+			"status": "failed",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	records := make([]models.KnowledgeChunk, 0, len(chunks))
+	for i, chunk := range chunks {
+		records = append(records, models.KnowledgeChunk{
+			DocumentID: document.ID,
+			AgentID:    document.AgentID,
+			Seq:        i,
+			Content:    chunk,
+			Embedding:  encodeKnowledgeVector(vectors[i]),
+		})
+	}
+
+	err = kc.DB.Transaction(func(tx *gorm.DB) error {
+		// 向量化期间文档可能已被删除
+		if err := tx.First(&models.KnowledgeDocument{}, document.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", document.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			if err := tx.CreateInBatches(records, 100).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.KnowledgeDocument{}).Where("id = ?", document.ID).Updates(map[string]interface{}{
+			"status":      "ready",
+			"chunk_count": len(records),
+			"error":       "",
+		}).Error
+	})
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			log.Printf("保存知识库文档 %d 的分块失败: %v", document.ID, err)
+			kc.DB.Model(&models.KnowledgeDocument{}).Where("id = ?", document.ID).Updates(map[string]interface{}{
+				"status": "failed",
+				"error":  err.Error(),
+			})
+		}
+		return
+	}
+
+	log.Printf("知识库文档 %d 向量化完成，分块数: %d，耗时: %v", document.ID, len(records), time.Since(startTs))
+}
+
+// KnowledgeResult 知识库检索结果
+type KnowledgeResult struct {
+	DocumentID   uint    `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	Content      string  `json:"content"`
+	Score        float64 `json:"score"`
+}
+
+// search 按余弦相似度检索智能体知识库中与 query 最相关的 topK 个分块，topK 不大于 0 时使用配置
+func (kc *KnowledgeController) search(ctx context.Context, agentID uint, query string, topK int) ([]KnowledgeResult, error) {
+	if topK <= 0 {
+		topK = kc.Config.TopK
+	}
+	if topK > knowledgeMaxTopK {
+		topK = knowledgeMaxTopK
+	}
+
+	var chunks []models.KnowledgeChunk
+	if err := kc.DB.Where("agent_id = ?", agentID).Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return []KnowledgeResult{}, nil
+	}
+
+	vectors, err := kc.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	ranked := rankKnowledgeChunks(vectors[0], chunks, topK, kc.Config.Threshold)
+
+	documentIDs := make([]uint, 0, len(ranked))
+	for _, item := range ranked {
+		documentIDs = append(documentIDs, item.chunk.DocumentID)
+	}
+	documentNames := make(map[uint]string)
+	if len(documentIDs) > 0 {
+		var documents []models.KnowledgeDocument
+		kc.DB.Select("id", "name").Where("id IN ?", documentIDs).Find(&documents)
+		for _, document := range documents {
+			documentNames[document.ID] = document.Name
+		}
+	}
+
+	results := make([]KnowledgeResult, 0, len(ranked))
+	for _, item := range ranked {
+		results = append(results, KnowledgeResult{
+			DocumentID:   item.chunk.DocumentID,
+			DocumentName: documentNames[item.chunk.DocumentID],
+			Content:      item.chunk.Content,
+			Score:        item.score,
+		})
+	}
+	return results, nil
+}
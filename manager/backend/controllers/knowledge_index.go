@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// 每次请求向量模型的最大分块数
+const knowledgeEmbedBatchSize = 16
+
+// KnowledgeEmbedder 调用 OpenAI 兼容的 /v1/embeddings 接口计算向量
+// 本地部署可以使用 Ollama、text-embeddings-inference 等提供此接口的服务
+type KnowledgeEmbedder struct {
+	Config     config.EmbeddingConfig
+	HTTPClient *http.Client
+}
+
+// NewKnowledgeEmbedder 创建向量模型客户端
+func NewKnowledgeEmbedder(cfg config.EmbeddingConfig) *KnowledgeEmbedder {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &KnowledgeEmbedder{
+		Config:     cfg,
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Embed 批量计算文本的向量，返回顺序与输入一致
+func (e *KnowledgeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.Config.BaseURL == "" || e.Config.ModelName == "" {
+		return nil, fmt.Errorf("未配置知识库向量模型(knowledge.embedding)")
+	}
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += knowledgeEmbedBatchSize {
+		end := start + knowledgeEmbedBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *KnowledgeEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(struct {
+		Model      string   `json:"model"`
+		Input      []string `json:"input"`
+		Dimensions int      `json:"dimensions,omitempty"`
+	}{Model: e.Config.ModelName, Input: texts, Dimensions: e.Config.Dimensions})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Config.BaseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.Config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.Config.APIKey)
+	}
+
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求向量模型失败: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取向量模型响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("向量模型返回错误, status: %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析向量模型响应失败: %v", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("向量数量与输入不一致: %d != %d", len(result.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("向量下标越界: %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// extractPDFText 提取 PDF 中的文本，页与页之间按段落分隔
+// 扫描件等没有文本层的 PDF 提取结果为空，需要先 OCR 后再上传
+func extractPDFText(data []byte) (text string, err error) {
+	// 解析库遇到损坏的文件会 panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("PDF 文件已损坏: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	fonts := make(map[string]*pdf.Font)
+	pages := make([]string, 0, reader.NumPage())
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		// 缓存字体，避免每页重复解析字符映射
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				font := page.Font(name)
+				fonts[name] = &font
+			}
+		}
+		pageText, err := page.GetPlainText(fonts)
+		if err != nil {
+			return "", fmt.Errorf("提取第 %d 页文本失败: %v", i, err)
+		}
+		if pageText = strings.TrimSpace(pageText); pageText != "" {
+			pages = append(pages, pageText)
+		}
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// splitKnowledgeChunks 按段落将文档切分为不超过 size 个字的分块，相邻分块重叠 overlap 个字
+// 超长段落按句子切分，超长句子按字数硬切
+func splitKnowledgeChunks(text string, size, overlap int) []string {
+	var pieces []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		pieces = append(pieces, splitLongParagraph(paragraph, size)...)
+	}
+
+	var chunks []string
+	var current []rune
+	for _, piece := range pieces {
+		runes := []rune(piece)
+		if len(current) > 0 && len(current)+1+len(runes) > size {
+			chunks = append(chunks, string(current))
+			current = nil
+			// 重叠部分放不下时不保留
+			if overlap > 0 && overlap+1+len(runes) <= size {
+				previous := []rune(chunks[len(chunks)-1])
+				current = append(current, previous[len(previous)-min(overlap, len(previous)):]...)
+			}
+		}
+		if len(current) > 0 {
+			current = append(current, '\n')
+		}
+		current = append(current, runes...)
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, string(current))
+	}
+	return chunks
+}
+
+// splitLongParagraph 将超过 size 个字的段落按句子切分
+func splitLongParagraph(paragraph string, size int) []string {
+	runes := []rune(paragraph)
+	if len(runes) <= size {
+		return []string{paragraph}
+	}
+
+	var parts []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, string(current))
+			current = nil
+		}
+	}
+	for _, sentence := range splitSentences(runes) {
+		if len(current)+len(sentence) > size {
+			flush()
+		}
+		for len(sentence) > size {
+			parts = append(parts, string(sentence[:size]))
+			sentence = sentence[size:]
+		}
+		current = append(current, sentence...)
+	}
+	flush()
+	return parts
+}
+
+// splitSentences 按句末标点和换行切分句子，标点保留在句尾
+func splitSentences(runes []rune) [][]rune {
+	var sentences [][]rune
+	start := 0
+	for i, r := range runes {
+		if strings.ContainsRune("。！？；!?;\n", r) {
+			sentences = append(sentences, runes[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(runes) {
+		sentences = append(sentences, runes[start:])
+	}
+	return sentences
+}
+
+type rankedKnowledgeChunk struct {
+	chunk models.KnowledgeChunk
+	score float64
+}
+
+// rankKnowledgeChunks 计算分块与 query 向量的余弦相似度，返回不低于 threshold 的 topK 个，按相似度从高到低
+func rankKnowledgeChunks(query []float32, chunks []models.KnowledgeChunk, topK int, threshold float64) []rankedKnowledgeChunk {
+	var ranked []rankedKnowledgeChunk
+	for _, chunk := range chunks {
+		vector, err := decodeKnowledgeVector(chunk.Embedding)
+		if err != nil {
+			continue
+		}
+		score := cosineSimilarity(query, vector)
+		if score < threshold {
+			continue
+		}
+		ranked = append(ranked, rankedKnowledgeChunk{chunk: chunk, score: score})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+	if topK > 0 && len(ranked) > topK {
+		ranked = ranked[:topK]
+	}
+	return ranked
+}
+
+// cosineSimilarity 余弦相似度，维度不一致时返回 0
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func encodeKnowledgeVector(vector []float32) string {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func decodeKnowledgeVector(s string) ([]float32, error) {
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("向量长度错误: %d", len(buf))
+	}
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector, nil
+}
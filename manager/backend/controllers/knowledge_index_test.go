@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitKnowledgeChunks(t *testing.T) {
+	text := "第一段。\r\n\r\n第二段。\n\n\n\n第三段内容比较长。"
+
+	// 放得下时相邻段落合并到同一个分块
+	chunks := splitKnowledgeChunks(text, 100, 0)
+	if want := []string{"第一段。\n第二段。\n第三段内容比较长。"}; !reflect.DeepEqual(chunks, want) {
+		t.Fatalf("段落合并错误: %q", chunks)
+	}
+
+	// 超过 size 时另起分块，空段落被忽略
+	chunks = splitKnowledgeChunks(text, 10, 0)
+	if want := []string{"第一段。\n第二段。", "第三段内容比较长。"}; !reflect.DeepEqual(chunks, want) {
+		t.Fatalf("分块错误: %q", chunks)
+	}
+
+	if chunks := splitKnowledgeChunks(" \n\n \n", 10, 0); len(chunks) != 0 {
+		t.Errorf("空文档不应产生分块: %q", chunks)
+	}
+}
+
+func TestSplitKnowledgeChunksOverlap(t *testing.T) {
+	// 新分块以上一个分块末尾的 overlap 个字开头
+	chunks := splitKnowledgeChunks("一二三四五\n\n六七八", 8, 2)
+	if want := []string{"一二三四五", "四五\n六七八"}; !reflect.DeepEqual(chunks, want) {
+		t.Fatalf("重叠错误: %q", chunks)
+	}
+
+	// 重叠部分加上新段落超过 size 时不保留重叠
+	chunks = splitKnowledgeChunks("一二三四五\n\n六七八九十甲", 8, 2)
+	if want := []string{"一二三四五", "六七八九十甲"}; !reflect.DeepEqual(chunks, want) {
+		t.Fatalf("放不下时不应保留重叠: %q", chunks)
+	}
+
+	// 任何分块都不超过 size
+	text := strings.Repeat("这是一句话。", 50) + "\n\n" + strings.Repeat("另一段落！", 30)
+	for _, chunk := range splitKnowledgeChunks(text, 40, 10) {
+		if n := utf8.RuneCountInString(chunk); n > 40 {
+			t.Errorf("分块超过限制: %d, %q", n, chunk)
+		}
+	}
+}
+
+func TestSplitLongParagraph(t *testing.T) {
+	if parts := splitLongParagraph("短段落。", 10); !reflect.DeepEqual(parts, []string{"短段落。"}) {
+		t.Fatalf("未超长的段落不应切分: %q", parts)
+	}
+
+	// 按句末标点切分，标点保留在句尾，能放下的句子合并
+	parts := splitLongParagraph("你好。今天天气不错！出去走走吧？好", 10)
+	if want := []string{"你好。今天天气不错！", "出去走走吧？好"}; !reflect.DeepEqual(parts, want) {
+		t.Fatalf("按句子切分错误: %q", parts)
+	}
+
+	// 超长句子按字数硬切
+	parts = splitLongParagraph("开头。"+strings.Repeat("长", 12)+"。", 5)
+	if want := []string{"开头。", "长长长长长", "长长长长长", "长长。"}; !reflect.DeepEqual(parts, want) {
+		t.Fatalf("超长句子切分错误: %q", parts)
+	}
+}
+
+// buildTestPDF 生成每页一行文本的最小 PDF
+func buildTestPDF(pages ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+	var kids []string
+	for _, text := range pages {
+		content := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", len(objects)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var buf strings.Builder
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return []byte(buf.String())
+}
+
+func TestExtractPDFText(t *testing.T) {
+	text, err := extractPDFText(buildTestPDF("Hello knowledge", "Second page"))
+	if err != nil {
+		t.Fatalf("提取PDF文本失败: %v", err)
+	}
+	// 每页作为一个段落，分块时按段落处理
+	paragraphs := strings.Split(text, "\n\n")
+	if len(paragraphs) != 2 || !strings.Contains(paragraphs[0], "Hello knowledge") || !strings.Contains(paragraphs[1], "Second page") {
+		t.Fatalf("PDF文本错误: %q", text)
+	}
+
+	if _, err := extractPDFText([]byte("%PDF-1.4\nnot a pdf")); err == nil {
+		t.Errorf("损坏的PDF应返回错误")
+	}
+}
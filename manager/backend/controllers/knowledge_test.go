@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestKnowledgeController(t *testing.T) *KnowledgeController {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Device{}, &models.Agent{}, &models.KnowledgeDocument{}, &models.KnowledgeChunk{}); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	// 所有文本的向量都相同，相似度均为 1
+	embedder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [{"index": 0, "embedding": [1, 0]}]}`))
+	}))
+	t.Cleanup(embedder.Close)
+
+	return NewKnowledgeController(db, &config.Config{Knowledge: config.KnowledgeConfig{
+		Embedding: config.EmbeddingConfig{BaseURL: embedder.URL, ModelName: "bge-m3"},
+	}})
+}
+
+func TestInternalSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kc := newTestKnowledgeController(t)
+	kc.DB.Create(&models.Device{UserID: 1, AgentID: 1, DeviceName: "aa:bb"})
+	kc.DB.Create(&models.KnowledgeDocument{UserID: 1, AgentID: 1, Name: "手册", Status: "ready"})
+	for i := 0; i < 30; i++ {
+		kc.DB.Create(&models.KnowledgeChunk{DocumentID: 1, AgentID: 1, Seq: i, Content: fmt.Sprintf("分块%d", i), Embedding: encodeKnowledgeVector([]float32{1, 0})})
+	}
+
+	search := func(params url.Values) (int, []KnowledgeResult) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/internal/knowledge/search?"+params.Encode(), nil)
+		kc.InternalSearch(c)
+		var resp struct {
+			Data struct {
+				Results []KnowledgeResult `json:"results"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data.Results
+	}
+
+	// 缺少 device_id 或设备不属于该智能体时拒绝
+	if code, _ := search(url.Values{"agent_id": {"1"}, "query": {"你好"}}); code != http.StatusBadRequest {
+		t.Errorf("缺少 device_id 时状态码 %d", code)
+	}
+	if code, _ := search(url.Values{"device_id": {"aa:bb"}, "agent_id": {"2"}, "query": {"你好"}}); code != http.StatusNotFound {
+		t.Errorf("设备与智能体不匹配时状态码 %d", code)
+	}
+
+	// top_k 不超过上限
+	code, results := search(url.Values{"device_id": {"aa:bb"}, "agent_id": {"1"}, "query": {"你好"}, "top_k": {"1000"}})
+	if code != http.StatusOK || len(results) != knowledgeMaxTopK {
+		t.Errorf("检索结果错误: %d, %d 条", code, len(results))
+	}
+	if _, results := search(url.Values{"device_id": {"aa:bb"}, "agent_id": {"1"}, "query": {"你好"}}); len(results) != 3 {
+		t.Errorf("未指定 top_k 时应使用默认值: %d 条", len(results))
+	}
+}
+
+func TestDeleteAgentKnowledge(t *testing.T) {
+	kc := newTestKnowledgeController(t)
+	for agentID := uint(1); agentID <= 2; agentID++ {
+		document := models.KnowledgeDocument{UserID: 1, AgentID: agentID, Name: "手册"}
+		kc.DB.Create(&document)
+		kc.DB.Create(&models.KnowledgeChunk{DocumentID: document.ID, AgentID: agentID, Content: "内容"})
+	}
+
+	if err := kc.DB.Transaction(func(tx *gorm.DB) error { return deleteAgentKnowledge(tx, 1) }); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	var documents, chunks int64
+	kc.DB.Model(&models.KnowledgeDocument{}).Where("agent_id = ?", 1).Count(&documents)
+	kc.DB.Model(&models.KnowledgeChunk{}).Where("agent_id = ?", 1).Count(&chunks)
+	if documents != 0 || chunks != 0 {
+		t.Errorf("智能体的知识库未删除: %d 个文档, %d 个分块", documents, chunks)
+	}
+	kc.DB.Model(&models.KnowledgeChunk{}).Where("agent_id = ?", 2).Count(&chunks)
+	if chunks != 1 {
+		t.Errorf("不应删除其它智能体的知识库")
+	}
+}
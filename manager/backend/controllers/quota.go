@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 管理员查询配额用量，可按设备、智能体、用户任意组合查询
+func (ac *AdminController) GetQuotaUsage(c *gin.Context) {
+	deviceID := c.Query("device_id")
+	agentID := c.Query("agent_id")
+	userID := c.Query("user_id")
+	if deviceID == "" && agentID == "" && userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id、agent_id、user_id 至少需要一个"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	usage, err := ac.WebSocketController.RequestQuotaUsage(ctx, deviceID, agentID, userID)
+	if err != nil {
+		log.Printf("[GetQuotaUsage] 查询配额用量失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询配额用量失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": usage})
+}
+
+// 用户查询自己的配额用量，设备和智能体需属于当前用户
+func (uc *UserController) GetQuotaUsage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	deviceID := c.Query("device_id")
+	agentID := c.Query("agent_id")
+
+	if deviceID != "" {
+		var device models.Device
+		if err := uc.DB.Where("device_name = ? AND user_id = ?", deviceID, userID).First(&device).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "设备不存在或不属于当前用户"})
+			return
+		}
+	}
+	if agentID != "" {
+		var agent models.Agent
+		if err := uc.DB.Where("id = ? AND user_id = ?", agentID, userID).First(&agent).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "智能体不存在或不属于当前用户"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	usage, err := uc.WebSocketController.RequestQuotaUsage(ctx, deviceID, agentID, fmt.Sprintf("%v", userID))
+	if err != nil {
+		log.Printf("[GetQuotaUsage] 查询配额用量失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询配额用量失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": usage})
+}
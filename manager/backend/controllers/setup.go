@@ -93,6 +93,8 @@ func (sc *SetupController) InitializeDatabase(c *gin.Context) {
 		&models.GlobalRole{},
 		&models.SpeakerGroup{},
 		&models.SpeakerSample{},
+		&models.KnowledgeDocument{},
+		&models.KnowledgeChunk{},
 		&models.ChatMessage{},
 	)
 	if err != nil {
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
@@ -19,6 +20,7 @@ type UserController struct {
 	WebSocketController interface {
 		RequestMcpToolsFromClient(ctx context.Context, agentID string) ([]string, error)
 		InjectMessageToDevice(ctx context.Context, deviceID, message string, skipLlm bool) error
+		RequestQuotaUsage(ctx context.Context, deviceID, agentID, userID string) (map[string]interface{}, error)
 	}
 }
 
@@ -230,12 +232,13 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	var req struct {
-		Name         string  `json:"name" binding:"required,min=2,max=50"`
-		CustomPrompt string  `json:"custom_prompt"`
-		LLMConfigID  *string `json:"llm_config_id"`
-		TTSConfigID  *string `json:"tts_config_id"`
-		Voice        *string `json:"voice"`
-		ASRSpeed     string  `json:"asr_speed"`
+		Name          string  `json:"name" binding:"required,min=2,max=50"`
+		CustomPrompt  string  `json:"custom_prompt"`
+		LLMConfigID   *string `json:"llm_config_id"`
+		TTSConfigID   *string `json:"tts_config_id"`
+		Voice         *string `json:"voice"`
+		ASRSpeed      string  `json:"asr_speed"`
+		ContextConfig string  `json:"context_config"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -243,20 +246,26 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 		return
 	}
 
+	if !validContextConfig(req.ContextConfig) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "上下文窗口配置必须是JSON对象"})
+		return
+	}
+
 	// 设置默认值
 	if req.ASRSpeed == "" {
 		req.ASRSpeed = "normal"
 	}
 
 	agent := models.Agent{
-		UserID:       userID.(uint),
-		Name:         req.Name,
-		CustomPrompt: req.CustomPrompt,
-		LLMConfigID:  req.LLMConfigID,
-		TTSConfigID:  req.TTSConfigID,
-		Voice:        req.Voice,
-		ASRSpeed:     req.ASRSpeed,
-		Status:       "active",
+		UserID:        userID.(uint),
+		Name:          req.Name,
+		CustomPrompt:  req.CustomPrompt,
+		LLMConfigID:   req.LLMConfigID,
+		TTSConfigID:   req.TTSConfigID,
+		Voice:         req.Voice,
+		ASRSpeed:      req.ASRSpeed,
+		ContextConfig: req.ContextConfig,
+		Status:        "active",
 	}
 
 	if err := uc.DB.Create(&agent).Error; err != nil {
@@ -316,12 +325,13 @@ func (uc *UserController) UpdateAgent(c *gin.Context) {
 	}
 
 	var req struct {
-		Name         string  `json:"name" binding:"required,min=2,max=50"`
-		CustomPrompt string  `json:"custom_prompt"`
-		LLMConfigID  *string `json:"llm_config_id"`
-		TTSConfigID  *string `json:"tts_config_id"`
-		Voice        *string `json:"voice"`
-		ASRSpeed     string  `json:"asr_speed"`
+		Name          string  `json:"name" binding:"required,min=2,max=50"`
+		CustomPrompt  string  `json:"custom_prompt"`
+		LLMConfigID   *string `json:"llm_config_id"`
+		TTSConfigID   *string `json:"tts_config_id"`
+		Voice         *string `json:"voice"`
+		ASRSpeed      string  `json:"asr_speed"`
+		ContextConfig string  `json:"context_config"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -329,12 +339,18 @@ func (uc *UserController) UpdateAgent(c *gin.Context) {
 		return
 	}
 
+	if !validContextConfig(req.ContextConfig) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "上下文窗口配置必须是JSON对象"})
+		return
+	}
+
 	// 更新字段
 	agent.Name = req.Name
 	agent.CustomPrompt = req.CustomPrompt
 	agent.LLMConfigID = req.LLMConfigID
 	agent.TTSConfigID = req.TTSConfigID
 	agent.Voice = req.Voice
+	agent.ContextConfig = req.ContextConfig
 
 	if req.ASRSpeed != "" {
 		agent.ASRSpeed = req.ASRSpeed
@@ -360,7 +376,13 @@ func (uc *UserController) DeleteAgent(c *gin.Context) {
 		return
 	}
 
-	if err := uc.DB.Delete(&agent).Error; err != nil {
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteAgentKnowledge(tx, agent.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&agent).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除智能体失败"})
 		return
 	}
@@ -597,3 +619,12 @@ func (uc *UserController) GetDashboardStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+// validContextConfig 智能体的上下文窗口配置为空或JSON对象
+func validContextConfig(config string) bool {
+	if config == "" {
+		return true
+	}
+	var m map[string]interface{}
+	return json.Unmarshal([]byte(config), &m) == nil
+}
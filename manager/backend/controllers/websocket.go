@@ -718,6 +718,38 @@ func (ctrl *WebSocketController) RequestPingFromClient(ctx context.Context, uuid
 	return ctrl.SendRequestToClient(ctx, uuid, "GET", "/api/server/ping", nil)
 }
 
+// 请求配额用量，计数保存在共享的Redis中，任一已连接的客户端都可以处理
+func (ctrl *WebSocketController) RequestQuotaUsage(ctx context.Context, deviceID, agentID, userID string) (map[string]interface{}, error) {
+	body := map[string]interface{}{
+		"device_id": deviceID,
+		"agent_id":  agentID,
+		"user_id":   userID,
+	}
+
+	for item := range ctrl.clientsMap.IterBuffered() {
+		client := item.Val
+		if !client.isConnected {
+			continue
+		}
+		response, err := client.SendRequestWithResponse(ctx, "GET", "/api/quota/usage", body)
+		if err != nil {
+			log.Printf("向客户端 %s 请求配额用量失败: %v", client.ID, err)
+			continue
+		}
+		if response.Status != http.StatusOK {
+			return nil, fmt.Errorf("客户端返回错误状态: %d, %v", response.Status, response.Body)
+		}
+		result, _ := response.Body["result"].(string)
+		var usage map[string]interface{}
+		if err := json.Unmarshal([]byte(result), &usage); err != nil {
+			return nil, fmt.Errorf("解析配额用量失败: %v", err)
+		}
+		return usage, nil
+	}
+
+	return nil, fmt.Errorf("没有连接的客户端")
+}
+
 // InjectMessageToDevice 向设备注入消息（广播方式）
 func (ctrl *WebSocketController) InjectMessageToDevice(ctx context.Context, deviceID, message string, skipLlm bool) error {
 	body := map[string]interface{}{
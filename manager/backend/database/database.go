@@ -45,6 +45,8 @@ func Init(cfg config.DatabaseConfig) *gorm.DB {
 		&models.ChatMessage{},
 		&models.SpeakerGroup{},
 		&models.SpeakerSample{},
+		&models.KnowledgeDocument{},
+		&models.KnowledgeChunk{},
 	)
 	if err != nil {
 		log.Printf("数据库表结构迁移失败: %v", err)
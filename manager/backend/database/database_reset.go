@@ -31,6 +31,8 @@ func InitWithReset(cfg config.DatabaseConfig) *gorm.DB {
 		&models.GlobalRole{},
 		&models.SpeakerGroup{},
 		&models.SpeakerSample{},
+		&models.KnowledgeDocument{},
+		&models.KnowledgeChunk{},
 	)
 	if err != nil {
 		log.Printf("删除表时出现错误（可能表不存在）: %v", err)
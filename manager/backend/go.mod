@@ -8,6 +8,7 @@ require (
 	github.com/golang-jwt/jwt/v4 v4.5.0
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.0
+	github.com/ledongthuc/pdf v0.0.0-20240201131950-da5b75280b06
 	github.com/orcaman/concurrent-map/v2 v2.0.1
 	golang.org/x/crypto v0.9.0
 	gopkg.in/yaml.v3 v3.0.1
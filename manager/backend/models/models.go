@@ -35,17 +35,18 @@ type Device struct {
 
 // 智能体模型
 type Agent struct {
-	ID           uint      `json:"id" gorm:"primarykey"`
-	UserID       uint      `json:"user_id" gorm:"not null"`
-	Name         string    `json:"name" gorm:"type:varchar(100);not null"`             // 昵称
-	CustomPrompt string    `json:"custom_prompt" gorm:"type:text"`                     // 角色介绍(prompt)
-	LLMConfigID  *string   `json:"llm_config_id" gorm:"type:varchar(100)"`             // 语言模型配置ID
-	TTSConfigID  *string   `json:"tts_config_id" gorm:"type:varchar(100)"`             // 音色配置ID
-	Voice        *string   `json:"voice" gorm:"type:varchar(200)"`                     // 音色值
-	ASRSpeed     string    `json:"asr_speed" gorm:"type:varchar(20);default:'normal'"` // 语音识别速度: normal/patient/fast
-	Status       string    `json:"status" gorm:"type:varchar(20);default:'active'"`    // active, inactive
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            uint      `json:"id" gorm:"primarykey"`
+	UserID        uint      `json:"user_id" gorm:"not null"`
+	Name          string    `json:"name" gorm:"type:varchar(100);not null"`             // 昵称
+	CustomPrompt  string    `json:"custom_prompt" gorm:"type:text"`                     // 角色介绍(prompt)
+	LLMConfigID   *string   `json:"llm_config_id" gorm:"type:varchar(100)"`             // 语言模型配置ID
+	TTSConfigID   *string   `json:"tts_config_id" gorm:"type:varchar(100)"`             // 音色配置ID
+	Voice         *string   `json:"voice" gorm:"type:varchar(200)"`                     // 音色值
+	ASRSpeed      string    `json:"asr_speed" gorm:"type:varchar(20);default:'normal'"` // 语音识别速度: normal/patient/fast
+	ContextConfig string    `json:"context_config" gorm:"type:text"`                    // 上下文窗口配置(JSON): max_tokens, max_messages, enable_summary, summary_max_tokens
+	Status        string    `json:"status" gorm:"type:varchar(20);default:'active'"`    // active, inactive
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // 通用配置模型
@@ -104,6 +105,32 @@ type SpeakerSample struct {
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+// 知识库文档模型
+type KnowledgeDocument struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	AgentID    uint      `json:"agent_id" gorm:"not null;index"`
+	Name       string    `json:"name" gorm:"type:varchar(255);not null"`
+	Content    string    `json:"-" gorm:"type:longtext"`                           // 文档原文
+	Size       int       `json:"size"`                                             // 文档字数
+	ChunkCount int       `json:"chunk_count" gorm:"default:0"`                     // 分块数
+	Status     string    `json:"status" gorm:"type:varchar(20);default:'pending'"` // pending, ready, failed
+	Error      string    `json:"error" gorm:"type:text"`                           // 向量化失败原因
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// 知识库分块模型
+type KnowledgeChunk struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	DocumentID uint      `json:"document_id" gorm:"not null;index"`
+	AgentID    uint      `json:"agent_id" gorm:"not null;index"`
+	Seq        int       `json:"seq"` // 在文档中的序号
+	Content    string    `json:"content" gorm:"type:text;not null"`
+	Embedding  string    `json:"-" gorm:"type:text"` // float32 小端序向量的 base64 编码
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 // ChatMessage 聊天消息模型
 type ChatMessage struct {
 	ID        uint   `json:"id" gorm:"primarykey"`
@@ -28,6 +28,8 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	deviceActivationController := &controllers.DeviceActivationController{DB: db}
 	setupController := &controllers.SetupController{DB: db}
 	speakerGroupController := controllers.NewSpeakerGroupController(db, cfg)
+	knowledgeController := controllers.NewKnowledgeController(db, cfg)
+	knowledgeController.ResumePendingDocuments()
 
 	// 初始化聊天历史控制器（需要配置）
 	cfg = config.Load()
@@ -67,6 +69,7 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 		api.POST("/internal/history/messages", chatHistoryController.SaveMessage)                         // 保存消息（内部服务接口）
 		api.PUT("/internal/history/messages/:message_id/audio", chatHistoryController.UpdateMessageAudio) // 更新消息音频（内部服务接口）
 		api.GET("/internal/history/messages", chatHistoryController.GetMessagesForInit)                   // 获取消息（用于初始化加载，内部服务接口）
+		api.GET("/internal/knowledge/search", knowledgeController.InternalSearch)                         // 检索智能体知识库（内部服务接口）
 
 		// 需要认证的路由
 		auth := api.Group("")
@@ -105,9 +108,18 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				user.GET("/agents/:id/mcp-endpoint", userController.GetAgentMCPEndpoint)
 				user.GET("/agents/:id/mcp-tools", userController.GetAgentMcpTools)
 
+				// 知识库
+				user.GET("/agents/:id/knowledge", knowledgeController.GetDocuments)
+				user.POST("/agents/:id/knowledge", knowledgeController.UploadDocument)
+				user.DELETE("/agents/:id/knowledge/:doc_id", knowledgeController.DeleteDocument)
+				user.POST("/agents/:id/knowledge/search", knowledgeController.SearchDocuments)
+
 				// 消息注入
 				user.POST("/devices/inject-message", userController.InjectMessage)
 
+				// 配额用量
+				user.GET("/quota/usage", userController.GetQuotaUsage)
+
 				// 声纹组管理
 				user.POST("/speaker-groups", speakerGroupController.CreateSpeakerGroup)
 				user.GET("/speaker-groups", speakerGroupController.GetSpeakerGroups)
@@ -222,6 +234,12 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				admin.PUT("/devices/:id", adminController.UpdateDevice)
 				admin.DELETE("/devices/:id", adminController.DeleteDevice)
 
+				// 配额用量
+				admin.GET("/quota/usage", adminController.GetQuotaUsage)
+
+				// token用量统计
+				admin.GET("/usage/report", chatHistoryController.GetUsageReport)
+
 				// 智能体管理
 				admin.GET("/agents", adminController.GetAgents)
 				admin.POST("/agents", adminController.CreateAgent)
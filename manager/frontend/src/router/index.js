@@ -198,6 +198,12 @@ const routes = [
         name: 'AgentHistory',
         component: () => import('../views/user/AgentHistory.vue'),
         meta: { title: '聊天历史记录' }
+      },
+      {
+        path: '/user/agents/:id/knowledge',
+        name: 'AgentKnowledge',
+        component: () => import('../views/user/AgentKnowledge.vue'),
+        meta: { title: '知识库' }
       }
     ]
   }